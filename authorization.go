@@ -1,6 +1,8 @@
 package mercure
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
@@ -24,6 +26,9 @@ type claims struct {
 	// deprecated_claim tag in compatibility mode, the legacy mercure claim
 	// resolved into the same shape). Unexported, so it is never (un)marshaled.
 	authz *mercureAuthz
+
+	// tokenHash identifies the token, for the publishers without a subject.
+	tokenHash string
 }
 
 type role int
@@ -278,6 +283,9 @@ func (h *Hub) validateJWT(encodedToken string, publish bool, expectedAudience st
 
 	c.authz = authz
 
+	sum := sha256.Sum256([]byte(encodedToken))
+	c.tokenHash = hex.EncodeToString(sum[:])
+
 	// The legacy mercure claim is honored only when the token carries no
 	// authorization_details, and only in deprecated_claim builds running in
 	// compatibility mode (the stub is a no-op otherwise).
@@ -22,27 +22,40 @@ const BoltDefaultCleanupFrequency = 0.3
 
 const defaultBoltBucketName = "updates"
 
-// maxHistoryScan caps how many history events a single subscriber
-// reconnection can force the transport to walk before giving up on
-// finding the requested Last-Event-ID. The cap is a denial-of-service
-// guard: without it, an attacker sending an ancient or non-existent
-// Last-Event-ID forces an O(history-size) scan on every request.
-const maxHistoryScan = 10000
+// boltIndexBucketSuffix is appended to the bucket name to get the name of
+// the bucket mapping event IDs to the sequence of the matching update.
+const boltIndexBucketSuffix = "_ids"
 
 // BoltTransport implements the TransportInterface using the Bolt database.
 type BoltTransport struct {
 	sync.RWMutex
 
-	subscribers      *SubscriberList
-	logger           *slog.Logger
-	db               *bolt.DB
-	bucketName       string
-	size             uint64
-	cleanupFrequency float64
-	closed           chan struct{}
-	closedOnce       sync.Once
-	lastSeq          uint64
-	lastEventID      string
+	subscribers        *SubscriberList
+	logger             *slog.Logger
+	db                 *bolt.DB
+	bucketName         string
+	indexBucketName    string
+	size               uint64
+	cleanupFrequency   float64
+	maxAge             time.Duration
+	topicQuotas        []BoltTopicQuota
+	topicMatcherStore  *TopicMatcherStore
+	groupCommitDelay   time.Duration
+	groupCommitSize    int
+	dispatchShards     int
+	dispatcher         *shardedFanOut
+	lastValueCache     bool
+	compactions        []BoltCompaction
+	compactionInterval time.Duration
+	dedupWindow        time.Duration
+	commits            chan *boltCommit
+	closed             chan struct{}
+	closedOnce         sync.Once
+	sweeperDone        chan struct{}
+	committerDone      chan struct{}
+	compactorDone      chan struct{}
+	lastSeq            uint64
+	lastEventID        string
 }
 
 // NewBoltTransport creates a new BoltTransport.
@@ -53,6 +66,7 @@ func NewBoltTransport(
 	bucketName string,
 	size uint64,
 	cleanupFrequency float64,
+	options ...BoltOption,
 ) (*BoltTransport, error) {
 	if path == "" {
 		path = "bolt.db"
@@ -74,26 +88,125 @@ func NewBoltTransport(
 		return nil, &TransportError{err: err}
 	}
 
-	lastEventID, err := getDBLastEventID(db, bucketName)
+	indexBucketName := bucketName + boltIndexBucketSuffix
+
+	indexed, err := buildBoltIndex(db, bucketName, indexBucketName)
 	if err != nil {
+		_ = db.Close()
+
+		return nil, &TransportError{err: err}
+	}
+
+	if indexed > 0 && logger.Enabled(context.Background(), slog.LevelInfo) {
+		logger.LogAttrs(context.Background(), slog.LevelInfo, "Event ID index built from the existing history", slog.String("bucket", indexBucketName), slog.Int("updates", indexed))
+	}
+
+	lastEventID, lastSeq, err := getDBLastEventID(db, bucketName)
+	if err != nil {
+		_ = db.Close()
+
+		return nil, &TransportError{err: err}
+	}
+
+	t := &BoltTransport{
+		logger:            logger,
+		db:                db,
+		bucketName:        bucketName,
+		indexBucketName:   indexBucketName,
+		size:              size,
+		cleanupFrequency:  cleanupFrequency,
+		topicMatcherStore: &TopicMatcherStore{},
+		subscribers:       subscriberList,
+		closed:            make(chan struct{}),
+		commits:           make(chan *boltCommit),
+		sweeperDone:       make(chan struct{}),
+		committerDone:     make(chan struct{}),
+		compactorDone:     make(chan struct{}),
+		lastSeq:           lastSeq,
+		lastEventID:       lastEventID,
+	}
+
+	for _, o := range options {
+		if err := o(t); err != nil {
+			_ = db.Close()
+
+			return nil, &TransportError{err: err}
+		}
+	}
+
+	if err := t.initRetention(); err != nil {
+		_ = db.Close()
+
 		return nil, &TransportError{err: err}
 	}
 
-	return &BoltTransport{
-		logger:           logger,
-		db:               db,
-		bucketName:       bucketName,
-		size:             size,
-		cleanupFrequency: cleanupFrequency,
-		subscribers:      subscriberList,
-		closed:           make(chan struct{}),
-		lastEventID:      lastEventID,
-	}, nil
+	if err := t.initLastValues(); err != nil {
+		_ = db.Close()
+
+		return nil, &TransportError{err: err}
+	}
+
+	if err := t.initDeduplication(); err != nil {
+		_ = db.Close()
+
+		return nil, &TransportError{err: err}
+	}
+
+	t.dispatcher = newShardedFanOut(t.dispatchShards, t.closed)
+
+	go t.sweep()
+	go t.runCommitter()
+	go t.runCompactor()
+
+	return t, nil
 }
 
-func getDBLastEventID(db *bolt.DB, bucketName string) (string, error) {
+// buildBoltIndex migrates databases created before the event ID index
+// existed: if the updates bucket has no index bucket yet, it is created and
+// filled from the keys of the stored updates. It returns the number of
+// indexed updates.
+func buildBoltIndex(db *bolt.DB, bucketName, indexBucketName string) (int, error) {
+	var n int
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName))
+		if b == nil || tx.Bucket([]byte(indexBucketName)) != nil {
+			return nil
+		}
+
+		index, err := tx.CreateBucket([]byte(indexBucketName))
+		if err != nil {
+			return fmt.Errorf("error when creating Bolt DB bucket: %w", err)
+		}
+
+		return b.ForEach(func(k, _ []byte) error {
+			// Later updates with the same ID overwrite earlier ones, as in persist.
+			if len(k) <= 8 {
+				return nil
+			}
+
+			if err := index.Put(k[8:], k[:8]); err != nil {
+				return fmt.Errorf("unable to put value in Bolt DB: %w", err)
+			}
+
+			n++
+
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("unable to build the event ID index: %w", err)
+	}
+
+	return n, nil
+}
+
+// getDBLastEventID returns the ID and the sequence of the last stored update.
+func getDBLastEventID(db *bolt.DB, bucketName string) (string, uint64, error) {
 	lastEventID := EarliestLastEventID
 
+	var lastSeq uint64
+
 	err := db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucketName))
 		if b == nil {
@@ -102,22 +215,32 @@ func getDBLastEventID(db *bolt.DB, bucketName string) (string, error) {
 
 		if k, _ := b.Cursor().Last(); k != nil {
 			lastEventID = string(k[8:])
+			lastSeq = binary.BigEndian.Uint64(k[:8])
 		}
 
 		return nil
 	})
 	if err != nil {
-		return "", fmt.Errorf("unable to get last_event_id from BoltDB: %w", err)
+		return "", 0, fmt.Errorf("unable to get last_event_id from BoltDB: %w", err)
 	}
 
-	return lastEventID, nil
+	return lastEventID, lastSeq, nil
 }
 
 // Dispatch dispatches an update to all subscribers and persists it in Bolt DB.
 func (t *BoltTransport) Dispatch(ctx context.Context, update *Update) error {
+	_, err := t.dispatch(ctx, "", update)
+
+	return err
+}
+
+// dispatch persists and dispatches update, unless it is a replay of the
+// update stored with the same idempotency key. It reports whether the update
+// has been dispatched.
+func (t *BoltTransport) dispatch(ctx context.Context, key string, update *Update) (bool, error) {
 	select {
 	case <-t.closed:
-		return ErrClosedTransport
+		return false, ErrClosedTransport
 	default:
 	}
 
@@ -126,22 +249,61 @@ func (t *BoltTransport) Dispatch(ctx context.Context, update *Update) error {
 	// Marshal through the pointer so Update's custom MarshalJSON applies.
 	updateJSON, err := json.Marshal(update)
 	if err != nil {
-		return fmt.Errorf("error when marshaling update: %w", err)
+		return false, fmt.Errorf("error when marshaling update: %w", err)
+	}
+
+	if t.groupCommitSize > 0 {
+		return t.commit(ctx, key, update, updateJSON)
 	}
 
 	// We cannot use RLock() because Bolt allows only one read-write transaction at a time
 	t.Lock()
 	defer t.Unlock()
 
-	if err := t.persist(update.ID, updateJSON); err != nil {
-		return err
+	dispatched, err := t.persist(key, update, updateJSON)
+	if err != nil || !dispatched {
+		return false, err
 	}
 
-	for _, s := range t.subscribers.MatchAny(update) {
-		s.Dispatch(ctx, update, false)
+	t.fanOut(ctx, update)
+
+	return true, nil
+}
+
+// DispatchBatch persists the updates in a single transaction, then
+// dispatches them to the subscribers in order. Replays are detected as by
+// DispatchIdempotent. If one of the updates can't be persisted, none is.
+func (t *BoltTransport) DispatchBatch(ctx context.Context, keys []string, updates []*Update) ([]bool, error) {
+	select {
+	case <-t.closed:
+		return nil, ErrClosedTransport
+	default:
 	}
 
-	return nil
+	for _, update := range updates {
+		update.AssignUUID()
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	dispatched, err := t.persistBatchUpdates(keys, updates)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, update := range updates {
+		if dispatched[i] {
+			t.fanOut(ctx, update)
+		}
+	}
+
+	return dispatched, nil
+}
+
+// fanOut dispatches a stored update to the matching subscribers.
+func (t *BoltTransport) fanOut(ctx context.Context, update *Update) {
+	t.dispatcher.dispatch(ctx, update, t.subscribers.MatchAny(update))
 }
 
 // AddSubscriber adds a new subscriber to the transport.
@@ -157,10 +319,15 @@ func (t *BoltTransport) AddSubscriber(ctx context.Context, s *LocalSubscriber) e
 	toSeq := t.lastSeq
 	t.Unlock()
 
-	if s.RequestLastEventIDSet {
+	switch {
+	case s.RequestLastEventIDSet:
 		if err := t.dispatchHistory(ctx, s, toSeq); err != nil {
 			return err
 		}
+	case t.lastValueCache:
+		if err := t.dispatchLastValues(ctx, s, toSeq); err != nil {
+			return err
+		}
 	}
 
 	s.Ready(ctx)
@@ -184,6 +351,14 @@ func (t *BoltTransport) RemoveSubscriber(_ context.Context, s *LocalSubscriber)
 	return nil
 }
 
+// LastEventID returns the ID of the last dispatched update.
+func (t *BoltTransport) LastEventID(_ context.Context) string {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.lastEventID
+}
+
 // GetSubscribers get the list of active subscribers.
 func (t *BoltTransport) GetSubscribers(_ context.Context) (string, []*Subscriber, error) {
 	t.RLock()
@@ -196,6 +371,9 @@ func (t *BoltTransport) GetSubscribers(_ context.Context) (string, []*Subscriber
 func (t *BoltTransport) Close(_ context.Context) (err error) {
 	t.closedOnce.Do(func() {
 		close(t.closed)
+		<-t.sweeperDone
+		<-t.committerDone
+		<-t.compactorDone
 
 		t.Lock()
 		defer t.Unlock()
@@ -225,7 +403,7 @@ func pastSeqBound(k []byte, toSeq uint64) bool {
 	return binary.BigEndian.Uint64(k[:8]) > toSeq
 }
 
-//nolint:gocognit,funlen
+//nolint:funlen
 func (t *BoltTransport) dispatchHistory(ctx context.Context, s *LocalSubscriber, toSeq uint64) error {
 	ctx, span := startSpan(ctx, "mercure.transport.history",
 		trace.WithAttributes(
@@ -235,6 +413,11 @@ func (t *BoltTransport) dispatchHistory(ctx context.Context, s *LocalSubscriber,
 		))
 	defer span.End()
 
+	now := time.Now()
+
+	// Whether expired updates have been skipped, and must be purged.
+	var expired bool
+
 	err := t.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(t.bucketName))
 		if b == nil {
@@ -244,53 +427,44 @@ func (t *BoltTransport) dispatchHistory(ctx context.Context, s *LocalSubscriber,
 		}
 
 		c := b.Cursor()
-		responseLastEventID := EarliestLastEventID
-		afterFromID := s.RequestLastEventID == EarliestLastEventID
-		scanned := 0
 
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			// Keys written after the subscribe snapshot (concurrent Dispatch
-			// between subscriber registration and this read transaction)
-			// must not leak into the response header or be re-delivered
-			// alongside the live dispatch queue — check the bound first.
-			if pastSeqBound(k, toSeq) {
-				break
-			}
-
-			if !afterFromID {
-				// DoS guard: cap the search-for-requested-ID phase only.
-				// Once afterFromID is true the loop is dispatching legitimate
-				// authorized history and must not be truncated.
-				if scanned >= maxHistoryScan {
-					break
+		var k, v []byte
+		if s.RequestLastEventID == EarliestLastEventID {
+			k, v = c.First()
+		} else {
+			fromKey := t.seekID(tx, c, s.RequestLastEventID)
+
+			// A requested ID written after the subscribe snapshot is not part
+			// of the history window, it will be delivered live.
+			if fromKey == nil || pastSeqBound(fromKey, toSeq) {
+				// The requested id was never found, so nothing is replayed and
+				// there is no event preceding a first one sent. The protocol
+				// reserves "earliest" for this case — a requested event that
+				// does not exist or has been discarded — and reporting it tells
+				// the subscriber to re-fetch.
+				s.HistoryDispatched(EarliestLastEventID)
+
+				if t.logger.Enabled(ctx, slog.LevelInfo) {
+					t.logger.LogAttrs(ctx, slog.LevelInfo, "Can't find requested LastEventID")
 				}
 
-				scanned++
-
-				id := string(k[8:])
-				if id == s.RequestLastEventID {
-					afterFromID = true
-					// The subscriber already knows this id; echoing it
-					// is not a disclosure.
-					responseLastEventID = s.RequestLastEventID
-
-					continue
-				}
+				return nil
+			}
 
-				// Only disclose the id of an event the subscriber is
-				// authorized to read. We must deserialize to evaluate
-				// Match against the update's topics and Private flag.
-				var update *Update
-				if err := json.Unmarshal(v, &update); err != nil {
-					// Skip silently — do not disclose this id.
-					continue
-				}
+			// The cursor is positioned on the requested update.
+			k, v = c.Next()
+		}
 
-				if s.Match(update) {
-					responseLastEventID = id
-				}
+		// The subscriber already knows the requested id (or asked for the
+		// earliest event); echoing it is not a disclosure.
+		responseLastEventID := s.RequestLastEventID
 
-				continue
+		for ; k != nil; k, v = c.Next() {
+			// Keys written after the subscribe snapshot (concurrent Dispatch
+			// between subscriber registration and this read transaction)
+			// must not be re-delivered alongside the live dispatch queue.
+			if pastSeqBound(k, toSeq) {
+				break
 			}
 
 			var update *Update
@@ -306,6 +480,12 @@ func (t *BoltTransport) dispatchHistory(ctx context.Context, s *LocalSubscriber,
 				return err
 			}
 
+			if update.expired(now) {
+				expired = true
+
+				continue
+			}
+
 			if s.Match(update) && !s.Dispatch(ctx, update, true) {
 				s.HistoryDispatched(responseLastEventID)
 
@@ -313,25 +493,8 @@ func (t *BoltTransport) dispatchHistory(ctx context.Context, s *LocalSubscriber,
 			}
 		}
 
-		if !afterFromID {
-			// The requested id was never found, so nothing was replayed and
-			// there is no event preceding a first one sent. The protocol
-			// reserves "earliest" for this case — a requested event that does
-			// not exist or has been discarded — and reporting it tells the
-			// subscriber to re-fetch. Reporting the newest id seen while
-			// searching would instead claim it is caught up to an event it
-			// never received. This also covers giving up at maxHistoryScan.
-			responseLastEventID = EarliestLastEventID
-		}
-
-		// Unblock the subscriber before logging: it is parked on this channel
-		// and cannot send its response headers until the value arrives.
 		s.HistoryDispatched(responseLastEventID)
 
-		if !afterFromID && t.logger.Enabled(ctx, slog.LevelInfo) {
-			t.logger.LogAttrs(ctx, slog.LevelInfo, "Can't find requested LastEventID")
-		}
-
 		return nil
 	})
 	if err != nil {
@@ -341,44 +504,180 @@ func (t *BoltTransport) dispatchHistory(ctx context.Context, s *LocalSubscriber,
 		return err
 	}
 
+	if expired {
+		if err := t.purgeExpiredNow(); err != nil && t.logger.Enabled(ctx, slog.LevelError) {
+			t.logger.LogAttrs(ctx, slog.LevelError, "Unable to purge expired updates from the Bolt DB", slog.Any("error", err))
+		}
+	}
+
 	return nil
 }
 
-// persist stores update in the database.
-func (t *BoltTransport) persist(updateID string, updateJSON []byte) error {
+// seekID moves the cursor to the update with the given id using the event
+// ID index, and returns its key. It returns nil if this update isn't in the
+// history.
+func (t *BoltTransport) seekID(tx *bolt.Tx, c *bolt.Cursor, id string) []byte {
+	index := tx.Bucket([]byte(t.indexBucketName))
+	if index == nil {
+		return nil
+	}
+
+	prefix := index.Get([]byte(id))
+	if len(prefix) != 8 {
+		return nil
+	}
+
+	key := bytes.Join([][]byte{prefix, []byte(id)}, []byte{})
+	if k, _ := c.Seek(key); !bytes.Equal(k, key) {
+		return nil
+	}
+
+	return key
+}
+
+// persist stores update in the database, and reports whether it isn't a replay.
+func (t *BoltTransport) persist(key string, update *Update, updateJSON []byte) (bool, error) {
+	var (
+		seq        uint64
+		originalID string
+	)
+
+	if err := t.db.Update(func(tx *bolt.Tx) (err error) {
+		seq, originalID, err = t.store(tx, key, update, updateJSON)
+
+		return err
+	}); err != nil {
+		return false, fmt.Errorf("bolt error: %w", err)
+	}
+
+	if originalID != "" {
+		update.ID = originalID
+
+		return false, nil
+	}
+
+	t.lastSeq = seq
+	t.lastEventID = update.ID
+
+	return true, nil
+}
+
+// persistBatchUpdates stores the updates in a single transaction. The lock must be held.
+func (t *BoltTransport) persistBatchUpdates(keys []string, updates []*Update) ([]bool, error) {
+	var (
+		lastSeq     uint64
+		lastEventID string
+		// The ID of the original update of each replay, only applied once
+		// the transaction is committed.
+		originalIDs []string
+	)
+
 	if err := t.db.Update(func(tx *bolt.Tx) error {
-		bucket, err := tx.CreateBucketIfNotExists([]byte(t.bucketName))
-		if err != nil {
-			return fmt.Errorf("error when creating Bolt DB bucket: %w", err)
-		}
+		originalIDs = make([]string, len(updates))
 
-		seq, err := bucket.NextSequence()
-		if err != nil {
-			return fmt.Errorf("error when generating Bolt DB sequence: %w", err)
-		}
+		for i, update := range updates {
+			updateJSON, err := json.Marshal(update)
+			if err != nil {
+				return fmt.Errorf("error when marshaling update: %w", err)
+			}
 
-		prefix := make([]byte, 8)
-		binary.BigEndian.PutUint64(prefix, seq)
+			var key string
+			if keys != nil {
+				key = keys[i]
+			}
 
-		// The sequence value is prepended to the update id to create an ordered list
-		key := bytes.Join([][]byte{prefix, []byte(updateID)}, []byte{})
+			// Replays of updates stored earlier, possibly by the same batch,
+			// are skipped.
+			seq, originalID, err := t.store(tx, key, update, updateJSON)
+			if err != nil {
+				return err
+			}
 
-		// The DB is append-only
-		bucket.FillPercent = 1
+			if originalID != "" {
+				originalIDs[i] = originalID
 
-		t.lastSeq = seq
-		t.lastEventID = updateID
+				continue
+			}
 
-		if err := bucket.Put(key, updateJSON); err != nil {
-			return fmt.Errorf("unable to put value in Bolt DB: %w", err)
+			lastSeq = seq
+			lastEventID = update.ID
 		}
 
-		return t.cleanup(bucket, seq)
+		return nil
 	}); err != nil {
-		return fmt.Errorf("bolt error: %w", err)
+		return nil, fmt.Errorf("bolt error: %w", err)
 	}
 
-	return nil
+	if lastEventID != "" {
+		t.lastSeq = lastSeq
+		t.lastEventID = lastEventID
+	}
+
+	dispatched := make([]bool, len(updates))
+
+	for i, id := range originalIDs {
+		if id == "" {
+			dispatched[i] = true
+		} else {
+			updates[i].ID = id
+		}
+	}
+
+	return dispatched, nil
+}
+
+// put stores update in the database using the given transaction, and returns its sequence.
+func (t *BoltTransport) put(tx *bolt.Tx, update *Update, updateJSON []byte) (uint64, error) {
+	bucket, err := tx.CreateBucketIfNotExists([]byte(t.bucketName))
+	if err != nil {
+		return 0, fmt.Errorf("error when creating Bolt DB bucket: %w", err)
+	}
+
+	seq, err := bucket.NextSequence()
+	if err != nil {
+		return 0, fmt.Errorf("error when generating Bolt DB sequence: %w", err)
+	}
+
+	prefix := make([]byte, 8)
+	binary.BigEndian.PutUint64(prefix, seq)
+
+	// The sequence value is prepended to the update id to create an ordered list
+	key := bytes.Join([][]byte{prefix, []byte(update.ID)}, []byte{})
+
+	// The DB is append-only
+	bucket.FillPercent = 1
+
+	if err := bucket.Put(key, updateJSON); err != nil {
+		return 0, fmt.Errorf("unable to put value in Bolt DB: %w", err)
+	}
+
+	index, err := tx.CreateBucketIfNotExists([]byte(t.indexBucketName))
+	if err != nil {
+		return 0, fmt.Errorf("error when creating Bolt DB bucket: %w", err)
+	}
+
+	// If several updates share the same ID, the index points to the latest one.
+	if err := index.Put([]byte(update.ID), prefix); err != nil {
+		return 0, fmt.Errorf("unable to put value in Bolt DB: %w", err)
+	}
+
+	if err := t.cacheLastValue(tx, update, prefix, updateJSON); err != nil {
+		return 0, err
+	}
+
+	if err := t.track(tx, bucket, update, prefix); err != nil {
+		return 0, err
+	}
+
+	if err := t.trackExpiry(tx, update, key); err != nil {
+		return 0, err
+	}
+
+	if err := t.cleanup(tx, bucket, seq); err != nil {
+		return 0, err
+	}
+
+	return seq, nil
 }
 
 // shouldCleanup reports whether this publish runs a cleanup pass. cleanupFrequency
@@ -393,30 +692,61 @@ func (t *BoltTransport) shouldCleanup(lastID uint64) bool {
 	return rand.Float64() < t.cleanupFrequency //nolint:gosec
 }
 
-// cleanup removes entries in the history above the size limit, triggered probabilistically.
-func (t *BoltTransport) cleanup(bucket *bolt.Bucket, lastID uint64) error {
+// cleanup removes the entries in the history above the size limit, triggered
+// probabilistically. Expired entries are removed by the sweeper.
+func (t *BoltTransport) cleanup(tx *bolt.Tx, bucket *bolt.Bucket, lastID uint64) error {
 	if !t.shouldCleanup(lastID) {
 		return nil
 	}
 
-	removeUntil := lastID - t.size
+	return t.removeUntil(tx, bucket, lastID-t.size)
+}
 
+// removeUntil removes the updates with a sequence lower than or equal to seq.
+func (t *BoltTransport) removeUntil(tx *bolt.Tx, bucket *bolt.Bucket, seq uint64) error {
 	c := bucket.Cursor()
-	for k, _ := c.First(); k != nil; k, _ = c.Next() {
-		if binary.BigEndian.Uint64(k[:8]) > removeUntil {
-			break
+	for k, _ := c.First(); k != nil && binary.BigEndian.Uint64(k[:8]) <= seq; k, _ = c.First() {
+		if err := t.deleteUpdate(tx, c, k); err != nil {
+			return err
 		}
+	}
 
-		if err := bucket.Delete(k); err != nil {
+	return nil
+}
+
+// deleteUpdate removes the update the cursor is positioned on, with key k,
+// and all the entries referencing it.
+func (t *BoltTransport) deleteUpdate(tx *bolt.Tx, c *bolt.Cursor, k []byte) error {
+	prefix, id := k[:8], k[8:]
+
+	// The index entry may point to a more recent update with the same ID.
+	if index := tx.Bucket([]byte(t.indexBucketName)); index != nil && bytes.Equal(index.Get(id), prefix) {
+		if err := index.Delete(id); err != nil {
 			return fmt.Errorf("unable to delete value in Bolt DB: %w", err)
 		}
 	}
 
+	if err := t.untrack(tx, prefix); err != nil {
+		return err
+	}
+
+	if err := t.uncacheLastValue(tx, prefix, c.Bucket().Get(k)); err != nil {
+		return err
+	}
+
+	if err := c.Delete(); err != nil {
+		return fmt.Errorf("unable to delete value in Bolt DB: %w", err)
+	}
+
 	return nil
 }
 
 // Interface guards.
 var (
-	_ Transport            = (*BoltTransport)(nil)
-	_ TransportSubscribers = (*BoltTransport)(nil)
+	_ Transport                  = (*BoltTransport)(nil)
+	_ TransportLastEventID       = (*BoltTransport)(nil)
+	_ TransportSubscribers       = (*BoltTransport)(nil)
+	_ TransportTopicMatcherStore = (*BoltTransport)(nil)
+	_ TransportDeduplicator      = (*BoltTransport)(nil)
+	_ TransportBatchDispatcher   = (*BoltTransport)(nil)
 )
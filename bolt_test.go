@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"encoding/json"
 	"log/slog"
 	"os"
 	"strconv"
@@ -15,7 +16,7 @@ import (
 	bolt "go.etcd.io/bbolt"
 )
 
-func createBoltTransport(t *testing.T, size uint64, cleanupFrequency float64) *BoltTransport {
+func createBoltTransport(t *testing.T, size uint64, cleanupFrequency float64, options ...BoltOption) *BoltTransport {
 	t.Helper()
 
 	if cleanupFrequency == 0 {
@@ -23,7 +24,7 @@ func createBoltTransport(t *testing.T, size uint64, cleanupFrequency float64) *B
 	}
 
 	path := "test-" + t.Name() + ".db"
-	transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), path, defaultBoltBucketName, size, cleanupFrequency)
+	transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), path, defaultBoltBucketName, size, cleanupFrequency, options...)
 	require.NoError(t, err)
 
 	t.Cleanup(func() {
@@ -34,6 +35,35 @@ func createBoltTransport(t *testing.T, size uint64, cleanupFrequency float64) *B
 	return transport
 }
 
+// historyIDs returns the IDs of the updates stored in the history, and
+// checks that the event ID index is consistent with them.
+func historyIDs(t *testing.T, transport *BoltTransport) []string {
+	t.Helper()
+
+	var ids []string
+
+	require.NoError(t, transport.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(transport.bucketName))
+		if b == nil {
+			return nil
+		}
+
+		require.NoError(t, b.ForEach(func(k, _ []byte) error {
+			ids = append(ids, string(k[8:]))
+
+			return nil
+		}))
+
+		if index := tx.Bucket([]byte(transport.indexBucketName)); index != nil {
+			assert.Equal(t, b.Stats().KeyN, index.Stats().KeyN)
+		}
+
+		return nil
+	}))
+
+	return ids
+}
+
 func TestBoltTransportHistory(t *testing.T) {
 	t.Parallel()
 
@@ -455,3 +485,97 @@ func TestBoltTransportKnownLastEventIDIsEchoed(t *testing.T) {
 
 	s.Disconnect()
 }
+
+// Databases created before the event ID index existed are indexed when
+// opened, and resuming doesn't depend on how far back the requested event is.
+func TestBoltTransportBuildsIndexOfExistingDatabase(t *testing.T) {
+	t.Parallel()
+
+	const count = 15000
+
+	path := "test-" + t.Name() + ".db"
+	db, err := bolt.Open(path, 0o600, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucket([]byte(defaultBoltBucketName))
+		require.NoError(t, err)
+
+		bucket.FillPercent = 1
+
+		for i := range count {
+			seq, err := bucket.NextSequence()
+			require.NoError(t, err)
+
+			prefix := make([]byte, 8)
+			binary.BigEndian.PutUint64(prefix, seq)
+
+			u := &Update{Event: Event{ID: strconv.Itoa(i)}, Topics: []string{"https://example.com/foo"}}
+			v, err := json.Marshal(u)
+			require.NoError(t, err)
+
+			require.NoError(t, bucket.Put(bytes.Join([][]byte{prefix, []byte(u.ID)}, []byte{}), v))
+		}
+
+		return nil
+	}))
+	require.NoError(t, db.Close())
+
+	transport := createBoltTransport(t, 0, 0)
+
+	require.NoError(t, transport.db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, count, tx.Bucket([]byte(defaultBoltBucketName+boltIndexBucketSuffix)).Stats().KeyN)
+
+		return nil
+	}))
+
+	s := NewLocalSubscriber(strconv.Itoa(count-2), transport.logger, &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	assert.Equal(t, strconv.Itoa(count-2), <-s.responseLastEventID)
+	assert.Equal(t, strconv.Itoa(count-1), (<-s.Receive()).ID)
+
+	s.Disconnect()
+}
+
+func TestBoltTransportCleanupRemovesIndexEntries(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 5, 1)
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: "dup"}, Topics: []string{"https://example.com/foo"}}))
+
+	for i := range 10 {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{
+			Event:  Event{ID: strconv.Itoa(i)},
+			Topics: []string{"https://example.com/foo"},
+		}))
+
+		if i == 7 {
+			require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: "dup"}, Topics: []string{"https://example.com/foo"}}))
+		}
+	}
+
+	require.NoError(t, transport.db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 5, tx.Bucket([]byte(defaultBoltBucketName)).Stats().KeyN)
+		assert.Equal(t, 5, tx.Bucket([]byte(defaultBoltBucketName+boltIndexBucketSuffix)).Stats().KeyN)
+
+		return nil
+	}))
+
+	// A removed update can't be resumed from.
+	s := NewLocalSubscriber("2", transport.logger, &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+	assert.Equal(t, EarliestLastEventID, <-s.responseLastEventID)
+	s.Disconnect()
+
+	// Removing the first "dup" update kept the index entry of the second one.
+	s = NewLocalSubscriber("dup", transport.logger, &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+	assert.Equal(t, "dup", <-s.responseLastEventID)
+	assert.Equal(t, "8", (<-s.Receive()).ID)
+	s.Disconnect()
+}
@@ -0,0 +1,173 @@
+package mercure
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltImportBatchSize is the number of updates stored per transaction during an import.
+const boltImportBatchSize = 1000
+
+// ErrBoltBucketNotEmpty is returned when importing history into a bucket that already contains updates.
+var ErrBoltBucketNotEmpty = errors.New("the Bolt DB bucket is not empty")
+
+// Backup writes a consistent copy of the whole Bolt database to w, and
+// returns the number of bytes written. It uses a read transaction: updates
+// can still be dispatched while the backup is in progress, but aren't part of it.
+func (t *BoltTransport) Backup(w io.Writer) (int64, error) {
+	var n int64
+
+	if err := t.db.View(func(tx *bolt.Tx) (err error) {
+		n, err = tx.WriteTo(w)
+
+		return err //nolint:wrapcheck
+	}); err != nil {
+		return n, fmt.Errorf("unable to back up the Bolt DB: %w", err)
+	}
+
+	return n, nil
+}
+
+// Export writes the history to w as JSON Lines, oldest update first, and
+// returns the number of exported updates. Like Backup, it doesn't block
+// the dispatch of new updates.
+func (t *BoltTransport) Export(ctx context.Context, w io.Writer) (int, error) {
+	return exportBolt(ctx, t.db, t.bucketName, w)
+}
+
+// ExportBolt writes the history stored by a BoltTransport in the Bolt
+// database at path to w as JSON Lines, oldest update first. The database is
+// opened read-only, so it must not be held by a running hub: use the Export
+// method of its transport instead.
+func ExportBolt(ctx context.Context, path, bucketName string, w io.Writer) (int, error) {
+	if bucketName == "" {
+		bucketName = defaultBoltBucketName
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{ReadOnly: true, Timeout: 1 * time.Second})
+	if err != nil {
+		return 0, fmt.Errorf("unable to open Bolt DB %q: %w", path, err)
+	}
+	defer db.Close()
+
+	return exportBolt(ctx, db, bucketName, w)
+}
+
+func exportBolt(ctx context.Context, db *bolt.DB, bucketName string, w io.Writer) (int, error) {
+	var n int
+
+	bw := bufio.NewWriter(w)
+
+	if err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName))
+		if b == nil {
+			return nil // No data
+		}
+
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if n%boltImportBatchSize == 0 {
+				if err := ctx.Err(); err != nil {
+					return err //nolint:wrapcheck
+				}
+			}
+
+			// Stored updates are compact JSON documents, they never contain a newline.
+			if _, err := bw.Write(v); err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			if err := bw.WriteByte('\n'); err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			n++
+		}
+
+		return nil
+	}); err != nil {
+		return n, fmt.Errorf("unable to export the Bolt DB history: %w", err)
+	}
+
+	if err := bw.Flush(); err != nil {
+		return n, fmt.Errorf("unable to export the Bolt DB history: %w", err)
+	}
+
+	return n, nil
+}
+
+// Import stores the updates read from r, in the JSON Lines format produced
+// by Export, and returns the number of imported updates. The updates are
+// re-sequenced in the order they are read, so history can be moved between
+// bucket names and hosts. The bucket must not contain any update.
+//
+// Imported updates aren't dispatched to subscribers, and are considered as
+// stored at import time for the computation of their age.
+func (t *BoltTransport) Import(ctx context.Context, r io.Reader) (int, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	if err := t.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(t.bucketName)); b != nil {
+			if k, _ := b.Cursor().First(); k != nil {
+				return fmt.Errorf("%w: %q", ErrBoltBucketNotEmpty, t.bucketName)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+
+	var n int
+
+	dec := json.NewDecoder(r)
+	batch := make([]*Update, 0, boltImportBatchSize)
+
+	for {
+		var update *Update
+
+		err := dec.Decode(&update)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return n, fmt.Errorf("unable to unmarshal update: %w", err)
+		}
+
+		if update != nil {
+			update.AssignUUID()
+			batch = append(batch, update)
+		}
+
+		if len(batch) == boltImportBatchSize || (err != nil && len(batch) > 0) {
+			if err := t.importBatch(ctx, batch); err != nil {
+				return n, err
+			}
+
+			n += len(batch)
+
+			clear(batch)
+			batch = batch[:0]
+		}
+
+		if err != nil {
+			return n, nil
+		}
+	}
+}
+
+// importBatch stores the updates in a single transaction.
+func (t *BoltTransport) importBatch(ctx context.Context, batch []*Update) error {
+	if err := ctx.Err(); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	_, err := t.persistBatchUpdates(nil, batch)
+
+	return err
+}
@@ -0,0 +1,159 @@
+package mercure
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func dispatchNumberedBoltUpdates(t *testing.T, transport *BoltTransport, n int) {
+	t.Helper()
+
+	for i := 1; i <= n; i++ {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{
+			Event:  Event{ID: strconv.Itoa(i), Data: "data " + strconv.Itoa(i)},
+			Topics: []string{"https://example.com/" + strconv.Itoa(i%3)},
+		}))
+	}
+}
+
+func TestBoltTransportExportImport(t *testing.T) {
+	t.Parallel()
+
+	source := createBoltTransport(t, 0, 0)
+	dispatchNumberedBoltUpdates(t, source, boltImportBatchSize+500)
+
+	var export bytes.Buffer
+
+	n, err := source.Export(t.Context(), &export)
+	require.NoError(t, err)
+	assert.Equal(t, boltImportBatchSize+500, n)
+	assert.Equal(t, n, strings.Count(export.String(), "\n"))
+
+	// Import into another bucket, as when moving history to another hub.
+	target, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "target.db"), "moved", 0, 0)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, target.Close(t.Context()))
+	})
+
+	n, err = target.Import(t.Context(), &export)
+	require.NoError(t, err)
+	assert.Equal(t, boltImportBatchSize+500, n)
+
+	assert.Equal(t, historyIDs(t, source), historyIDs(t, target))
+
+	lastEventID, _, _ := target.GetSubscribers(t.Context())
+	assert.Equal(t, strconv.Itoa(boltImportBatchSize+500), lastEventID)
+
+	s := NewLocalSubscriber(strconv.Itoa(boltImportBatchSize+498), target.logger, &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/0"}}, nil)
+	require.NoError(t, target.AddSubscriber(t.Context(), s))
+
+	assert.Equal(t, strconv.Itoa(boltImportBatchSize+498), <-s.responseLastEventID)
+
+	u := <-s.Receive()
+	assert.Equal(t, strconv.Itoa(boltImportBatchSize+500), u.ID)
+	assert.Equal(t, "data "+strconv.Itoa(boltImportBatchSize+500), u.Data)
+	assert.Equal(t, []string{"https://example.com/0"}, u.Topics)
+
+	// Updates are re-sequenced from the start.
+	require.NoError(t, target.db.View(func(tx *bolt.Tx) error {
+		k, _ := tx.Bucket([]byte("moved")).Cursor().First()
+		assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 1, '1'}, k)
+
+		return nil
+	}))
+}
+
+func TestBoltTransportImportIntoNonEmptyBucket(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0)
+	dispatchNumberedBoltUpdates(t, transport, 1)
+
+	n, err := transport.Import(t.Context(), strings.NewReader(`{"ID":"2"}`+"\n"))
+	require.ErrorIs(t, err, ErrBoltBucketNotEmpty)
+	assert.Zero(t, n)
+
+	assert.Equal(t, []string{"1"}, historyIDs(t, transport))
+}
+
+func TestBoltTransportImportInvalidJSON(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0)
+
+	n, err := transport.Import(t.Context(), strings.NewReader(`{"ID":"1"}`+"\n{"))
+	require.Error(t, err)
+	assert.Zero(t, n)
+
+	assert.Empty(t, historyIDs(t, transport))
+}
+
+func TestBoltTransportBackup(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0)
+	dispatchNumberedBoltUpdates(t, transport, 10)
+
+	path := filepath.Join(t.TempDir(), "backup.db")
+
+	f, err := os.Create(path)
+	require.NoError(t, err)
+
+	n, err := transport.Backup(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), n)
+
+	restored, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), path, defaultBoltBucketName, 0, 0)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, restored.Close(t.Context()))
+	})
+
+	assert.Equal(t, historyIDs(t, transport), historyIDs(t, restored))
+
+	lastEventID, _, _ := restored.GetSubscribers(t.Context())
+	assert.Equal(t, "10", lastEventID)
+}
+
+func TestExportBolt(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "bolt.db")
+
+	transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), path, "", 0, 0)
+	require.NoError(t, err)
+
+	dispatchNumberedBoltUpdates(t, transport, 3)
+	require.NoError(t, transport.Close(t.Context()))
+
+	var export bytes.Buffer
+
+	n, err := ExportBolt(t.Context(), path, "", &export)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	lines := strings.Split(strings.TrimSuffix(export.String(), "\n"), "\n")
+	require.Len(t, lines, 3)
+	assert.JSONEq(t, `{"ID":"1","Type":"","Retry":0,"Data":"data 1","Topics":["https://example.com/1"],"Private":false,"Debug":false}`, lines[0])
+
+	n, err = ExportBolt(t.Context(), path, "unknown", &export)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
@@ -0,0 +1,106 @@
+package mercure
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func BenchmarkBoltTransport(b *testing.B) {
+	subscribeBenchmarkHelper(b, subBenchBoltTransport())
+}
+
+func BenchmarkBoltTransportGroupCommit(b *testing.B) {
+	subscribeBenchmarkHelper(b, subBenchBoltTransport(WithBoltGroupCommit(2*time.Millisecond, 128)))
+}
+
+func subBenchBoltTransport(options ...BoltOption) func(b *testing.B, topics, concurrency, matchPct int, testName string) {
+	return func(b *testing.B, topics, concurrency, matchPct int, testName string) {
+		b.Helper()
+
+		tr, err := NewBoltTransport(NewSubscriberList(1_000), slog.Default(), filepath.Join(b.TempDir(), "bolt.db"), "", 0, 0, options...)
+		require.NoError(b, err)
+
+		ctx := b.Context()
+
+		b.Cleanup(func() {
+			assert.NoError(b, tr.Close(context.Background()))
+		})
+
+		top := make([]string, topics)
+		tsMatch := make([]string, topics)
+
+		tsNoMatch := make([]string, topics)
+		for i := range topics {
+			tsNoMatch[i] = fmt.Sprintf("/%d/:id", rand.Int())
+			if topics/2 == i {
+				n := rand.Int()
+				top[i] = fmt.Sprintf("/%d/%d", n, rand.Int())
+				tsMatch[i] = fmt.Sprintf("/%d/:id", n)
+			} else {
+				top[i] = fmt.Sprintf("/%d/%d", rand.Int(), rand.Int())
+				tsMatch[i] = tsNoMatch[i]
+			}
+		}
+
+		tms := &TopicMatcherStore{}
+
+		subscribers := make([]*LocalSubscriber, concurrency)
+		for i := range concurrency {
+			s := NewLocalSubscriber("", slog.Default(), tms)
+			if i%100 < matchPct {
+				s.setMatchers(stringsToURLPatternMatchers(tsMatch), nil)
+			} else {
+				s.setMatchers(stringsToURLPatternMatchers(tsNoMatch), nil)
+			}
+
+			subscribers[i] = s
+			require.NoError(b, tr.AddSubscriber(ctx, s))
+		}
+
+		ctx, done := context.WithCancel(ctx)
+		b.Cleanup(done)
+
+		for i := range concurrency {
+			go func() {
+				for {
+					select {
+					case _, ok := <-subscribers[i].Receive():
+						if !ok {
+							return
+						}
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+
+		b.Run(testName, func(b *testing.B) {
+			// Concurrent publishers are what group commit batches together.
+			b.SetParallelism(concurrency)
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					require.NoError(b, tr.Dispatch(ctx, testUpdate(&Update{}, top...)))
+				}
+			})
+		})
+	}
+}
+
+/*
+These are example commands comparing the throughput with and without group commit.
+Omission of any environment variable causes the test to enumerate a few meaningful options.
+
+SUB_TEST_CONCURRENCY=100 \
+	SUB_TEST_TOPICS=1 \
+	SUB_TEST_MATCHPCT=10 \
+	go test -bench=BenchmarkBoltTransport -run=^$ -benchmem
+*/
@@ -0,0 +1,178 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrInvalidBoltGroupCommit is returned when the group commit delay or size isn't positive.
+var ErrInvalidBoltGroupCommit = errors.New("invalid Bolt group commit settings")
+
+// boltCommit is an update waiting to be persisted by the group committer.
+type boltCommit struct {
+	ctx        context.Context //nolint:containedctx
+	key        string
+	update     *Update
+	updateJSON []byte
+	// stored is set before the result is sent on err.
+	stored bool
+	err    chan error
+}
+
+// WithBoltGroupCommit enables group commit: concurrent calls to Dispatch are
+// collected for up to maxDelay, or until maxSize updates are pending, then
+// persisted in a single Bolt transaction and dispatched to subscribers in
+// order. This trades a little latency for a much higher publish throughput,
+// as the cost of syncing the database to disk is shared by the whole group.
+func WithBoltGroupCommit(maxDelay time.Duration, maxSize int) BoltOption {
+	return func(t *BoltTransport) error {
+		if maxDelay <= 0 || maxSize <= 0 {
+			return fmt.Errorf("%w: delay %s, size %d", ErrInvalidBoltGroupCommit, maxDelay, maxSize)
+		}
+
+		t.groupCommitDelay = maxDelay
+		t.groupCommitSize = maxSize
+
+		return nil
+	}
+}
+
+// commit hands the update over to the group committer, waits until it has
+// been persisted, and reports whether it isn't a replay.
+func (t *BoltTransport) commit(ctx context.Context, key string, update *Update, updateJSON []byte) (bool, error) {
+	c := &boltCommit{ctx: ctx, key: key, update: update, updateJSON: updateJSON, err: make(chan error, 1)}
+
+	// The channel is unbuffered: once sent, the update is owned by the
+	// committer, which always reports a result, even when closing.
+	select {
+	case t.commits <- c:
+	case <-t.closed:
+		return false, ErrClosedTransport
+	}
+
+	if err := <-c.err; err != nil {
+		return false, err
+	}
+
+	return c.stored, nil
+}
+
+// runCommitter collects the updates to persist until the transport is closed.
+func (t *BoltTransport) runCommitter() {
+	defer close(t.committerDone)
+
+	if t.groupCommitSize <= 0 {
+		return
+	}
+
+	batch := make([]*boltCommit, 0, t.groupCommitSize)
+	timer := time.NewTimer(t.groupCommitDelay)
+	timer.Stop()
+
+	for {
+		select {
+		case <-t.closed:
+			return
+		case c := <-t.commits:
+			batch = append(batch, c)
+		}
+
+		timer.Reset(t.groupCommitDelay)
+
+	collect:
+		for len(batch) < t.groupCommitSize {
+			select {
+			case c := <-t.commits:
+				batch = append(batch, c)
+			case <-timer.C:
+				break collect
+			}
+		}
+
+		timer.Stop()
+
+		t.persistBatch(batch)
+
+		clear(batch)
+		batch = batch[:0]
+	}
+}
+
+// persistBatch stores the updates in a single transaction, then dispatches
+// them. If the transaction fails, each update is retried in its own
+// transaction, so that one bad update doesn't fail the whole group.
+func (t *BoltTransport) persistBatch(batch []*boltCommit) {
+	t.Lock()
+	defer t.Unlock()
+
+	var (
+		lastSeq     uint64
+		lastEventID string
+		// The ID of the original update of each replay, only applied once
+		// the transaction is committed: the updates are retried one by one
+		// if it fails.
+		originalIDs []string
+	)
+
+	err := t.db.Update(func(tx *bolt.Tx) error {
+		originalIDs = make([]string, len(batch))
+
+		for i, c := range batch {
+			// Replays of an update of the same batch are detected too.
+			seq, originalID, err := t.store(tx, c.key, c.update, c.updateJSON)
+			if err != nil {
+				return err
+			}
+
+			if originalID != "" {
+				originalIDs[i] = originalID
+
+				continue
+			}
+
+			lastSeq = seq
+			lastEventID = c.update.ID
+		}
+
+		return nil
+	})
+	if err == nil {
+		if lastSeq != 0 {
+			t.lastSeq = lastSeq
+			t.lastEventID = lastEventID
+		}
+
+		for i, c := range batch {
+			if originalIDs[i] == "" {
+				c.stored = true
+				t.fanOut(c.ctx, c.update)
+			} else {
+				c.update.ID = originalIDs[i]
+			}
+
+			c.err <- nil
+		}
+
+		return
+	}
+
+	for _, c := range batch {
+		stored, err := t.persist(c.key, c.update, c.updateJSON)
+		if err != nil {
+			c.err <- err
+
+			continue
+		}
+
+		c.stored = stored
+		if stored {
+			t.fanOut(c.ctx, c.update)
+		}
+
+		c.err <- nil
+	}
+}
@@ -0,0 +1,98 @@
+package mercure
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltTransportGroupCommit(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0, WithBoltGroupCommit(5*time.Millisecond, 10))
+
+	s := NewLocalSubscriber("", transport.logger, &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Go(func() {
+			assert.NoError(t, transport.Dispatch(t.Context(), &Update{
+				Event:  Event{ID: strconv.Itoa(i)},
+				Topics: []string{"https://example.com/foo"},
+			}))
+		})
+	}
+
+	wg.Wait()
+
+	// Live updates are received in the order they have been stored.
+	ids := historyIDs(t, transport)
+	require.Len(t, ids, 50)
+
+	for _, id := range ids {
+		assert.Equal(t, id, (<-s.Receive()).ID)
+	}
+
+	lastEventID, _, _ := transport.GetSubscribers(t.Context())
+	assert.Equal(t, ids[len(ids)-1], lastEventID)
+
+	s = NewLocalSubscriber(ids[47], transport.logger, &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	assert.Equal(t, ids[47], <-s.responseLastEventID)
+	assert.Equal(t, ids[48], (<-s.Receive()).ID)
+	assert.Equal(t, ids[49], (<-s.Receive()).ID)
+}
+
+// A failing update doesn't fail the other updates of its group.
+func TestBoltTransportGroupCommitPerUpdateError(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0, WithBoltGroupCommit(time.Second, 3))
+
+	errs := make([]error, 3)
+
+	var wg sync.WaitGroup
+	for i, id := range []string{"1", strings.Repeat("x", 40000), "3"} {
+		wg.Go(func() {
+			errs[i] = transport.Dispatch(t.Context(), &Update{Event: Event{ID: id}, Topics: []string{"https://example.com/foo"}})
+		})
+	}
+
+	wg.Wait()
+
+	require.NoError(t, errs[0])
+	require.Error(t, errs[1])
+	require.NoError(t, errs[2])
+
+	assert.ElementsMatch(t, []string{"1", "3"}, historyIDs(t, transport))
+}
+
+func TestBoltTransportGroupCommitClosed(t *testing.T) {
+	t.Parallel()
+
+	transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "bolt.db"), "", 0, 0, WithBoltGroupCommit(time.Millisecond, 10))
+	require.NoError(t, err)
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Topics: []string{"https://example.com/foo"}}))
+	require.NoError(t, transport.Close(t.Context()))
+
+	require.ErrorIs(t, transport.Dispatch(t.Context(), &Update{Topics: []string{"https://example.com/foo"}}), ErrClosedTransport)
+}
+
+func TestBoltTransportInvalidGroupCommit(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "bolt.db"), "", 0, 0, WithBoltGroupCommit(0, 10))
+	require.ErrorIs(t, err, ErrInvalidBoltGroupCommit)
+}
@@ -0,0 +1,250 @@
+package mercure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltDefaultCompactionInterval is the default delay between two compactions of the history.
+const BoltDefaultCompactionInterval = time.Minute
+
+// boltCompactionBatchSize is the maximum number of updates scanned or removed
+// in a single transaction, so that compacting doesn't delay publications nor
+// prevent Bolt from reusing freed pages.
+const boltCompactionBatchSize = 1000
+
+// ErrInvalidBoltCompaction is returned when a compaction rule has an
+// unsupported matcher type or keeps no update.
+var ErrInvalidBoltCompaction = errors.New("invalid Bolt compaction rule")
+
+// BoltCompaction keeps in the history only the Keep newest updates of each
+// canonical topic (the first topic of an update) matching Matcher.
+type BoltCompaction struct {
+	Matcher TopicMatcher
+	Keep    uint64
+}
+
+// WithBoltCompaction compacts the history of the topics matching the given
+// rules every interval (BoltDefaultCompactionInterval if 0). When a topic
+// matches several rules, the first one applies. The other topics are still
+// only subject to the size, maximum age and quota settings.
+//
+// Compaction runs in the background: the history is scanned in short read-only
+// transactions, and the superseded updates are removed in small batches. The
+// remaining updates are replayed in their original order. A subscriber
+// reconnecting with the ID of a removed update gets "earliest", as for
+// updates removed by the other retention settings.
+func WithBoltCompaction(interval time.Duration, rules ...BoltCompaction) BoltOption {
+	return func(t *BoltTransport) error {
+		for _, r := range rules {
+			if !knownMatcherType(r.Matcher.Type) || r.Keep == 0 {
+				return fmt.Errorf("%w: %s %q: %d", ErrInvalidBoltCompaction, r.Matcher.Type, r.Matcher.Pattern, r.Keep)
+			}
+		}
+
+		if interval <= 0 {
+			interval = BoltDefaultCompactionInterval
+		}
+
+		t.compactionInterval = interval
+		t.compactions = rules
+
+		return nil
+	}
+}
+
+// runCompactor periodically compacts the history, until the transport is closed.
+func (t *BoltTransport) runCompactor() {
+	defer close(t.compactorDone)
+
+	if len(t.compactions) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(t.compactionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.closed:
+			return
+		case <-ticker.C:
+		}
+
+		ctx := context.Background()
+		if _, err := t.compact(ctx); err != nil && t.logger.Enabled(ctx, slog.LevelError) {
+			t.logger.LogAttrs(ctx, slog.LevelError, "Unable to compact the Bolt DB history", slog.Any("error", err))
+		}
+	}
+}
+
+// compact removes the superseded updates of the compacted topics, and returns their number.
+func (t *BoltTransport) compact(ctx context.Context) (int, error) {
+	keys, err := t.supersededKeys()
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+
+	for batch := range slices.Chunk(keys, boltCompactionBatchSize) {
+		select {
+		case <-t.closed:
+			return n, ErrClosedTransport
+		default:
+		}
+
+		if err := t.db.Update(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket([]byte(t.bucketName))
+			if bucket == nil {
+				return nil
+			}
+
+			c := bucket.Cursor()
+
+			for _, k := range batch {
+				// The update may have been removed since the scan.
+				if found, _ := c.Seek(k); !bytes.Equal(found, k) {
+					continue
+				}
+
+				if err := t.deleteUpdate(tx, c, k); err != nil {
+					return err
+				}
+
+				n++
+			}
+
+			return nil
+		}); err != nil {
+			return n, fmt.Errorf("bolt error: %w", err)
+		}
+	}
+
+	if n > 0 && t.logger.Enabled(ctx, slog.LevelDebug) {
+		t.logger.LogAttrs(ctx, slog.LevelDebug, "Bolt DB history compacted", slog.Int("removed", n))
+	}
+
+	return n, nil
+}
+
+// supersededKeys returns the keys of the updates of the compacted topics
+// followed by at least Keep newer updates of the same topic.
+//
+// The history is scanned from the newest update, in chunks of
+// boltCompactionBatchSize updates each read in its own transaction: a
+// long-lived read transaction would prevent Bolt from reusing the pages freed
+// in the meantime. Updates published or removed between two chunks can only
+// lead to keeping more updates than needed until the next compaction.
+func (t *BoltTransport) supersededKeys() ([][]byte, error) {
+	t.RLock()
+	store := t.topicMatcherStore
+	t.RUnlock()
+
+	var (
+		keys [][]byte
+		last []byte
+		done bool
+	)
+
+	// The number of updates seen for each compacted topic, newest first.
+	// Topics no rule applies to aren't tracked: the matcher store caches
+	// the result of the match.
+	counts := make(map[string]uint64)
+
+	for !done {
+		select {
+		case <-t.closed:
+			return nil, ErrClosedTransport
+		default:
+		}
+
+		err := t.db.View(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket([]byte(t.bucketName))
+			if bucket == nil {
+				done = true
+
+				return nil
+			}
+
+			c := bucket.Cursor()
+
+			var k, v []byte
+			if last == nil {
+				k, v = c.Last()
+			} else {
+				// The last scanned update may have been removed since the
+				// previous chunk: resume from the first older key.
+				k, v = c.Seek(last)
+				if k == nil {
+					k, v = c.Last()
+				}
+
+				for k != nil && bytes.Compare(k, last) >= 0 {
+					k, v = c.Prev()
+				}
+			}
+
+			for n := 0; k != nil; k, v = c.Prev() {
+				if n == boltCompactionBatchSize {
+					return nil
+				}
+
+				n++
+				last = bytes.Clone(k)
+
+				var update struct{ Topics []string }
+				if err := json.Unmarshal(v, &update); err != nil {
+					return fmt.Errorf("unable to unmarshal update: %w", err)
+				}
+
+				if len(update.Topics) == 0 {
+					continue
+				}
+
+				rule := t.compactionRule(store, update.Topics[0])
+				if rule == nil {
+					continue
+				}
+
+				count := counts[update.Topics[0]] + 1
+				counts[update.Topics[0]] = count
+
+				if count > rule.Keep {
+					keys = append(keys, last)
+				}
+			}
+
+			done = true
+
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan the Bolt DB history: %w", err)
+		}
+	}
+
+	return keys, nil
+}
+
+// compactionRule returns the first compaction rule matching the given
+// canonical topic, or nil if the topic isn't compacted.
+func (t *BoltTransport) compactionRule(store *TopicMatcherStore, topic string) *BoltCompaction {
+	topics := []string{topic}
+
+	for i := range t.compactions {
+		if store.matches(topics, t.compactions[i].Matcher) {
+			return &t.compactions[i]
+		}
+	}
+
+	return nil
+}
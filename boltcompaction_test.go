@@ -0,0 +1,117 @@
+package mercure
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dispatchCompactionFixtures(t *testing.T, transport *BoltTransport) {
+	t.Helper()
+
+	for _, u := range []struct{ id, topic string }{
+		{"a1", "https://example.com/state/a"},
+		{"b1", "https://example.com/state/b"},
+		{"e1", "https://example.com/events"},
+		{"a2", "https://example.com/state/a"},
+		{"r1", "https://example.com/rooms/1"},
+		{"a3", "https://example.com/state/a"},
+		{"e2", "https://example.com/events"},
+		{"r2", "https://example.com/rooms/1"},
+		{"b2", "https://example.com/state/b"},
+		{"a4", "https://example.com/state/a"},
+	} {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: u.id}, Topics: []string{u.topic, "https://example.com/state/a"}}))
+	}
+}
+
+func TestBoltTransportCompaction(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0, WithBoltCompaction(time.Hour,
+		BoltCompaction{Matcher: TopicMatcher{Type: MatcherTypeURLPattern, Pattern: "https://example.com/state/*"}, Keep: 2},
+		BoltCompaction{Matcher: TopicMatcher{Type: MatcherTypeExact, Pattern: "https://example.com/state/b"}, Keep: 10},
+		BoltCompaction{Matcher: TopicMatcher{Type: MatcherTypeExact, Pattern: "https://example.com/rooms/1"}, Keep: 1},
+	))
+
+	dispatchCompactionFixtures(t, transport)
+
+	n, err := transport.compact(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	// Only the canonical topic counts, the first matching rule applies.
+	assert.Equal(t, []string{"b1", "e1", "a3", "e2", "r2", "b2", "a4"}, historyIDs(t, transport))
+
+	n, err = transport.compact(t.Context())
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	// The remaining updates are replayed in order.
+	s := NewLocalSubscriber("b1", slog.Default(), &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/state/a"}}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	for _, id := range []string{"e1", "a3", "e2", "r2", "b2", "a4"} {
+		assert.Equal(t, id, (<-s.Receive()).ID)
+	}
+
+	// A removed update can't be used to resume anymore.
+	s = NewLocalSubscriber("a2", slog.Default(), &TopicMatcherStore{})
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+	assert.Equal(t, EarliestLastEventID, <-s.ResponseLastEventID())
+}
+
+func TestBoltTransportCompactionChunks(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0, WithBoltCompaction(time.Hour,
+		BoltCompaction{Matcher: TopicMatcher{Type: MatcherTypeExact, Pattern: "https://example.com/0"}, Keep: 1},
+	))
+
+	total := 2*boltCompactionBatchSize + 10
+	dispatchNumberedBoltUpdates(t, transport, total)
+
+	// All the updates of https://example.com/0 but the newest one are
+	// removed, even when they span several scanned chunks.
+	n, err := transport.compact(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, total/3-1, n)
+
+	ids := historyIDs(t, transport)
+	assert.Len(t, ids, total-n)
+	assert.Equal(t, strconv.Itoa(total), ids[len(ids)-1])
+	assert.NotContains(t, ids, strconv.Itoa(total-3))
+}
+
+func TestBoltTransportCompactionInBackground(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0, WithBoltCompaction(10*time.Millisecond,
+		BoltCompaction{Matcher: TopicMatcher{Type: MatcherTypeURLPattern, Pattern: "https://example.com/state/*"}, Keep: 1},
+	))
+
+	dispatchCompactionFixtures(t, transport)
+
+	assert.Eventually(t, func() bool {
+		return len(historyIDs(t, transport)) == 6
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"e1", "r1", "e2", "r2", "b2", "a4"}, historyIDs(t, transport))
+}
+
+func TestBoltTransportInvalidCompaction(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "bolt.db")
+
+	_, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), path, "", 0, 0, WithBoltCompaction(0, BoltCompaction{Matcher: TopicMatcher{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}}))
+	require.ErrorIs(t, err, ErrInvalidBoltCompaction)
+
+	_, err = NewBoltTransport(NewSubscriberList(0), slog.Default(), path, "", 0, 0, WithBoltCompaction(0, BoltCompaction{Matcher: TopicMatcher{Type: "foo", Pattern: "https://example.com/foo"}, Keep: 1}))
+	require.ErrorIs(t, err, ErrInvalidBoltCompaction)
+}
@@ -0,0 +1,108 @@
+package mercure
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltExpiresBucketSuffix is appended to the bucket name to get the name of
+// the bucket mapping the expiration times of the updates, followed by their
+// sequence, to their keys. It only lists the updates having an expiration time.
+const boltExpiresBucketSuffix = "_expires"
+
+// trackExpiry records the expiration time of the update stored under key, if any.
+func (t *BoltTransport) trackExpiry(tx *bolt.Tx, update *Update, key []byte) error {
+	if update.Expires.IsZero() {
+		return nil
+	}
+
+	expires, err := tx.CreateBucketIfNotExists([]byte(t.bucketName + boltExpiresBucketSuffix))
+	if err != nil {
+		return fmt.Errorf("error when creating Bolt DB bucket: %w", err)
+	}
+
+	if err := expires.Put(bytes.Join([][]byte{boltExpiresTimestamp(update.Expires), key[:8]}, nil), key); err != nil {
+		return fmt.Errorf("unable to put value in Bolt DB: %w", err)
+	}
+
+	return nil
+}
+
+// purgeExpired removes from the history the updates expired at now. As
+// timestamps are truncated, an update may be kept up to a millisecond after
+// its expiration, but is never removed before.
+func (t *BoltTransport) purgeExpired(tx *bolt.Tx, bucket *bolt.Bucket, now time.Time) error {
+	expires := tx.Bucket([]byte(t.bucketName + boltExpiresBucketSuffix))
+	if expires == nil {
+		return nil
+	}
+
+	bc := bucket.Cursor()
+	limit := boltExpiresTimestamp(now)
+
+	c := expires.Cursor()
+	for k, v := c.First(); k != nil && bytes.Compare(k[:8], limit) < 0; k, v = c.First() {
+		// The update may have already been removed by the other retention settings.
+		if found, _ := bc.Seek(v); bytes.Equal(found, v) {
+			if err := t.deleteUpdate(tx, bc, found); err != nil {
+				return err
+			}
+		}
+
+		if err := c.Delete(); err != nil {
+			return fmt.Errorf("unable to delete value in Bolt DB: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// purgeExpiredNow removes the expired updates in a dedicated transaction,
+// only opened if there is something to remove.
+func (t *BoltTransport) purgeExpiredNow() error {
+	now := time.Now()
+
+	var expired bool
+
+	if err := t.db.View(func(tx *bolt.Tx) error {
+		if expires := tx.Bucket([]byte(t.bucketName + boltExpiresBucketSuffix)); expires != nil {
+			k, _ := expires.Cursor().First()
+			expired = k != nil && bytes.Compare(k[:8], boltExpiresTimestamp(now)) < 0
+		}
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("bolt error: %w", err)
+	}
+
+	if !expired {
+		return nil
+	}
+
+	if err := t.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(t.bucketName))
+		if bucket == nil {
+			return nil
+		}
+
+		return t.purgeExpired(tx, bucket, now)
+	}); err != nil {
+		return fmt.Errorf("bolt error: %w", err)
+	}
+
+	return nil
+}
+
+// boltExpiresTimestamp encodes t with a millisecond precision, so that
+// expiration times far in the future don't overflow. Times before the Unix
+// epoch are clamped to it.
+func boltExpiresTimestamp(t time.Time) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(max(t.UnixMilli(), 0))) //nolint:gosec
+
+	return k
+}
@@ -0,0 +1,75 @@
+package mercure
+
+import (
+	"log/slog"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dispatchExpiring(t *testing.T, transport *BoltTransport, id string, ttl time.Duration) {
+	t.Helper()
+
+	u := &Update{Event: Event{ID: id}, Topics: []string{"https://example.com/foo"}}
+	if ttl != 0 {
+		u.Expires = time.Now().Add(ttl)
+	}
+
+	require.NoError(t, transport.Dispatch(t.Context(), u))
+}
+
+func TestBoltTransportExpiryHistory(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		transport := createBoltTransport(t, 0, 0)
+
+		dispatchExpiring(t, transport, "a", time.Second)
+		dispatchExpiring(t, transport, "b", 0)
+		dispatchExpiring(t, transport, "c", time.Hour)
+
+		time.Sleep(2 * time.Second)
+
+		// Expired updates stay in the history until the next cleanup.
+		assert.Equal(t, []string{"a", "b", "c"}, historyIDs(t, transport))
+
+		s := NewLocalSubscriber(EarliestLastEventID, slog.Default(), &TopicMatcherStore{})
+		s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}}, nil)
+		require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+		assert.Equal(t, "b", (<-s.Receive()).ID)
+		assert.Equal(t, "c", (<-s.Receive()).ID)
+		assert.Empty(t, s.Receive())
+
+		// Skipped updates are purged.
+		assert.Equal(t, []string{"b", "c"}, historyIDs(t, transport))
+	})
+}
+
+func TestBoltTransportExpiryCleanup(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		transport := createBoltTransport(t, 0, 0)
+
+		dispatchExpiring(t, transport, "a", 2*time.Second)
+		dispatchExpiring(t, transport, "b", time.Second)
+		dispatchExpiring(t, transport, "c", time.Hour)
+		dispatchExpiring(t, transport, "d", 0)
+
+		// Publishing doesn't remove the expired updates.
+		time.Sleep(1500 * time.Millisecond)
+		dispatchExpiring(t, transport, "e", 0)
+
+		assert.Equal(t, []string{"a", "b", "c", "d", "e"}, historyIDs(t, transport))
+
+		// The sweeper does.
+		time.Sleep(boltMaxSweepInterval)
+		synctest.Wait()
+
+		assert.Equal(t, []string{"c", "d", "e"}, historyIDs(t, transport))
+	})
+}
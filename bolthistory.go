@@ -0,0 +1,103 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxHistoryScan caps the number of updates read to serve a page of the
+// history, so that a subscriber matching few updates doesn't keep a read
+// transaction open while the whole history is scanned.
+const maxHistoryScan = 10 * maxHistoryLimit
+
+// GetHistory returns at most limit updates matching s dispatched after sinceID.
+// It reads at most maxHistoryScan updates.
+func (t *BoltTransport) GetHistory(ctx context.Context, s *Subscriber, sinceID string, limit int) (*HistoryPage, error) {
+	select {
+	case <-t.closed:
+		return nil, ErrClosedTransport
+	default:
+	}
+
+	_, span := startSpan(ctx, "mercure.transport.history",
+		trace.WithAttributes(
+			attribute.String("mercure.transport", "bolt"),
+			attribute.String("mercure.last_event_id.requested", sinceID),
+		))
+	defer span.End()
+
+	now := time.Now()
+	page := &HistoryPage{}
+
+	err := t.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(t.bucketName))
+		if b == nil {
+			if sinceID != EarliestLastEventID {
+				return ErrUnknownLastEventID
+			}
+
+			return nil // No data
+		}
+
+		c := b.Cursor()
+
+		var k, v []byte
+		if sinceID == EarliestLastEventID {
+			k, v = c.First()
+		} else {
+			if t.seekID(tx, c, sinceID) == nil {
+				return ErrUnknownLastEventID
+			}
+
+			// The cursor is positioned on the requested update.
+			k, v = c.Next()
+		}
+
+		for scanned := 0; k != nil; k, v = c.Next() {
+			if scanned == maxHistoryScan {
+				// The next page starts after the last scanned update.
+				page.More = true
+
+				return nil
+			}
+
+			scanned++
+
+			var update *Update
+			if err := json.Unmarshal(v, &update); err != nil {
+				return fmt.Errorf("unable to unmarshal update: %w", err)
+			}
+
+			if !update.expired(now) && s.Match(update) {
+				if len(page.Updates) == limit {
+					page.More = true
+
+					return nil
+				}
+
+				page.Updates = append(page.Updates, update)
+			}
+
+			page.LastEventID = string(k[8:])
+		}
+
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, ErrUnknownLastEventID) {
+			err = fmt.Errorf("unable to retrieve history from BoltDB: %w", err)
+			recordSpanError(span, err)
+		}
+
+		return nil, err
+	}
+
+	return page, nil
+}
@@ -0,0 +1,90 @@
+package mercure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltGetHistory(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0)
+	ctx := t.Context()
+
+	s := NewSubscriber(transport.logger, &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers([]string{"https://example.com/foo"}), stringsToExactMatchers(nil))
+
+	page, err := transport.GetHistory(ctx, s, EarliestLastEventID, 10)
+	require.NoError(t, err)
+	assert.Equal(t, &HistoryPage{}, page)
+
+	_, err = transport.GetHistory(ctx, s, "a", 10)
+	require.ErrorIs(t, err, ErrUnknownLastEventID)
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, transport.Dispatch(ctx, &Update{Topics: []string{"https://example.com/foo"}, Event: Event{ID: id}}))
+	}
+
+	require.NoError(t, transport.Dispatch(ctx, &Update{Topics: []string{"https://example.com/foo"}, Event: Event{ID: "private"}, Private: true}))
+	require.NoError(t, transport.Dispatch(ctx, &Update{Topics: []string{"https://example.com/bar"}, Event: Event{ID: "other"}}))
+
+	page, err = transport.GetHistory(ctx, s, "a", 2)
+	require.NoError(t, err)
+	assert.Len(t, page.Updates, 2)
+	assert.Equal(t, "b", page.Updates[0].ID)
+	assert.Equal(t, "c", page.Updates[1].ID)
+	assert.Equal(t, "c", page.LastEventID)
+	assert.True(t, page.More)
+
+	page, err = transport.GetHistory(ctx, s, "c", 2)
+	require.NoError(t, err)
+	assert.Len(t, page.Updates, 1)
+	assert.Equal(t, "d", page.Updates[0].ID)
+	// The cursor skips the updates not matching s.
+	assert.Equal(t, "other", page.LastEventID)
+	assert.False(t, page.More)
+
+	_, err = transport.GetHistory(ctx, s, "unknown", 2)
+	require.ErrorIs(t, err, ErrUnknownLastEventID)
+
+	require.NoError(t, transport.Close(ctx))
+
+	_, err = transport.GetHistory(ctx, s, EarliestLastEventID, 2)
+	require.ErrorIs(t, err, ErrClosedTransport)
+}
+
+func TestBoltGetHistoryMaxScan(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0)
+	ctx := t.Context()
+
+	updates := make([]*Update, maxHistoryScan+1)
+	for i := range updates {
+		updates[i] = &Update{Topics: []string{"https://example.com/bar"}}
+	}
+
+	updates[maxHistoryScan].Topics = []string{"https://example.com/foo"}
+
+	_, err := transport.DispatchBatch(ctx, nil, updates)
+	require.NoError(t, err)
+
+	s := NewSubscriber(transport.logger, &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers([]string{"https://example.com/foo"}), stringsToExactMatchers(nil))
+
+	// The scan stops before the matching update.
+	page, err := transport.GetHistory(ctx, s, EarliestLastEventID, 10)
+	require.NoError(t, err)
+	assert.Empty(t, page.Updates)
+	assert.Equal(t, updates[maxHistoryScan-1].ID, page.LastEventID)
+	assert.True(t, page.More)
+
+	page, err = transport.GetHistory(ctx, s, page.LastEventID, 10)
+	require.NoError(t, err)
+	require.Len(t, page.Updates, 1)
+	assert.Equal(t, updates[maxHistoryScan].ID, page.Updates[0].ID)
+	assert.Equal(t, updates[maxHistoryScan].ID, page.LastEventID)
+	assert.False(t, page.More)
+}
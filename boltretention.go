@@ -0,0 +1,341 @@
+package mercure
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltTimestampsBucketSuffix is appended to the bucket name to get the name
+// of the bucket mapping storage times to the sequence of the last update
+// stored at that time. It is only maintained when a maximum age is set.
+const boltTimestampsBucketSuffix = "_timestamps"
+
+// boltQuotasBucketSuffix is appended to the bucket name to get the name of
+// the bucket containing, for each topic quota, a nested bucket listing the
+// sequences of the matching updates. The sequence of a nested bucket is the
+// number of updates it lists.
+const boltQuotasBucketSuffix = "_quotas"
+
+// boltMaxSweepInterval is the maximum delay between two removals of the
+// updates older than the maximum age, and of the expired updates.
+const boltMaxSweepInterval = time.Minute
+
+// ErrInvalidBoltTopicQuota is returned when a topic quota has an unsupported
+// matcher type or a zero size.
+var ErrInvalidBoltTopicQuota = errors.New("invalid Bolt topic quota")
+
+// BoltTopicQuota caps the number of updates matching Matcher kept in the
+// history. When the quota is exceeded, the oldest matching updates are
+// removed, so a chatty topic cannot evict the history of the other ones.
+type BoltTopicQuota struct {
+	Matcher TopicMatcher
+	Size    uint64
+}
+
+func (q BoltTopicQuota) bucketName() []byte {
+	return []byte(string(q.Matcher.Type) + ":" + q.Matcher.Pattern)
+}
+
+// BoltOption sets an optional setting of BoltTransport.
+type BoltOption func(t *BoltTransport) error
+
+// WithBoltMaxAge removes from the history the updates older than maxAge.
+// Expired updates are removed by a background sweeper, regardless of the
+// cleanup frequency.
+func WithBoltMaxAge(maxAge time.Duration) BoltOption {
+	return func(t *BoltTransport) error {
+		t.maxAge = maxAge
+
+		return nil
+	}
+}
+
+// WithBoltTopicQuotas caps the number of updates kept in the history for the
+// topics matching the given patterns. An update matching several quotas
+// counts for each of them.
+//
+// Updates stored before a quota is configured aren't counted.
+func WithBoltTopicQuotas(quotas ...BoltTopicQuota) BoltOption {
+	return func(t *BoltTransport) error {
+		for _, q := range quotas {
+			if !knownMatcherType(q.Matcher.Type) || q.Size == 0 {
+				return fmt.Errorf("%w: %s %q: %d", ErrInvalidBoltTopicQuota, q.Matcher.Type, q.Matcher.Pattern, q.Size)
+			}
+		}
+
+		t.topicQuotas = quotas
+
+		return nil
+	}
+}
+
+// SetTopicMatcherStore sets the TopicMatcherStore used to match the topic quotas.
+func (t *BoltTransport) SetTopicMatcherStore(store *TopicMatcherStore) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.topicMatcherStore = store
+}
+
+// initRetention creates the buckets needed by the configured retention
+// settings and removes the ones that aren't used anymore.
+func (t *BoltTransport) initRetention() error {
+	err := t.db.Update(func(tx *bolt.Tx) error {
+		if err := t.initTimestamps(tx); err != nil {
+			return err
+		}
+
+		quotasBucketName := []byte(t.bucketName + boltQuotasBucketSuffix)
+		if len(t.topicQuotas) == 0 {
+			if err := tx.DeleteBucket(quotasBucketName); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return fmt.Errorf("unable to delete Bolt DB bucket: %w", err)
+			}
+
+			return nil
+		}
+
+		quotas, err := tx.CreateBucketIfNotExists(quotasBucketName)
+		if err != nil {
+			return fmt.Errorf("error when creating Bolt DB bucket: %w", err)
+		}
+
+		configured := make(map[string]struct{}, len(t.topicQuotas))
+		for _, q := range t.topicQuotas {
+			configured[string(q.bucketName())] = struct{}{}
+
+			if _, err := quotas.CreateBucketIfNotExists(q.bucketName()); err != nil {
+				return fmt.Errorf("error when creating Bolt DB bucket: %w", err)
+			}
+		}
+
+		var stale [][]byte
+		if err := quotas.ForEachBucket(func(k []byte) error {
+			if _, ok := configured[string(k)]; !ok {
+				stale = append(stale, bytes.Clone(k))
+			}
+
+			return nil
+		}); err != nil {
+			return fmt.Errorf("unable to list Bolt DB buckets: %w", err)
+		}
+
+		for _, k := range stale {
+			if err := quotas.DeleteBucket(k); err != nil {
+				return fmt.Errorf("unable to delete Bolt DB bucket: %w", err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to initialize the Bolt DB retention: %w", err)
+	}
+
+	return nil
+}
+
+// initTimestamps creates the timestamps bucket when a maximum age is set,
+// and deletes it otherwise. Updates stored before are considered as stored now.
+func (t *BoltTransport) initTimestamps(tx *bolt.Tx) error {
+	if t.maxAge <= 0 {
+		if err := tx.DeleteBucket([]byte(t.bucketName + boltTimestampsBucketSuffix)); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return fmt.Errorf("unable to delete Bolt DB bucket: %w", err)
+		}
+
+		return nil
+	}
+
+	if tx.Bucket([]byte(t.bucketName+boltTimestampsBucketSuffix)) != nil {
+		return nil
+	}
+
+	timestamps, err := tx.CreateBucket([]byte(t.bucketName + boltTimestampsBucketSuffix))
+	if err != nil {
+		return fmt.Errorf("error when creating Bolt DB bucket: %w", err)
+	}
+
+	if t.lastSeq == 0 {
+		return nil
+	}
+
+	seq := make([]byte, 8)
+	binary.BigEndian.PutUint64(seq, t.lastSeq)
+
+	if err := timestamps.Put(boltTimestamp(time.Now()), seq); err != nil {
+		return fmt.Errorf("unable to put value in Bolt DB: %w", err)
+	}
+
+	return nil
+}
+
+func boltTimestamp(t time.Time) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(t.UnixNano())) //nolint:gosec
+
+	return k
+}
+
+// track records the storage time and the quotas of the update with the
+// sequence prefix, and removes the oldest updates exceeding the quotas.
+func (t *BoltTransport) track(tx *bolt.Tx, bucket *bolt.Bucket, update *Update, prefix []byte) error {
+	if t.maxAge > 0 {
+		timestamps, err := tx.CreateBucketIfNotExists([]byte(t.bucketName + boltTimestampsBucketSuffix))
+		if err != nil {
+			return fmt.Errorf("error when creating Bolt DB bucket: %w", err)
+		}
+
+		if err := timestamps.Put(boltTimestamp(time.Now()), prefix); err != nil {
+			return fmt.Errorf("unable to put value in Bolt DB: %w", err)
+		}
+	}
+
+	if len(t.topicQuotas) == 0 {
+		return nil
+	}
+
+	quotas := tx.Bucket([]byte(t.bucketName + boltQuotasBucketSuffix))
+
+	for _, q := range t.topicQuotas {
+		if !t.topicMatcherStore.matches(update.Topics, q.Matcher) {
+			continue
+		}
+
+		qb := quotas.Bucket(q.bucketName())
+		if err := qb.Put(prefix, nil); err != nil {
+			return fmt.Errorf("unable to put value in Bolt DB: %w", err)
+		}
+
+		if err := qb.SetSequence(qb.Sequence() + 1); err != nil {
+			return fmt.Errorf("unable to update Bolt DB sequence: %w", err)
+		}
+
+		if err := t.enforceQuota(tx, bucket, qb, q.Size); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// enforceQuota removes the oldest updates listed in qb until there are at most size of them.
+func (t *BoltTransport) enforceQuota(tx *bolt.Tx, bucket, qb *bolt.Bucket, size uint64) error {
+	c := bucket.Cursor()
+
+	for qb.Sequence() > size {
+		seq, _ := qb.Cursor().First()
+		if seq == nil {
+			return qb.SetSequence(0) //nolint:wrapcheck
+		}
+
+		// The key is removed from qb, it must not point to its memory anymore.
+		seq = bytes.Clone(seq)
+
+		if k, _ := c.Seek(seq); k != nil && bytes.HasPrefix(k, seq) {
+			if err := t.deleteUpdate(tx, c, k); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		// The update has already been removed.
+		if err := t.untrack(tx, seq); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// untrack removes the update with the sequence prefix from the quotas.
+// Its timestamp, if any, is removed by the sweeper.
+func (t *BoltTransport) untrack(tx *bolt.Tx, prefix []byte) error {
+	quotas := tx.Bucket([]byte(t.bucketName + boltQuotasBucketSuffix))
+	if quotas == nil {
+		return nil
+	}
+
+	//nolint:wrapcheck
+	return quotas.ForEachBucket(func(name []byte) error {
+		qb := quotas.Bucket(name)
+		if k, _ := qb.Cursor().Seek(prefix); !bytes.Equal(k, prefix) {
+			return nil
+		}
+
+		if err := qb.Delete(prefix); err != nil {
+			return fmt.Errorf("unable to delete value in Bolt DB: %w", err)
+		}
+
+		return qb.SetSequence(qb.Sequence() - 1)
+	})
+}
+
+// removeExpired removes the updates stored before the given time.
+func (t *BoltTransport) removeExpired(before time.Time) error {
+	err := t.db.Update(func(tx *bolt.Tx) error {
+		timestamps := tx.Bucket([]byte(t.bucketName + boltTimestampsBucketSuffix))
+		bucket := tx.Bucket([]byte(t.bucketName))
+
+		if timestamps == nil || bucket == nil {
+			return nil
+		}
+
+		var seq uint64
+
+		c := timestamps.Cursor()
+		for k, v := c.First(); k != nil && bytes.Compare(k, boltTimestamp(before)) < 0; k, v = c.First() {
+			seq = max(seq, binary.BigEndian.Uint64(v))
+
+			if err := c.Delete(); err != nil {
+				return fmt.Errorf("unable to delete value in Bolt DB: %w", err)
+			}
+		}
+
+		return t.removeUntil(tx, bucket, seq)
+	})
+	if err != nil {
+		return fmt.Errorf("bolt error: %w", err)
+	}
+
+	return nil
+}
+
+// sweep periodically removes the updates older than the maximum age and the
+// expired updates, until the transport is closed.
+func (t *BoltTransport) sweep() {
+	defer close(t.sweeperDone)
+
+	interval := boltMaxSweepInterval
+	if t.maxAge > 0 {
+		interval = min(t.maxAge, interval)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.closed:
+			return
+		case <-ticker.C:
+		}
+
+		ctx := context.Background()
+		if t.maxAge > 0 {
+			if err := t.removeExpired(time.Now().Add(-t.maxAge)); err != nil && t.logger.Enabled(ctx, slog.LevelError) {
+				t.logger.LogAttrs(ctx, slog.LevelError, "Unable to remove expired updates from the Bolt DB", slog.Any("error", err))
+			}
+		}
+
+		if err := t.purgeExpiredNow(); err != nil && t.logger.Enabled(ctx, slog.LevelError) {
+			t.logger.LogAttrs(ctx, slog.LevelError, "Unable to purge expired updates from the Bolt DB", slog.Any("error", err))
+		}
+	}
+}
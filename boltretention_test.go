@@ -0,0 +1,190 @@
+package mercure
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func dispatchBoltUpdates(t *testing.T, transport *BoltTransport, topic string, ids ...string) {
+	t.Helper()
+
+	for _, id := range ids {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: id}, Topics: []string{topic}}))
+	}
+}
+
+func TestBoltTransportRemoveExpired(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0, WithBoltMaxAge(time.Hour))
+
+	dispatchBoltUpdates(t, transport, "https://example.com/foo", "1", "2")
+
+	before := time.Now()
+
+	dispatchBoltUpdates(t, transport, "https://example.com/foo", "3")
+
+	require.NoError(t, transport.removeExpired(before))
+	assert.Equal(t, []string{"3"}, historyIDs(t, transport))
+
+	require.NoError(t, transport.removeExpired(time.Now()))
+	assert.Empty(t, historyIDs(t, transport))
+}
+
+func TestBoltTransportMaxAgeSweeper(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0, WithBoltMaxAge(50*time.Millisecond))
+
+	dispatchBoltUpdates(t, transport, "https://example.com/foo", "1", "2")
+
+	require.Eventually(t, func() bool {
+		return len(historyIDs(t, transport)) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// Updates stored before the maximum age is set are considered as stored when
+// the transport is opened.
+func TestBoltTransportMaxAgeExistingHistory(t *testing.T) {
+	t.Parallel()
+
+	path := "test-" + t.Name() + ".db"
+
+	transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), path, "", 0, 0)
+	require.NoError(t, err)
+	dispatchBoltUpdates(t, transport, "https://example.com/foo", "1", "2")
+	require.NoError(t, transport.Close(t.Context()))
+
+	before := time.Now()
+
+	transport, err = NewBoltTransport(NewSubscriberList(0), slog.Default(), path, "", 0, 0, WithBoltMaxAge(time.Hour))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Close(t.Context()))
+		require.NoError(t, os.Remove(path))
+	})
+
+	require.NoError(t, transport.removeExpired(before))
+	assert.Equal(t, []string{"1", "2"}, historyIDs(t, transport))
+
+	require.NoError(t, transport.removeExpired(time.Now()))
+	assert.Empty(t, historyIDs(t, transport))
+}
+
+func TestBoltTransportTopicQuotas(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0, WithBoltTopicQuotas(
+		BoltTopicQuota{Matcher: TopicMatcher{Type: MatcherTypeExact, Pattern: "https://example.com/chatty"}, Size: 2},
+		BoltTopicQuota{Matcher: TopicMatcher{Type: MatcherTypeURLPattern, Pattern: "https://example.com/rooms/:id"}, Size: 3},
+	))
+
+	dispatchBoltUpdates(t, transport, "https://example.com/quiet", "q1")
+	dispatchBoltUpdates(t, transport, "https://example.com/chatty", "c1", "c2")
+	dispatchBoltUpdates(t, transport, "https://example.com/rooms/1", "r1", "r2")
+	dispatchBoltUpdates(t, transport, "https://example.com/chatty", "c3", "c4")
+	dispatchBoltUpdates(t, transport, "https://example.com/rooms/2", "r3", "r4")
+	dispatchBoltUpdates(t, transport, "https://example.com/quiet", "q2")
+
+	assert.Equal(t, []string{"q1", "r2", "c3", "c4", "r3", "r4", "q2"}, historyIDs(t, transport))
+
+	require.NoError(t, transport.db.View(func(tx *bolt.Tx) error {
+		quotas := tx.Bucket([]byte(defaultBoltBucketName + boltQuotasBucketSuffix))
+
+		assert.Equal(t, uint64(2), quotas.Bucket([]byte("exact:https://example.com/chatty")).Sequence())
+		assert.Equal(t, uint64(3), quotas.Bucket([]byte("urlpattern:https://example.com/rooms/:id")).Sequence())
+
+		return nil
+	}))
+
+	s := NewLocalSubscriber(EarliestLastEventID, transport.logger, &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/chatty"}}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	assert.Equal(t, "c3", (<-s.Receive()).ID)
+	assert.Equal(t, "c4", (<-s.Receive()).ID)
+}
+
+// Updates removed because of the global size limit or of the maximum age are
+// not counted anymore in the topic quotas.
+func TestBoltTransportTopicQuotasUntrackRemovedUpdates(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 3, 1, WithBoltMaxAge(time.Hour), WithBoltTopicQuotas(
+		BoltTopicQuota{Matcher: TopicMatcher{Type: MatcherTypeExact, Pattern: "*"}, Size: 10},
+	))
+
+	dispatchBoltUpdates(t, transport, "https://example.com/foo", "1", "2", "3", "4", "5")
+	assert.Equal(t, []string{"3", "4", "5"}, historyIDs(t, transport))
+
+	sequence := func() (seq uint64) {
+		require.NoError(t, transport.db.View(func(tx *bolt.Tx) error {
+			qb := tx.Bucket([]byte(defaultBoltBucketName + boltQuotasBucketSuffix)).Bucket([]byte("exact:*"))
+			seq = qb.Sequence()
+			assert.Equal(t, int(seq), qb.Stats().KeyN)
+
+			return nil
+		}))
+
+		return seq
+	}
+
+	assert.Equal(t, uint64(3), sequence())
+
+	require.NoError(t, transport.removeExpired(time.Now()))
+	assert.Equal(t, uint64(0), sequence())
+}
+
+func TestBoltTransportStaleTopicQuotasAreRemoved(t *testing.T) {
+	t.Parallel()
+
+	path := "test-" + t.Name() + ".db"
+	foo := BoltTopicQuota{Matcher: TopicMatcher{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}, Size: 1}
+	bar := BoltTopicQuota{Matcher: TopicMatcher{Type: MatcherTypeExact, Pattern: "https://example.com/bar"}, Size: 1}
+
+	transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), path, "", 0, 0, WithBoltTopicQuotas(foo, bar))
+	require.NoError(t, err)
+	require.NoError(t, transport.Close(t.Context()))
+
+	transport, err = NewBoltTransport(NewSubscriberList(0), slog.Default(), path, "", 0, 0, WithBoltTopicQuotas(bar))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Close(t.Context()))
+		require.NoError(t, os.Remove(path))
+	})
+
+	require.NoError(t, transport.db.View(func(tx *bolt.Tx) error {
+		quotas := tx.Bucket([]byte(defaultBoltBucketName + boltQuotasBucketSuffix))
+
+		assert.Nil(t, quotas.Bucket(foo.bucketName()))
+		assert.NotNil(t, quotas.Bucket(bar.bucketName()))
+
+		return nil
+	}))
+}
+
+func TestBoltTransportInvalidTopicQuota(t *testing.T) {
+	t.Parallel()
+
+	for i, q := range []BoltTopicQuota{
+		{Matcher: TopicMatcher{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}},
+		{Matcher: TopicMatcher{Type: "unknown", Pattern: "https://example.com/foo"}, Size: 1},
+	} {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "bolt.db"), "", 0, 0, WithBoltTopicQuotas(q))
+			require.ErrorIs(t, err, ErrInvalidBoltTopicQuota)
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/gob"
 	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
@@ -15,11 +16,44 @@ func init() { //nolint:gochecknoinits
 	caddy.RegisterModule(&Bolt{})
 }
 
+// BoltTopicQuota caps the number of updates kept in the history for the topics matching a pattern.
+type BoltTopicQuota struct {
+	// The matcher type of the pattern: "exact" (default) or "urlpattern".
+	MatchType string `json:"match_type,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+	Size      uint64 `json:"size,omitempty"`
+}
+
+// BoltCompaction keeps only the newest updates of each topic matching a pattern.
+type BoltCompaction struct {
+	// The matcher type of the pattern: "exact" (default) or "urlpattern".
+	MatchType string `json:"match_type,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+	Keep      uint64 `json:"keep,omitempty"`
+}
+
 type Bolt struct {
 	Path             string  `json:"path,omitempty"`
 	BucketName       string  `json:"bucket_name,omitempty"`
 	Size             uint64  `json:"size,omitempty"`
 	CleanupFrequency float64 `json:"cleanup_frequency,omitempty"`
+	// Updates older than this duration are removed from the history.
+	MaxAge      caddy.Duration   `json:"max_age,omitempty"`
+	TopicQuotas []BoltTopicQuota `json:"topic_quotas,omitempty"`
+	// Concurrent publications are persisted in a single transaction, waiting up to this delay for the group to fill.
+	GroupCommitDelay caddy.Duration `json:"group_commit_delay,omitempty"`
+	// The maximum number of publications persisted in a single transaction.
+	GroupCommitSize int `json:"group_commit_size,omitempty"`
+	// The number of workers dispatching each update to the subscribers in parallel.
+	DispatchShards int `json:"dispatch_shards,omitempty"`
+	// Send the latest update of each topic to new subscribers connecting without a Last-Event-ID.
+	LastValueCache bool `json:"last_value_cache,omitempty"`
+	// Only the newest updates of each topic matching these patterns are kept in the history.
+	Compactions []BoltCompaction `json:"compactions,omitempty"`
+	// The delay between two compactions of the history, defaults to 1m.
+	CompactionInterval caddy.Duration `json:"compaction_interval,omitempty"`
+	// A publication reusing an idempotency key or ID during this duration is a replay and isn't stored nor dispatched again.
+	DeduplicationWindow caddy.Duration `json:"deduplication_window,omitempty"`
 
 	transport    *mercure.BoltTransport
 	transportKey string
@@ -52,6 +86,50 @@ func (b *Bolt) Provision(ctx caddy.Context) error {
 
 	b.transportKey = key.String()
 
+	quotas := make([]mercure.BoltTopicQuota, 0, len(b.TopicQuotas))
+	for _, q := range b.TopicQuotas {
+		matchType := mercure.MatcherTypeExact
+		if q.MatchType != "" {
+			matchType = mercure.MatcherType(q.MatchType)
+		}
+
+		quotas = append(quotas, mercure.BoltTopicQuota{Matcher: mercure.TopicMatcher{Type: matchType, Pattern: q.Pattern}, Size: q.Size})
+	}
+
+	options := []mercure.BoltOption{
+		mercure.WithBoltMaxAge(time.Duration(b.MaxAge)),
+		mercure.WithBoltTopicQuotas(quotas...),
+	}
+	if b.GroupCommitSize > 0 {
+		options = append(options, mercure.WithBoltGroupCommit(time.Duration(b.GroupCommitDelay), b.GroupCommitSize))
+	}
+
+	if b.DispatchShards > 0 {
+		options = append(options, mercure.WithBoltDispatchShards(b.DispatchShards))
+	}
+
+	if b.LastValueCache {
+		options = append(options, mercure.WithBoltLastValueCache())
+	}
+
+	if len(b.Compactions) > 0 {
+		compactions := make([]mercure.BoltCompaction, 0, len(b.Compactions))
+		for _, c := range b.Compactions {
+			matchType := mercure.MatcherTypeExact
+			if c.MatchType != "" {
+				matchType = mercure.MatcherType(c.MatchType)
+			}
+
+			compactions = append(compactions, mercure.BoltCompaction{Matcher: mercure.TopicMatcher{Type: matchType, Pattern: c.Pattern}, Keep: c.Keep})
+		}
+
+		options = append(options, mercure.WithBoltCompaction(time.Duration(b.CompactionInterval), compactions...))
+	}
+
+	if b.DeduplicationWindow > 0 {
+		options = append(options, mercure.WithBoltDeduplicationWindow(time.Duration(b.DeduplicationWindow)))
+	}
+
 	destructor, _, err := TransportUsagePool.LoadOrNew(b.transportKey, func() (caddy.Destructor, error) {
 		t, err := mercure.NewBoltTransport(
 			mercure.NewSubscriberList(ctx.Value(SubscriberListCacheSizeContextKey).(int)),
@@ -60,6 +138,7 @@ func (b *Bolt) Provision(ctx caddy.Context) error {
 			b.BucketName,
 			b.Size,
 			b.CleanupFrequency,
+			options...,
 		)
 		if err != nil {
 			return nil, err
@@ -127,6 +206,128 @@ func (b *Bolt) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 				}
 
 				b.Size = s
+
+			case "max_age":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, e := caddy.ParseDuration(d.Val())
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				b.MaxAge = caddy.Duration(v)
+
+			case "topic_quota", "topic_quota_urlpattern":
+				q := BoltTopicQuota{}
+				if d.Val() == "topic_quota_urlpattern" {
+					q.MatchType = string(mercure.MatcherTypeURLPattern)
+				}
+
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				q.Pattern = d.Val()
+
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				s, e := strconv.ParseUint(d.Val(), 10, 64)
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				q.Size = s
+				b.TopicQuotas = append(b.TopicQuotas, q)
+
+			case "group_commit":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, e := caddy.ParseDuration(d.Val())
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				b.GroupCommitDelay = caddy.Duration(v)
+
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				s, e := strconv.Atoi(d.Val())
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				b.GroupCommitSize = s
+
+			case "dispatch_shards":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				s, e := strconv.Atoi(d.Val())
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				b.DispatchShards = s
+
+			case "last_value_cache":
+				b.LastValueCache = true
+
+			case "compaction", "compaction_urlpattern":
+				c := BoltCompaction{}
+				if d.Val() == "compaction_urlpattern" {
+					c.MatchType = string(mercure.MatcherTypeURLPattern)
+				}
+
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				c.Pattern = d.Val()
+
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				k, e := strconv.ParseUint(d.Val(), 10, 64)
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				c.Keep = k
+				b.Compactions = append(b.Compactions, c)
+
+			case "compaction_interval":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, e := caddy.ParseDuration(d.Val())
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				b.CompactionInterval = caddy.Duration(v)
+
+			case "deduplication_window":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, e := caddy.ParseDuration(d.Val())
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				b.DeduplicationWindow = caddy.Duration(v)
 			}
 		}
 	}
@@ -108,6 +108,13 @@ func TestMercure(t *testing.T) {
 			path ` + boltPath + `
 		}`},
 		{"local", "transport local\n"},
+		{"mesh", `transport mesh {
+				secret !ChangeMeMesh!
+				transport local
+			}`},
+		{"sqlite", `transport sqlite {
+			path ` + filepath.Join(t.TempDir(), "mercure.sqlite") + `
+		}`},
 	}
 
 	for _, d := range data {
@@ -693,6 +700,16 @@ mercure {
 		bucket_name foo
 		size 20
 		cleanup_frequency 0.2
+		max_age 24h
+		topic_quota https://example.com/chatty 100
+		topic_quota_urlpattern https://example.com/rooms/:id 10
+		group_commit 2ms 128
+		dispatch_shards 8
+		last_value_cache
+		compaction https://example.com/status 5
+		compaction_urlpattern https://example.com/users/:id 1
+		compaction_interval 30s
+		deduplication_window 5m
 	}
 }
 `, "caddyfile", `{
@@ -714,9 +731,336 @@ mercure {
 									"transport": {
 										"bucket_name": "foo",
 										"cleanup_frequency": 0.2,
+										"compaction_interval": 30000000000,
+										"compactions": [
+											{
+												"keep": 5,
+												"pattern": "https://example.com/status"
+											},
+											{
+												"keep": 1,
+												"match_type": "urlpattern",
+												"pattern": "https://example.com/users/:id"
+											}
+										],
+										"deduplication_window": 300000000000,
+										"dispatch_shards": 8,
+										"group_commit_delay": 2000000,
+										"group_commit_size": 128,
+										"last_value_cache": true,
+										"max_age": 86400000000000,
 										"name": "bolt",
 										"path": "test.db",
-										"size": 20
+										"size": 20,
+										"topic_quotas": [
+											{
+												"pattern": "https://example.com/chatty",
+												"size": 100
+											},
+											{
+												"match_type": "urlpattern",
+												"pattern": "https://example.com/rooms/:id",
+												"size": 10
+											}
+										]
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptPostgresConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	transport postgres {
+		dsn {env.DATABASE_URL}
+		table foo
+		size 20
+		cleanup_frequency 0.2
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"transport": {
+										"cleanup_frequency": 0.2,
+										"dsn": "{env.DATABASE_URL}",
+										"name": "postgres",
+										"size": 20,
+										"table": "foo"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptRedisConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	transport redis {
+		url {env.REDIS_URL}
+		stream foo
+		size 20
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"transport": {
+										"name": "redis",
+										"size": 20,
+										"stream": "foo",
+										"url": "{env.REDIS_URL}"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptNatsConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	transport nats {
+		url nats://localhost:4222
+		stream foo
+		size 20
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"transport": {
+										"name": "nats",
+										"size": 20,
+										"stream": "foo",
+										"url": "nats://localhost:4222"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptRelayConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	transport relay {
+		upstream https://hub.example.com/.well-known/mercure
+		subscriber_jwt subscriber-token
+		publisher_jwt publisher-token
+		match https://example.com/foo
+		match_urlpattern https://example.com/books/:id
+		reconnect_delay 5s
+		history_size 1000
+		history_max_age 1m
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"transport": {
+										"history_max_age": 60000000000,
+										"history_size": 1000,
+										"name": "relay",
+										"publisher_jwt": "publisher-token",
+										"reconnect_delay": 5000000000,
+										"subscriber_jwt": "subscriber-token",
+										"topics": [
+											{
+												"pattern": "https://example.com/foo"
+											},
+											{
+												"match_type": "urlpattern",
+												"pattern": "https://example.com/books/:id"
+											}
+										],
+										"upstream": "https://hub.example.com/.well-known/mercure"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptMeshConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	transport mesh {
+		peers https://node2.example.com/.well-known/mercure https://node3.example.com/.well-known/mercure
+		secret {env.MERCURE_MESH_SECRET}
+		timeout 10s
+		queue_size 100
+		transport local {
+			history_size 1000
+		}
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"transport": {
+										"name": "mesh",
+										"peers": [
+											"https://node2.example.com/.well-known/mercure",
+											"https://node3.example.com/.well-known/mercure"
+										],
+										"secret": "{env.MERCURE_MESH_SECRET}",
+										"timeout": 10000000000,
+										"queue_size": 100,
+										"transport": {
+											"history_size": 1000,
+											"name": "local"
+										}
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptSQLiteConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	transport sqlite {
+		path /data/mercure.sqlite
+		size 1000
+		max_age 1h
+		import_bolt /data/mercure.db updates
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"transport": {
+										"import_bolt": "/data/mercure.db",
+										"import_bolt_bucket_name": "updates",
+										"max_age": 3600000000000,
+										"name": "sqlite",
+										"path": "/data/mercure.sqlite",
+										"size": 1000
 									}
 								}
 							]
@@ -766,6 +1110,55 @@ mercure {
 }`)
 }
 
+func TestAdaptLocalHistoryConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	transport local {
+		history_size 1000
+		history_max_age 30s
+		dispatch_shards 4
+		last_value_cache 100
+		deduplication_window 1m
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"transport": {
+										"deduplication_window": 60000000000,
+										"dispatch_shards": 4,
+										"history_max_age": 30000000000,
+										"history_size": 1000,
+										"last_value_cache": true,
+										"last_value_cache_size": 100,
+										"name": "local"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
 func TestNewJWKSetKeyfunc(t *testing.T) {
 	jwksPath, err := filepath.Abs("testdata/RS256.jwks.json")
 	require.NoError(t, err)
@@ -951,10 +1344,14 @@ func TestUnmarshalCaddyfileAcceptsKnownDirectives(t *testing.T) {
 		playground
 		debugger
 		subscriptions
+		websocket
 		write_timeout 1m
 		dispatch_timeout 5s
 		heartbeat 40s
+		poll_timeout 20s
 		max_request_body_size 1MB
+		slow_subscriber_policy drop_oldest
+		subscriber_buffer_size 100
 		cookie_name mercure_access_token
 		cors_origins *
 		publish_origins *
@@ -977,7 +1374,11 @@ func TestUnmarshalCaddyfileAcceptsKnownDirectives(t *testing.T) {
 	m := new(Mercure)
 	require.NoError(t, m.UnmarshalCaddyfile(d))
 	assert.True(t, m.Anonymous)
+	assert.True(t, m.WebSocket)
+	assert.Equal(t, caddy.Duration(20*time.Second), *m.PollTimeout)
 	assert.Equal(t, []string{"*"}, m.CORSOrigins)
+	assert.Equal(t, "drop_oldest", m.SlowSubscriberPolicy)
+	assert.Equal(t, 100, *m.SubscriberBufferSize)
 	assert.Len(t, m.Issuers, 1)
 }
 
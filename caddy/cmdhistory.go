@@ -0,0 +1,216 @@
+package caddy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+
+	caddycmd "github.com/caddyserver/caddy/v2/cmd"
+	"github.com/dunglas/mercure"
+	"github.com/spf13/cobra"
+)
+
+var errMissingHistoryFlag = errors.New("missing required flag")
+
+func init() { //nolint:gochecknoinits
+	caddycmd.RegisterCommand(caddycmd.Command{
+		Name:  "mercure-history",
+		Usage: "export|import|backup",
+		Short: "Export, import or back up the history of the Bolt transport",
+		Long: `
+Moves the history stored by the Bolt transport between databases, bucket
+names and hosts, and backs it up without stopping the hub.
+
+"export" writes the history as JSON Lines, one update per line, oldest
+first. With --db, it reads the database file directly; the file must not be
+held by a running hub. Otherwise, it asks the running hub through the admin
+API.
+
+"import" reads history exported as JSON Lines and stores it, re-sequenced,
+in the given bucket of the database file, which is created if needed. The
+bucket must not contain any update. The hub using the database must be
+stopped.
+
+"backup" asks the running hub, through the admin API, for a consistent copy
+of its whole Bolt database. The copy can be used as is by the Bolt transport.
+
+The admin API address is determined as for "caddy stop": from --address,
+from the admin settings of the config given by --config and --adapter, or
+the default address. If several hubs are configured, --hub selects one by
+name.
+
+Example:
+
+  caddy mercure-history export --db /data/mercure.db > history.jsonl
+
+  caddy mercure-history import --db /data/new.db --bucket updates < history.jsonl
+
+  caddy mercure-history backup --output mercure-backup.db
+`,
+		CobraFunc: func(cmd *cobra.Command) {
+			exportCmd := &cobra.Command{
+				Use:   "export [--db <path> [--bucket <name>] | --address <admin>] [--hub <name>] [--output <file>]",
+				Short: "Write the history as JSON Lines",
+				RunE:  caddycmd.WrapCommandFuncForCobra(cmdMercureHistoryExport),
+			}
+			exportCmd.Flags().String("db", "", "path of the Bolt database to read directly, instead of asking the running hub")
+			exportCmd.Flags().String("bucket", "", "name of the Bolt bucket storing the history (default: updates), with --db")
+			exportCmd.Flags().String("output", "-", "file to write the history to, - for stdout")
+			addAdminFlags(exportCmd)
+
+			importCmd := &cobra.Command{
+				Use:   "import --db <path> [--bucket <name>] [--input <file>]",
+				Short: "Store history read as JSON Lines in a Bolt database",
+				RunE:  caddycmd.WrapCommandFuncForCobra(cmdMercureHistoryImport),
+			}
+			importCmd.Flags().String("db", "", "path of the Bolt database to import the history to")
+			importCmd.Flags().String("bucket", "", "name of the Bolt bucket to store the history in (default: updates)")
+			importCmd.Flags().String("input", "-", "file to read the history from, - for stdin")
+
+			backupCmd := &cobra.Command{
+				Use:   "backup --output <file> [--address <admin>] [--hub <name>]",
+				Short: "Copy the Bolt database of the running hub",
+				RunE:  caddycmd.WrapCommandFuncForCobra(cmdMercureHistoryBackup),
+			}
+			backupCmd.Flags().String("output", "", "file to write the backup to")
+			addAdminFlags(backupCmd)
+
+			cmd.AddCommand(exportCmd, importCmd, backupCmd)
+		},
+	})
+}
+
+func addAdminFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("config", "c", "", "configuration file to read the admin API address from")
+	cmd.Flags().StringP("adapter", "a", "", "name of config adapter to apply")
+	cmd.Flags().String("address", "", "the address of Caddy's admin API")
+	cmd.Flags().String("hub", "", "name of the hub, required if several hubs are configured")
+}
+
+func cmdMercureHistoryExport(fl caddycmd.Flags) (int, error) {
+	out, closeOut, err := createOutput(fl.String("output"))
+	if err != nil {
+		return 1, err
+	}
+
+	if path := fl.String("db"); path != "" {
+		n, err := mercure.ExportBolt(context.Background(), path, fl.String("bucket"), out)
+		if err := closeOut(err); err != nil {
+			return 1, err
+		}
+
+		fmt.Fprintf(os.Stderr, "%d updates exported\n", n)
+
+		return 0, nil
+	}
+
+	err = adminHistoryRequest(fl, "export", out)
+	if err := closeOut(err); err != nil {
+		return 1, err
+	}
+
+	return 0, nil
+}
+
+func cmdMercureHistoryImport(fl caddycmd.Flags) (int, error) {
+	path := fl.String("db")
+	if path == "" {
+		return 1, fmt.Errorf("%w: --db is required", errMissingHistoryFlag)
+	}
+
+	in := io.Reader(os.Stdin)
+
+	if input := fl.String("input"); input != "-" {
+		f, err := os.Open(input)
+		if err != nil {
+			return 1, fmt.Errorf("unable to open %q: %w", input, err)
+		}
+		defer f.Close()
+
+		in = f
+	}
+
+	transport, err := mercure.NewBoltTransport(mercure.NewSubscriberList(0), slog.Default(), path, fl.String("bucket"), 0, 0)
+	if err != nil {
+		return 1, err
+	}
+
+	n, err := transport.Import(context.Background(), in)
+	if err := errors.Join(err, transport.Close(context.Background())); err != nil {
+		return 1, err
+	}
+
+	fmt.Fprintf(os.Stderr, "%d updates imported\n", n)
+
+	return 0, nil
+}
+
+func cmdMercureHistoryBackup(fl caddycmd.Flags) (int, error) {
+	output := fl.String("output")
+	if output == "" || output == "-" {
+		return 1, fmt.Errorf("%w: --output is required", errMissingHistoryFlag)
+	}
+
+	out, closeOut, err := createOutput(output)
+	if err != nil {
+		return 1, err
+	}
+
+	err = adminHistoryRequest(fl, "backup", out)
+	if err := closeOut(err); err != nil {
+		return 1, err
+	}
+
+	return 0, nil
+}
+
+// createOutput opens the file to write to, - being stdout. The returned
+// function closes it, and removes it if the write failed.
+func createOutput(output string) (io.Writer, func(error) error, error) {
+	if output == "-" {
+		return os.Stdout, func(err error) error { return err }, nil
+	}
+
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create %q: %w", output, err)
+	}
+
+	return f, func(err error) error {
+		if err = errors.Join(err, f.Close()); err != nil {
+			_ = os.Remove(output)
+		}
+
+		return err
+	}, nil
+}
+
+// adminHistoryRequest copies the response of the history admin endpoint to out.
+func adminHistoryRequest(fl caddycmd.Flags, action string, out io.Writer) error {
+	addr, err := caddycmd.DetermineAdminAPIAddress(fl.String("address"), nil, fl.String("config"), fl.String("adapter"))
+	if err != nil {
+		return fmt.Errorf("couldn't determine admin API address: %w", err)
+	}
+
+	uri := "/mercure/history/" + action
+	if hub := fl.String("hub"); hub != "" {
+		uri = "/mercure/history/" + url.PathEscape(hub) + "/" + action
+	}
+
+	resp, err := caddycmd.AdminAPIRequest(addr, http.MethodGet, uri, nil, nil)
+	if err != nil {
+		return fmt.Errorf("unable to %s the history: %w", action, err)
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return fmt.Errorf("unable to %s the history: %w", action, err)
+	}
+
+	return nil
+}
@@ -127,7 +127,7 @@ func (h *Health) checkTransports(r *http.Request, checkType, hubName string) err
 
 		matched = true
 
-		checker, ok := info.transport.(mercure.TransportHealthChecker)
+		checker, ok := mercure.TransportAs[mercure.TransportHealthChecker](info.transport)
 		if !ok {
 			continue
 		}
@@ -0,0 +1,161 @@
+package caddy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/dunglas/mercure"
+)
+
+const (
+	historyBackup = "backup"
+	historyExport = "export"
+)
+
+var (
+	errUnknownHistoryPath = errors.New("unknown history endpoint")
+	errNoHistoryTransport = errors.New("the transport doesn't support history backups")
+	errAmbiguousHub       = errors.New("several hubs match, a unique hub name is required")
+)
+
+func init() { //nolint:gochecknoinits
+	caddy.RegisterModule(&History{})
+}
+
+// historyBackuper is implemented by the transports able to back up their whole database.
+type historyBackuper interface {
+	Backup(w io.Writer) (int64, error)
+	Export(ctx context.Context, w io.Writer) (int, error)
+}
+
+// History is a Caddy admin API module that exposes endpoints to back up
+// and export the history of running hubs.
+type History struct{}
+
+// CaddyModule returns the Caddy module information.
+func (*History) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "admin.api.mercure_history",
+		New: func() caddy.Module { return new(History) },
+	}
+}
+
+// Routes returns the admin routes for the history module.
+func (h *History) Routes() []caddy.AdminRoute {
+	return []caddy.AdminRoute{
+		{
+			Pattern: "/mercure/history/",
+			Handler: caddy.AdminHandlerFunc(h.handleHistory),
+		},
+	}
+}
+
+func (h *History) handleHistory(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        errMethodNotAllowed,
+		}
+	}
+
+	action, hubName, err := parseHistoryPath(r.URL.Path)
+	if err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusNotFound,
+			Err:        err,
+		}
+	}
+
+	b, err := h.findBackuper(hubName)
+	switch {
+	case errors.Is(err, errHubNotFound):
+		return caddy.APIError{
+			HTTPStatus: http.StatusNotFound,
+			Err:        err,
+		}
+	case err != nil:
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        err,
+		}
+	}
+
+	if action == historyBackup {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="mercure.db"`)
+
+		_, err = b.Backup(w)
+	} else {
+		w.Header().Set("Content-Type", "application/jsonl")
+
+		_, err = b.Export(r.Context(), w)
+	}
+
+	if err != nil {
+		caddy.Log().Named("admin.api.mercure_history").Error(
+			fmt.Sprintf("history %s failed for hub=%q: %v", action, hubName, err),
+		)
+
+		// The response has already been partially sent: abort it, so the
+		// client doesn't mistake a truncated backup for a complete one.
+		panic(http.ErrAbortHandler)
+	}
+
+	return nil
+}
+
+func parseHistoryPath(urlPath string) (action, hubName string, err error) {
+	path := strings.TrimPrefix(urlPath, "/mercure/history/")
+	path = strings.TrimSuffix(path, "/")
+
+	for _, a := range []string{historyBackup, historyExport} {
+		switch {
+		case path == a:
+			return a, "", nil
+		case strings.HasSuffix(path, "/"+a):
+			return a, strings.TrimSuffix(path, "/"+a), nil
+		}
+	}
+
+	return "", "", errUnknownHistoryPath
+}
+
+// findBackuper returns the transport of the hub with the given name, or of
+// the only configured hub if the name is empty.
+func (h *History) findBackuper(hubName string) (historyBackuper, error) { //nolint:ireturn
+	hubsMu.Lock()
+	defer hubsMu.Unlock()
+
+	var found *hubInfo
+
+	for _, info := range hubs {
+		if hubName != "" && info.name != hubName {
+			continue
+		}
+
+		if found != nil && found.transport != info.transport {
+			return nil, errAmbiguousHub
+		}
+
+		found = info
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("%w: %q", errHubNotFound, hubName)
+	}
+
+	b, ok := mercure.TransportAs[historyBackuper](found.transport)
+	if !ok {
+		return nil, fmt.Errorf("%w: hub %q", errNoHistoryTransport, found.name)
+	}
+
+	return b, nil
+}
+
+// Interface guards.
+var _ caddy.AdminRouter = (*History)(nil)
@@ -0,0 +1,174 @@
+package caddy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddytest"
+	caddycmd "github.com/caddyserver/caddy/v2/cmd"
+	"github.com/dunglas/mercure"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func initHistoryServer(t *testing.T, transportConfig string) *caddytest.Tester {
+	t.Helper()
+
+	tester := caddytest.NewTester(t)
+	tester.InitServer(`{
+	skip_install_trust
+	admin localhost:2999
+	http_port     9080
+	https_port    9443
+}
+
+localhost:9080 {
+	route {
+		mercure {
+			anonymous
+			issuer https://example.com {
+				publisher {
+					jwt !ChangeMe!
+				}
+			}
+			resource_identifier https://example.com/.well-known/mercure
+			`+transportConfig+`
+		}
+
+		respond 404
+	}
+}`, "caddyfile")
+
+	return tester
+}
+
+func runHistoryCommand(t *testing.T, name string, flags map[string]string) {
+	t.Helper()
+
+	root := &cobra.Command{}
+	caddycmd.Commands()["mercure-history"].CobraFunc(root)
+
+	for _, cmd := range root.Commands() {
+		if cmd.Name() != name {
+			continue
+		}
+
+		for k, v := range flags {
+			require.NoError(t, cmd.Flags().Set(k, v))
+		}
+
+		require.NoError(t, cmd.RunE(cmd, nil))
+
+		return
+	}
+
+	t.Fatalf("unknown command %q", name)
+}
+
+func exportedIDs(t *testing.T, path, bucketName string) []string {
+	t.Helper()
+
+	var export bytes.Buffer
+
+	_, err := mercure.ExportBolt(t.Context(), path, bucketName, &export)
+	require.NoError(t, err)
+
+	return jsonLinesIDs(t, export.String())
+}
+
+func jsonLinesIDs(t *testing.T, jsonLines string) []string {
+	t.Helper()
+
+	var ids []string
+
+	for line := range strings.Lines(jsonLines) {
+		var u mercure.Update
+
+		require.NoError(t, json.Unmarshal([]byte(line), &u))
+
+		ids = append(ids, u.ID)
+	}
+
+	return ids
+}
+
+func TestHistoryEndpoints(t *testing.T) {
+	dir := t.TempDir()
+	tester := initHistoryServer(t, "transport bolt {\n\t\t\t\tpath "+filepath.Join(dir, "bolt.db")+"\n\t\t\t}")
+
+	for _, id := range []string{"1", "2"} {
+		body := url.Values{"topic": {"https://example.com/foo"}, "data": {"bar"}, "id": {id}}
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:9080/.well-known/mercure", strings.NewReader(body.Encode()))
+		require.NoError(t, err)
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", bearerPrefix+publisherJWT)
+
+		resp := tester.AssertResponseCode(req, http.StatusOK)
+		require.NoError(t, resp.Body.Close())
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:2999/mercure/history/export", nil)
+	require.NoError(t, err)
+
+	resp := tester.AssertResponseCode(req, http.StatusOK)
+	export, err := io.ReadAll(resp.Body)
+	require.NoError(t, resp.Body.Close())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"1", "2"}, jsonLinesIDs(t, string(export)))
+
+	req, err = http.NewRequest(http.MethodGet, "http://localhost:2999/mercure/history/default/backup", nil)
+	require.NoError(t, err)
+
+	resp = tester.AssertResponseCode(req, http.StatusOK)
+	backup, err := io.ReadAll(resp.Body)
+	require.NoError(t, resp.Body.Close())
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "backup.db"), backup, 0o600))
+	assert.Equal(t, []string{"1", "2"}, exportedIDs(t, filepath.Join(dir, "backup.db"), ""))
+
+	req, err = http.NewRequest(http.MethodGet, "http://localhost:2999/mercure/history/unknown/backup", nil)
+	require.NoError(t, err)
+
+	resp = tester.AssertResponseCode(req, http.StatusNotFound)
+	require.NoError(t, resp.Body.Close())
+
+	t.Run("command", func(t *testing.T) {
+		runHistoryCommand(t, "backup", map[string]string{"address": "localhost:2999", "output": filepath.Join(dir, "cmd-backup.db")})
+		assert.Equal(t, []string{"1", "2"}, exportedIDs(t, filepath.Join(dir, "cmd-backup.db"), ""))
+
+		runHistoryCommand(t, "export", map[string]string{"address": "localhost:2999", "hub": "default", "output": filepath.Join(dir, "history.jsonl")})
+		runHistoryCommand(t, "import", map[string]string{"db": filepath.Join(dir, "moved.db"), "bucket": "moved", "input": filepath.Join(dir, "history.jsonl")})
+		assert.Equal(t, []string{"1", "2"}, exportedIDs(t, filepath.Join(dir, "moved.db"), "moved"))
+
+		runHistoryCommand(t, "export", map[string]string{"db": filepath.Join(dir, "moved.db"), "bucket": "moved", "output": filepath.Join(dir, "moved.jsonl")})
+		moved, err := os.ReadFile(filepath.Join(dir, "moved.jsonl"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"1", "2"}, jsonLinesIDs(t, string(moved)))
+	})
+}
+
+func TestHistoryEndpointUnsupportedTransport(t *testing.T) {
+	tester := initHistoryServer(t, "transport local")
+
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:2999/mercure/history/backup", nil)
+	require.NoError(t, err)
+
+	resp := tester.AssertResponseCode(req, http.StatusBadRequest)
+	require.NoError(t, resp.Body.Close())
+
+	req, err = http.NewRequest(http.MethodGet, "http://localhost:2999/mercure/history/restore", nil)
+	require.NoError(t, err)
+
+	resp = tester.AssertResponseCode(req, http.StatusNotFound)
+	require.NoError(t, resp.Body.Close())
+}
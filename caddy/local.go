@@ -1,21 +1,36 @@
 package caddy
 
 import (
+	"bytes"
+	"encoding/gob"
+	"strconv"
+	"time"
+
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 	"github.com/dunglas/mercure"
 )
 
-type localTransportKeyStruct struct{}
-
-var localTransportKey = localTransportKeyStruct{} //nolint:gochecknoglobals
-
 func init() { //nolint:gochecknoinits
 	caddy.RegisterModule(&Local{})
 }
 
 type Local struct {
-	transport *mercure.LocalTransport
+	// The number of updates to keep in memory, to replay them to reconnecting subscribers.
+	HistorySize uint64 `json:"history_size,omitempty"`
+	// The duration during which updates are kept in memory, to replay them to reconnecting subscribers.
+	HistoryMaxAge caddy.Duration `json:"history_max_age,omitempty"`
+	// The number of workers dispatching each update to the subscribers in parallel.
+	DispatchShards int `json:"dispatch_shards,omitempty"`
+	// Send the latest update of each topic to new subscribers connecting without a Last-Event-ID.
+	LastValueCache bool `json:"last_value_cache,omitempty"`
+	// The maximum number of topics of the last value cache. Defaults to 10000.
+	LastValueCacheSize int `json:"last_value_cache_size,omitempty"`
+	// A publication reusing an idempotency key or ID during this duration is a replay and isn't dispatched again.
+	DeduplicationWindow caddy.Duration `json:"deduplication_window,omitempty"`
+
+	transport    *mercure.LocalTransport
+	transportKey string
 }
 
 // CaddyModule returns the Caddy module information.
@@ -31,11 +46,34 @@ func (l *Local) GetTransport() mercure.Transport { //nolint:ireturn
 }
 
 // Provision provisions l's configuration.
+//
+//nolint:wrapcheck
 func (l *Local) Provision(ctx caddy.Context) error {
-	destructor, _, _ := TransportUsagePool.LoadOrNew(localTransportKey, func() (caddy.Destructor, error) {
+	var key bytes.Buffer
+	if err := gob.NewEncoder(&key).Encode(l); err != nil {
+		return err
+	}
+
+	l.transportKey = "local" + key.String()
+
+	options := []mercure.LocalOption{
+		mercure.WithLocalHistorySize(l.HistorySize),
+		mercure.WithLocalHistoryMaxAge(time.Duration(l.HistoryMaxAge)),
+		mercure.WithLocalDispatchShards(l.DispatchShards),
+		mercure.WithLocalDeduplicationWindow(time.Duration(l.DeduplicationWindow)),
+	}
+	switch {
+	case l.LastValueCache && l.LastValueCacheSize > 0:
+		options = append(options, mercure.WithLocalLastValueCacheSize(l.LastValueCacheSize))
+	case l.LastValueCache:
+		options = append(options, mercure.WithLocalLastValueCache())
+	}
+
+	destructor, _, _ := TransportUsagePool.LoadOrNew(l.transportKey, func() (caddy.Destructor, error) {
 		return TransportDestructor[*mercure.LocalTransport]{
 			Transport: mercure.NewLocalTransport(
 				mercure.NewSubscriberList(ctx.Value(SubscriberListCacheSizeContextKey).(int)),
+				options...,
 			),
 		}, nil
 	})
@@ -47,18 +85,86 @@ func (l *Local) Provision(ctx caddy.Context) error {
 
 //nolint:wrapcheck
 func (l *Local) Cleanup() error {
-	_, err := TransportUsagePool.Delete(localTransportKey)
+	_, err := TransportUsagePool.Delete(l.transportKey)
 
 	return err
 }
 
 // UnmarshalCaddyfile sets up the handler from Caddyfile tokens.
-func (l *Local) UnmarshalCaddyfile(_ *caddyfile.Dispenser) error {
+//
+//nolint:wrapcheck
+func (l *Local) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "history_size":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				s, e := strconv.ParseUint(d.Val(), 10, 64)
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				l.HistorySize = s
+
+			case "history_max_age":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, e := caddy.ParseDuration(d.Val())
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				l.HistoryMaxAge = caddy.Duration(v)
+
+			case "dispatch_shards":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				s, e := strconv.Atoi(d.Val())
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				l.DispatchShards = s
+
+			case "last_value_cache":
+				l.LastValueCache = true
+
+				if d.NextArg() {
+					s, e := strconv.Atoi(d.Val())
+					if e != nil {
+						return d.WrapErr(e)
+					}
+
+					l.LastValueCacheSize = s
+				}
+
+			case "deduplication_window":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, e := caddy.ParseDuration(d.Val())
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				l.DeduplicationWindow = caddy.Duration(v)
+			}
+		}
+	}
+
 	return nil
 }
 
 var (
-	_ caddy.Provisioner     = (*Bolt)(nil)
-	_ caddy.CleanerUpper    = (*Bolt)(nil)
-	_ caddyfile.Unmarshaler = (*Bolt)(nil)
+	_ caddy.Provisioner     = (*Local)(nil)
+	_ caddy.CleanerUpper    = (*Local)(nil)
+	_ caddyfile.Unmarshaler = (*Local)(nil)
 )
@@ -133,6 +133,9 @@ type Mercure struct {
 	// Dispatch updates when subscriptions are created or terminated
 	Subscriptions bool `json:"subscriptions,omitempty"`
 
+	// Accept WebSocket connections on the hub URL, alongside SSE.
+	WebSocket bool `json:"websocket,omitempty"`
+
 	// Enable the prod-safe debugger UI at /.well-known/mercure/debug/.
 	Debugger bool `json:"debugger,omitempty"`
 
@@ -149,11 +152,22 @@ type Mercure struct {
 	// Frequency of the heartbeat, defaults to 40s.
 	Heartbeat *caddy.Duration `json:"heartbeat,omitempty"`
 
+	// Maximum duration a long-polling subscriber waits for updates, defaults to 30s.
+	PollTimeout *caddy.Duration `json:"poll_timeout,omitempty"`
+
 	// Maximum size in bytes of publish and QUERY subscribe request bodies;
 	// larger requests are rejected with a 413 status code. Defaults to 1MiB,
 	// set to 0 to disable the in-hub limit.
 	MaxRequestBodySize *int64 `json:"max_request_body_size,omitempty"`
 
+	// What to do when a subscriber doesn't receive updates fast enough:
+	// "disconnect" (default), "drop_oldest" or "conflate".
+	SlowSubscriberPolicy string `json:"slow_subscriber_policy,omitempty"`
+
+	// Number of updates buffered for each subscriber before applying the slow
+	// subscriber policy, defaults to 1000.
+	SubscriberBufferSize *int `json:"subscriber_buffer_size,omitempty"`
+
 	// Issuers binds each trusted issuer (RFC 9068 §4) to its own verification
 	// material, so key material is never pooled across issuers.
 	Issuers []IssuerConfig `json:"issuers,omitempty"`
@@ -335,6 +349,10 @@ func (m *Mercure) Provision(ctx caddy.Context) (err error) { //nolint:funlen,goc
 		opts = append(opts, mercure.WithSubscriptions())
 	}
 
+	if m.WebSocket {
+		opts = append(opts, mercure.WithWebSocket())
+	}
+
 	if d := m.WriteTimeout; d != nil {
 		opts = append(opts, mercure.WithWriteTimeout(time.Duration(*d)))
 	}
@@ -347,10 +365,22 @@ func (m *Mercure) Provision(ctx caddy.Context) (err error) { //nolint:funlen,goc
 		opts = append(opts, mercure.WithHeartbeat(time.Duration(*d)))
 	}
 
+	if d := m.PollTimeout; d != nil {
+		opts = append(opts, mercure.WithPollTimeout(time.Duration(*d)))
+	}
+
 	if s := m.MaxRequestBodySize; s != nil {
 		opts = append(opts, mercure.WithMaxRequestBodySize(*s))
 	}
 
+	if m.SlowSubscriberPolicy != "" {
+		opts = append(opts, mercure.WithSlowSubscriberPolicy(mercure.SlowSubscriberPolicy(m.SlowSubscriberPolicy)))
+	}
+
+	if s := m.SubscriberBufferSize; s != nil {
+		opts = append(opts, mercure.WithSubscriberBufferSize(*s))
+	}
+
 	if len(m.PublishOrigins) > 0 {
 		opts = append(opts, mercure.WithPublishOrigins(m.PublishOrigins))
 	}
@@ -497,6 +527,9 @@ func (m *Mercure) UnmarshalCaddyfile(d *caddyfile.Dispenser) (err error) { //nol
 			case "subscriptions":
 				m.Subscriptions = true
 
+			case "websocket":
+				m.WebSocket = true
+
 			case "write_timeout":
 				if m.WriteTimeout, err = parseDurationParameter(d); err != nil {
 					return err
@@ -512,6 +545,11 @@ func (m *Mercure) UnmarshalCaddyfile(d *caddyfile.Dispenser) (err error) { //nol
 					return err
 				}
 
+			case "poll_timeout":
+				if m.PollTimeout, err = parseDurationParameter(d); err != nil {
+					return err
+				}
+
 			case "max_request_body_size":
 				if !d.NextArg() {
 					return d.ArgErr()
@@ -525,6 +563,25 @@ func (m *Mercure) UnmarshalCaddyfile(d *caddyfile.Dispenser) (err error) { //nol
 				s := int64(size)
 				m.MaxRequestBodySize = &s
 
+			case "slow_subscriber_policy":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				m.SlowSubscriberPolicy = d.Val()
+
+			case "subscriber_buffer_size":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				size, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return d.WrapErr(err)
+				}
+
+				m.SubscriberBufferSize = &size
+
 			case "publisher_jwks_url":
 				if !d.NextArg() {
 					return d.ArgErr()
@@ -0,0 +1,178 @@
+package caddy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/dunglas/mercure"
+)
+
+var errMissingMeshSecret = errors.New("the secret of the mesh transport must be set")
+
+func init() { //nolint:gochecknoinits
+	caddy.RegisterModule(&Mesh{})
+}
+
+type Mesh struct {
+	// The URLs of the other hubs of the mesh. Placeholders such as {env.MERCURE_PEER} are supported.
+	Peers []string `json:"peers,omitempty"`
+	// The secret shared by the hubs of the mesh to authenticate each other. Placeholders are supported.
+	Secret string `json:"secret,omitempty"`
+	// The timeout of the requests sent to the peers.
+	Timeout caddy.Duration `json:"timeout,omitempty"`
+	// The number of updates waiting to be forwarded to each peer.
+	QueueSize int `json:"queue_size,omitempty"`
+	// The transport dispatching the updates to the subscribers of this hub. Defaults to bolt.
+	TransportRaw json.RawMessage `json:"transport,omitempty" caddy:"namespace=http.handlers.mercure inline_key=name"` //nolint:tagalign
+
+	transport *mercure.MeshTransport
+}
+
+// CaddyModule returns the Caddy module information.
+func (*Mesh) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.mercure.mesh",
+		New: func() caddy.Module { return new(Mesh) },
+	}
+}
+
+func (m *Mesh) GetTransport() mercure.Transport { //nolint:ireturn
+	return m.transport
+}
+
+// Provision provisions m's configuration.
+//
+// The MeshTransport only wraps the pooled inner transport, which is closed by
+// its own module, so it isn't pooled itself.
+//
+//nolint:wrapcheck
+func (m *Mesh) Provision(ctx caddy.Context) error {
+	repl := caddy.NewReplacer()
+	m.Secret = repl.ReplaceKnown(m.Secret, "")
+
+	if m.Secret == "" {
+		return errMissingMeshSecret
+	}
+
+	peers := make([]*url.URL, 0, len(m.Peers))
+	for _, p := range m.Peers {
+		u, err := url.Parse(repl.ReplaceKnown(p, ""))
+		if err != nil {
+			return err
+		}
+
+		peers = append(peers, u)
+	}
+
+	var (
+		mod any
+		err error
+	)
+
+	if m.TransportRaw == nil {
+		mod, err = ctx.LoadModuleByID("http.handlers.mercure.bolt", nil)
+	} else {
+		mod, err = ctx.LoadModule(m, "TransportRaw")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var options []mercure.MeshOption
+	if m.Timeout > 0 {
+		options = append(options, mercure.WithMeshHTTPClient(&http.Client{Timeout: time.Duration(m.Timeout)}))
+	}
+
+	if m.QueueSize > 0 {
+		options = append(options, mercure.WithMeshQueueSize(m.QueueSize))
+	}
+
+	m.transport, err = mercure.NewMeshTransport(mod.(Transport).GetTransport(), ctx.Slogger(), peers, m.Secret, options...)
+
+	return err
+}
+
+// UnmarshalCaddyfile sets up the handler from Caddyfile tokens.
+//
+//nolint:wrapcheck
+func (m *Mesh) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "peers":
+				peers := d.RemainingArgs()
+				if len(peers) == 0 {
+					return d.ArgErr()
+				}
+
+				m.Peers = append(m.Peers, peers...)
+
+			case "secret":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				m.Secret = d.Val()
+
+			case "timeout":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, e := caddy.ParseDuration(d.Val())
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				m.Timeout = caddy.Duration(v)
+
+			case "queue_size":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, e := strconv.Atoi(d.Val())
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				m.QueueSize = v
+
+			case "transport":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				name := d.Val()
+				modID := "http.handlers.mercure." + name
+
+				unm, err := caddyfile.UnmarshalModule(d, modID)
+				if err != nil {
+					return err
+				}
+
+				t, ok := unm.(Transport)
+				if !ok {
+					return d.Errf(`module %s (%T) is not a supported transport implementation (requires "github.com/dunglas/mercure/caddy".Transport)`, modID, unm)
+				}
+
+				m.TransportRaw = caddyconfig.JSONModuleObject(t, "name", name, nil)
+			}
+		}
+	}
+
+	return nil
+}
+
+var (
+	_ caddy.Provisioner     = (*Mesh)(nil)
+	_ caddyfile.Unmarshaler = (*Mesh)(nil)
+)
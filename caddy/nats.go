@@ -0,0 +1,132 @@
+package caddy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"strconv"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/dunglas/mercure"
+)
+
+var errMissingNatsURL = errors.New("the url of the NATS transport must be set")
+
+func init() { //nolint:gochecknoinits
+	caddy.RegisterModule(&Nats{})
+}
+
+type Nats struct {
+	// The NATS server URL. Placeholders such as {env.NATS_URL} are supported.
+	URL    string `json:"url,omitempty"`
+	Stream string `json:"stream,omitempty"`
+	Size   uint64 `json:"size,omitempty"`
+
+	transport    *mercure.NatsTransport
+	transportKey string
+}
+
+// CaddyModule returns the Caddy module information.
+func (*Nats) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.mercure.nats",
+		New: func() caddy.Module { return new(Nats) },
+	}
+}
+
+func (n *Nats) GetTransport() mercure.Transport { //nolint:ireturn
+	return n.transport
+}
+
+// Provision provisions n's configuration.
+//
+//nolint:wrapcheck
+func (n *Nats) Provision(ctx caddy.Context) error {
+	n.URL = caddy.NewReplacer().ReplaceKnown(n.URL, "")
+	if n.URL == "" {
+		return errMissingNatsURL
+	}
+
+	var key bytes.Buffer
+	if err := gob.NewEncoder(&key).Encode(n); err != nil {
+		return err
+	}
+
+	n.transportKey = key.String()
+
+	destructor, _, err := TransportUsagePool.LoadOrNew(n.transportKey, func() (caddy.Destructor, error) {
+		t, err := mercure.NewNatsTransport(
+			ctx,
+			mercure.NewSubscriberList(ctx.Value(SubscriberListCacheSizeContextKey).(int)),
+			ctx.Slogger(),
+			n.URL,
+			n.Stream,
+			n.Size,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		return TransportDestructor[*mercure.NatsTransport]{Transport: t}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	n.transport = destructor.(TransportDestructor[*mercure.NatsTransport]).Transport
+
+	return nil
+}
+
+//nolint:wrapcheck
+func (n *Nats) Cleanup() error {
+	_, err := TransportUsagePool.Delete(n.transportKey)
+
+	return err
+}
+
+// UnmarshalCaddyfile sets up the handler from Caddyfile tokens.
+//
+//nolint:wrapcheck
+func (n *Nats) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "url":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				n.URL = d.Val()
+
+			case "stream":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				n.Stream = d.Val()
+
+			case "size":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				s, e := strconv.ParseUint(d.Val(), 10, 64)
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				n.Size = s
+			}
+		}
+	}
+
+	return nil
+}
+
+var (
+	_ caddy.Provisioner     = (*Nats)(nil)
+	_ caddy.CleanerUpper    = (*Nats)(nil)
+	_ caddyfile.Unmarshaler = (*Nats)(nil)
+)
@@ -0,0 +1,150 @@
+package caddy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"strconv"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/dunglas/mercure"
+)
+
+var errMissingPostgresDSN = errors.New("the dsn of the PostgreSQL transport must be set")
+
+func init() { //nolint:gochecknoinits
+	caddy.RegisterModule(&Postgres{})
+}
+
+type Postgres struct {
+	// The PostgreSQL connection string. Placeholders such as {env.DATABASE_URL} are supported.
+	DSN              string  `json:"dsn,omitempty"`
+	Table            string  `json:"table,omitempty"`
+	Size             uint64  `json:"size,omitempty"`
+	CleanupFrequency float64 `json:"cleanup_frequency,omitempty"`
+
+	transport    *mercure.PostgresTransport
+	transportKey string
+}
+
+// CaddyModule returns the Caddy module information.
+func (*Postgres) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.mercure.postgres",
+		New: func() caddy.Module { return new(Postgres) },
+	}
+}
+
+func (p *Postgres) GetTransport() mercure.Transport { //nolint:ireturn
+	return p.transport
+}
+
+// Provision provisions p's configuration.
+//
+//nolint:wrapcheck
+func (p *Postgres) Provision(ctx caddy.Context) error {
+	p.DSN = caddy.NewReplacer().ReplaceKnown(p.DSN, "")
+	if p.DSN == "" {
+		return errMissingPostgresDSN
+	}
+
+	if p.CleanupFrequency == 0 {
+		p.CleanupFrequency = mercure.PostgresDefaultCleanupFrequency
+	}
+
+	var key bytes.Buffer
+	if err := gob.NewEncoder(&key).Encode(p); err != nil {
+		return err
+	}
+
+	p.transportKey = key.String()
+
+	destructor, _, err := TransportUsagePool.LoadOrNew(p.transportKey, func() (caddy.Destructor, error) {
+		t, err := mercure.NewPostgresTransport(
+			ctx,
+			mercure.NewSubscriberList(ctx.Value(SubscriberListCacheSizeContextKey).(int)),
+			ctx.Slogger(),
+			p.DSN,
+			p.Table,
+			p.Size,
+			p.CleanupFrequency,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		return TransportDestructor[*mercure.PostgresTransport]{Transport: t}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	p.transport = destructor.(TransportDestructor[*mercure.PostgresTransport]).Transport
+
+	return nil
+}
+
+//nolint:wrapcheck
+func (p *Postgres) Cleanup() error {
+	_, err := TransportUsagePool.Delete(p.transportKey)
+
+	return err
+}
+
+// UnmarshalCaddyfile sets up the handler from Caddyfile tokens.
+//
+//nolint:wrapcheck
+func (p *Postgres) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "dsn":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				p.DSN = d.Val()
+
+			case "table":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				p.Table = d.Val()
+
+			case "cleanup_frequency":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				f, e := strconv.ParseFloat(d.Val(), 64)
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				p.CleanupFrequency = f
+
+			case "size":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				s, e := strconv.ParseUint(d.Val(), 10, 64)
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				p.Size = s
+			}
+		}
+	}
+
+	return nil
+}
+
+var (
+	_ caddy.Provisioner     = (*Postgres)(nil)
+	_ caddy.CleanerUpper    = (*Postgres)(nil)
+	_ caddyfile.Unmarshaler = (*Postgres)(nil)
+)
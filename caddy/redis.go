@@ -0,0 +1,132 @@
+package caddy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"strconv"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/dunglas/mercure"
+)
+
+var errMissingRedisURL = errors.New("the url of the Redis transport must be set")
+
+func init() { //nolint:gochecknoinits
+	caddy.RegisterModule(&Redis{})
+}
+
+type Redis struct {
+	// The Redis URL. Placeholders such as {env.REDIS_URL} are supported.
+	URL    string `json:"url,omitempty"`
+	Stream string `json:"stream,omitempty"`
+	Size   uint64 `json:"size,omitempty"`
+
+	transport    *mercure.RedisTransport
+	transportKey string
+}
+
+// CaddyModule returns the Caddy module information.
+func (*Redis) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.mercure.redis",
+		New: func() caddy.Module { return new(Redis) },
+	}
+}
+
+func (r *Redis) GetTransport() mercure.Transport { //nolint:ireturn
+	return r.transport
+}
+
+// Provision provisions r's configuration.
+//
+//nolint:wrapcheck
+func (r *Redis) Provision(ctx caddy.Context) error {
+	r.URL = caddy.NewReplacer().ReplaceKnown(r.URL, "")
+	if r.URL == "" {
+		return errMissingRedisURL
+	}
+
+	var key bytes.Buffer
+	if err := gob.NewEncoder(&key).Encode(r); err != nil {
+		return err
+	}
+
+	r.transportKey = key.String()
+
+	destructor, _, err := TransportUsagePool.LoadOrNew(r.transportKey, func() (caddy.Destructor, error) {
+		t, err := mercure.NewRedisTransport(
+			ctx,
+			mercure.NewSubscriberList(ctx.Value(SubscriberListCacheSizeContextKey).(int)),
+			ctx.Slogger(),
+			r.URL,
+			r.Stream,
+			r.Size,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		return TransportDestructor[*mercure.RedisTransport]{Transport: t}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r.transport = destructor.(TransportDestructor[*mercure.RedisTransport]).Transport
+
+	return nil
+}
+
+//nolint:wrapcheck
+func (r *Redis) Cleanup() error {
+	_, err := TransportUsagePool.Delete(r.transportKey)
+
+	return err
+}
+
+// UnmarshalCaddyfile sets up the handler from Caddyfile tokens.
+//
+//nolint:wrapcheck
+func (r *Redis) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "url":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				r.URL = d.Val()
+
+			case "stream":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				r.Stream = d.Val()
+
+			case "size":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				s, e := strconv.ParseUint(d.Val(), 10, 64)
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				r.Size = s
+			}
+		}
+	}
+
+	return nil
+}
+
+var (
+	_ caddy.Provisioner     = (*Redis)(nil)
+	_ caddy.CleanerUpper    = (*Redis)(nil)
+	_ caddyfile.Unmarshaler = (*Redis)(nil)
+)
@@ -0,0 +1,229 @@
+package caddy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/dunglas/mercure"
+)
+
+var errMissingRelayUpstream = errors.New("the upstream of the relay transport must be set")
+
+func init() { //nolint:gochecknoinits
+	caddy.RegisterModule(&Relay{})
+}
+
+// RelayTopic selects topics to relay from the upstream hub.
+type RelayTopic struct {
+	// The matcher type of the pattern: "exact" (default) or "urlpattern".
+	MatchType string `json:"match_type,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+}
+
+type Relay struct {
+	// The URL of the upstream hub. Placeholders such as {env.MERCURE_UPSTREAM} are supported.
+	Upstream string `json:"upstream,omitempty"`
+	// The JWT used to subscribe to the upstream hub. Placeholders are supported.
+	SubscriberJWT string `json:"subscriber_jwt,omitempty"`
+	// The JWT used to forward local publications to the upstream hub. Local publications aren't forwarded if not set.
+	PublisherJWT string `json:"publisher_jwt,omitempty"`
+	// The topics to relay. All topics are relayed if empty.
+	Topics []RelayTopic `json:"topics,omitempty"`
+	// The delay before reconnecting to the upstream hub after an error.
+	ReconnectDelay caddy.Duration `json:"reconnect_delay,omitempty"`
+	// The number of relayed updates to keep in memory, to replay them to reconnecting subscribers.
+	HistorySize uint64 `json:"history_size,omitempty"`
+	// The duration during which relayed updates are kept in memory, to replay them to reconnecting subscribers.
+	HistoryMaxAge caddy.Duration `json:"history_max_age,omitempty"`
+
+	transport    *mercure.RelayTransport
+	transportKey string
+}
+
+// CaddyModule returns the Caddy module information.
+func (*Relay) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.mercure.relay",
+		New: func() caddy.Module { return new(Relay) },
+	}
+}
+
+func (r *Relay) GetTransport() mercure.Transport { //nolint:ireturn
+	return r.transport
+}
+
+// Provision provisions r's configuration.
+//
+//nolint:wrapcheck
+func (r *Relay) Provision(ctx caddy.Context) error {
+	repl := caddy.NewReplacer()
+	r.Upstream = repl.ReplaceKnown(r.Upstream, "")
+	r.SubscriberJWT = repl.ReplaceKnown(r.SubscriberJWT, "")
+	r.PublisherJWT = repl.ReplaceKnown(r.PublisherJWT, "")
+
+	if r.Upstream == "" {
+		return errMissingRelayUpstream
+	}
+
+	upstream, err := url.Parse(r.Upstream)
+	if err != nil {
+		return err
+	}
+
+	var key bytes.Buffer
+	if err := gob.NewEncoder(&key).Encode(r); err != nil {
+		return err
+	}
+
+	r.transportKey = key.String()
+
+	options := []mercure.RelayOption{
+		mercure.WithRelaySubscriberJWT(r.SubscriberJWT),
+		mercure.WithRelayPublisherJWT(r.PublisherJWT),
+		mercure.WithRelayLocalOptions(
+			mercure.WithLocalHistorySize(r.HistorySize),
+			mercure.WithLocalHistoryMaxAge(time.Duration(r.HistoryMaxAge)),
+		),
+	}
+
+	if r.ReconnectDelay > 0 {
+		options = append(options, mercure.WithRelayReconnectDelay(time.Duration(r.ReconnectDelay)))
+	}
+
+	if len(r.Topics) > 0 {
+		matchers := make([]mercure.TopicMatcher, 0, len(r.Topics))
+		for _, t := range r.Topics {
+			matchType := mercure.MatcherTypeExact
+			if t.MatchType != "" {
+				matchType = mercure.MatcherType(t.MatchType)
+			}
+
+			matchers = append(matchers, mercure.TopicMatcher{Type: matchType, Pattern: t.Pattern})
+		}
+
+		options = append(options, mercure.WithRelayTopicMatchers(matchers...))
+	}
+
+	destructor, _, err := TransportUsagePool.LoadOrNew(r.transportKey, func() (caddy.Destructor, error) {
+		t, err := mercure.NewRelayTransport(
+			mercure.NewSubscriberList(ctx.Value(SubscriberListCacheSizeContextKey).(int)),
+			ctx.Slogger(),
+			upstream,
+			options...,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		return TransportDestructor[*mercure.RelayTransport]{Transport: t}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r.transport = destructor.(TransportDestructor[*mercure.RelayTransport]).Transport
+
+	return nil
+}
+
+//nolint:wrapcheck
+func (r *Relay) Cleanup() error {
+	_, err := TransportUsagePool.Delete(r.transportKey)
+
+	return err
+}
+
+// UnmarshalCaddyfile sets up the handler from Caddyfile tokens.
+//
+//nolint:wrapcheck
+func (r *Relay) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "upstream":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				r.Upstream = d.Val()
+
+			case "subscriber_jwt":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				r.SubscriberJWT = d.Val()
+
+			case "publisher_jwt":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				r.PublisherJWT = d.Val()
+
+			case "match", "match_urlpattern":
+				t := RelayTopic{}
+				if d.Val() == "match_urlpattern" {
+					t.MatchType = string(mercure.MatcherTypeURLPattern)
+				}
+
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				t.Pattern = d.Val()
+				r.Topics = append(r.Topics, t)
+
+			case "reconnect_delay":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, e := caddy.ParseDuration(d.Val())
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				r.ReconnectDelay = caddy.Duration(v)
+
+			case "history_size":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				s, e := strconv.ParseUint(d.Val(), 10, 64)
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				r.HistorySize = s
+
+			case "history_max_age":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, e := caddy.ParseDuration(d.Val())
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				r.HistoryMaxAge = caddy.Duration(v)
+			}
+		}
+	}
+
+	return nil
+}
+
+var (
+	_ caddy.Provisioner     = (*Relay)(nil)
+	_ caddy.CleanerUpper    = (*Relay)(nil)
+	_ caddyfile.Unmarshaler = (*Relay)(nil)
+)
@@ -0,0 +1,165 @@
+package caddy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/dunglas/mercure"
+)
+
+func init() { //nolint:gochecknoinits
+	caddy.RegisterModule(&SQLite{})
+}
+
+type SQLite struct {
+	Path   string         `json:"path,omitempty"`
+	Size   uint64         `json:"size,omitempty"`
+	MaxAge caddy.Duration `json:"max_age,omitempty"`
+
+	// The path of a Bolt database to import the history from, when the SQLite database is empty.
+	ImportBolt string `json:"import_bolt,omitempty"`
+	// The bucket name of the imported Bolt database.
+	ImportBoltBucketName string `json:"import_bolt_bucket_name,omitempty"`
+
+	transport    *mercure.SQLiteTransport
+	transportKey string
+}
+
+// CaddyModule returns the Caddy module information.
+func (*SQLite) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.mercure.sqlite",
+		New: func() caddy.Module { return new(SQLite) },
+	}
+}
+
+func (s *SQLite) GetTransport() mercure.Transport { //nolint:ireturn
+	return s.transport
+}
+
+// Provision provisions s's configuration.
+//
+//nolint:wrapcheck
+func (s *SQLite) Provision(ctx caddy.Context) error {
+	if s.Path == "" {
+		s.Path = filepath.Join(caddy.AppDataDir(), "mercure.sqlite")
+	}
+
+	var key bytes.Buffer
+	if err := gob.NewEncoder(&key).Encode(s); err != nil {
+		return err
+	}
+
+	s.transportKey = key.String()
+
+	destructor, _, err := TransportUsagePool.LoadOrNew(s.transportKey, func() (caddy.Destructor, error) {
+		t, err := mercure.NewSQLiteTransport(
+			mercure.NewSubscriberList(ctx.Value(SubscriberListCacheSizeContextKey).(int)),
+			ctx.Slogger(),
+			s.Path,
+			s.Size,
+			time.Duration(s.MaxAge),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if s.ImportBolt != "" {
+			n, err := t.ImportBolt(ctx, s.ImportBolt, s.ImportBoltBucketName)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				_ = t.Close(ctx)
+
+				return nil, err
+			}
+
+			if logger := ctx.Slogger(); n > 0 && logger.Enabled(ctx, slog.LevelInfo) {
+				logger.LogAttrs(ctx, slog.LevelInfo, "Bolt history imported", slog.String("path", s.ImportBolt), slog.Int("updates", n))
+			}
+		}
+
+		return TransportDestructor[*mercure.SQLiteTransport]{Transport: t}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.transport = destructor.(TransportDestructor[*mercure.SQLiteTransport]).Transport
+
+	return nil
+}
+
+//nolint:wrapcheck
+func (s *SQLite) Cleanup() error {
+	_, err := TransportUsagePool.Delete(s.transportKey)
+
+	return err
+}
+
+// UnmarshalCaddyfile sets up the handler from Caddyfile tokens.
+//
+//nolint:wrapcheck
+func (s *SQLite) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "path":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				s.Path = d.Val()
+
+			case "size":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, e := strconv.ParseUint(d.Val(), 10, 64)
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				s.Size = v
+
+			case "max_age":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, e := caddy.ParseDuration(d.Val())
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				s.MaxAge = caddy.Duration(v)
+
+			case "import_bolt":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				s.ImportBolt = d.Val()
+
+				if d.NextArg() {
+					s.ImportBoltBucketName = d.Val()
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+var (
+	_ caddy.Provisioner     = (*SQLite)(nil)
+	_ caddy.CleanerUpper    = (*SQLite)(nil)
+	_ caddyfile.Unmarshaler = (*SQLite)(nil)
+)
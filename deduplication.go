@@ -0,0 +1,232 @@
+package mercure
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltDedupKeysBucketSuffix is appended to the bucket name to get the name of
+// the bucket mapping idempotency keys to the storage time and the ID of the
+// update published with them.
+const boltDedupKeysBucketSuffix = "_dedup_keys"
+
+// boltDedupTimesBucketSuffix is appended to the bucket name to get the name
+// of the bucket listing the idempotency keys by storage time, to forget them
+// when they leave the deduplication window.
+const boltDedupTimesBucketSuffix = "_dedup_times"
+
+// WithLocalDeduplicationWindow remembers the idempotency keys of the updates
+// dispatched during the last window in memory. See WithBoltDeduplicationWindow.
+func WithLocalDeduplicationWindow(window time.Duration) LocalOption {
+	return func(t *LocalTransport) {
+		t.dedupWindow = window
+	}
+}
+
+// WithBoltDeduplicationWindow remembers the idempotency keys of the updates
+// stored during the last window, so that a publication with a key already
+// used during this window is detected as a replay: it isn't stored nor
+// dispatched again, and the ID of the original update is returned instead.
+//
+// Keys are checked and stored in the same transaction as the update, so that
+// concurrent replays are detected, even when group commit is enabled.
+func WithBoltDeduplicationWindow(window time.Duration) BoltOption {
+	return func(t *BoltTransport) error {
+		t.dedupWindow = window
+
+		return nil
+	}
+}
+
+// localDedupEntry is an idempotency key remembered by LocalTransport.
+type localDedupEntry struct {
+	key  string
+	id   string
+	time time.Time
+}
+
+// Deduplicates reports whether a deduplication window is configured.
+func (t *LocalTransport) Deduplicates() bool {
+	return t.dedupWindow > 0
+}
+
+// DispatchIdempotent dispatches update unless it is a replay. See TransportDeduplicator.
+func (t *LocalTransport) DispatchIdempotent(ctx context.Context, key string, update *Update) (bool, error) {
+	if key == "" || t.dedupWindow <= 0 {
+		if err := t.Dispatch(ctx, update); err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	select {
+	case <-t.closed:
+		return false, ErrClosedTransport
+	default:
+	}
+
+	update.AssignUUID()
+
+	now := time.Now()
+
+	// The key is reserved before dispatching, so that a concurrent replay is
+	// detected as well.
+	t.Lock()
+	for len(t.dedupQueue) > 0 && now.Sub(t.dedupQueue[0].time) > t.dedupWindow {
+		if t.dedupKeys[t.dedupQueue[0].key] == t.dedupQueue[0].id {
+			delete(t.dedupKeys, t.dedupQueue[0].key)
+		}
+
+		t.dedupQueue[0] = localDedupEntry{}
+		t.dedupQueue = t.dedupQueue[1:]
+	}
+
+	if id, ok := t.dedupKeys[key]; ok {
+		t.Unlock()
+
+		update.ID = id
+
+		return false, nil
+	}
+
+	if t.dedupKeys == nil {
+		t.dedupKeys = make(map[string]string)
+	}
+
+	t.dedupKeys[key] = update.ID
+	t.dedupQueue = append(t.dedupQueue, localDedupEntry{key, update.ID, now})
+	t.Unlock()
+
+	if err := t.Dispatch(ctx, update); err != nil {
+		// The publisher can retry: release the key.
+		t.releaseDedupKey(key, update.ID)
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// releaseDedupKey forgets the key reserved for the update with the given ID.
+func (t *LocalTransport) releaseDedupKey(key, id string) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.dedupKeys[key] != id {
+		return
+	}
+
+	delete(t.dedupKeys, key)
+
+	for i := len(t.dedupQueue) - 1; i >= 0; i-- {
+		if t.dedupQueue[i].key == key && t.dedupQueue[i].id == id {
+			t.dedupQueue = slices.Delete(t.dedupQueue, i, i+1)
+
+			break
+		}
+	}
+}
+
+// Deduplicates reports whether a deduplication window is configured.
+func (t *BoltTransport) Deduplicates() bool {
+	return t.dedupWindow > 0
+}
+
+// DispatchIdempotent persists and dispatches update unless it is a replay. See TransportDeduplicator.
+func (t *BoltTransport) DispatchIdempotent(ctx context.Context, key string, update *Update) (bool, error) {
+	return t.dispatch(ctx, key, update)
+}
+
+// initDeduplication deletes the deduplication buckets when the window is
+// disabled, so that stale keys aren't used if it is enabled again.
+func (t *BoltTransport) initDeduplication() error {
+	if t.dedupWindow > 0 {
+		return nil
+	}
+
+	err := t.db.Update(func(tx *bolt.Tx) error {
+		for _, suffix := range []string{boltDedupKeysBucketSuffix, boltDedupTimesBucketSuffix} {
+			if err := tx.DeleteBucket([]byte(t.bucketName + suffix)); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return fmt.Errorf("unable to delete Bolt DB bucket: %w", err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to initialize the Bolt DB deduplication: %w", err)
+	}
+
+	return nil
+}
+
+// store puts update in the database, unless it is a replay of an update
+// stored with the same idempotency key during the deduplication window. In
+// this case, it returns the ID of the original update. update isn't modified:
+// the transaction may still be rolled back.
+func (t *BoltTransport) store(tx *bolt.Tx, key string, update *Update, updateJSON []byte) (seq uint64, originalID string, err error) {
+	if key == "" || t.dedupWindow <= 0 {
+		seq, err := t.put(tx, update, updateJSON)
+
+		return seq, "", err
+	}
+
+	keys, err := tx.CreateBucketIfNotExists([]byte(t.bucketName + boltDedupKeysBucketSuffix))
+	if err != nil {
+		return 0, "", fmt.Errorf("error when creating Bolt DB bucket: %w", err)
+	}
+
+	times, err := tx.CreateBucketIfNotExists([]byte(t.bucketName + boltDedupTimesBucketSuffix))
+	if err != nil {
+		return 0, "", fmt.Errorf("error when creating Bolt DB bucket: %w", err)
+	}
+
+	now := time.Now()
+	if err := forgetDedupKeys(keys, times, now.Add(-t.dedupWindow)); err != nil {
+		return 0, "", err
+	}
+
+	if v := keys.Get([]byte(key)); len(v) >= 8 {
+		return 0, string(v[8:]), nil
+	}
+
+	seq, err = t.put(tx, update, updateJSON)
+	if err != nil {
+		return 0, "", err
+	}
+
+	ts := boltTimestamp(now)
+
+	if err := keys.Put([]byte(key), bytes.Join([][]byte{ts, []byte(update.ID)}, nil)); err != nil {
+		return 0, "", fmt.Errorf("unable to put value in Bolt DB: %w", err)
+	}
+
+	if err := times.Put(bytes.Join([][]byte{ts, []byte(key)}, nil), nil); err != nil {
+		return 0, "", fmt.Errorf("unable to put value in Bolt DB: %w", err)
+	}
+
+	return seq, "", nil
+}
+
+// forgetDedupKeys removes the idempotency keys stored before the given time.
+func forgetDedupKeys(keys, times *bolt.Bucket, before time.Time) error {
+	c := times.Cursor()
+	for k, _ := c.First(); k != nil && bytes.Compare(k[:8], boltTimestamp(before)) < 0; k, _ = c.First() {
+		if err := keys.Delete(k[8:]); err != nil {
+			return fmt.Errorf("unable to delete value in Bolt DB: %w", err)
+		}
+
+		if err := c.Delete(); err != nil {
+			return fmt.Errorf("unable to delete value in Bolt DB: %w", err)
+		}
+	}
+
+	return nil
+}
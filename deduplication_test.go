@@ -0,0 +1,233 @@
+package mercure
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+// assertDeduplicated dispatches updates with the same key, and checks that only the first one is dispatched.
+func assertDeduplicated(t *testing.T, transport TransportDeduplicator, key string) string {
+	t.Helper()
+
+	require.True(t, transport.Deduplicates())
+
+	first := &Update{Topics: []string{"https://example.com/foo"}}
+	dispatched, err := transport.DispatchIdempotent(t.Context(), key, first)
+	require.NoError(t, err)
+	assert.True(t, dispatched)
+	assert.NotEmpty(t, first.ID)
+
+	replay := &Update{Event: Event{ID: "replay"}, Topics: []string{"https://example.com/foo"}}
+	dispatched, err = transport.DispatchIdempotent(t.Context(), key, replay)
+	require.NoError(t, err)
+	assert.False(t, dispatched)
+	assert.Equal(t, first.ID, replay.ID)
+
+	return first.ID
+}
+
+func TestLocalTransportDeduplication(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		transport := NewLocalTransport(NewSubscriberList(0), WithLocalDeduplicationWindow(time.Minute))
+		t.Cleanup(func() {
+			require.NoError(t, transport.Close(t.Context()))
+		})
+
+		s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+		s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}}, nil)
+		require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+		id := assertDeduplicated(t, transport, "a")
+		assert.Equal(t, id, (<-s.Receive()).ID)
+
+		// Other keys aren't affected.
+		assertDeduplicated(t, transport, "b")
+
+		// Keys are forgotten after the window.
+		time.Sleep(2 * time.Minute)
+		assert.NotEqual(t, id, assertDeduplicated(t, transport, "a"))
+		assert.Len(t, transport.dedupKeys, 1)
+
+		// Without key, updates are always dispatched.
+		dispatched, err := transport.DispatchIdempotent(t.Context(), "", &Update{Topics: []string{"https://example.com/foo"}})
+		require.NoError(t, err)
+		assert.True(t, dispatched)
+	})
+}
+
+func TestLocalTransportDeduplicationRelease(t *testing.T) {
+	t.Parallel()
+
+	transport := NewLocalTransport(NewSubscriberList(0), WithLocalDeduplicationWindow(time.Minute))
+	t.Cleanup(func() {
+		require.NoError(t, transport.Close(t.Context()))
+	})
+
+	id := assertDeduplicated(t, transport, "a")
+	assertDeduplicated(t, transport, "b")
+
+	// Only the reservation of the failed update is released.
+	transport.releaseDedupKey("a", "other")
+	assert.Len(t, transport.dedupKeys, 2)
+
+	transport.releaseDedupKey("a", id)
+	assert.Len(t, transport.dedupKeys, 1)
+	assert.Len(t, transport.dedupQueue, 1)
+	assert.NotEqual(t, id, assertDeduplicated(t, transport, "a"))
+}
+
+func TestLocalTransportWithoutDeduplication(t *testing.T) {
+	t.Parallel()
+
+	transport := NewLocalTransport(NewSubscriberList(0))
+	t.Cleanup(func() {
+		require.NoError(t, transport.Close(t.Context()))
+	})
+
+	assert.False(t, transport.Deduplicates())
+
+	for range 2 {
+		dispatched, err := transport.DispatchIdempotent(t.Context(), "a", &Update{Topics: []string{"https://example.com/foo"}})
+		require.NoError(t, err)
+		assert.True(t, dispatched)
+	}
+}
+
+func TestBoltTransportDeduplication(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		transport := createBoltTransport(t, 0, 0, WithBoltDeduplicationWindow(time.Minute))
+
+		s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+		s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}}, nil)
+		require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+		id := assertDeduplicated(t, transport, "a")
+		assert.Equal(t, id, (<-s.Receive()).ID)
+		assert.Equal(t, []string{id}, historyIDs(t, transport))
+		assert.Equal(t, id, transport.lastEventID)
+
+		time.Sleep(2 * time.Minute)
+
+		// Expired keys are forgotten.
+		id2 := assertDeduplicated(t, transport, "a")
+		assert.Equal(t, []string{id, id2}, historyIDs(t, transport))
+		require.NoError(t, transport.db.View(func(tx *bolt.Tx) error {
+			assert.Equal(t, 1, tx.Bucket([]byte(defaultBoltBucketName+boltDedupKeysBucketSuffix)).Stats().KeyN)
+			assert.Equal(t, 1, tx.Bucket([]byte(defaultBoltBucketName+boltDedupTimesBucketSuffix)).Stats().KeyN)
+
+			return nil
+		}))
+	})
+}
+
+func TestBoltTransportDeduplicationGroupCommit(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0, WithBoltDeduplicationWindow(time.Minute), WithBoltGroupCommit(10*time.Millisecond, 16))
+
+	var (
+		wg         sync.WaitGroup
+		mu         sync.Mutex
+		ids        = make(map[string]struct{})
+		dispatches int
+	)
+
+	// Concurrent replays are part of the same group.
+	for range 10 {
+		wg.Go(func() {
+			u := &Update{Topics: []string{"https://example.com/foo"}}
+			dispatched, err := transport.DispatchIdempotent(t.Context(), "a", u)
+			assert.NoError(t, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			ids[u.ID] = struct{}{}
+			if dispatched {
+				dispatches++
+			}
+		})
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, 1, dispatches)
+	assert.Len(t, ids, 1)
+	assert.Len(t, historyIDs(t, transport), 1)
+}
+
+// The updates of a failed transaction keep their ID, even when a replay has
+// been detected before the failure.
+func TestBoltTransportDeduplicationRollback(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0, WithBoltDeduplicationWindow(time.Minute))
+
+	updates := []*Update{
+		{Event: Event{ID: "a"}, Topics: []string{"https://example.com/foo"}},
+		{Event: Event{ID: "b"}, Topics: []string{"https://example.com/foo"}},
+		{Event: Event{ID: strings.Repeat("x", 40000)}, Topics: []string{"https://example.com/foo"}},
+	}
+
+	_, err := transport.DispatchBatch(t.Context(), []string{"k", "k", ""}, updates)
+	require.Error(t, err)
+	assert.Equal(t, "b", updates[1].ID)
+	assert.Empty(t, historyIDs(t, transport))
+
+	dispatched, err := transport.DispatchBatch(t.Context(), []string{"k", "k"}, updates[:2])
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, false}, dispatched)
+	assert.Equal(t, "a", updates[1].ID)
+}
+
+func TestBoltTransportDeduplicationInit(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "bolt.db")
+
+	transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), path, "", 0, 0, WithBoltDeduplicationWindow(time.Hour))
+	require.NoError(t, err)
+
+	id := assertDeduplicated(t, transport, "a")
+	require.NoError(t, transport.Close(t.Context()))
+
+	// Keys are persisted.
+	transport, err = NewBoltTransport(NewSubscriberList(0), slog.Default(), path, "", 0, 0, WithBoltDeduplicationWindow(time.Hour))
+	require.NoError(t, err)
+
+	u := &Update{Topics: []string{"https://example.com/foo"}}
+	dispatched, err := transport.DispatchIdempotent(t.Context(), "a", u)
+	require.NoError(t, err)
+	assert.False(t, dispatched)
+	assert.Equal(t, id, u.ID)
+	require.NoError(t, transport.Close(t.Context()))
+
+	// Disabling the deduplication removes the buckets.
+	transport, err = NewBoltTransport(NewSubscriberList(0), slog.Default(), path, "", 0, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, transport.db.View(func(tx *bolt.Tx) error {
+		assert.Nil(t, tx.Bucket([]byte(defaultBoltBucketName+boltDedupKeysBucketSuffix)))
+		assert.Nil(t, tx.Bucket([]byte(defaultBoltBucketName+boltDedupTimesBucketSuffix)))
+
+		return nil
+	}))
+
+	dispatched, err = transport.DispatchIdempotent(t.Context(), "a", &Update{Topics: []string{"https://example.com/foo"}})
+	require.NoError(t, err)
+	assert.True(t, dispatched)
+	require.NoError(t, transport.Close(t.Context()))
+}
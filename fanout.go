@@ -0,0 +1,133 @@
+package mercure
+
+import (
+	"context"
+	"sync"
+)
+
+// shardedFanOutMinSubscribers is the number of matching subscribers below
+// which an update is dispatched on the publisher's goroutine: handing it over
+// to the workers would cost more than it saves.
+const shardedFanOutMinSubscribers = 256
+
+// WithLocalDispatchShards dispatches each update to the matching subscribers
+// in parallel, using shards workers. See WithBoltDispatchShards.
+func WithLocalDispatchShards(shards int) LocalOption {
+	return func(t *LocalTransport) {
+		t.dispatchShards = shards
+	}
+}
+
+// WithBoltDispatchShards dispatches each update to the matching subscribers
+// in parallel, using shards workers. Values lower than 2 disable it.
+//
+// Subscribers are partitioned between the workers, each worker dispatching
+// to its subscribers in turn, so the dispatch time grows with the audience
+// divided by the number of workers. Updates are still dispatched to a given
+// subscriber in order: a subscriber always belongs to the same worker, and
+// Dispatch returns once all the workers are done.
+func WithBoltDispatchShards(shards int) BoltOption {
+	return func(t *BoltTransport) error {
+		t.dispatchShards = shards
+
+		return nil
+	}
+}
+
+// fanOutJob is the part of a dispatch handled by a worker.
+type fanOutJob struct {
+	ctx         context.Context //nolint:containedctx
+	update      *Update
+	subscribers []*LocalSubscriber
+	done        *sync.WaitGroup
+}
+
+// shardedFanOut is a pool of workers dispatching updates to partitions of the subscribers.
+type shardedFanOut struct {
+	shards         []chan fanOutJob
+	minSubscribers int
+	quit           <-chan struct{}
+}
+
+// newShardedFanOut starts shards workers, which stop when quit is closed.
+// It returns nil, meaning dispatching on the publisher's goroutine, if
+// shards is lower than 2.
+func newShardedFanOut(shards int, quit <-chan struct{}) *shardedFanOut {
+	if shards < 2 {
+		return nil
+	}
+
+	f := &shardedFanOut{
+		shards:         make([]chan fanOutJob, shards),
+		minSubscribers: shardedFanOutMinSubscribers,
+		quit:           quit,
+	}
+
+	for i := range f.shards {
+		// Unbuffered: a job sent before quit is closed is always run.
+		f.shards[i] = make(chan fanOutJob)
+
+		go f.work(f.shards[i])
+	}
+
+	return f
+}
+
+func (f *shardedFanOut) work(jobs <-chan fanOutJob) {
+	for {
+		select {
+		case job := <-jobs:
+			dispatchToSubscribers(job.ctx, job.update, job.subscribers)
+			job.done.Done()
+		case <-f.quit:
+			return
+		}
+	}
+}
+
+// dispatch dispatches update to subscribers and waits until it's done.
+// It is safe to call on a nil *shardedFanOut.
+func (f *shardedFanOut) dispatch(ctx context.Context, update *Update, subscribers []*LocalSubscriber) {
+	if f == nil || len(subscribers) < f.minSubscribers {
+		dispatchToSubscribers(ctx, update, subscribers)
+
+		return
+	}
+
+	n := uint64(len(f.shards))
+	partitions := make([][]*LocalSubscriber, n)
+
+	for _, s := range subscribers {
+		i := s.shard % n
+		if partitions[i] == nil {
+			partitions[i] = make([]*LocalSubscriber, 0, len(subscribers)/int(n)+1)
+		}
+
+		partitions[i] = append(partitions[i], s)
+	}
+
+	var done sync.WaitGroup
+
+	for i, p := range partitions {
+		if len(p) == 0 {
+			continue
+		}
+
+		done.Add(1)
+
+		select {
+		case f.shards[i] <- fanOutJob{ctx, update, p, &done}:
+		case <-f.quit:
+			dispatchToSubscribers(ctx, update, p)
+			done.Done()
+		}
+	}
+
+	done.Wait()
+}
+
+func dispatchToSubscribers(ctx context.Context, update *Update, subscribers []*LocalSubscriber) {
+	for _, s := range subscribers {
+		s.Dispatch(ctx, update, false)
+	}
+}
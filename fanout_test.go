@@ -0,0 +1,104 @@
+package mercure
+
+import (
+	"log/slog"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func subscribeBroadcast(t *testing.T, transport Transport, n int) []*LocalSubscriber {
+	t.Helper()
+
+	subscribers := make([]*LocalSubscriber, n)
+	for i := range subscribers {
+		subscribers[i] = NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+		subscribers[i].SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/broadcast"}}, nil)
+		require.NoError(t, transport.AddSubscriber(t.Context(), subscribers[i]))
+	}
+
+	return subscribers
+}
+
+func assertReceivedInOrder(t *testing.T, subscribers []*LocalSubscriber, n int) {
+	t.Helper()
+
+	for _, s := range subscribers {
+		for i := range n {
+			require.Equal(t, strconv.Itoa(i), (<-s.Receive()).ID)
+		}
+	}
+}
+
+func TestLocalTransportDispatchShards(t *testing.T) {
+	t.Parallel()
+
+	transport := NewLocalTransport(NewSubscriberList(0), WithLocalDispatchShards(4), WithLocalHistorySize(10))
+	t.Cleanup(func() {
+		require.NoError(t, transport.Close(t.Context()))
+	})
+
+	require.NotNil(t, transport.dispatcher)
+
+	subscribers := subscribeBroadcast(t, transport, 2*shardedFanOutMinSubscribers)
+
+	for i := range 10 {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: strconv.Itoa(i)}, Topics: []string{"https://example.com/broadcast"}}))
+	}
+
+	assertReceivedInOrder(t, subscribers, 10)
+}
+
+func TestBoltTransportDispatchShards(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0, WithBoltDispatchShards(4))
+	require.NotNil(t, transport.dispatcher)
+
+	subscribers := subscribeBroadcast(t, transport, 2*shardedFanOutMinSubscribers)
+
+	for i := range 10 {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: strconv.Itoa(i)}, Topics: []string{"https://example.com/broadcast"}}))
+	}
+
+	assertReceivedInOrder(t, subscribers, 10)
+}
+
+func TestShardedFanOutDisabled(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, newShardedFanOut(0, nil))
+	assert.Nil(t, newShardedFanOut(1, nil))
+
+	// A nil fan-out dispatches on the caller's goroutine.
+	var f *shardedFanOut
+
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.Ready(t.Context())
+	f.dispatch(t.Context(), &Update{Event: Event{ID: "a"}}, []*LocalSubscriber{s})
+
+	assert.Equal(t, "a", (<-s.Receive()).ID)
+}
+
+func TestShardedFanOutAfterQuit(t *testing.T) {
+	t.Parallel()
+
+	quit := make(chan struct{})
+	f := newShardedFanOut(4, quit)
+	f.minSubscribers = 0
+
+	close(quit)
+
+	subscribers := make([]*LocalSubscriber, 8)
+	for i := range subscribers {
+		subscribers[i] = NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+		subscribers[i].Ready(t.Context())
+	}
+
+	// The workers are stopped, the update is dispatched on the caller's goroutine.
+	f.dispatch(t.Context(), &Update{Event: Event{ID: "0"}}, subscribers)
+
+	assertReceivedInOrder(t, subscribers, 1)
+}
@@ -60,6 +60,19 @@ func (h *Hub) initHandler() {
 
 	h.registerSubscriptionHandlers(router)
 
+	if th, ok := TransportAs[TransportHandler](h.transport); ok {
+		router.PathPrefix(th.HandlerPathPrefix()).Handler(th)
+	}
+
+	if h.webSocket && (h.subscriberConfigured || h.anonymous) {
+		// Registered first: WebSocket handshakes are GET requests too.
+		router.HandleFunc(defaultHubURL, h.WebSocketHandler).Methods(http.MethodGet).MatcherFunc(isWebSocketUpgrade)
+	}
+
+	if _, ok := TransportAs[TransportHistory](h.transport); ok && (h.subscriberConfigured || h.anonymous) {
+		router.HandleFunc(historyURL, h.HistoryHandler).Methods(http.MethodGet, http.MethodHead)
+	}
+
 	if h.subscriberConfigured || h.anonymous {
 		router.HandleFunc(defaultHubURL, h.SubscribeHandler).Methods(http.MethodGet, http.MethodHead, methodQuery)
 	}
@@ -134,7 +147,7 @@ func (h *Hub) registerSubscriptionHandlers(r *mux.Router) {
 		return
 	}
 
-	if _, ok := h.transport.(TransportSubscribers); !ok {
+	if _, ok := TransportAs[TransportSubscribers](h.transport); !ok {
 		if h.logger.Enabled(h.ctx, slog.LevelError) {
 			h.logger.LogAttrs(h.ctx, slog.LevelError, "The current transport doesn't support subscriptions. Subscription API disabled.")
 		}
@@ -0,0 +1,112 @@
+package mercure
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	historyURL = defaultHubURL + "/history"
+
+	// paramSince is the history query parameter holding the ID of the update
+	// after which the history is read.
+	paramSince = "since"
+	// paramLimit is the history query parameter holding the page size.
+	paramLimit = "limit"
+
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// historyResponse is the body of a history response.
+type historyResponse struct {
+	Updates []*jsonUpdate `json:"updates"`
+	// LastEventID is the cursor to pass as since to get the next page.
+	LastEventID string `json:"last_event_id"`
+	// More reports whether the history may hold more matching updates.
+	More bool `json:"more,omitempty"`
+}
+
+// HistoryHandler returns a page of the updates of the history matching the
+// subscription parameters. Subscribers are authorized as by SubscribeHandler,
+// and only receive the updates they could have received live.
+func (h *Hub) HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "mercure.history", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	th, ok := TransportAs[TransportHistory](h.transport)
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	query := r.URL.Query()
+
+	since := query.Get(paramSince)
+	if since == "" {
+		since = EarliestLastEventID
+	}
+
+	limit := defaultHistoryLimit
+	if l := query.Get(paramLimit); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 || limit > maxHistoryLimit {
+			http.Error(w, `invalid "limit" parameter`, http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	s := h.newRequestSubscriber(ctx, span, w, r)
+	if s == nil {
+		return
+	}
+
+	page, err := th.GetHistory(ctx, &s.Subscriber, since, limit)
+
+	// As for event streams, an unknown ID is answered with the reserved
+	// "earliest" value, telling the client to fetch the history again from
+	// the start.
+	resp := historyResponse{Updates: []*jsonUpdate{}, LastEventID: since}
+
+	switch {
+	case errors.Is(err, ErrUnknownLastEventID):
+		resp.LastEventID = EarliestLastEventID
+		page = &HistoryPage{}
+	case err != nil:
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+
+		if h.logger.Enabled(ctx, slog.LevelError) {
+			h.logger.LogAttrs(ctx, slog.LevelError, "Unable to retrieve history", slog.Any("error", err))
+		}
+
+		recordSpanError(span, err)
+
+		return
+	}
+
+	for _, update := range page.Updates {
+		resp.Updates = append(resp.Updates, newJSONUpdate(update, s.updateTopics(update)))
+	}
+
+	// The cursor skips the updates not matching the subscription too.
+	if page.LastEventID != "" {
+		resp.LastEventID = page.LastEventID
+	}
+
+	resp.More = page.More
+
+	header := w.Header()
+	header["Content-Type"] = []string{"application/json"}
+	header["Cache-Control"] = headerCacheControl
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil && h.logger.Enabled(ctx, slog.LevelInfo) {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, "Failed to write history response", slog.Any("error", err))
+	}
+}
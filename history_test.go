@@ -0,0 +1,131 @@
+package mercure
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getHistory(t *testing.T, hub *Hub, query string, cookie string) historyResponse {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, historyURL+"?"+query, nil)
+	if cookie != "" {
+		req.AddCookie(&http.Cookie{Name: defaultCookieName, Value: cookie})
+	}
+
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var resp historyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	return resp
+}
+
+func TestHistoryHandler(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0)
+	hub := createDummy(t, WithTransport(transport))
+	ctx := t.Context()
+
+	for _, u := range []*Update{
+		{Topics: []string{"https://example.com/reviews/1"}, Event: Event{ID: "a", Data: "d1"}},
+		{Topics: []string{"https://example.com/reviews/2"}, Event: Event{ID: "b", Data: "d2"}, Private: true},
+		{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: "c", Data: "d3"}},
+		{Topics: []string{"https://example.com/reviews/3"}, Event: Event{ID: "d", Data: "d4"}, Private: true},
+		{Topics: []string{"https://example.com/reviews/4"}, Event: Event{ID: "e", Data: "d5"}},
+	} {
+		require.NoError(t, transport.Dispatch(ctx, u))
+	}
+
+	cookie := createDummyAuthorizedJWT(roleSubscriber, []string{"https://example.com/reviews/3"})
+	query := "match_urlpattern=https://example.com/reviews/:id&limit=2"
+
+	resp := getHistory(t, hub, query, cookie)
+	assert.Equal(t, []*jsonUpdate{{ID: "a", Data: "d1"}, {ID: "d", Data: "d4"}}, resp.Updates)
+	assert.Equal(t, "d", resp.LastEventID)
+	assert.True(t, resp.More)
+
+	resp = getHistory(t, hub, query+"&since="+resp.LastEventID, cookie)
+	assert.Equal(t, []*jsonUpdate{{ID: "e", Data: "d5"}}, resp.Updates)
+	assert.Equal(t, "e", resp.LastEventID)
+	assert.False(t, resp.More)
+
+	resp = getHistory(t, hub, query+"&since="+resp.LastEventID, cookie)
+	assert.Empty(t, resp.Updates)
+	assert.Equal(t, "e", resp.LastEventID)
+	assert.False(t, resp.More)
+
+	resp = getHistory(t, hub, query+"&since=unknown", cookie)
+	assert.Empty(t, resp.Updates)
+	assert.Equal(t, EarliestLastEventID, resp.LastEventID)
+}
+
+func TestHistoryHandlerWithTopics(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0)
+	hub := createAnonymousDummy(t, WithTransport(transport))
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{
+		Topics: []string{"https://example.com/books/1"},
+		Event:  Event{ID: "a", Type: "foo", Data: "d1"},
+	}))
+
+	resp := getHistory(t, hub, "match=https://example.com/books/1&with_topics", "")
+	assert.Equal(t, []*jsonUpdate{{ID: "a", Type: "foo", Data: "d1", Topics: []string{"https://example.com/books/1"}}}, resp.Updates)
+	assert.Equal(t, "a", resp.LastEventID)
+}
+
+func TestHistoryHandlerErrors(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithTransport(createBoltTransport(t, 0, 0)))
+
+	for _, tc := range []struct {
+		name   string
+		query  string
+		cookie string
+		status int
+	}{
+		{"unauthorized", "match=https://example.com/books/1", "", http.StatusUnauthorized},
+		{"no matcher", "", createDummyAuthorizedJWT(roleSubscriber, nil), http.StatusBadRequest},
+		{"invalid limit", "match=https://example.com/books/1&limit=foo", createDummyAuthorizedJWT(roleSubscriber, nil), http.StatusBadRequest},
+		{"limit too large", "match=https://example.com/books/1&limit=1001", createDummyAuthorizedJWT(roleSubscriber, nil), http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, historyURL+"?"+tc.query, nil)
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: defaultCookieName, Value: tc.cookie})
+			}
+
+			w := httptest.NewRecorder()
+			hub.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.status, w.Code)
+		})
+	}
+}
+
+func TestHistoryHandlerNotSupported(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t)
+
+	req := httptest.NewRequest(http.MethodGet, historyURL+"?match=https://example.com/books/1", nil)
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
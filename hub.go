@@ -19,6 +19,7 @@ const (
 	DefaultWriteTimeout    = 600 * time.Second
 	DefaultDispatchTimeout = 5 * time.Second
 	DefaultHeartbeat       = 40 * time.Second
+	DefaultPollTimeout     = 30 * time.Second
 
 	// DefaultMaxRequestBodySize bounds the publish and QUERY subscribe request
 	// bodies; larger requests are rejected with a 413 as the protocol requires.
@@ -142,6 +143,17 @@ func WithSubscriptions() Option {
 	}
 }
 
+// WithWebSocket allows subscribers to connect to the hub URL with the
+// WebSocket protocol instead of Server-Sent Events. Tokens carrying the
+// publish action can publish updates over the same connection.
+func WithWebSocket() Option {
+	return func(o *opt) error {
+		o.webSocket = true
+
+		return nil
+	}
+}
+
 // WithLogger sets the logger to use.
 func WithLogger(logger *slog.Logger) Option {
 	return func(o *opt) error {
@@ -179,6 +191,17 @@ func WithHeartbeat(interval time.Duration) Option {
 	}
 }
 
+// WithPollTimeout sets the maximum duration a long-polling subscriber waits
+// for updates before getting an empty response, defaults to 30s. The wait is
+// also bounded by the write timeout and the expiration of the token.
+func WithPollTimeout(timeout time.Duration) Option {
+	return func(o *opt) error {
+		o.pollTimeout = timeout
+
+		return nil
+	}
+}
+
 // WithMaxRequestBodySize bounds the size, in bytes, of publish and QUERY
 // subscribe request bodies; larger requests are rejected with a 413 status
 // code. Defaults to DefaultMaxRequestBodySize, set to 0 to disable the
@@ -412,10 +435,12 @@ func WithResourceIdentifier(resourceIdentifier string) Option {
 // If you change this, also update the Caddy module and the documentation.
 type opt struct {
 	transport                    Transport
+	transportMiddlewares         []TransportMiddleware
 	topicMatcherStore            *TopicMatcherStore
 	anonymous                    bool
 	debug                        bool
 	subscriptions                bool
+	webSocket                    bool
 	debugger                     bool
 	playground                   bool
 	playgroundTokenFunc          func(resourceIdentifier string) (string, error)
@@ -423,7 +448,10 @@ type opt struct {
 	writeTimeout                 time.Duration
 	dispatchTimeout              time.Duration
 	heartbeat                    time.Duration
+	pollTimeout                  time.Duration
 	maxRequestBodySize           int64
+	slowSubscriberPolicy         SlowSubscriberPolicy
+	subscriberBufferSize         int
 	issuers                      map[string]issuerVerifier
 	publisherConfigured          bool
 	subscriberConfigured         bool
@@ -527,10 +555,13 @@ type Hub struct {
 // NewHub creates a new Hub instance.
 func NewHub(ctx context.Context, options ...Option) (*Hub, error) {
 	opt := &opt{
-		writeTimeout:       DefaultWriteTimeout,
-		dispatchTimeout:    DefaultDispatchTimeout,
-		heartbeat:          DefaultHeartbeat,
-		maxRequestBodySize: DefaultMaxRequestBodySize,
+		writeTimeout:         DefaultWriteTimeout,
+		dispatchTimeout:      DefaultDispatchTimeout,
+		heartbeat:            DefaultHeartbeat,
+		pollTimeout:          DefaultPollTimeout,
+		maxRequestBodySize:   DefaultMaxRequestBodySize,
+		slowSubscriberPolicy: SlowSubscriberDisconnect,
+		subscriberBufferSize: DefaultSubscriberBufferSize,
 	}
 
 	for _, o := range options {
@@ -560,7 +591,9 @@ func NewHub(ctx context.Context, options ...Option) (*Hub, error) {
 		opt.transport = NewLocalTransport(NewSubscriberList(DefaultSubscriberListCacheSize))
 	}
 
-	if ttss, ok := opt.transport.(TransportTopicMatcherStore); ok {
+	opt.transport = applyTransportMiddlewares(opt.transport, opt.transportMiddlewares)
+
+	if ttss, ok := TransportAs[TransportTopicMatcherStore](opt.transport); ok {
 		ttss.SetTopicMatcherStore(opt.topicMatcherStore)
 	}
 
@@ -0,0 +1,368 @@
+package mercure
+
+import (
+	"bytes"
+	"cmp"
+	"container/list"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltLastValuesBucketSuffix is appended to the bucket name to get the name
+// of the bucket mapping canonical topics to their latest update.
+const boltLastValuesBucketSuffix = "_last_values"
+
+// privateLastValuePrefix prefixes the keys of the private last values, so
+// that they don't replace the public ones. Topics can't contain control
+// characters, so the keys can't collide.
+const privateLastValuePrefix = "\x00"
+
+// DefaultLocalLastValueCacheSize is the default maximum number of topics of
+// the in-memory last value cache.
+const DefaultLocalLastValueCacheSize = 10_000
+
+// WithLocalLastValueCache keeps the latest update of each topic in memory,
+// for at most DefaultLocalLastValueCacheSize topics. See
+// WithBoltLastValueCache and WithLocalLastValueCacheSize.
+func WithLocalLastValueCache() LocalOption {
+	return WithLocalLastValueCacheSize(DefaultLocalLastValueCacheSize)
+}
+
+// WithLocalLastValueCacheSize keeps the latest update of at most size topics
+// in memory. The topics whose last update is the oldest are evicted first.
+func WithLocalLastValueCacheSize(size int) LocalOption {
+	return func(t *LocalTransport) {
+		t.lastValues = make(map[string]*list.Element)
+		t.lastValueOrder = list.New()
+		t.lastValueCacheSize = max(size, 1)
+	}
+}
+
+// localLastValue is an entry of the in-memory last value cache.
+type localLastValue struct {
+	key    string
+	update *Update
+}
+
+// WithBoltLastValueCache keeps the latest update of each topic in a dedicated
+// bucket, as long as the update is kept in the history: it is removed along
+// with the update by the retention settings, the expiration and the compaction.
+//
+// Subscribers connecting without a Last-Event-ID first receive the latest
+// update of each topic they are subscribed and authorized to, in the order
+// they have been published, then the live updates. Updates are keyed by
+// their canonical topic (the first one). Subscription events aren't cached.
+func WithBoltLastValueCache() BoltOption {
+	return func(t *BoltTransport) error {
+		t.lastValueCache = true
+
+		return nil
+	}
+}
+
+// lastValueKey returns the key under which update is cached, and false if it
+// must not be cached. Public and private updates are cached separately: a
+// private update must not hide the public last value from the subscribers
+// not allowed to receive it.
+func lastValueKey(update *Update) (string, bool) {
+	if len(update.Topics) == 0 || update.Type == reservedEventType {
+		return "", false
+	}
+
+	if update.Private {
+		return privateLastValuePrefix + update.Topics[0], true
+	}
+
+	return update.Topics[0], true
+}
+
+// subscribedToLastValue reports whether s is subscribed to the canonical
+// topic of a cached update, given its cache key.
+func subscribedToLastValue(s *LocalSubscriber, key string) bool {
+	return s.matchesAny([]string{strings.TrimPrefix(key, privateLastValuePrefix)}, s.SubscribedMatchers)
+}
+
+// exactLastValueKeys returns the cache keys of the topics s is subscribed
+// to, and false if s has matchers other than exact ones.
+func exactLastValueKeys(s *LocalSubscriber) ([]string, bool) {
+	keys := make([]string, 0, 2*len(s.SubscribedMatchers))
+
+	for _, m := range s.SubscribedMatchers {
+		if m.Type != MatcherTypeExact || m.Pattern == "*" {
+			return nil, false
+		}
+
+		keys = append(keys, m.Pattern, privateLastValuePrefix+m.Pattern)
+	}
+
+	return keys, true
+}
+
+// dispatchLastValues sends the cached updates to a new subscriber, until its buffer is full.
+func dispatchLastValues(ctx context.Context, s *LocalSubscriber, updates []*Update) {
+	for _, u := range updates {
+		if !s.Dispatch(ctx, u, true) {
+			return
+		}
+	}
+}
+
+// cacheLastValue stores update as the latest value of its topic, and evicts
+// the oldest value if the cache is full. The lock must be held.
+func (t *LocalTransport) cacheLastValue(update *Update) {
+	key, ok := lastValueKey(update)
+	if !ok {
+		return
+	}
+
+	if e, ok := t.lastValues[key]; ok {
+		e.Value.(*localLastValue).update = update
+		t.lastValueOrder.MoveToBack(e)
+
+		return
+	}
+
+	t.lastValues[key] = t.lastValueOrder.PushBack(&localLastValue{key, update})
+
+	if t.lastValueOrder.Len() > t.lastValueCacheSize {
+		oldest := t.lastValueOrder.Front()
+		t.lastValueOrder.Remove(oldest)
+		delete(t.lastValues, oldest.Value.(*localLastValue).key)
+	}
+}
+
+// lastValuesFor returns the cached updates s can receive, in publication order. The lock must be held.
+func (t *LocalTransport) lastValuesFor(s *LocalSubscriber) []*Update {
+	var updates []*Update
+
+	for e := t.lastValueOrder.Front(); e != nil; e = e.Next() {
+		if lv := e.Value.(*localLastValue); subscribedToLastValue(s, lv.key) && s.Match(lv.update) {
+			updates = append(updates, lv.update)
+		}
+	}
+
+	return updates
+}
+
+// initLastValues fills the last value bucket from the history when the cache
+// is enabled on an existing database, and deletes it when the cache is
+// disabled, so that it isn't stale if enabled again.
+func (t *BoltTransport) initLastValues() error {
+	name := []byte(t.bucketName + boltLastValuesBucketSuffix)
+
+	err := t.db.Update(func(tx *bolt.Tx) error {
+		if !t.lastValueCache {
+			if err := tx.DeleteBucket(name); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return fmt.Errorf("unable to delete Bolt DB bucket: %w", err)
+			}
+
+			return nil
+		}
+
+		if lastValues := tx.Bucket(name); lastValues != nil {
+			return t.pruneLastValues(tx, lastValues)
+		}
+
+		lastValues, err := tx.CreateBucket(name)
+		if err != nil {
+			return fmt.Errorf("error when creating Bolt DB bucket: %w", err)
+		}
+
+		b := tx.Bucket([]byte(t.bucketName))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			var update *Update
+			if err := json.Unmarshal(v, &update); err != nil {
+				return fmt.Errorf("unable to unmarshal update: %w", err)
+			}
+
+			// Later updates overwrite earlier ones.
+			return putLastValue(lastValues, update, k[:8], v)
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("unable to initialize the Bolt DB last value cache: %w", err)
+	}
+
+	return nil
+}
+
+// cacheLastValue stores update as the latest value of its topic.
+func (t *BoltTransport) cacheLastValue(tx *bolt.Tx, update *Update, prefix, updateJSON []byte) error {
+	if !t.lastValueCache {
+		return nil
+	}
+
+	lastValues, err := tx.CreateBucketIfNotExists([]byte(t.bucketName + boltLastValuesBucketSuffix))
+	if err != nil {
+		return fmt.Errorf("error when creating Bolt DB bucket: %w", err)
+	}
+
+	return putLastValue(lastValues, update, prefix, updateJSON)
+}
+
+// putLastValue stores the sequence of the update followed by its JSON representation.
+func putLastValue(lastValues *bolt.Bucket, update *Update, prefix, updateJSON []byte) error {
+	key, ok := lastValueKey(update)
+	if !ok {
+		return nil
+	}
+
+	if err := lastValues.Put([]byte(key), bytes.Join([][]byte{prefix, updateJSON}, nil)); err != nil {
+		return fmt.Errorf("unable to put value in Bolt DB: %w", err)
+	}
+
+	return nil
+}
+
+// pruneLastValues removes the last values whose update isn't in the history
+// anymore, such as the ones cached by versions not removing them along with
+// the updates.
+func (t *BoltTransport) pruneLastValues(tx *bolt.Tx, lastValues *bolt.Bucket) error {
+	var stale [][]byte
+
+	var c *bolt.Cursor
+	if b := tx.Bucket([]byte(t.bucketName)); b != nil {
+		c = b.Cursor()
+	}
+
+	if err := lastValues.ForEach(func(k, v []byte) error {
+		if c == nil || len(v) < 8 {
+			stale = append(stale, k)
+
+			return nil
+		}
+
+		if found, _ := c.Seek(v[:8]); !bytes.HasPrefix(found, v[:8]) {
+			stale = append(stale, k)
+		}
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unable to read Bolt DB bucket: %w", err)
+	}
+
+	for _, k := range stale {
+		if err := lastValues.Delete(k); err != nil {
+			return fmt.Errorf("unable to delete value in Bolt DB: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// uncacheLastValue removes the last value of the update with the sequence
+// prefix and the JSON representation updateJSON, if it is still the latest
+// of its topic. It is called when the update is removed from the history.
+func (t *BoltTransport) uncacheLastValue(tx *bolt.Tx, prefix, updateJSON []byte) error {
+	if !t.lastValueCache {
+		return nil
+	}
+
+	lastValues := tx.Bucket([]byte(t.bucketName + boltLastValuesBucketSuffix))
+	if lastValues == nil {
+		return nil
+	}
+
+	var update *Update
+	if err := json.Unmarshal(updateJSON, &update); err != nil {
+		return fmt.Errorf("unable to unmarshal update: %w", err)
+	}
+
+	key, ok := lastValueKey(update)
+	if !ok || !bytes.HasPrefix(lastValues.Get([]byte(key)), prefix) {
+		return nil
+	}
+
+	if err := lastValues.Delete([]byte(key)); err != nil {
+		return fmt.Errorf("unable to delete value in Bolt DB: %w", err)
+	}
+
+	return nil
+}
+
+// dispatchLastValues sends to s the cached updates it can receive, stored
+// up to the sequence snapshot toSeq. Later ones are delivered live. The last
+// values of the topics s is subscribed to are retrieved directly when it only
+// has exact matchers, and the values are only decoded when s is subscribed
+// to their topic.
+func (t *BoltTransport) dispatchLastValues(ctx context.Context, s *LocalSubscriber, toSeq uint64) error {
+	type lastValue struct {
+		seq    uint64
+		update *Update
+	}
+
+	var lastValues []lastValue
+
+	add := func(v []byte) error {
+		if len(v) < 8 || pastSeqBound(v, toSeq) {
+			return nil
+		}
+
+		var update *Update
+		if err := json.Unmarshal(v[8:], &update); err != nil {
+			return fmt.Errorf("unable to unmarshal update: %w", err)
+		}
+
+		if s.Match(update) {
+			lastValues = append(lastValues, lastValue{binary.BigEndian.Uint64(v[:8]), update})
+		}
+
+		return nil
+	}
+
+	err := t.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(t.bucketName + boltLastValuesBucketSuffix))
+		if b == nil {
+			return nil
+		}
+
+		if keys, ok := exactLastValueKeys(s); ok {
+			for _, k := range keys {
+				if err := add(b.Get([]byte(k))); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			if !subscribedToLastValue(s, string(k)) {
+				return nil
+			}
+
+			return add(v)
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("unable to retrieve last values from BoltDB: %w", err)
+	}
+
+	// Subscribing twice to the same topic retrieves its last values twice.
+	slices.SortFunc(lastValues, func(a, b lastValue) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+	lastValues = slices.CompactFunc(lastValues, func(a, b lastValue) bool {
+		return a.seq == b.seq
+	})
+
+	updates := make([]*Update, len(lastValues))
+	for i, lv := range lastValues {
+		updates[i] = lv.update
+	}
+
+	dispatchLastValues(ctx, s, updates)
+
+	return nil
+}
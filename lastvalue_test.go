@@ -0,0 +1,282 @@
+package mercure
+
+import (
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func dispatchLastValueFixtures(t *testing.T, transport Transport) {
+	t.Helper()
+
+	for _, u := range []*Update{
+		{Event: Event{ID: "a1"}, Topics: []string{"https://example.com/a"}},
+		{Event: Event{ID: "b1"}, Topics: []string{"https://example.com/b"}},
+		{Event: Event{ID: "a2"}, Topics: []string{"https://example.com/a", "https://example.com/alternate"}},
+		{Event: Event{ID: "c1"}, Topics: []string{"https://example.com/c"}, Private: true},
+		{Event: Event{ID: "d1"}, Topics: []string{"https://example.com/d"}},
+		{Event: Event{ID: "s1", Type: reservedEventType}, Topics: []string{"https://example.com/b"}},
+	} {
+		require.NoError(t, transport.Dispatch(t.Context(), u))
+	}
+}
+
+// assertLastValues subscribes to the a, b and c topics, and checks the received updates.
+func assertLastValues(t *testing.T, transport Transport, lastEventID string, expected ...string) {
+	t.Helper()
+
+	s := NewLocalSubscriber(lastEventID, slog.Default(), &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{
+		{Type: MatcherTypeExact, Pattern: "https://example.com/a"},
+		{Type: MatcherTypeExact, Pattern: "https://example.com/b"},
+		{Type: MatcherTypeExact, Pattern: "https://example.com/c"},
+	}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: "live"}, Topics: []string{"https://example.com/a"}}))
+
+	for _, id := range expected {
+		assert.Equal(t, id, (<-s.Receive()).ID)
+	}
+
+	assert.Equal(t, "live", (<-s.Receive()).ID)
+}
+
+func TestLocalTransportLastValueCache(t *testing.T) {
+	t.Parallel()
+
+	transport := NewLocalTransport(NewSubscriberList(0), WithLocalLastValueCache())
+	t.Cleanup(func() {
+		require.NoError(t, transport.Close(t.Context()))
+	})
+
+	dispatchLastValueFixtures(t, transport)
+
+	// The subscription event for b isn't cached, the private update isn't authorized.
+	assertLastValues(t, transport, "", "b1", "a2")
+}
+
+// assertPrivateLastValues checks that a private update doesn't replace the public last value of its topic.
+func assertPrivateLastValues(t *testing.T, transport Transport) {
+	t.Helper()
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: "public"}, Topics: []string{"https://example.com/a"}}))
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: "private"}, Topics: []string{"https://example.com/a"}, Private: true}))
+
+	matchers := []TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/a"}}
+
+	for _, tc := range []struct {
+		allowedPrivateMatchers []TopicMatcher
+		expected               []string
+	}{
+		{nil, []string{"public"}},
+		{matchers, []string{"public", "private"}},
+	} {
+		s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+		s.SetMatchers(matchers, tc.allowedPrivateMatchers)
+		require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+		for _, id := range tc.expected {
+			assert.Equal(t, id, (<-s.Receive()).ID)
+		}
+
+		assert.Empty(t, s.Receive())
+	}
+}
+
+func TestLocalTransportLastValueCachePrivate(t *testing.T) {
+	t.Parallel()
+
+	transport := NewLocalTransport(NewSubscriberList(0), WithLocalLastValueCache())
+	t.Cleanup(func() {
+		require.NoError(t, transport.Close(t.Context()))
+	})
+
+	assertPrivateLastValues(t, transport)
+}
+
+func TestLocalTransportLastValueCacheSize(t *testing.T) {
+	t.Parallel()
+
+	transport := NewLocalTransport(NewSubscriberList(0), WithLocalLastValueCacheSize(2))
+	t.Cleanup(func() {
+		require.NoError(t, transport.Close(t.Context()))
+	})
+
+	dispatchLastValueFixtures(t, transport)
+
+	// Only the values of c and d are kept.
+	assert.Len(t, transport.lastValues, 2)
+	assertLastValues(t, transport, "")
+}
+
+func TestLocalTransportLastValueCacheWithLastEventID(t *testing.T) {
+	t.Parallel()
+
+	transport := NewLocalTransport(NewSubscriberList(0), WithLocalLastValueCache(), WithLocalHistorySize(10))
+	t.Cleanup(func() {
+		require.NoError(t, transport.Close(t.Context()))
+	})
+
+	dispatchLastValueFixtures(t, transport)
+
+	// The history is sent instead.
+	assertLastValues(t, transport, "b1", "a2", "s1")
+}
+
+func TestLocalTransportWithoutLastValueCache(t *testing.T) {
+	t.Parallel()
+
+	transport := NewLocalTransport(NewSubscriberList(0))
+	t.Cleanup(func() {
+		require.NoError(t, transport.Close(t.Context()))
+	})
+
+	dispatchLastValueFixtures(t, transport)
+	assertLastValues(t, transport, "")
+}
+
+func TestBoltTransportLastValueCache(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0, WithBoltLastValueCache())
+
+	dispatchLastValueFixtures(t, transport)
+	assertLastValues(t, transport, "", "b1", "a2")
+	assertLastValues(t, transport, "b1", "a2", "s1", "live")
+}
+
+func TestBoltTransportLastValueCachePrivate(t *testing.T) {
+	t.Parallel()
+
+	assertPrivateLastValues(t, createBoltTransport(t, 0, 0, WithBoltLastValueCache()))
+}
+
+// boltLastValueKeys returns the keys of the last value bucket.
+func boltLastValueKeys(t *testing.T, transport *BoltTransport) []string {
+	t.Helper()
+
+	var keys []string
+
+	require.NoError(t, transport.db.View(func(tx *bolt.Tx) error {
+		//nolint:wrapcheck
+		return tx.Bucket([]byte(transport.bucketName + boltLastValuesBucketSuffix)).ForEach(func(k, _ []byte) error {
+			keys = append(keys, string(k))
+
+			return nil
+		})
+	}))
+
+	return keys
+}
+
+func TestBoltTransportLastValueCacheRetention(t *testing.T) {
+	t.Parallel()
+
+	// The last values are removed along with their update from the history,
+	// which only keeps c1, d1 and s1.
+	transport := createBoltTransport(t, 3, 1, WithBoltLastValueCache())
+
+	dispatchLastValueFixtures(t, transport)
+	assert.ElementsMatch(t, []string{privateLastValuePrefix + "https://example.com/c", "https://example.com/d"}, boltLastValueKeys(t, transport))
+	assertLastValues(t, transport, "")
+}
+
+func TestBoltTransportLastValueCacheCompaction(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0, WithBoltLastValueCache(), WithBoltCompaction(time.Hour,
+		BoltCompaction{Matcher: TopicMatcher{Type: MatcherTypeExact, Pattern: "https://example.com/a"}, Keep: 1},
+	))
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: "public"}, Topics: []string{"https://example.com/a"}}))
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: "private"}, Topics: []string{"https://example.com/a"}, Private: true}))
+
+	// The public update is superseded by the private one.
+	_, err := transport.compact(t.Context())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"private"}, historyIDs(t, transport))
+	assert.Equal(t, []string{privateLastValuePrefix + "https://example.com/a"}, boltLastValueKeys(t, transport))
+}
+
+func TestBoltTransportLastValueCacheMatchers(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0, WithBoltLastValueCache())
+	dispatchLastValueFixtures(t, transport)
+
+	for _, tc := range []struct {
+		name     string
+		matchers []TopicMatcher
+		expected []string
+	}{
+		{"pattern", []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/:x"}}, []string{"b1", "a2", "d1"}},
+		{"wildcard", []TopicMatcher{{Type: MatcherTypeExact, Pattern: "*"}}, []string{"b1", "a2", "d1"}},
+		{"duplicate", []TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/b"}, {Type: MatcherTypeExact, Pattern: "https://example.com/b"}}, []string{"b1"}},
+		// Updates are cached for their canonical topic only.
+		{"alternate", []TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/alternate"}}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+			s.SetMatchers(tc.matchers, nil)
+			require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+			for _, id := range tc.expected {
+				assert.Equal(t, id, (<-s.Receive()).ID)
+			}
+
+			assert.Empty(t, s.Receive())
+		})
+	}
+}
+
+func TestBoltTransportLastValueCacheInit(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "bolt.db")
+
+	transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), path, "", 0, 0)
+	require.NoError(t, err)
+
+	dispatchLastValueFixtures(t, transport)
+	require.NoError(t, transport.Close(t.Context()))
+
+	// Enabling the cache on an existing database fills it from the history.
+	transport, err = NewBoltTransport(NewSubscriberList(0), slog.Default(), path, "", 0, 0, WithBoltLastValueCache())
+	require.NoError(t, err)
+
+	assertLastValues(t, transport, "", "b1", "a2")
+	require.NoError(t, transport.Close(t.Context()))
+
+	// The last values whose update isn't in the history anymore are removed.
+	db, err := bolt.Open(path, 0o600, nil)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		//nolint:wrapcheck
+		return tx.Bucket([]byte(defaultBoltBucketName+boltLastValuesBucketSuffix)).Put([]byte("https://example.com/stale"), []byte("\x00\x00\x00\x00\x00\x00\x03\xe7{}"))
+	}))
+	require.NoError(t, db.Close())
+
+	transport, err = NewBoltTransport(NewSubscriberList(0), slog.Default(), path, "", 0, 0, WithBoltLastValueCache())
+	require.NoError(t, err)
+
+	assert.NotContains(t, boltLastValueKeys(t, transport), "https://example.com/stale")
+	require.NoError(t, transport.Close(t.Context()))
+
+	// Disabling it removes the bucket.
+	transport, err = NewBoltTransport(NewSubscriberList(0), slog.Default(), path, "", 0, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, transport.db.View(func(tx *bolt.Tx) error {
+		assert.Nil(t, tx.Bucket([]byte(defaultBoltBucketName+boltLastValuesBucketSuffix)))
+
+		return nil
+	}))
+	require.NoError(t, transport.Close(t.Context()))
+}
@@ -1,11 +1,46 @@
 package mercure
 
 import (
+	"container/list"
 	"context"
 	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// LocalOption sets an optional setting of LocalTransport.
+type LocalOption func(t *LocalTransport)
+
+// WithLocalHistorySize keeps the last size updates in memory, so subscribers
+// reconnecting with a recent Last-Event-ID receive the updates they missed.
+func WithLocalHistorySize(size uint64) LocalOption {
+	return func(t *LocalTransport) {
+		t.historySize = size
+	}
+}
+
+// WithLocalHistoryMaxAge keeps the updates dispatched during the last maxAge
+// in memory, so subscribers reconnecting with a recent Last-Event-ID receive
+// the updates they missed.
+func WithLocalHistoryMaxAge(maxAge time.Duration) LocalOption {
+	return func(t *LocalTransport) {
+		t.historyMaxAge = maxAge
+	}
+}
+
+// localHistoryEntry is an update kept in the in-memory history.
+type localHistoryEntry struct {
+	update *Update
+	seq    uint64
+	time   time.Time
+}
+
 // LocalTransport implements the TransportInterface without database and simply broadcast the live Updates.
+//
+// It optionally keeps the most recent updates in a bounded in-memory ring
+// buffer, to replay them to reconnecting subscribers.
 type LocalTransport struct {
 	sync.RWMutex
 
@@ -13,15 +48,55 @@ type LocalTransport struct {
 	lastEventID string
 	closed      chan struct{}
 	closedOnce  sync.Once
+
+	dispatchShards int
+	dispatcher     *shardedFanOut
+
+	historySize   uint64
+	historyMaxAge time.Duration
+	// history is a ring buffer: the oldest entry is at historyHead.
+	history      []localHistoryEntry
+	historyHead  int
+	historyLen   int
+	historyIndex map[string]uint64
+	lastSeq      uint64
+
+	// lastValues maps canonical topics to their latest update, in
+	// lastValueOrder, which lists them oldest first.
+	lastValues         map[string]*list.Element
+	lastValueOrder     *list.List
+	lastValueCacheSize int
+
+	// dedupKeys maps the idempotency keys of the deduplication window to
+	// the IDs of their updates, dedupQueue lists them oldest first.
+	dedupWindow time.Duration
+	dedupKeys   map[string]string
+	dedupQueue  []localDedupEntry
 }
 
 // NewLocalTransport creates a new LocalTransport.
-func NewLocalTransport(sl *SubscriberList) *LocalTransport {
-	return &LocalTransport{
+func NewLocalTransport(sl *SubscriberList, options ...LocalOption) *LocalTransport {
+	t := &LocalTransport{
 		subscribers: sl,
 		closed:      make(chan struct{}),
 		lastEventID: EarliestLastEventID,
 	}
+
+	for _, o := range options {
+		o(t)
+	}
+
+	if t.hasHistory() {
+		t.historyIndex = make(map[string]uint64)
+	}
+
+	t.dispatcher = newShardedFanOut(t.dispatchShards, t.closed)
+
+	return t
+}
+
+func (t *LocalTransport) hasHistory() bool {
+	return t.historySize > 0 || t.historyMaxAge > 0
 }
 
 // Dispatch dispatches an update to all subscribers.
@@ -34,10 +109,30 @@ func (t *LocalTransport) Dispatch(ctx context.Context, update *Update) error {
 
 	update.AssignUUID()
 
-	for _, s := range t.subscribers.MatchAny(update) {
-		s.Dispatch(ctx, update, false)
+	if t.hasHistory() || t.lastValues != nil {
+		// Storing the update and selecting the subscribers to dispatch it to
+		// must be atomic: a subscriber added in between would receive it both
+		// from the history and live, or not at all.
+		t.Lock()
+		if t.hasHistory() {
+			t.push(update)
+		}
+
+		if t.lastValues != nil {
+			t.cacheLastValue(update)
+		}
+
+		subscribers := t.subscribers.MatchAny(update)
+		t.lastEventID = update.ID
+		t.Unlock()
+
+		t.dispatcher.dispatch(ctx, update, subscribers)
+
+		return nil
 	}
 
+	t.dispatcher.dispatch(ctx, update, t.subscribers.MatchAny(update))
+
 	t.Lock()
 	t.lastEventID = update.ID
 	t.Unlock()
@@ -45,6 +140,84 @@ func (t *LocalTransport) Dispatch(ctx context.Context, update *Update) error {
 	return nil
 }
 
+// push appends the update to the history, and evicts the entries exceeding the limits.
+func (t *LocalTransport) push(update *Update) {
+	now := time.Now()
+	t.evictExpired(now)
+
+	if t.historySize > 0 && uint64(t.historyLen) >= t.historySize {
+		t.evictOldest()
+	}
+
+	if t.historyLen == len(t.history) {
+		// The buffer is full but below the size limit, if any: grow it, the
+		// oldest entry first.
+		capacity := max(2*len(t.history), 16)
+		if t.historySize > 0 && uint64(capacity) > t.historySize {
+			capacity = int(t.historySize) //nolint:gosec
+		}
+
+		grown := make([]localHistoryEntry, capacity)
+		n := copy(grown, t.history[t.historyHead:])
+		copy(grown[n:], t.history[:t.historyHead])
+
+		t.history = grown
+		t.historyHead = 0
+	}
+
+	t.lastSeq++
+	t.history[(t.historyHead+t.historyLen)%len(t.history)] = localHistoryEntry{update: update, seq: t.lastSeq, time: now}
+	t.historyLen++
+
+	// If several updates share the same ID, the index points to the latest one.
+	t.historyIndex[update.ID] = t.lastSeq
+}
+
+func (t *LocalTransport) evictExpired(now time.Time) {
+	if t.historyMaxAge <= 0 {
+		return
+	}
+
+	for t.historyLen > 0 && now.Sub(t.history[t.historyHead].time) > t.historyMaxAge {
+		t.evictOldest()
+	}
+}
+
+func (t *LocalTransport) evictOldest() {
+	e := t.history[t.historyHead]
+	if t.historyIndex[e.update.ID] == e.seq {
+		delete(t.historyIndex, e.update.ID)
+	}
+
+	t.history[t.historyHead] = localHistoryEntry{}
+	t.historyHead = (t.historyHead + 1) % len(t.history)
+	t.historyLen--
+}
+
+// historySince returns the updates dispatched after the one with the given
+// ID, and whether this ID has been found. EarliestLastEventID returns the
+// whole history.
+func (t *LocalTransport) historySince(lastEventID string) ([]*Update, bool) {
+	t.evictExpired(time.Now())
+
+	from := 0
+	if lastEventID != EarliestLastEventID {
+		seq, ok := t.historyIndex[lastEventID]
+		if !ok {
+			return nil, false
+		}
+
+		from = int(seq-t.history[t.historyHead].seq) + 1 //nolint:gosec
+	}
+
+	updates := make([]*Update, 0, t.historyLen-from)
+	for i := from; i < t.historyLen; i++ {
+		updates = append(updates, t.history[(t.historyHead+i)%len(t.history)].update)
+	}
+
+	return updates, true
+}
+
 // AddSubscriber adds a new subscriber to the transport.
 func (t *LocalTransport) AddSubscriber(ctx context.Context, s *LocalSubscriber) error {
 	select {
@@ -53,6 +226,34 @@ func (t *LocalTransport) AddSubscriber(ctx context.Context, s *LocalSubscriber)
 	default:
 	}
 
+	if t.hasHistory() || t.lastValues != nil {
+		t.Lock()
+		t.subscribers.Add(s)
+
+		var (
+			history    []*Update
+			found      bool
+			lastValues []*Update
+		)
+
+		switch {
+		case s.RequestLastEventIDSet && t.hasHistory():
+			history, found = t.historySince(s.RequestLastEventID)
+		case !s.RequestLastEventIDSet && t.lastValues != nil:
+			lastValues = t.lastValuesFor(s)
+		}
+		t.Unlock()
+
+		if s.RequestLastEventIDSet {
+			t.dispatchHistory(ctx, s, history, found)
+		}
+
+		dispatchLastValues(ctx, s, lastValues)
+		s.Ready(ctx)
+
+		return nil
+	}
+
 	t.Lock()
 	defer t.Unlock()
 
@@ -67,6 +268,33 @@ func (t *LocalTransport) AddSubscriber(ctx context.Context, s *LocalSubscriber)
 	return nil
 }
 
+func (t *LocalTransport) dispatchHistory(ctx context.Context, s *LocalSubscriber, history []*Update, found bool) {
+	ctx, span := startSpan(ctx, "mercure.transport.history",
+		trace.WithAttributes(
+			attribute.String("mercure.transport", "local"),
+			attribute.String("mercure.subscriber.id", s.ID),
+			attribute.String("mercure.last_event_id.requested", s.RequestLastEventID),
+		))
+	defer span.End()
+
+	if !found {
+		// The requested event doesn't exist or has been evicted: report
+		// "earliest" to tell the subscriber to re-fetch.
+		s.HistoryDispatched(EarliestLastEventID)
+
+		return
+	}
+
+	for _, u := range history {
+		if s.Match(u) && !s.Dispatch(ctx, u, true) {
+			break
+		}
+	}
+
+	// The subscriber already knows the requested id; echoing it is not a disclosure.
+	s.HistoryDispatched(s.RequestLastEventID)
+}
+
 // RemoveSubscriber removes a subscriber from the transport.
 func (t *LocalTransport) RemoveSubscriber(_ context.Context, s *LocalSubscriber) error {
 	select {
@@ -83,6 +311,14 @@ func (t *LocalTransport) RemoveSubscriber(_ context.Context, s *LocalSubscriber)
 	return nil
 }
 
+// LastEventID returns the ID of the last dispatched update.
+func (t *LocalTransport) LastEventID(_ context.Context) string {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.lastEventID
+}
+
 // GetSubscribers gets the list of active subscribers.
 func (t *LocalTransport) GetSubscribers(_ context.Context) (string, []*Subscriber, error) {
 	t.RLock()
@@ -108,5 +344,9 @@ func (t *LocalTransport) Close(_ context.Context) (err error) {
 	return nil
 }
 
-// Interface guard.
-var _ Transport = (*LocalTransport)(nil)
+// Interface guards.
+var (
+	_ Transport             = (*LocalTransport)(nil)
+	_ TransportLastEventID  = (*LocalTransport)(nil)
+	_ TransportDeduplicator = (*LocalTransport)(nil)
+)
@@ -2,8 +2,10 @@ package mercure
 
 import (
 	"log/slog"
+	"strconv"
 	"testing"
 	"testing/synctest"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -168,3 +170,111 @@ func TestLocalTransportGetSubscribers(t *testing.T) {
 	assert.Contains(t, subscribers, &s1.Subscriber)
 	assert.Contains(t, subscribers, &s2.Subscriber)
 }
+
+func TestLocalTransportHistory(t *testing.T) {
+	t.Parallel()
+
+	transport := NewLocalTransport(NewSubscriberList(0), WithLocalHistorySize(10))
+	t.Cleanup(func() {
+		assert.NoError(t, transport.Close(t.Context()))
+	})
+
+	ctx := t.Context()
+
+	require.NoError(t, transport.Dispatch(ctx, &Update{Topics: []string{"https://example.com/subscribed"}, Event: Event{ID: "1"}}))
+	require.NoError(t, transport.Dispatch(ctx, &Update{Topics: []string{"https://example.com/subscribed"}, Event: Event{ID: "2"}}))
+	require.NoError(t, transport.Dispatch(ctx, &Update{Topics: []string{"https://example.com/not-subscribed"}, Event: Event{ID: "3"}}))
+	require.NoError(t, transport.Dispatch(ctx, &Update{Topics: []string{"https://example.com/subscribed"}, Private: true, Event: Event{ID: "4"}}))
+	require.NoError(t, transport.Dispatch(ctx, &Update{Topics: []string{"https://example.com/subscribed"}, Event: Event{ID: "5"}}))
+
+	s := NewLocalSubscriber("1", slog.Default(), &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/subscribed"}}, nil)
+	require.NoError(t, transport.AddSubscriber(ctx, s))
+
+	assert.Equal(t, "1", <-s.responseLastEventID)
+	assert.Equal(t, "2", (<-s.Receive()).ID)
+	assert.Equal(t, "5", (<-s.Receive()).ID)
+
+	// Live updates are dispatched after the history.
+	require.NoError(t, transport.Dispatch(ctx, &Update{Topics: []string{"https://example.com/subscribed"}, Event: Event{ID: "6"}}))
+	assert.Equal(t, "6", (<-s.Receive()).ID)
+}
+
+func TestLocalTransportHistorySize(t *testing.T) {
+	t.Parallel()
+
+	transport := NewLocalTransport(NewSubscriberList(0), WithLocalHistorySize(20))
+	t.Cleanup(func() {
+		assert.NoError(t, transport.Close(t.Context()))
+	})
+
+	for i := range 50 {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{Topics: []string{"https://example.com/foo"}, Event: Event{ID: strconv.Itoa(i)}}))
+	}
+
+	// The evicted update can't be resumed from.
+	s := NewLocalSubscriber("29", slog.Default(), &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+	assert.Equal(t, EarliestLastEventID, <-s.responseLastEventID)
+
+	s = NewLocalSubscriber(EarliestLastEventID, slog.Default(), &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+	assert.Equal(t, EarliestLastEventID, <-s.responseLastEventID)
+
+	for i := 30; i < 50; i++ {
+		assert.Equal(t, strconv.Itoa(i), (<-s.Receive()).ID)
+	}
+
+	s = NewLocalSubscriber("47", slog.Default(), &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+	assert.Equal(t, "47", <-s.responseLastEventID)
+	assert.Equal(t, "48", (<-s.Receive()).ID)
+	assert.Equal(t, "49", (<-s.Receive()).ID)
+}
+
+func TestLocalTransportHistoryMaxAge(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		transport := NewLocalTransport(NewSubscriberList(0), WithLocalHistoryMaxAge(time.Minute))
+		t.Cleanup(func() {
+			assert.NoError(t, transport.Close(t.Context()))
+		})
+
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{Topics: []string{"https://example.com/foo"}, Event: Event{ID: "1"}}))
+		time.Sleep(45 * time.Second)
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{Topics: []string{"https://example.com/foo"}, Event: Event{ID: "2"}}))
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{Topics: []string{"https://example.com/foo"}, Event: Event{ID: "3"}}))
+		time.Sleep(30 * time.Second)
+
+		s := NewLocalSubscriber("1", slog.Default(), &TopicMatcherStore{})
+		s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}}, nil)
+		require.NoError(t, transport.AddSubscriber(t.Context(), s))
+		assert.Equal(t, EarliestLastEventID, <-s.responseLastEventID)
+
+		s = NewLocalSubscriber("2", slog.Default(), &TopicMatcherStore{})
+		s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}}, nil)
+		require.NoError(t, transport.AddSubscriber(t.Context(), s))
+		assert.Equal(t, "2", <-s.responseLastEventID)
+		assert.Equal(t, "3", (<-s.Receive()).ID)
+	})
+}
+
+func TestLocalTransportWithoutHistory(t *testing.T) {
+	t.Parallel()
+
+	transport := NewLocalTransport(NewSubscriberList(0))
+	t.Cleanup(func() {
+		assert.NoError(t, transport.Close(t.Context()))
+	})
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Topics: []string{"https://example.com/foo"}, Event: Event{ID: "1"}}))
+
+	s := NewLocalSubscriber("1", slog.Default(), &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+	assert.Equal(t, EarliestLastEventID, <-s.responseLastEventID)
+}
@@ -98,3 +98,45 @@ SUB_TEST_CONCURRENCY=20000 \
 	go test -bench=. -run=BenchmarkLocalTransport -cpuprofile profile.out -benchmem
 go tool pprof --pdf _dist/bin profile.out > profile.pdf
 */
+
+// BenchmarkLocalTransportFanOut measures the latency of publishing an update
+// to a large audience, dispatched serially or by the sharded fan-out.
+func BenchmarkLocalTransportFanOut(b *testing.B) {
+	for _, audience := range []int{1_000, 10_000, 50_000} {
+		for _, shards := range []int{0, 4, 16} {
+			b.Run(fmt.Sprintf("audience=%d/shards=%d", audience, shards), func(b *testing.B) {
+				tr := NewLocalTransport(NewSubscriberList(1_000), WithLocalDispatchShards(shards))
+				ctx, done := context.WithCancel(b.Context())
+
+				b.Cleanup(func() {
+					done()
+					assert.NoError(b, tr.Close(b.Context()))
+				})
+
+				for range audience {
+					s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+					s.setMatchers(stringsToExactMatchers([]string{"https://example.com/broadcast"}), nil)
+					require.NoError(b, tr.AddSubscriber(ctx, s))
+
+					go func() {
+						for {
+							select {
+							case <-s.Receive():
+							case <-ctx.Done():
+								return
+							}
+						}
+					}()
+				}
+
+				u := &Update{Event: Event{ID: "a"}, Topics: []string{"https://example.com/broadcast"}}
+
+				b.ResetTimer()
+
+				for b.Loop() {
+					require.NoError(b, tr.Dispatch(ctx, u))
+				}
+			})
+		}
+	}
+}
@@ -19,17 +19,36 @@ type LocalSubscriber struct {
 	responseLastEventID chan string
 	ready               atomic.Uint32
 	liveQueue           []*Update
+	withTopics          bool
+	// poll is true for long-polling subscribers.
+	poll bool
+	// shard is the worker of the sharded fan-out dispatching to this subscriber.
+	shard uint64
+
+	slowPolicy            SlowSubscriberPolicy
+	slowSubscriberMetrics SlowSubscriberMetrics
+	// dropped is the number of updates dropped since the subscriber has last been notified.
+	dropped atomic.Uint64
+	// pending are the conflated updates waiting for room in out.
+	pending      []*Update
+	pendingCount atomic.Int64
 }
 
-const outBufferLength = 1000
+// localSubscriberCount assigns the subscribers to the fan-out workers in turn.
+var localSubscriberCount atomic.Uint64 //nolint:gochecknoglobals
 
 // NewLocalSubscriber creates a new subscriber.
 func NewLocalSubscriber(lastEventID string, logger *slog.Logger, topicMatcherStore *TopicMatcherStore) *LocalSubscriber {
+	return newLocalSubscriber(lastEventID, logger, topicMatcherStore, DefaultSubscriberBufferSize)
+}
+
+func newLocalSubscriber(lastEventID string, logger *slog.Logger, topicMatcherStore *TopicMatcherStore, bufferSize int) *LocalSubscriber {
 	id := "urn:uuid:" + uuid.Must(uuid.NewV4()).String()
 	s := &LocalSubscriber{
 		Subscriber:          *NewSubscriber(logger, topicMatcherStore),
 		responseLastEventID: make(chan string, 1),
-		out:                 make(chan *Update, outBufferLength),
+		out:                 make(chan *Update, bufferSize),
+		shard:               localSubscriberCount.Add(1),
 	}
 
 	s.ID = id
@@ -57,14 +76,20 @@ func (s *LocalSubscriber) Dispatch(ctx context.Context, u *Update, fromHistory b
 		return true
 	}
 
-	select {
-	case s.out <- u:
-		return true
-	default:
-		s.handleFullChan(ctx)
+	return s.send(ctx, u)
+}
 
-		return false
+// send queues u, applying the slow subscriber policy if the out channel is full.
+func (s *LocalSubscriber) send(ctx context.Context, u *Update) bool {
+	if s.pending == nil || s.flushPending() {
+		select {
+		case s.out <- u:
+			return true
+		default:
+		}
 	}
+
+	return s.handleFullChan(ctx, u)
 }
 
 // Ready flips the ready flag to true and flushes queued live updates returning number of events flushed.
@@ -77,16 +102,14 @@ func (s *LocalSubscriber) Ready(ctx context.Context) (n int) {
 	}
 
 	for _, u := range s.liveQueue {
-		select {
-		case s.out <- u:
-			n++
-		default:
+		if !s.send(ctx, u) {
 			s.ready.Store(1)
-			s.handleFullChan(ctx)
 			s.liveQueue = nil
 
 			return n
 		}
+
+		n++
 	}
 
 	s.ready.Store(1)
@@ -95,6 +118,16 @@ func (s *LocalSubscriber) Ready(ctx context.Context) (n int) {
 	return n
 }
 
+// updateTopics returns the topics of u to send to the subscriber: none,
+// unless it asked for them, and then only those it is authorized for.
+func (s *LocalSubscriber) updateTopics(u *Update) []string {
+	if !s.withTopics {
+		return nil
+	}
+
+	return s.authorizedTopics(u)
+}
+
 // Receive returns a chan when incoming updates are dispatched.
 func (s *LocalSubscriber) Receive() <-chan *Update {
 	return s.out
@@ -105,6 +138,14 @@ func (s *LocalSubscriber) HistoryDispatched(responseLastEventID string) {
 	s.responseLastEventID <- responseLastEventID
 }
 
+// ResponseLastEventID returns a chan receiving the value passed to
+// HistoryDispatched, to send in the Mercure-Last-Event-ID header. Transports
+// call HistoryDispatched exactly once if RequestLastEventIDSet is true, and
+// never otherwise.
+func (s *LocalSubscriber) ResponseLastEventID() <-chan string {
+	return s.responseLastEventID
+}
+
 // Disconnect disconnects the subscriber.
 func (s *LocalSubscriber) Disconnect() {
 	s.mutex.Lock()
@@ -113,15 +154,6 @@ func (s *LocalSubscriber) Disconnect() {
 	s.doDisconnect()
 }
 
-// handleFullChan disconnects the subscriber when the out channel is full.
-func (s *LocalSubscriber) handleFullChan(ctx context.Context) {
-	s.doDisconnect()
-
-	if s.logger.Enabled(ctx, slog.LevelInfo) {
-		s.logger.LogAttrs(ctx, slog.LevelInfo, "Subscriber unable to receive updates fast enough")
-	}
-}
-
 func (s *LocalSubscriber) doDisconnect() {
 	if s.disconnected.Load() > 0 {
 		return // already disconnected
@@ -129,4 +161,7 @@ func (s *LocalSubscriber) doDisconnect() {
 
 	s.disconnected.Store(1)
 	close(s.out)
+
+	s.pending = nil
+	s.pendingCount.Store(0)
 }
@@ -0,0 +1,554 @@
+// Package mercuretest provides a conformance test suite for implementations of mercure.Transport.
+package mercuretest
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dunglas/mercure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	topic      = "https://example.com/mercuretest/foo"
+	otherTopic = "https://example.com/mercuretest/bar"
+
+	// timeout is the maximum delay to receive an expected update.
+	timeout = 5 * time.Second
+	// silence is how long to wait before asserting that no update has been received.
+	silence = 50 * time.Millisecond
+)
+
+// TransportFactory creates the transport to test, with an empty history.
+// The suite closes it at the end of each test.
+type TransportFactory func(t *testing.T) mercure.Transport
+
+// SuiteOption sets an optional setting of the suite.
+type SuiteOption func(s *suite)
+
+// WithoutHistory skips the tests requiring the transport to keep a history,
+// and checks that subscribers requesting one are told to re-fetch instead.
+func WithoutHistory() SuiteOption {
+	return func(s *suite) {
+		s.withoutHistory = true
+	}
+}
+
+// WithAsyncDispatch is for transports dispatching the updates when they are
+// read back from a store shared by several hubs, such as a stream: before
+// subscribing, the suite waits for the updates previously dispatched to be
+// read, using TransportLastEventID, and for the transport to be ready.
+func WithAsyncDispatch() SuiteOption {
+	return func(s *suite) {
+		s.asyncDispatch = true
+	}
+}
+
+type suite struct {
+	factory        TransportFactory
+	withoutHistory bool
+	asyncDispatch  bool
+}
+
+// RunTransportSuite checks that the transports created by factory behave as
+// the built-in ones: live dispatch, history replay, the value reported by
+// HistoryDispatched, subscriptions concurrent with dispatches, the list of
+// subscribers, the last event ID, and the behavior after Close.
+func RunTransportSuite(t *testing.T, factory TransportFactory, options ...SuiteOption) {
+	t.Helper()
+
+	s := &suite{factory: factory}
+	for _, o := range options {
+		o(s)
+	}
+
+	tests := []struct {
+		name    string
+		test    func(t *testing.T)
+		history bool
+	}{
+		{"Dispatch", s.testDispatch, false},
+		{"DispatchAssignsID", s.testDispatchAssignsID, false},
+		{"DispatchPrivate", s.testDispatchPrivate, false},
+		{"NoLastEventID", s.testNoLastEventID, false},
+		{"UnknownLastEventID", s.testUnknownLastEventID, false},
+		{"EmptyLastEventID", s.testEmptyLastEventID, false},
+		{"History", s.testHistory, true},
+		{"HistoryEarliest", s.testHistoryEarliest, true},
+		{"HistoryMatch", s.testHistoryMatch, true},
+		{"HistoryAndLive", s.testHistoryAndLive, true},
+		{"SubscribeDuringDispatch", s.testSubscribeDuringDispatch, false},
+		{"GetSubscribers", s.testGetSubscribers, false},
+		{"LastEventID", s.testLastEventID, false},
+		{"Health", s.testHealth, false},
+		{"Close", s.testClose, false},
+	}
+
+	for _, tt := range tests {
+		if tt.history && s.withoutHistory {
+			continue
+		}
+
+		t.Run(tt.name, tt.test)
+	}
+}
+
+// newTransport creates a transport, closed at the end of the test.
+func (s *suite) newTransport(t *testing.T) mercure.Transport { //nolint:ireturn
+	t.Helper()
+
+	transport := s.factory(t)
+
+	t.Cleanup(func() {
+		assert.NoError(t, transport.Close(t.Context()))
+	})
+
+	return transport
+}
+
+// newSubscriber creates a subscriber to topics, allowed to receive the private updates of privateTopics.
+func newSubscriber(lastEventID string, topics, privateTopics []string) *mercure.LocalSubscriber {
+	s := mercure.NewLocalSubscriber(lastEventID, slog.Default(), &mercure.TopicMatcherStore{})
+	s.SetMatchers(exactMatchers(topics), exactMatchers(privateTopics))
+
+	return s
+}
+
+func exactMatchers(topics []string) []mercure.TopicMatcher {
+	matchers := make([]mercure.TopicMatcher, len(topics))
+	for i, t := range topics {
+		matchers[i] = mercure.TopicMatcher{Type: mercure.MatcherTypeExact, Pattern: t}
+	}
+
+	return matchers
+}
+
+func dispatch(t *testing.T, transport mercure.Transport, id string, topics ...string) {
+	t.Helper()
+
+	require.NoError(t, transport.Dispatch(t.Context(), &mercure.Update{Event: mercure.Event{ID: id, Data: "data " + id}, Topics: topics}))
+}
+
+func dispatchRange(t *testing.T, transport mercure.Transport, from, to int) {
+	t.Helper()
+
+	for i := from; i <= to; i++ {
+		dispatch(t, transport, strconv.Itoa(i), topic)
+	}
+}
+
+// waitDispatched waits for the update with the given ID to be dispatched by
+// transports using WithAsyncDispatch.
+func (s *suite) waitDispatched(t *testing.T, transport mercure.Transport, id string) {
+	t.Helper()
+
+	if !s.asyncDispatch {
+		return
+	}
+
+	tl, ok := mercure.TransportAs[mercure.TransportLastEventID](transport)
+	require.True(t, ok, "transports dispatching asynchronously must implement TransportLastEventID")
+
+	require.Eventually(t, func() bool {
+		return tl.LastEventID(t.Context()) == id
+	}, timeout, time.Millisecond)
+}
+
+func receive(t *testing.T, s *mercure.LocalSubscriber) *mercure.Update {
+	t.Helper()
+
+	select {
+	case u, ok := <-s.Receive():
+		require.True(t, ok, "the subscriber has been disconnected")
+
+		return u
+	case <-time.After(timeout):
+		require.FailNow(t, "no update received")
+
+		return nil
+	}
+}
+
+func assertReceivedIDs(t *testing.T, s *mercure.LocalSubscriber, ids ...string) {
+	t.Helper()
+
+	for _, id := range ids {
+		assert.Equal(t, id, receive(t, s).ID)
+	}
+}
+
+func assertNothingReceived(t *testing.T, s *mercure.LocalSubscriber) {
+	t.Helper()
+
+	select {
+	case u, ok := <-s.Receive():
+		if ok {
+			assert.Failf(t, "unexpected update", "received %q", u.ID)
+		}
+	case <-time.After(silence):
+	}
+}
+
+func responseLastEventID(t *testing.T, s *mercure.LocalSubscriber) string {
+	t.Helper()
+
+	select {
+	case id := <-s.ResponseLastEventID():
+		return id
+	case <-time.After(timeout):
+		require.FailNow(t, "HistoryDispatched hasn't been called")
+
+		return ""
+	}
+}
+
+func ids(from, to int) []string {
+	ids := make([]string, 0, to-from+1)
+	for i := from; i <= to; i++ {
+		ids = append(ids, strconv.Itoa(i))
+	}
+
+	return ids
+}
+
+func (s *suite) testDispatch(t *testing.T) {
+	transport := s.newTransport(t)
+
+	sub := newSubscriber("", []string{topic}, nil)
+	other := newSubscriber("", []string{otherTopic}, nil)
+
+	require.NoError(t, transport.AddSubscriber(t.Context(), sub))
+	require.NoError(t, transport.AddSubscriber(t.Context(), other))
+
+	dispatch(t, transport, "1", topic)
+	dispatch(t, transport, "2", otherTopic, topic)
+
+	u := receive(t, sub)
+	assert.Equal(t, "1", u.ID)
+	assert.Equal(t, "data 1", u.Data)
+	assert.Equal(t, []string{topic}, u.Topics)
+
+	assertReceivedIDs(t, sub, "2")
+	assertReceivedIDs(t, other, "2")
+	assertNothingReceived(t, other)
+}
+
+func (s *suite) testDispatchAssignsID(t *testing.T) {
+	transport := s.newTransport(t)
+
+	sub := newSubscriber("", []string{topic}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), sub))
+
+	u := &mercure.Update{Topics: []string{topic}}
+	require.NoError(t, transport.Dispatch(t.Context(), u))
+	require.NotEmpty(t, u.ID)
+
+	assert.Equal(t, u.ID, receive(t, sub).ID)
+}
+
+func (s *suite) testDispatchPrivate(t *testing.T) {
+	transport := s.newTransport(t)
+
+	allowed := newSubscriber("", []string{topic}, []string{topic})
+	denied := newSubscriber("", []string{topic}, nil)
+
+	require.NoError(t, transport.AddSubscriber(t.Context(), allowed))
+	require.NoError(t, transport.AddSubscriber(t.Context(), denied))
+
+	require.NoError(t, transport.Dispatch(t.Context(), &mercure.Update{Event: mercure.Event{ID: "1"}, Topics: []string{topic}, Private: true}))
+
+	u := receive(t, allowed)
+	assert.Equal(t, "1", u.ID)
+	assert.True(t, u.Private)
+
+	assertNothingReceived(t, denied)
+}
+
+// HistoryDispatched must not be called for subscribers that didn't request a history.
+func (s *suite) testNoLastEventID(t *testing.T) {
+	transport := s.newTransport(t)
+
+	dispatchRange(t, transport, 1, 2)
+	s.waitDispatched(t, transport, "2")
+
+	sub := newSubscriber("", []string{topic}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), sub))
+
+	dispatch(t, transport, "3", topic)
+	assertReceivedIDs(t, sub, "3")
+
+	select {
+	case id := <-sub.ResponseLastEventID():
+		assert.Failf(t, "HistoryDispatched called", "with %q", id)
+	default:
+	}
+}
+
+// A requested event that doesn't exist is reported as "earliest", and nothing is replayed.
+func (s *suite) testUnknownLastEventID(t *testing.T) {
+	transport := s.newTransport(t)
+
+	dispatchRange(t, transport, 1, 3)
+	s.waitDispatched(t, transport, "3")
+
+	sub := newSubscriber("unknown", []string{topic}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), sub))
+
+	assert.Equal(t, mercure.EarliestLastEventID, responseLastEventID(t, sub))
+
+	dispatch(t, transport, "4", topic)
+	assertReceivedIDs(t, sub, "4")
+}
+
+// A Last-Event-ID sent with an empty value still gets a response value, "earliest".
+func (s *suite) testEmptyLastEventID(t *testing.T) {
+	transport := s.newTransport(t)
+
+	dispatchRange(t, transport, 1, 3)
+	s.waitDispatched(t, transport, "3")
+
+	sub := newSubscriber("", []string{topic}, nil)
+	sub.RequestLastEventIDSet = true
+	require.NoError(t, transport.AddSubscriber(t.Context(), sub))
+
+	assert.Equal(t, mercure.EarliestLastEventID, responseLastEventID(t, sub))
+
+	dispatch(t, transport, "4", topic)
+	assertReceivedIDs(t, sub, "4")
+}
+
+// The updates following the requested one are replayed in order, and the requested ID is echoed.
+func (s *suite) testHistory(t *testing.T) {
+	transport := s.newTransport(t)
+
+	dispatchRange(t, transport, 1, 10)
+	s.waitDispatched(t, transport, "10")
+
+	sub := newSubscriber("7", []string{topic}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), sub))
+
+	assert.Equal(t, "7", responseLastEventID(t, sub))
+	assertReceivedIDs(t, sub, ids(8, 10)...)
+	assertNothingReceived(t, sub)
+}
+
+// "earliest" replays the whole history.
+func (s *suite) testHistoryEarliest(t *testing.T) {
+	transport := s.newTransport(t)
+
+	dispatchRange(t, transport, 1, 5)
+	s.waitDispatched(t, transport, "5")
+
+	sub := newSubscriber(mercure.EarliestLastEventID, []string{topic}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), sub))
+
+	assert.Equal(t, mercure.EarliestLastEventID, responseLastEventID(t, sub))
+	assertReceivedIDs(t, sub, ids(1, 5)...)
+}
+
+// Only the updates matching the subscription, and the private ones the subscriber is allowed to receive, are replayed.
+func (s *suite) testHistoryMatch(t *testing.T) {
+	transport := s.newTransport(t)
+
+	dispatch(t, transport, "1", topic)
+	dispatch(t, transport, "2", otherTopic)
+	require.NoError(t, transport.Dispatch(t.Context(), &mercure.Update{Event: mercure.Event{ID: "3"}, Topics: []string{topic}, Private: true}))
+	require.NoError(t, transport.Dispatch(t.Context(), &mercure.Update{Event: mercure.Event{ID: "4", Type: "type", Data: "data\nline", Retry: 10}, Topics: []string{otherTopic, topic}}))
+	s.waitDispatched(t, transport, "4")
+
+	sub := newSubscriber("1", []string{topic}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), sub))
+
+	assert.Equal(t, "1", responseLastEventID(t, sub))
+
+	u := receive(t, sub)
+	assert.Equal(t, "4", u.ID)
+	assert.Equal(t, "type", u.Type)
+	assert.Equal(t, "data\nline", u.Data)
+	assert.Equal(t, uint64(10), u.Retry)
+	assert.Equal(t, []string{otherTopic, topic}, u.Topics)
+
+	assertNothingReceived(t, sub)
+}
+
+// Live updates are received after the replayed ones.
+func (s *suite) testHistoryAndLive(t *testing.T) {
+	transport := s.newTransport(t)
+
+	dispatchRange(t, transport, 1, 3)
+	s.waitDispatched(t, transport, "3")
+
+	sub := newSubscriber("1", []string{topic}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), sub))
+
+	dispatch(t, transport, "4", topic)
+
+	assert.Equal(t, "1", responseLastEventID(t, sub))
+	assertReceivedIDs(t, sub, ids(2, 4)...)
+}
+
+// Subscribers added while updates are dispatched receive each update at
+// most once, in order. With a history, they receive every update following
+// the requested one: none is lost or duplicated between the history and the
+// live updates.
+func (s *suite) testSubscribeDuringDispatch(t *testing.T) {
+	const (
+		updates     = 200
+		subscribers = 20
+	)
+
+	transport := s.newTransport(t)
+
+	dispatch(t, transport, "0", topic)
+	s.waitDispatched(t, transport, "0")
+
+	var wg sync.WaitGroup
+
+	wg.Go(func() {
+		for i := 1; i <= updates; i++ {
+			assert.NoError(t, transport.Dispatch(t.Context(), &mercure.Update{Event: mercure.Event{ID: strconv.Itoa(i)}, Topics: []string{topic}}))
+		}
+	})
+
+	subs := make([]*mercure.LocalSubscriber, subscribers)
+	for i := range subs {
+		lastEventID := "0"
+		if s.withoutHistory {
+			lastEventID = ""
+		}
+
+		subs[i] = newSubscriber(lastEventID, []string{topic}, nil)
+		require.NoError(t, transport.AddSubscriber(t.Context(), subs[i]))
+	}
+
+	wg.Wait()
+
+	// Mark the end of the stream.
+	dispatch(t, transport, "end", topic)
+
+	for _, sub := range subs {
+		var received []string
+
+		for u := receive(t, sub); u.ID != "end"; u = receive(t, sub) {
+			received = append(received, u.ID)
+		}
+
+		if !s.withoutHistory {
+			assert.Equal(t, ids(1, updates), received)
+
+			continue
+		}
+
+		assert.True(t, slices.IsSortedFunc(received, func(a, b string) int {
+			i, _ := strconv.Atoi(a)
+			j, _ := strconv.Atoi(b)
+
+			return i - j
+		}), "updates received out of order: %v", received)
+		assert.Len(t, slices.Compact(slices.Clone(received)), len(received), "updates received twice: %v", received)
+	}
+}
+
+func (s *suite) testGetSubscribers(t *testing.T) {
+	transport := s.newTransport(t)
+
+	ts, ok := mercure.TransportAs[mercure.TransportSubscribers](transport)
+	if !ok {
+		t.Skip("the transport doesn't implement TransportSubscribers")
+	}
+
+	sub := newSubscriber("", []string{topic}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), sub))
+
+	dispatchRange(t, transport, 1, 2)
+	assertReceivedIDs(t, sub, "1", "2")
+
+	lastEventID, subscribers, err := ts.GetSubscribers(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "2", lastEventID)
+	require.Len(t, subscribers, 1)
+	assert.Equal(t, sub.ID, subscribers[0].ID)
+	assert.Equal(t, sub.SubscribedMatchers, subscribers[0].SubscribedMatchers)
+
+	require.NoError(t, transport.RemoveSubscriber(t.Context(), sub))
+
+	_, subscribers, err = ts.GetSubscribers(t.Context())
+	require.NoError(t, err)
+	assert.Empty(t, subscribers)
+}
+
+func (s *suite) testLastEventID(t *testing.T) {
+	transport := s.newTransport(t)
+
+	tl, ok := mercure.TransportAs[mercure.TransportLastEventID](transport)
+	if !ok {
+		t.Skip("the transport doesn't implement TransportLastEventID")
+	}
+
+	assert.Equal(t, mercure.EarliestLastEventID, tl.LastEventID(t.Context()))
+
+	sub := newSubscriber("", []string{topic}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), sub))
+
+	dispatchRange(t, transport, 1, 2)
+	assertReceivedIDs(t, sub, "1", "2")
+
+	assert.Equal(t, "2", tl.LastEventID(t.Context()))
+}
+
+func (s *suite) testHealth(t *testing.T) {
+	transport := s.newTransport(t)
+
+	hc, ok := mercure.TransportAs[mercure.TransportHealthChecker](transport)
+	if !ok {
+		t.Skip("the transport doesn't implement TransportHealthChecker")
+	}
+
+	if s.asyncDispatch {
+		// The store is read in the background.
+		require.Eventually(t, func() bool {
+			return hc.Ready(t.Context()) == nil
+		}, timeout, time.Millisecond)
+	}
+
+	require.NoError(t, hc.Ready(t.Context()))
+	assert.NoError(t, hc.Live(t.Context()))
+}
+
+// After Close, subscribers are disconnected, and dispatching or subscribing fails with ErrClosedTransport.
+func (s *suite) testClose(t *testing.T) {
+	transport := s.newTransport(t)
+
+	sub := newSubscriber("", []string{topic}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), sub))
+
+	require.NoError(t, transport.Close(t.Context()))
+	require.NoError(t, transport.Close(t.Context()), "Close must be idempotent")
+
+	select {
+	case _, ok := <-sub.Receive():
+		assert.False(t, ok, "the subscriber must be disconnected")
+	case <-time.After(timeout):
+		assert.Fail(t, "the subscriber hasn't been disconnected")
+	}
+
+	err := transport.Dispatch(t.Context(), &mercure.Update{Topics: []string{topic}})
+	assert.True(t, errors.Is(err, mercure.ErrClosedTransport), "Dispatch: %v", err)
+
+	err = transport.AddSubscriber(t.Context(), newSubscriber("", []string{topic}, nil))
+	assert.True(t, errors.Is(err, mercure.ErrClosedTransport), "AddSubscriber: %v", err)
+
+	if hc, ok := mercure.TransportAs[mercure.TransportHealthChecker](transport); ok {
+		err = hc.Ready(t.Context())
+		assert.True(t, errors.Is(err, mercure.ErrClosedTransport), "Ready: %v", err)
+
+		err = hc.Live(t.Context())
+		assert.True(t, errors.Is(err, mercure.ErrClosedTransport), "Live: %v", err)
+	}
+}
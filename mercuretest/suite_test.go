@@ -0,0 +1,138 @@
+package mercuretest_test
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dunglas/mercure"
+	"github.com/dunglas/mercure/mercuretest"
+	"github.com/jackc/pgx/v5"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalTransport(t *testing.T) {
+	t.Parallel()
+
+	mercuretest.RunTransportSuite(t, func(*testing.T) mercure.Transport {
+		return mercure.NewLocalTransport(mercure.NewSubscriberList(0))
+	}, mercuretest.WithoutHistory())
+}
+
+func TestLocalTransportWithHistory(t *testing.T) {
+	t.Parallel()
+
+	mercuretest.RunTransportSuite(t, func(*testing.T) mercure.Transport {
+		return mercure.NewLocalTransport(mercure.NewSubscriberList(0), mercure.WithLocalHistorySize(1000))
+	})
+}
+
+func TestBoltTransport(t *testing.T) {
+	t.Parallel()
+
+	mercuretest.RunTransportSuite(t, func(t *testing.T) mercure.Transport {
+		transport, err := mercure.NewBoltTransport(mercure.NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "bolt.db"), "", 0, 0)
+		require.NoError(t, err)
+
+		return transport
+	})
+}
+
+func TestBoltTransportGroupCommit(t *testing.T) {
+	t.Parallel()
+
+	mercuretest.RunTransportSuite(t, func(t *testing.T) mercure.Transport {
+		transport, err := mercure.NewBoltTransport(mercure.NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "bolt.db"), "", 0, 0, mercure.WithBoltGroupCommit(time.Millisecond, 16))
+		require.NoError(t, err)
+
+		return transport
+	})
+}
+
+func TestSQLiteTransport(t *testing.T) {
+	t.Parallel()
+
+	mercuretest.RunTransportSuite(t, func(t *testing.T) mercure.Transport {
+		transport, err := mercure.NewSQLiteTransport(mercure.NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "mercure.sqlite"), 0, 0)
+		require.NoError(t, err)
+
+		return transport
+	})
+}
+
+func TestRedisTransport(t *testing.T) {
+	t.Parallel()
+
+	mercuretest.RunTransportSuite(t, func(t *testing.T) mercure.Transport {
+		transport, err := mercure.NewRedisTransport(t.Context(), mercure.NewSubscriberList(0), slog.Default(), "redis://"+miniredis.RunT(t).Addr(), "", 0)
+		require.NoError(t, err)
+
+		return transport
+	}, mercuretest.WithAsyncDispatch())
+}
+
+func TestNatsTransport(t *testing.T) {
+	t.Parallel()
+
+	mercuretest.RunTransportSuite(t, func(t *testing.T) mercure.Transport {
+		ns, err := server.NewServer(&server.Options{
+			Host:      "127.0.0.1",
+			Port:      server.RANDOM_PORT,
+			JetStream: true,
+			StoreDir:  t.TempDir(),
+			NoLog:     true,
+			NoSigs:    true,
+		})
+		require.NoError(t, err)
+
+		go ns.Start()
+
+		require.True(t, ns.ReadyForConnections(5*time.Second))
+		t.Cleanup(ns.Shutdown)
+
+		transport, err := mercure.NewNatsTransport(t.Context(), mercure.NewSubscriberList(0), slog.Default(), ns.ClientURL(), "", 0)
+		require.NoError(t, err)
+
+		return transport
+	}, mercuretest.WithAsyncDispatch())
+}
+
+// TestPostgresTransport uses the database set in the MERCURE_TEST_POSTGRES_DSN
+// environment variable, and is skipped if it isn't set, except on CI.
+func TestPostgresTransport(t *testing.T) {
+	t.Parallel()
+
+	dsn := os.Getenv("MERCURE_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		if os.Getenv("CI") != "" {
+			t.Fatal("MERCURE_TEST_POSTGRES_DSN must be set on CI")
+		}
+
+		t.Skip("MERCURE_TEST_POSTGRES_DSN not set")
+	}
+
+	mercuretest.RunTransportSuite(t, func(t *testing.T) mercure.Transport {
+		table := "suite_" + strings.ToLower(strings.ReplaceAll(t.Name(), "/", "_"))
+
+		// Registered before the suite closes the transport, so run after.
+		t.Cleanup(func() {
+			conn, err := pgx.Connect(context.Background(), dsn)
+			require.NoError(t, err)
+
+			_, err = conn.Exec(context.Background(), "DROP TABLE IF EXISTS "+pgx.Identifier{table}.Sanitize())
+			require.NoError(t, err)
+			require.NoError(t, conn.Close(context.Background()))
+		})
+
+		transport, err := mercure.NewPostgresTransport(t.Context(), mercure.NewSubscriberList(0), slog.Default(), dsn, table, 0, mercure.PostgresDefaultCleanupFrequency)
+		require.NoError(t, err)
+
+		return transport
+	}, mercuretest.WithAsyncDispatch())
+}
@@ -0,0 +1,607 @@
+package mercure
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MeshDefaultTimeout is the default timeout of the requests sent to the peers.
+	MeshDefaultTimeout = 5 * time.Second
+	// MeshDefaultQueueSize is the default number of updates waiting to be
+	// forwarded to each peer.
+	MeshDefaultQueueSize = 1000
+	// MeshDefaultAttempts is the default number of attempts to forward an
+	// update to a peer.
+	MeshDefaultAttempts = 3
+	// MeshDefaultRetryDelay is the default delay between two attempts to
+	// forward an update to a peer.
+	MeshDefaultRetryDelay = time.Second
+
+	// meshURL is the path prefix of the internal endpoints of the mesh.
+	meshURL = defaultHubURL + "/mesh/"
+)
+
+var (
+	// ErrInvalidMeshPeer is returned when the URL of a peer isn't an absolute HTTP(S) URL.
+	ErrInvalidMeshPeer = errors.New("invalid peer hub URL")
+	// ErrMissingMeshSecret is returned when no secret is set to authenticate the peers.
+	ErrMissingMeshSecret = errors.New("the mesh secret must be set")
+	// ErrMeshPeer is returned when a peer can't be reached or rejects a request.
+	ErrMeshPeer = errors.New("peer hub unavailable")
+	// ErrInvalidMeshQueue is returned when the forwarding queue settings aren't positive.
+	ErrInvalidMeshQueue = errors.New("the queue size and the number of attempts must be positive")
+)
+
+// MeshOption sets an optional setting of MeshTransport.
+type MeshOption func(t *MeshTransport) error
+
+// WithMeshHTTPClient sets the HTTP client used to reach the peers.
+func WithMeshHTTPClient(client *http.Client) MeshOption {
+	return func(t *MeshTransport) error {
+		t.client = client
+
+		return nil
+	}
+}
+
+// WithMeshQueueSize sets the number of updates waiting to be forwarded to
+// each peer. When the queue of a peer is full, the updates published
+// meanwhile aren't forwarded to it.
+func WithMeshQueueSize(size int) MeshOption {
+	return func(t *MeshTransport) error {
+		if size <= 0 {
+			return ErrInvalidMeshQueue
+		}
+
+		t.queueSize = size
+
+		return nil
+	}
+}
+
+// WithMeshRetry sets the number of attempts to forward an update to a peer,
+// and the delay between two attempts.
+func WithMeshRetry(attempts int, delay time.Duration) MeshOption {
+	return func(t *MeshTransport) error {
+		if attempts <= 0 {
+			return ErrInvalidMeshQueue
+		}
+
+		t.attempts = attempts
+		t.retryDelay = delay
+
+		return nil
+	}
+}
+
+// meshForward is an update waiting to be forwarded to a peer.
+type meshForward struct {
+	update *Update
+	body   []byte
+}
+
+// meshSubscriber is the representation of a Subscriber exchanged between peers.
+// SubscriptionPayloads are sent as is, as they can't be resolved again without the claims.
+type meshSubscriber struct {
+	ID                     string         `json:"id"`
+	EscapedID              string         `json:"escapedId"`
+	SubscribedMatchers     []TopicMatcher `json:"subscribedMatchers"`
+	AllowedPrivateMatchers []TopicMatcher `json:"allowedPrivateMatchers,omitempty"`
+	SubscriptionPayloads   []any          `json:"subscriptionPayloads,omitempty"`
+}
+
+type meshSubscribers struct {
+	LastEventID string           `json:"lastEventId"`
+	Subscribers []meshSubscriber `json:"subscribers"`
+}
+
+// MeshTransport connects hubs in a static mesh, without external broker.
+//
+// The updates published on a hub are dispatched by the wrapped transport
+// (typically a LocalTransport or a BoltTransport), then forwarded to every
+// peer through an internal endpoint served by the hub under
+// /.well-known/mercure/mesh/. Peers dispatch forwarded updates to their own
+// subscribers without forwarding them again, so every hub must list all the
+// other ones.
+//
+// Updates are forwarded asynchronously, in order, through a bounded queue per
+// peer, so that an unavailable peer doesn't slow down publications. A peer
+// misses the updates it failed to receive after all the attempts, the ones
+// published while its queue was full, and the ones still queued when the
+// transport is closed.
+//
+// Peers authenticate with a shared secret. As the secret allows publishing
+// any update, including private ones and subscription events, it must be
+// kept out of reach of publishers and subscribers.
+type MeshTransport struct {
+	inner             Transport
+	logger            *slog.Logger
+	peers             []*url.URL
+	queues            []chan meshForward
+	queueSize         int
+	attempts          int
+	retryDelay        time.Duration
+	secret            []byte
+	client            *http.Client
+	topicMatcherStore *TopicMatcherStore
+	ctx               context.Context //nolint:containedctx
+	cancel            context.CancelFunc
+	forwarders        sync.WaitGroup
+	closed            chan struct{}
+	closedOnce        sync.Once
+}
+
+// NewMeshTransport creates a new MeshTransport forwarding the updates
+// dispatched by inner to the hubs at peers (e.g. https://node2.example.com/.well-known/mercure).
+func NewMeshTransport(inner Transport, logger *slog.Logger, peers []*url.URL, secret string, options ...MeshOption) (*MeshTransport, error) {
+	if secret == "" {
+		return nil, &TransportError{err: ErrMissingMeshSecret}
+	}
+
+	for _, p := range peers {
+		if p == nil || !p.IsAbs() || (p.Scheme != "http" && p.Scheme != "https") {
+			return nil, &TransportError{err: fmt.Errorf("%w: %v", ErrInvalidMeshPeer, p)}
+		}
+	}
+
+	t := &MeshTransport{
+		inner:      inner,
+		logger:     logger,
+		peers:      peers,
+		queueSize:  MeshDefaultQueueSize,
+		attempts:   MeshDefaultAttempts,
+		retryDelay: MeshDefaultRetryDelay,
+		secret:     []byte(secret),
+		client:     &http.Client{Timeout: MeshDefaultTimeout},
+		closed:     make(chan struct{}),
+	}
+
+	for _, o := range options {
+		if err := o(t); err != nil {
+			return nil, &TransportError{err: err}
+		}
+	}
+
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+
+	t.queues = make([]chan meshForward, len(peers))
+	for i, peer := range peers {
+		t.queues[i] = make(chan meshForward, t.queueSize)
+
+		t.forwarders.Go(func() {
+			t.forward(peer, t.queues[i])
+		})
+	}
+
+	return t, nil
+}
+
+// Dispatch dispatches an update to the local subscribers, then queues it to
+// be forwarded to the peers.
+//
+// A peer failing to receive the update is logged but doesn't fail the
+// dispatch, as the update has already been sent to the local subscribers;
+// unavailable peers are reported by Ready.
+func (t *MeshTransport) Dispatch(ctx context.Context, update *Update) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	// All the hubs must store the update with the same ID.
+	update.AssignUUID()
+
+	if err := t.inner.Dispatch(ctx, update); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if len(t.peers) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("unable to marshal the update: %w", err)
+	}
+
+	for i, peer := range t.peers {
+		select {
+		case t.queues[i] <- meshForward{update, body}:
+		default:
+			if t.logger.Enabled(ctx, slog.LevelError) {
+				t.logger.LogAttrs(ctx, slog.LevelError, "The forwarding queue of the peer is full, update dropped", slog.String("peer", peer.String()), slog.Any("update", update))
+			}
+		}
+	}
+
+	return nil
+}
+
+// forward sends the updates of queue to peer, in order, until the transport is closed.
+func (t *MeshTransport) forward(peer *url.URL, queue <-chan meshForward) {
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case f := <-queue:
+			t.send(peer, f)
+		}
+	}
+}
+
+// send sends an update to peer, retrying on failure.
+func (t *MeshTransport) send(peer *url.URL, f meshForward) {
+	for attempt := 1; ; attempt++ {
+		resp, err := t.request(t.ctx, http.MethodPost, peer, "updates", f.body)
+		if err == nil {
+			err = resp.Body.Close()
+		}
+
+		if err == nil || t.ctx.Err() != nil {
+			return
+		}
+
+		if attempt >= t.attempts {
+			if t.logger.Enabled(t.ctx, slog.LevelError) {
+				t.logger.LogAttrs(t.ctx, slog.LevelError, "Unable to forward the update to the peer", slog.String("peer", peer.String()), slog.Any("update", f.update), slog.Int("attempts", attempt), slog.Any("error", err))
+			}
+
+			return
+		}
+
+		if t.logger.Enabled(t.ctx, slog.LevelWarn) {
+			t.logger.LogAttrs(t.ctx, slog.LevelWarn, "Unable to forward the update to the peer, retrying", slog.String("peer", peer.String()), slog.Int("attempt", attempt), slog.Any("error", err))
+		}
+
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-time.After(t.retryDelay):
+		}
+	}
+}
+
+// request sends a request to an internal endpoint of a peer. The body of the
+// returned response must be closed by the caller.
+func (t *MeshTransport) request(ctx context.Context, method string, peer *url.URL, endpoint string, body []byte) (*http.Response, error) {
+	u := peer.JoinPath("mesh", endpoint)
+
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMeshPeer, err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+string(t.secret))
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMeshPeer, err)
+	}
+
+	if resp.StatusCode/100 != 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+
+		return nil, fmt.Errorf("%w: %s: %s", ErrMeshPeer, u, resp.Status)
+	}
+
+	return resp, nil
+}
+
+// AddSubscriber adds a new subscriber to the wrapped transport.
+func (t *MeshTransport) AddSubscriber(ctx context.Context, s *LocalSubscriber) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	return t.inner.AddSubscriber(ctx, s) //nolint:wrapcheck
+}
+
+// RemoveSubscriber removes a subscriber from the wrapped transport.
+func (t *MeshTransport) RemoveSubscriber(ctx context.Context, s *LocalSubscriber) error {
+	return t.inner.RemoveSubscriber(ctx, s) //nolint:wrapcheck
+}
+
+// GetSubscribers gets the last event ID and the subscribers of this hub and of all its peers.
+// Unavailable peers are logged and skipped.
+func (t *MeshTransport) GetSubscribers(ctx context.Context) (string, []*Subscriber, error) {
+	lastEventID, subscribers, err := t.localSubscribers(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	results := make([][]*Subscriber, len(t.peers))
+
+	var wg sync.WaitGroup
+	for i, peer := range t.peers {
+		wg.Go(func() {
+			s, err := t.peerSubscribers(ctx, peer)
+			if err != nil {
+				if t.logger.Enabled(ctx, slog.LevelWarn) {
+					t.logger.LogAttrs(ctx, slog.LevelWarn, "Unable to retrieve the subscribers of the peer", slog.String("peer", peer.String()), slog.Any("error", err))
+				}
+
+				return
+			}
+
+			results[i] = s
+		})
+	}
+
+	wg.Wait()
+
+	for _, s := range results {
+		subscribers = append(subscribers, s...)
+	}
+
+	return lastEventID, subscribers, nil
+}
+
+func (t *MeshTransport) localSubscribers(ctx context.Context) (string, []*Subscriber, error) {
+	ts, ok := TransportAs[TransportSubscribers](t.inner)
+	if !ok {
+		return "", nil, nil
+	}
+
+	return ts.GetSubscribers(ctx) //nolint:wrapcheck
+}
+
+func (t *MeshTransport) peerSubscribers(ctx context.Context, peer *url.URL) ([]*Subscriber, error) {
+	resp, err := t.request(ctx, http.MethodGet, peer, "subscribers", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var ms meshSubscribers
+	if err := json.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("%w: invalid subscribers: %w", ErrMeshPeer, err)
+	}
+
+	subscribers := make([]*Subscriber, 0, len(ms.Subscribers))
+	for _, m := range ms.Subscribers {
+		s := NewSubscriber(t.logger, t.topicMatcherStore)
+		s.ID = m.ID
+		s.EscapedID = m.EscapedID
+		s.SetMatchers(m.SubscribedMatchers, m.AllowedPrivateMatchers)
+
+		if len(m.SubscriptionPayloads) == len(s.SubscribedMatchers) {
+			s.SubscriptionPayloads = m.SubscriptionPayloads
+		}
+
+		subscribers = append(subscribers, s)
+	}
+
+	return subscribers, nil
+}
+
+// HandlerPathPrefix returns the path prefix of the internal endpoints of the mesh.
+func (t *MeshTransport) HandlerPathPrefix() string {
+	return meshURL
+}
+
+// ServeHTTP serves the internal endpoints called by the peers.
+func (t *MeshTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), t.secret) != 1 {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+		return
+	}
+
+	var (
+		method  string
+		handler http.HandlerFunc
+	)
+
+	switch strings.TrimPrefix(r.URL.Path, meshURL) {
+	case "updates":
+		method, handler = http.MethodPost, t.handleUpdate
+	case "subscribers":
+		method, handler = http.MethodGet, t.handleSubscribers
+	case "health":
+		method, handler = http.MethodGet, t.handleHealth
+	default:
+		http.NotFound(w, r)
+
+		return
+	}
+
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	handler(w, r)
+}
+
+// handleUpdate dispatches an update forwarded by a peer to the local subscribers, without forwarding it again.
+func (t *MeshTransport) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	var update Update
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+
+		return
+	}
+
+	if err := t.inner.Dispatch(r.Context(), &update); err != nil {
+		if t.logger.Enabled(r.Context(), slog.LevelError) {
+			t.logger.LogAttrs(r.Context(), slog.LevelError, "Unable to dispatch the update forwarded by a peer", slog.Any("update", &update), slog.Any("error", err))
+		}
+
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSubscribers returns the subscribers of this hub, excluding the ones of its peers.
+func (t *MeshTransport) handleSubscribers(w http.ResponseWriter, r *http.Request) {
+	lastEventID, subscribers, err := t.localSubscribers(r.Context())
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+
+		return
+	}
+
+	ms := meshSubscribers{LastEventID: lastEventID, Subscribers: make([]meshSubscriber, 0, len(subscribers))}
+	for _, s := range subscribers {
+		ms.Subscribers = append(ms.Subscribers, meshSubscriber{
+			ID:                     s.ID,
+			EscapedID:              s.EscapedID,
+			SubscribedMatchers:     s.SubscribedMatchers,
+			AllowedPrivateMatchers: s.AllowedPrivateMatchers,
+			SubscriptionPayloads:   s.SubscriptionPayloads,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(ms); err != nil && t.logger.Enabled(r.Context(), slog.LevelInfo) {
+		t.logger.LogAttrs(r.Context(), slog.LevelInfo, "Unable to send the subscribers to the peer", slog.Any("error", err))
+	}
+}
+
+// handleHealth reports whether the wrapped transport of this hub is ready.
+func (t *MeshTransport) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if err := t.innerReady(r.Context()); err != nil {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (t *MeshTransport) innerReady(ctx context.Context) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	if hc, ok := TransportAs[TransportHealthChecker](t.inner); ok {
+		return hc.Ready(ctx) //nolint:wrapcheck
+	}
+
+	return nil
+}
+
+// Ready reports whether the wrapped transport is ready. The peers are
+// ignored: otherwise, a single unavailable peer would make every hub of the
+// mesh unready, and the load balancer remove the whole cluster. Use
+// PeersReady to check them.
+func (t *MeshTransport) Ready(ctx context.Context) error {
+	return t.innerReady(ctx)
+}
+
+// PeersReady reports whether all the peers are reachable, and their wrapped
+// transport ready. Failures to forward updates to a peer are also logged.
+func (t *MeshTransport) PeersReady(ctx context.Context) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	errs := make([]error, len(t.peers))
+
+	var wg sync.WaitGroup
+	for i, peer := range t.peers {
+		wg.Go(func() {
+			resp, err := t.request(ctx, http.MethodGet, peer, "health", nil)
+			if err == nil {
+				err = resp.Body.Close()
+			}
+
+			errs[i] = err
+		})
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// Live reports whether the wrapped transport is alive. Unavailable peers
+// don't require this hub to be restarted, so they are ignored.
+func (t *MeshTransport) Live(ctx context.Context) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	if hc, ok := TransportAs[TransportHealthChecker](t.inner); ok {
+		return hc.Live(ctx) //nolint:wrapcheck
+	}
+
+	return nil
+}
+
+// SetTopicMatcherStore sets the TopicMatcherStore used by the subscribers of
+// the peers, and passes it to the wrapped transport.
+func (t *MeshTransport) SetTopicMatcherStore(store *TopicMatcherStore) {
+	t.topicMatcherStore = store
+
+	if ttms, ok := TransportAs[TransportTopicMatcherStore](t.inner); ok {
+		ttms.SetTopicMatcherStore(store)
+	}
+}
+
+// Unwrap returns the wrapped transport.
+func (t *MeshTransport) Unwrap() Transport { //nolint:ireturn
+	return t.inner
+}
+
+// Close stops forwarding the updates to the peers, and closes the wrapped transport.
+func (t *MeshTransport) Close(ctx context.Context) (err error) {
+	t.closedOnce.Do(func() {
+		close(t.closed)
+
+		t.cancel()
+		t.forwarders.Wait()
+
+		err = t.inner.Close(ctx)
+	})
+
+	return err //nolint:wrapcheck
+}
+
+// Interface guards.
+var (
+	_ Transport                  = (*MeshTransport)(nil)
+	_ TransportSubscribers       = (*MeshTransport)(nil)
+	_ TransportHealthChecker     = (*MeshTransport)(nil)
+	_ TransportTopicMatcherStore = (*MeshTransport)(nil)
+	_ TransportHandler           = (*MeshTransport)(nil)
+	_ TransportUnwrapper         = (*MeshTransport)(nil)
+)
@@ -0,0 +1,352 @@
+package mercure
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMeshSecret = "!ChangeMeMesh!"
+
+// createMesh starts n hubs connected in a mesh.
+func createMesh(t *testing.T, n int) ([]*MeshTransport, []*httptest.Server) {
+	t.Helper()
+
+	handlers := make([]atomic.Pointer[Hub], n)
+	servers := make([]*httptest.Server, n)
+	peers := make([]*url.URL, n)
+
+	for i := range n {
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlers[i].Load().ServeHTTP(w, r)
+		}))
+		t.Cleanup(servers[i].Close)
+
+		u, err := url.Parse(servers[i].URL + defaultHubURL)
+		require.NoError(t, err)
+
+		peers[i] = u
+	}
+
+	transports := make([]*MeshTransport, n)
+
+	for i := range n {
+		var others []*url.URL
+
+		for j, p := range peers {
+			if j != i {
+				others = append(others, p)
+			}
+		}
+
+		transport, err := NewMeshTransport(NewLocalTransport(NewSubscriberList(0)), slog.Default(), others, testMeshSecret)
+		require.NoError(t, err)
+
+		t.Cleanup(func() {
+			require.NoError(t, transport.Close(t.Context()))
+		})
+
+		transports[i] = transport
+		handlers[i].Store(createAnonymousDummy(t, WithTransport(transport)))
+	}
+
+	return transports, servers
+}
+
+func TestMeshTransportDispatch(t *testing.T) {
+	t.Parallel()
+
+	transports, _ := createMesh(t, 3)
+
+	subscribers := make([]*LocalSubscriber, len(transports))
+	for i, transport := range transports {
+		subscribers[i] = NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+		subscribers[i].SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}}, nil)
+		require.NoError(t, transport.AddSubscriber(t.Context(), subscribers[i]))
+	}
+
+	u := &Update{Event: Event{Data: "foo"}, Topics: []string{"https://example.com/foo"}}
+	require.NoError(t, transports[1].Dispatch(t.Context(), u))
+	require.NotEmpty(t, u.ID)
+
+	require.NoError(t, transports[1].Dispatch(t.Context(), &Update{Event: Event{ID: "b"}, Topics: []string{"https://example.com/foo"}}))
+
+	// Every hub receives each update once, with the same ID: forwarded updates aren't forwarded again.
+	for _, s := range subscribers {
+		received := <-s.Receive()
+		assert.Equal(t, u.ID, received.ID)
+		assert.Equal(t, "foo", received.Data)
+
+		assert.Equal(t, "b", (<-s.Receive()).ID)
+	}
+
+	for _, transport := range transports {
+		lastEventID, _, err := transport.GetSubscribers(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "b", lastEventID)
+	}
+}
+
+func TestMeshTransportGetSubscribers(t *testing.T) {
+	t.Parallel()
+
+	transports, _ := createMesh(t, 2)
+
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.SetMatchers(
+		[]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}},
+		[]TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/:id"}},
+	)
+	s.SubscriptionPayloads = []any{map[string]any{"foo": "bar"}}
+	require.NoError(t, transports[1].AddSubscriber(t.Context(), s))
+
+	_, subscribers, err := transports[0].GetSubscribers(t.Context())
+	require.NoError(t, err)
+	require.Len(t, subscribers, 1)
+
+	assert.Equal(t, s.ID, subscribers[0].ID)
+	assert.Equal(t, s.EscapedID, subscribers[0].EscapedID)
+	assert.Equal(t, s.SubscribedMatchers, subscribers[0].SubscribedMatchers)
+	assert.Equal(t, s.AllowedPrivateMatchers, subscribers[0].AllowedPrivateMatchers)
+	assert.Equal(t, s.EscapedMatchers, subscribers[0].EscapedMatchers)
+	assert.Equal(t, s.SubscriptionPayloads, subscribers[0].SubscriptionPayloads)
+
+	_, subscribers, err = transports[1].GetSubscribers(t.Context())
+	require.NoError(t, err)
+	assert.Len(t, subscribers, 1)
+}
+
+func TestMeshTransportUnavailablePeer(t *testing.T) {
+	t.Parallel()
+
+	transports, servers := createMesh(t, 2)
+
+	require.NoError(t, transports[0].Ready(t.Context()))
+	require.NoError(t, transports[1].Ready(t.Context()))
+	require.NoError(t, transports[0].PeersReady(t.Context()))
+
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}}, nil)
+	require.NoError(t, transports[0].AddSubscriber(t.Context(), s))
+
+	servers[1].Close()
+
+	// An unavailable peer doesn't make the other hubs unready.
+	require.ErrorIs(t, transports[0].PeersReady(t.Context()), ErrMeshPeer)
+	require.NoError(t, transports[0].Ready(t.Context()))
+	require.NoError(t, transports[0].Live(t.Context()))
+
+	// The local subscribers are still served.
+	require.NoError(t, transports[0].Dispatch(t.Context(), &Update{Event: Event{ID: "a"}, Topics: []string{"https://example.com/foo"}}))
+	assert.Equal(t, "a", (<-s.Receive()).ID)
+
+	_, subscribers, err := transports[0].GetSubscribers(t.Context())
+	require.NoError(t, err)
+	assert.Len(t, subscribers, 1)
+}
+
+func TestMeshTransportRetry(t *testing.T) {
+	t.Parallel()
+
+	var (
+		requests atomic.Int32
+		received = make(chan string, 10)
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt to forward each update fails.
+		if requests.Add(1)%2 == 1 {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+
+			return
+		}
+
+		var u Update
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&u))
+
+		received <- u.ID
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	peer, err := url.Parse(server.URL + defaultHubURL)
+	require.NoError(t, err)
+
+	transport, err := NewMeshTransport(NewLocalTransport(NewSubscriberList(0)), slog.Default(), []*url.URL{peer}, testMeshSecret, WithMeshRetry(2, time.Millisecond))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Close(t.Context()))
+	})
+
+	for _, id := range []string{"a", "b"} {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: id}, Topics: []string{"https://example.com/foo"}}))
+	}
+
+	// The updates are forwarded in order.
+	assert.Equal(t, "a", <-received)
+	assert.Equal(t, "b", <-received)
+	assert.Equal(t, int32(4), requests.Load())
+}
+
+func TestMeshTransportRejectedUpdate(t *testing.T) {
+	t.Parallel()
+
+	var buf lockedBuffer
+
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	var requests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	}))
+	t.Cleanup(server.Close)
+
+	peer, err := url.Parse(server.URL + defaultHubURL)
+	require.NoError(t, err)
+
+	transport, err := NewMeshTransport(NewLocalTransport(NewSubscriberList(0)), logger, []*url.URL{peer}, testMeshSecret, WithMeshRetry(3, time.Millisecond))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Close(t.Context()))
+	})
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: "a"}, Topics: []string{"https://example.com/foo"}}))
+
+	require.Eventually(t, func() bool {
+		return strings.Contains(buf.String(), `"msg":"Unable to forward the update to the peer","peer":"`+peer.String()+`"`)
+	}, 5*time.Second, time.Millisecond)
+	assert.Contains(t, buf.String(), `401 Unauthorized`)
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p) //nolint:wrapcheck
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+func TestMeshTransportFullQueue(t *testing.T) {
+	t.Parallel()
+
+	unblock := make(chan struct{})
+	received := make(chan string, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+
+		var u Update
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&u))
+
+		received <- u.ID
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	peer, err := url.Parse(server.URL + defaultHubURL)
+	require.NoError(t, err)
+
+	transport, err := NewMeshTransport(NewLocalTransport(NewSubscriberList(0)), slog.Default(), []*url.URL{peer}, testMeshSecret, WithMeshQueueSize(1))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Close(t.Context()))
+	})
+
+	// The forwarder blocks on a, b is queued.
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: "a"}, Topics: []string{"https://example.com/foo"}}))
+	require.Eventually(t, func() bool {
+		return len(transport.queues[0]) == 0
+	}, 5*time.Second, time.Millisecond)
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: "b"}, Topics: []string{"https://example.com/foo"}}))
+
+	// Dispatching doesn't block while the queue is full, c is dropped.
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: "c"}, Topics: []string{"https://example.com/foo"}}))
+
+	close(unblock)
+
+	assert.Equal(t, "a", <-received)
+	assert.Equal(t, "b", <-received)
+	assert.Empty(t, received)
+}
+
+func TestMeshTransportAuthentication(t *testing.T) {
+	t.Parallel()
+
+	_, servers := createMesh(t, 1)
+
+	for _, authorization := range []string{"", "Bearer invalid", testMeshSecret} {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, servers[0].URL+meshURL+"updates", strings.NewReader(`{"Topics":["https://example.com/foo"]}`))
+		require.NoError(t, err)
+
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, servers[0].URL+meshURL+"subscribers", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+testMeshSecret)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestNewMeshTransportInvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewMeshTransport(NewLocalTransport(NewSubscriberList(0)), slog.Default(), nil, "")
+	require.ErrorIs(t, err, ErrMissingMeshSecret)
+
+	for _, p := range []string{"/.well-known/mercure", "ftp://example.com/.well-known/mercure"} {
+		peer, err := url.Parse(p)
+		require.NoError(t, err)
+
+		_, err = NewMeshTransport(NewLocalTransport(NewSubscriberList(0)), slog.Default(), []*url.URL{peer}, testMeshSecret)
+		require.ErrorIs(t, err, ErrInvalidMeshPeer)
+	}
+
+	for _, o := range []MeshOption{WithMeshQueueSize(0), WithMeshRetry(0, time.Second)} {
+		_, err = NewMeshTransport(NewLocalTransport(NewSubscriberList(0)), slog.Default(), nil, testMeshSecret, o)
+		require.ErrorIs(t, err, ErrInvalidMeshQueue)
+	}
+}
@@ -27,6 +27,7 @@ type PrometheusMetrics struct {
 	subscribersTotal prometheus.Counter
 	subscribers      prometheus.Gauge
 	updatesTotal     prometheus.Counter
+	slowSubscribers  *prometheus.CounterVec
 }
 
 // NewPrometheusMetrics creates a Prometheus metrics collector.
@@ -56,6 +57,13 @@ func NewPrometheusMetrics(registry prometheus.Registerer) *PrometheusMetrics {
 				Help: "Total number of handled updates",
 			},
 		),
+		slowSubscribers: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "mercure_slow_subscribers_total",
+				Help: "Total number of actions taken because a subscriber didn't receive updates fast enough, by outcome",
+			},
+			[]string{"outcome"},
+		),
 	}
 
 	// https://github.com/caddyserver/caddy/pull/6820
@@ -74,6 +82,11 @@ func NewPrometheusMetrics(registry prometheus.Registerer) *PrometheusMetrics {
 		panic(err)
 	}
 
+	if err := m.registry.Register(m.slowSubscribers); err != nil &&
+		!errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+		panic(err)
+	}
+
 	return m
 }
 
@@ -89,3 +102,10 @@ func (m *PrometheusMetrics) SubscriberDisconnected(_ *LocalSubscriber) {
 func (m *PrometheusMetrics) UpdatePublished(_ *Update) {
 	m.updatesTotal.Inc()
 }
+
+func (m *PrometheusMetrics) SlowSubscriber(_ *LocalSubscriber, outcome SlowSubscriberOutcome) {
+	m.slowSubscribers.WithLabelValues(string(outcome)).Inc()
+}
+
+// Interface guards.
+var _ SlowSubscriberMetrics = (*PrometheusMetrics)(nil)
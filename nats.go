@@ -0,0 +1,582 @@
+package mercure
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultNatsStreamName = "mercure"
+
+// natsMaxDisconnection is how long the connection to the NATS server may be
+// lost before Live starts reporting the transport as unhealthy.
+const natsMaxDisconnection = time.Minute
+
+// natsHistoryBatchSize is the number of updates fetched at once when replaying the history.
+const natsHistoryBatchSize = 100
+
+// natsPingTimeout is the default timeout of the round trip to the NATS server
+// done by Ready.
+const natsPingTimeout = 5 * time.Second
+
+// ErrNatsDisconnected is returned by the health checks when the connection
+// to the NATS server is lost.
+var ErrNatsDisconnected = errors.New("disconnected from the NATS server")
+
+// NatsTransport implements the TransportInterface using NATS JetStream.
+//
+// Updates are published to a durable stream, on a subject derived from their
+// first topic, and consumed by all hub nodes connected to the same NATS cluster.
+// A second stream, keeping only the last message per subject, maps update IDs
+// to stream sequences to replay history.
+type NatsTransport struct {
+	sync.RWMutex
+
+	subscribers    *SubscriberList
+	logger         *slog.Logger
+	conn           *nats.Conn
+	js             jetstream.JetStream
+	stream         jetstream.Stream
+	index          jetstream.Stream
+	updatesSubject string
+	idsSubject     string
+	closed         chan struct{}
+	closedOnce     sync.Once
+	consumeContext jetstream.ConsumeContext
+	lastSeq        uint64
+	lastEventID    string
+
+	connMu            sync.RWMutex
+	disconnectedSince time.Time
+}
+
+// NewNatsTransport creates a new NatsTransport.
+//
+// The streams are created or updated if needed. The stream storing the ID
+// index is named after the updates stream, suffixed with "_ids".
+func NewNatsTransport(
+	ctx context.Context,
+	subscriberList *SubscriberList,
+	logger *slog.Logger,
+	url string,
+	stream string,
+	size uint64,
+) (*NatsTransport, error) {
+	if stream == "" {
+		stream = defaultNatsStreamName
+	}
+
+	t := &NatsTransport{
+		logger:         logger,
+		subscribers:    subscriberList,
+		updatesSubject: stream + ".updates.",
+		idsSubject:     stream + ".ids.",
+		closed:         make(chan struct{}),
+		lastEventID:    EarliestLastEventID,
+	}
+
+	conn, err := nats.Connect(
+		url,
+		nats.Name("mercure"),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(t.handleDisconnect),
+		nats.ReconnectHandler(t.handleReconnect),
+	)
+	if err != nil {
+		return nil, &TransportError{dsn: url, msg: "unable to connect to NATS", err: err}
+	}
+
+	t.conn = conn
+
+	if err := t.init(ctx, stream, size); err != nil {
+		conn.Close()
+
+		return nil, &TransportError{dsn: url, err: err}
+	}
+
+	return t, nil
+}
+
+// init creates the streams, retrieves the last stored event and starts consuming updates.
+func (t *NatsTransport) init(ctx context.Context, stream string, size uint64) error {
+	js, err := jetstream.New(t.conn)
+	if err != nil {
+		return fmt.Errorf("unable to create JetStream context: %w", err)
+	}
+
+	t.js = js
+
+	maxMsgs := int64(-1)
+	if size > 0 {
+		maxMsgs = int64(size) //nolint:gosec
+	}
+
+	if t.stream, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     stream,
+		Subjects: []string{t.updatesSubject + ">"},
+		MaxMsgs:  maxMsgs,
+		Storage:  jetstream.FileStorage,
+	}); err != nil {
+		return fmt.Errorf("unable to create stream %q: %w", stream, err)
+	}
+
+	if t.index, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:              stream + "_ids",
+		Subjects:          []string{t.idsSubject + ">"},
+		MaxMsgs:           maxMsgs,
+		MaxMsgsPerSubject: 1,
+		Storage:           jetstream.FileStorage,
+	}); err != nil {
+		return fmt.Errorf("unable to create stream %q: %w", stream+"_ids", err)
+	}
+
+	info, err := t.stream.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get last_event_id from NATS: %w", err)
+	}
+
+	t.lastSeq = info.State.LastSeq
+	if t.lastSeq > 0 {
+		if update, err := t.getUpdate(ctx, t.lastSeq); err == nil {
+			t.lastEventID = update.ID
+		}
+	}
+
+	consumer, err := t.stream.OrderedConsumer(ctx, jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{t.updatesSubject + ">"},
+		DeliverPolicy:  jetstream.DeliverByStartSequencePolicy,
+		OptStartSeq:    t.lastSeq + 1,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create consumer: %w", err)
+	}
+
+	if t.consumeContext, err = consumer.Consume(t.handleMessage, jetstream.ConsumeErrHandler(t.handleConsumeError)); err != nil {
+		return fmt.Errorf("unable to consume stream %q: %w", stream, err)
+	}
+
+	return nil
+}
+
+// Dispatch dispatches an update to all subscribers and persists it in JetStream.
+//
+// Local subscribers, as well as subscribers connected to other hub nodes,
+// receive the update when it is consumed from the stream.
+func (t *NatsTransport) Dispatch(ctx context.Context, update *Update) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	// The hub validates the updates, but the transport can be used directly.
+	if len(update.Topics) == 0 {
+		return ErrMissingTopic
+	}
+
+	update.AssignUUID()
+
+	// Marshal through the pointer so Update's custom MarshalJSON applies.
+	updateJSON, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("error when marshaling update: %w", err)
+	}
+
+	// A message has a single subject. The hub nodes consume all the updates
+	// and match their topics themselves, so the subject, derived from the
+	// first (canonical) topic, only helps to inspect the stream.
+	ack, err := t.js.Publish(ctx, t.updatesSubject+natsToken(update.Topics[0]), updateJSON)
+	if err != nil {
+		return fmt.Errorf("unable to publish update: %w", err)
+	}
+
+	// The update has been delivered, if indexing fails it can still be
+	// retrieved when replaying the whole history.
+	if _, err := t.js.Publish(ctx, t.idsSubject+natsToken(update.ID), strconv.AppendUint(nil, ack.Sequence, 10)); err != nil {
+		return fmt.Errorf("unable to index update: %w", err)
+	}
+
+	return nil
+}
+
+// natsToken encodes s as a valid subject token.
+func natsToken(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// AddSubscriber adds a new subscriber to the transport.
+func (t *NatsTransport) AddSubscriber(ctx context.Context, s *LocalSubscriber) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	t.Lock()
+	t.subscribers.Add(s)
+	toSeq := t.lastSeq
+	t.Unlock()
+
+	if s.RequestLastEventIDSet {
+		if err := t.dispatchHistory(ctx, s, toSeq); err != nil {
+			return err
+		}
+	}
+
+	s.Ready(ctx)
+
+	return nil
+}
+
+// RemoveSubscriber removes a new subscriber from the transport.
+func (t *NatsTransport) RemoveSubscriber(_ context.Context, s *LocalSubscriber) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.subscribers.Remove(s)
+
+	return nil
+}
+
+// LastEventID returns the ID of the last dispatched update.
+func (t *NatsTransport) LastEventID(_ context.Context) string {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.lastEventID
+}
+
+// GetSubscribers get the list of active subscribers.
+func (t *NatsTransport) GetSubscribers(_ context.Context) (string, []*Subscriber, error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.lastEventID, getSubscribers(t.subscribers), nil
+}
+
+// Ready reports whether the NATS server is reachable.
+func (t *NatsTransport) Ready(ctx context.Context) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	if !t.conn.IsConnected() {
+		return ErrNatsDisconnected
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, natsPingTimeout)
+		defer cancel()
+	}
+
+	if err := t.conn.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("unable to ping the NATS server: %w", err)
+	}
+
+	return nil
+}
+
+// Live reports whether the transport is closed or has been disconnected from
+// the NATS server for an extended period.
+func (t *NatsTransport) Live(_ context.Context) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	if t.conn.IsClosed() {
+		return ErrNatsDisconnected
+	}
+
+	t.connMu.RLock()
+	defer t.connMu.RUnlock()
+
+	if !t.disconnectedSince.IsZero() && time.Since(t.disconnectedSince) > natsMaxDisconnection {
+		return ErrNatsDisconnected
+	}
+
+	return nil
+}
+
+// Close closes the Transport.
+func (t *NatsTransport) Close(_ context.Context) error {
+	t.closedOnce.Do(func() {
+		close(t.closed)
+
+		t.consumeContext.Stop()
+		t.conn.Close()
+
+		t.Lock()
+		defer t.Unlock()
+
+		t.subscribers.Walk(0, func(s *LocalSubscriber) bool {
+			s.Disconnect()
+
+			return true
+		})
+	})
+
+	return nil
+}
+
+func (t *NatsTransport) handleDisconnect(_ *nats.Conn, err error) {
+	t.connMu.Lock()
+	if t.disconnectedSince.IsZero() {
+		t.disconnectedSince = time.Now()
+	}
+	t.connMu.Unlock()
+
+	select {
+	case <-t.closed:
+		return
+	default:
+	}
+
+	if t.logger.Enabled(context.Background(), slog.LevelError) {
+		t.logger.LogAttrs(context.Background(), slog.LevelError, "Disconnected from the NATS server, reconnecting", slog.Any("error", err))
+	}
+}
+
+func (t *NatsTransport) handleReconnect(_ *nats.Conn) {
+	t.connMu.Lock()
+	defer t.connMu.Unlock()
+
+	t.disconnectedSince = time.Time{}
+}
+
+func (t *NatsTransport) handleConsumeError(_ jetstream.ConsumeContext, err error) {
+	if t.logger.Enabled(context.Background(), slog.LevelWarn) {
+		t.logger.LogAttrs(context.Background(), slog.LevelWarn, "Error while consuming the NATS stream", slog.Any("error", err))
+	}
+}
+
+// handleMessage dispatches the updates published by all the hub nodes to local subscribers.
+func (t *NatsTransport) handleMessage(msg jetstream.Msg) {
+	ctx := context.Background()
+
+	metadata, err := msg.Metadata()
+	if err != nil {
+		if t.logger.Enabled(ctx, slog.LevelError) {
+			t.logger.LogAttrs(ctx, slog.LevelError, "Invalid message coming from NATS", slog.Any("error", err))
+		}
+
+		return
+	}
+
+	var update *Update
+	if err := json.Unmarshal(msg.Data(), &update); err != nil {
+		if t.logger.Enabled(ctx, slog.LevelError) {
+			t.logger.LogAttrs(ctx, slog.LevelError, "Unable to unmarshal update coming from NATS", slog.Uint64("seq", metadata.Sequence.Stream), slog.Any("error", err))
+		}
+
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	if metadata.Sequence.Stream > t.lastSeq {
+		t.lastSeq = metadata.Sequence.Stream
+		t.lastEventID = update.ID
+	}
+
+	for _, s := range t.subscribers.MatchAny(update) {
+		s.Dispatch(ctx, update, false)
+	}
+}
+
+// getUpdate retrieves the update stored at the given sequence.
+func (t *NatsTransport) getUpdate(ctx context.Context, seq uint64) (*Update, error) {
+	msg, err := t.stream.GetMsg(ctx, seq)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get message %d: %w", seq, err)
+	}
+
+	var update *Update
+	if err := json.Unmarshal(msg.Data, &update); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal update: %w", err)
+	}
+
+	return update, nil
+}
+
+// lookupSeq returns the sequence of the update with the given ID, or 0 if it
+// doesn't exist or has been discarded.
+func (t *NatsTransport) lookupSeq(ctx context.Context, id string) (uint64, error) {
+	msg, err := t.index.GetLastMsgForSubject(ctx, t.idsSubject+natsToken(id))
+	if errors.Is(err, jetstream.ErrMsgNotFound) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("unable to look up update %q: %w", id, err)
+	}
+
+	seq, err := strconv.ParseUint(string(msg.Data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid sequence for update %q: %w", id, err)
+	}
+
+	// The index may outlive the update when the stream is size-limited.
+	update, err := t.getUpdate(ctx, seq)
+	if errors.Is(err, jetstream.ErrMsgNotFound) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	if update.ID != id {
+		return 0, nil
+	}
+
+	return seq, nil
+}
+
+func (t *NatsTransport) dispatchHistory(ctx context.Context, s *LocalSubscriber, toSeq uint64) error {
+	ctx, span := startSpan(ctx, "mercure.transport.history",
+		trace.WithAttributes(
+			attribute.String("mercure.transport", "nats"),
+			attribute.String("mercure.subscriber.id", s.ID),
+			attribute.String("mercure.last_event_id.requested", s.RequestLastEventID),
+		))
+	defer span.End()
+
+	fromSeq := uint64(1)
+	responseLastEventID := EarliestLastEventID
+
+	if s.RequestLastEventID != EarliestLastEventID {
+		seq, err := t.lookupSeq(ctx, s.RequestLastEventID)
+		if err != nil {
+			s.HistoryDispatched(EarliestLastEventID)
+
+			err = fmt.Errorf("unable to retrieve history from NATS: %w", err)
+			recordSpanError(span, err)
+
+			return err
+		}
+
+		if seq == 0 {
+			// The requested event doesn't exist or has been discarded: the
+			// protocol reserves "earliest" for this case, nothing is replayed.
+			s.HistoryDispatched(EarliestLastEventID)
+
+			if t.logger.Enabled(ctx, slog.LevelInfo) {
+				t.logger.LogAttrs(ctx, slog.LevelInfo, "Can't find requested LastEventID")
+			}
+
+			return nil
+		}
+
+		// The subscriber already knows this id; echoing it is not a disclosure.
+		fromSeq = seq + 1
+		responseLastEventID = s.RequestLastEventID
+	}
+
+	if fromSeq <= toSeq {
+		if err := t.replay(ctx, s, fromSeq, toSeq); err != nil {
+			s.HistoryDispatched(responseLastEventID)
+			recordSpanError(span, err)
+
+			return err
+		}
+	}
+
+	s.HistoryDispatched(responseLastEventID)
+
+	return nil
+}
+
+// replay sends to s the updates it can receive stored from fromSeq to toSeq,
+// read in batches by an ordered consumer, until its buffer is full.
+func (t *NatsTransport) replay(ctx context.Context, s *LocalSubscriber, fromSeq, toSeq uint64) error {
+	consumer, err := t.stream.OrderedConsumer(ctx, jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{t.updatesSubject + ">"},
+		DeliverPolicy:  jetstream.DeliverByStartSequencePolicy,
+		OptStartSeq:    fromSeq,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to retrieve history from NATS: %w", err)
+	}
+
+	it, err := consumer.Messages(jetstream.PullMaxMessages(natsHistoryBatchSize))
+	if err != nil {
+		return fmt.Errorf("unable to retrieve history from NATS: %w", err)
+	}
+
+	defer func() {
+		it.Stop()
+
+		// Don't wait for the server to remove the inactive consumer.
+		if info := consumer.CachedInfo(); info != nil {
+			_ = t.stream.DeleteConsumer(context.WithoutCancel(ctx), info.Name)
+		}
+	}()
+
+	for {
+		msg, err := it.Next(jetstream.NextContext(ctx))
+		if err != nil {
+			return fmt.Errorf("unable to retrieve history from NATS: %w", err)
+		}
+
+		metadata, err := msg.Metadata()
+		if err != nil {
+			return fmt.Errorf("unable to retrieve history from NATS: %w", err)
+		}
+
+		// The updates stored after toSeq are delivered live.
+		if metadata.Sequence.Stream > toSeq {
+			return nil
+		}
+
+		var update *Update
+		if err := json.Unmarshal(msg.Data(), &update); err != nil {
+			if t.logger.Enabled(ctx, slog.LevelError) {
+				t.logger.LogAttrs(ctx, slog.LevelError, "Unable to unmarshal update coming from NATS", slog.Uint64("seq", metadata.Sequence.Stream), slog.Any("error", err))
+			}
+
+			return fmt.Errorf("unable to unmarshal update: %w", err)
+		}
+
+		if s.Match(update) && !s.Dispatch(ctx, update, true) {
+			return nil
+		}
+
+		// toSeq may have been discarded since, when the stream is size-limited:
+		// stop at the last stored update instead of waiting for a new one.
+		if metadata.Sequence.Stream == toSeq || metadata.NumPending == 0 {
+			return nil
+		}
+	}
+}
+
+// Interface guards.
+var (
+	_ Transport              = (*NatsTransport)(nil)
+	_ TransportLastEventID   = (*NatsTransport)(nil)
+	_ TransportSubscribers   = (*NatsTransport)(nil)
+	_ TransportHealthChecker = (*NatsTransport)(nil)
+)
@@ -0,0 +1,214 @@
+package mercure
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runNatsServer(t *testing.T) *server.Server {
+	t.Helper()
+
+	ns, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	require.NoError(t, err)
+
+	go ns.Start()
+
+	require.True(t, ns.ReadyForConnections(5*time.Second))
+	t.Cleanup(ns.Shutdown)
+
+	return ns
+}
+
+func createNatsTransport(t *testing.T, ns *server.Server, size uint64) *NatsTransport {
+	t.Helper()
+
+	transport, err := NewNatsTransport(t.Context(), NewSubscriberList(0), slog.Default(), ns.ClientURL(), "", size)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Close(context.Background()))
+	})
+
+	return transport
+}
+
+// waitForNatsLastEventID waits until the given update has been consumed from the stream.
+func waitForNatsLastEventID(t *testing.T, transport *NatsTransport, id string) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		lastEventID, _, _ := transport.GetSubscribers(t.Context())
+
+		return lastEventID == id
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNatsTransportRetrieveAllHistory(t *testing.T) {
+	t.Parallel()
+
+	transport := createNatsTransport(t, runNatsServer(t), 0)
+	topics := []string{"https://example.com/foo"}
+
+	for i := 1; i <= 2*natsHistoryBatchSize+3; i++ {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{
+			Event:  Event{ID: strconv.Itoa(i)},
+			Topics: topics,
+		}))
+	}
+
+	waitForNatsLastEventID(t, transport, strconv.Itoa(2*natsHistoryBatchSize+3))
+
+	s := NewLocalSubscriber(EarliestLastEventID, transport.logger, &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers(topics), stringsToExactMatchers(nil))
+
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+	assert.Equal(t, EarliestLastEventID, <-s.responseLastEventID)
+
+	for i := 1; i <= 2*natsHistoryBatchSize+3; i++ {
+		assert.Equal(t, strconv.Itoa(i), (<-s.Receive()).ID)
+	}
+
+	// The consumer reading the history has been removed, only the one
+	// dispatching the live updates remains.
+	names := transport.stream.ConsumerNames(t.Context())
+	n := 0
+	for range names.Name() {
+		n++
+	}
+
+	require.NoError(t, names.Err())
+	assert.Equal(t, 1, n)
+}
+
+func TestNatsTransportDiscardedLastEventIDReportsEarliest(t *testing.T) {
+	t.Parallel()
+
+	transport := createNatsTransport(t, runNatsServer(t), 5)
+
+	topics := []string{"https://example.com/foo"}
+	for i := 1; i <= 12; i++ {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{
+			Event:  Event{ID: strconv.Itoa(i)},
+			Topics: topics,
+		}))
+	}
+
+	waitForNatsLastEventID(t, transport, "12")
+
+	info, err := transport.stream.Info(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), info.State.Msgs)
+
+	s := NewLocalSubscriber("2", transport.logger, &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers(topics), stringsToExactMatchers(nil))
+
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+	assert.Equal(t, EarliestLastEventID, <-s.responseLastEventID)
+
+	s = NewLocalSubscriber(EarliestLastEventID, transport.logger, &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers(topics), stringsToExactMatchers(nil))
+
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+	assert.Equal(t, EarliestLastEventID, <-s.responseLastEventID)
+
+	for i := 8; i <= 12; i++ {
+		assert.Equal(t, strconv.Itoa(i), (<-s.Receive()).ID)
+	}
+}
+
+func TestNatsTransportMultipleNodes(t *testing.T) {
+	t.Parallel()
+
+	ns := runNatsServer(t)
+	node1 := createNatsTransport(t, ns, 0)
+	node2 := createNatsTransport(t, ns, 0)
+
+	s := NewLocalSubscriber("", node2.logger, &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers([]string{"https://example.com/foo"}), stringsToExactMatchers(nil))
+	require.NoError(t, node2.AddSubscriber(t.Context(), s))
+
+	u := &Update{Topics: []string{"https://example.com/foo"}}
+	require.NoError(t, node1.Dispatch(t.Context(), u))
+
+	assert.Equal(t, u.ID, (<-s.Receive()).ID)
+	waitForNatsLastEventID(t, node1, u.ID)
+	waitForNatsLastEventID(t, node2, u.ID)
+}
+
+func TestNatsTransportResumesFromLastEvent(t *testing.T) {
+	t.Parallel()
+
+	ns := runNatsServer(t)
+	transport := createNatsTransport(t, ns, 0)
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Topics: []string{"https://example.com/foo"}, Event: Event{ID: "1"}}))
+	waitForNatsLastEventID(t, transport, "1")
+	require.NoError(t, transport.Close(t.Context()))
+
+	transport = createNatsTransport(t, ns, 0)
+
+	lastEventID, _, _ := transport.GetSubscribers(t.Context())
+	assert.Equal(t, "1", lastEventID)
+}
+
+func TestNatsTransportDispatchWithoutTopic(t *testing.T) {
+	t.Parallel()
+
+	transport := createNatsTransport(t, runNatsServer(t), 0)
+
+	require.ErrorIs(t, transport.Dispatch(t.Context(), &Update{}), ErrMissingTopic)
+}
+
+func TestNatsTransportHealth(t *testing.T) {
+	t.Parallel()
+
+	ns := runNatsServer(t)
+	transport := createNatsTransport(t, ns, 0)
+
+	require.NoError(t, transport.Ready(t.Context()))
+	require.NoError(t, transport.Live(t.Context()))
+
+	ns.Shutdown()
+
+	require.Eventually(t, func() bool {
+		return transport.Ready(t.Context()) != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.ErrorIs(t, transport.Ready(t.Context()), ErrNatsDisconnected)
+
+	// The connection has been lost for less than the threshold.
+	require.NoError(t, transport.Live(t.Context()))
+
+	transport.connMu.Lock()
+	transport.disconnectedSince = time.Now().Add(-2 * natsMaxDisconnection)
+	transport.connMu.Unlock()
+
+	require.ErrorIs(t, transport.Live(t.Context()), ErrNatsDisconnected)
+}
+
+func TestNewNatsTransportConnectionFailure(t *testing.T) {
+	t.Parallel()
+
+	ns := runNatsServer(t)
+	url := ns.ClientURL()
+	ns.Shutdown()
+
+	_, err := NewNatsTransport(t.Context(), NewSubscriberList(0), slog.Default(), url, "", 0)
+
+	var transportErr *TransportError
+	require.ErrorAs(t, err, &transportErr)
+	assert.Equal(t, "unable to connect to NATS", transportErr.msg)
+}
@@ -0,0 +1,588 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const PostgresDefaultCleanupFrequency = 0.3
+
+const defaultPostgresTableName = "mercure_updates"
+
+// postgresListenRetryDelay is the delay between two attempts to re-establish
+// the LISTEN connection after it has been lost.
+const postgresListenRetryDelay = time.Second
+
+// postgresMaxListenerDowntime is how long the LISTEN connection may stay down
+// before Live starts reporting the transport as unhealthy.
+const postgresMaxListenerDowntime = time.Minute
+
+// ErrPostgresListenerDown is returned by the health checks when the
+// connection receiving notifications from other hub nodes is not established.
+var ErrPostgresListenerDown = errors.New("postgres listener is not connected")
+
+// PostgresTransport implements the TransportInterface using PostgreSQL.
+//
+// Updates are stored in a table and their sequence number is broadcast to all
+// hub nodes sharing the same database using LISTEN/NOTIFY.
+type PostgresTransport struct {
+	sync.RWMutex
+
+	subscribers      *SubscriberList
+	logger           *slog.Logger
+	pool             *pgxpool.Pool
+	tableName        string
+	table            string
+	size             uint64
+	cleanupFrequency float64
+	closed           chan struct{}
+	closedOnce       sync.Once
+	listenerDone     chan struct{}
+	cancelListener   context.CancelFunc
+	lastSeq          int64
+	lastEventID      string
+
+	listenerMu        sync.RWMutex
+	listening         bool
+	listenerDownSince time.Time
+	listenerErr       error
+}
+
+// NewPostgresTransport creates a new PostgresTransport.
+//
+// The table is created if it doesn't exist. Its name is also used as the
+// notification channel, so all hubs using the same table share the same updates.
+func NewPostgresTransport(
+	ctx context.Context,
+	subscriberList *SubscriberList,
+	logger *slog.Logger,
+	dsn string,
+	table string,
+	size uint64,
+	cleanupFrequency float64,
+) (*PostgresTransport, error) {
+	if table == "" {
+		table = defaultPostgresTableName
+	}
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, &TransportError{dsn: dsn, msg: "invalid DSN", err: err}
+	}
+
+	t := &PostgresTransport{
+		logger:            logger,
+		pool:              pool,
+		tableName:         table,
+		table:             pgx.Identifier{table}.Sanitize(),
+		size:              size,
+		cleanupFrequency:  cleanupFrequency,
+		subscribers:       subscriberList,
+		closed:            make(chan struct{}),
+		listenerDone:      make(chan struct{}),
+		lastEventID:       EarliestLastEventID,
+		listenerDownSince: time.Now(),
+	}
+
+	if err := t.init(ctx); err != nil {
+		pool.Close()
+
+		return nil, &TransportError{dsn: dsn, err: err}
+	}
+
+	listenerCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	t.cancelListener = cancel
+
+	go t.listen(listenerCtx)
+
+	return t, nil
+}
+
+// init creates the table and retrieves the last stored event.
+func (t *PostgresTransport) init(ctx context.Context) error {
+	if _, err := t.pool.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	seq bigserial PRIMARY KEY,
+	id text NOT NULL,
+	update json NOT NULL
+)`, t.table)); err != nil {
+		return fmt.Errorf("unable to create table: %w", err)
+	}
+
+	if _, err := t.pool.Exec(ctx, fmt.Sprintf(
+		"CREATE INDEX IF NOT EXISTS %s ON %s (id)",
+		pgx.Identifier{t.tableName + "_id_idx"}.Sanitize(),
+		t.table,
+	)); err != nil {
+		return fmt.Errorf("unable to create index: %w", err)
+	}
+
+	err := t.pool.QueryRow(ctx, fmt.Sprintf("SELECT seq, id FROM %s ORDER BY seq DESC LIMIT 1", t.table)).Scan(&t.lastSeq, &t.lastEventID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("unable to get last_event_id from PostgreSQL: %w", err)
+	}
+
+	return nil
+}
+
+// Dispatch dispatches an update to all subscribers and persists it in PostgreSQL.
+//
+// Local subscribers, as well as subscribers connected to other hub nodes, receive
+// the update when the notification sent in the same database transaction is delivered.
+func (t *PostgresTransport) Dispatch(ctx context.Context, update *Update) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	update.AssignUUID()
+
+	// Marshal through the pointer so Update's custom MarshalJSON applies.
+	updateJSON, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("error when marshaling update: %w", err)
+	}
+
+	if err := pgx.BeginFunc(ctx, t.pool, func(tx pgx.Tx) error {
+		// Sequence numbers are assigned when inserting, but concurrent
+		// transactions may commit in a different order: a listener or a
+		// subscriber reading the history in between would skip the update
+		// with the lower sequence number forever. Serializing the inserts
+		// until the commit makes the sequence order match the commit order.
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", t.tableName); err != nil {
+			return fmt.Errorf("unable to lock the table: %w", err)
+		}
+
+		var seq int64
+		if err := tx.QueryRow(ctx, fmt.Sprintf("INSERT INTO %s (id, update) VALUES ($1, $2) RETURNING seq", t.table), update.ID, updateJSON).Scan(&seq); err != nil {
+			return fmt.Errorf("unable to insert update: %w", err)
+		}
+
+		if _, err := tx.Exec(ctx, "SELECT pg_notify($1, $2)", t.tableName, strconv.FormatInt(seq, 10)); err != nil {
+			return fmt.Errorf("unable to notify update: %w", err)
+		}
+
+		return t.cleanup(ctx, tx, seq)
+	}); err != nil {
+		return fmt.Errorf("postgres error: %w", err)
+	}
+
+	return nil
+}
+
+// AddSubscriber adds a new subscriber to the transport.
+func (t *PostgresTransport) AddSubscriber(ctx context.Context, s *LocalSubscriber) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	t.Lock()
+	t.subscribers.Add(s)
+	toSeq := t.lastSeq
+	t.Unlock()
+
+	if s.RequestLastEventIDSet {
+		if err := t.dispatchHistory(ctx, s, toSeq); err != nil {
+			return err
+		}
+	}
+
+	s.Ready(ctx)
+
+	return nil
+}
+
+// RemoveSubscriber removes a new subscriber from the transport.
+func (t *PostgresTransport) RemoveSubscriber(_ context.Context, s *LocalSubscriber) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.subscribers.Remove(s)
+
+	return nil
+}
+
+// LastEventID returns the ID of the last dispatched update.
+func (t *PostgresTransport) LastEventID(_ context.Context) string {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.lastEventID
+}
+
+// GetSubscribers get the list of active subscribers.
+func (t *PostgresTransport) GetSubscribers(_ context.Context) (string, []*Subscriber, error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.lastEventID, getSubscribers(t.subscribers), nil
+}
+
+// Ready reports whether the database is reachable and notifications are being received.
+func (t *PostgresTransport) Ready(ctx context.Context) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	if err := t.pool.Ping(ctx); err != nil {
+		return fmt.Errorf("unable to ping PostgreSQL: %w", err)
+	}
+
+	t.listenerMu.RLock()
+	defer t.listenerMu.RUnlock()
+
+	if !t.listening {
+		return t.listenerError()
+	}
+
+	return nil
+}
+
+// Live reports whether the transport is closed or hasn't been able to receive
+// notifications for an extended period.
+func (t *PostgresTransport) Live(_ context.Context) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	t.listenerMu.RLock()
+	defer t.listenerMu.RUnlock()
+
+	if !t.listening && time.Since(t.listenerDownSince) > postgresMaxListenerDowntime {
+		return t.listenerError()
+	}
+
+	return nil
+}
+
+// listenerError must be called with listenerMu held.
+func (t *PostgresTransport) listenerError() error {
+	if t.listenerErr == nil {
+		return ErrPostgresListenerDown
+	}
+
+	return fmt.Errorf("%w: %w", ErrPostgresListenerDown, t.listenerErr)
+}
+
+// Close closes the Transport.
+func (t *PostgresTransport) Close(_ context.Context) error {
+	t.closedOnce.Do(func() {
+		close(t.closed)
+
+		t.cancelListener()
+		<-t.listenerDone
+
+		t.Lock()
+		defer t.Unlock()
+
+		t.subscribers.Walk(0, func(s *LocalSubscriber) bool {
+			s.Disconnect()
+
+			return true
+		})
+		t.pool.Close()
+	})
+
+	return nil
+}
+
+// listen receives notifications from all the hub nodes and dispatches the
+// corresponding updates to local subscribers. The connection is re-established
+// until the transport is closed.
+func (t *PostgresTransport) listen(ctx context.Context) {
+	defer close(t.listenerDone)
+
+	for {
+		err := t.listenOnce(ctx)
+
+		t.listenerMu.Lock()
+		if t.listening {
+			t.listenerDownSince = time.Now()
+		}
+
+		t.listening = false
+		t.listenerErr = err
+		t.listenerMu.Unlock()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if t.logger.Enabled(ctx, slog.LevelError) {
+			t.logger.LogAttrs(ctx, slog.LevelError, "PostgreSQL listener disconnected, reconnecting", slog.Any("error", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(postgresListenRetryDelay):
+		}
+	}
+}
+
+func (t *PostgresTransport) listenOnce(ctx context.Context) error {
+	conn, err := t.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to acquire connection: %w", err)
+	}
+
+	// The connection is in LISTEN mode, don't give it back to the pool.
+	pc := conn.Hijack()
+	defer pc.Close(context.WithoutCancel(ctx))
+
+	if _, err := pc.Exec(ctx, "LISTEN "+t.table); err != nil {
+		return fmt.Errorf("unable to listen: %w", err)
+	}
+
+	// Updates persisted while the listener was not connected are dispatched
+	// now, those already dispatched this way will be notified again and must be skipped.
+	caughtUp, err := t.catchUp(ctx)
+	if err != nil {
+		return err
+	}
+
+	t.listenerMu.Lock()
+	t.listening = true
+	t.listenerErr = nil
+	t.listenerMu.Unlock()
+
+	for {
+		n, err := pc.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to wait for notification: %w", err)
+		}
+
+		seq, err := strconv.ParseInt(n.Payload, 10, 64)
+		if err != nil {
+			if t.logger.Enabled(ctx, slog.LevelError) {
+				t.logger.LogAttrs(ctx, slog.LevelError, "Invalid PostgreSQL notification payload", slog.String("payload", n.Payload), slog.Any("error", err))
+			}
+
+			continue
+		}
+
+		if seq <= caughtUp {
+			continue
+		}
+
+		if err := t.fetchAndDispatch(ctx, "seq = $1", seq); err != nil {
+			return err
+		}
+	}
+}
+
+// catchUp dispatches the updates stored after the last one dispatched and
+// returns the sequence number of the last stored update.
+func (t *PostgresTransport) catchUp(ctx context.Context) (int64, error) {
+	t.RLock()
+	lastSeq := t.lastSeq
+	t.RUnlock()
+
+	if err := t.fetchAndDispatch(ctx, "seq > $1", lastSeq); err != nil {
+		return 0, err
+	}
+
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.lastSeq, nil
+}
+
+func (t *PostgresTransport) fetchAndDispatch(ctx context.Context, where string, arg int64) error {
+	rows, err := t.pool.Query(ctx, fmt.Sprintf("SELECT seq, id, update FROM %s WHERE %s ORDER BY seq", t.table, where), arg)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve updates: %w", err)
+	}
+
+	var (
+		seq        int64
+		id         string
+		updateJSON []byte
+	)
+
+	_, err = pgx.ForEachRow(rows, []any{&seq, &id, &updateJSON}, func() error {
+		var update *Update
+		if err := json.Unmarshal(updateJSON, &update); err != nil {
+			if t.logger.Enabled(ctx, slog.LevelError) {
+				t.logger.LogAttrs(ctx, slog.LevelError, "Unable to unmarshal update coming from PostgreSQL", slog.String("id", id), slog.Any("error", err))
+			}
+
+			return nil
+		}
+
+		t.Lock()
+		defer t.Unlock()
+
+		// Notifications may be delivered in a different order than the
+		// sequence: the last event ID only moves forward.
+		if seq > t.lastSeq {
+			t.lastSeq = seq
+			t.lastEventID = id
+		}
+
+		for _, s := range t.subscribers.MatchAny(update) {
+			s.Dispatch(ctx, update, false)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to retrieve updates: %w", err)
+	}
+
+	return nil
+}
+
+//nolint:funlen
+func (t *PostgresTransport) dispatchHistory(ctx context.Context, s *LocalSubscriber, toSeq int64) error {
+	ctx, span := startSpan(ctx, "mercure.transport.history",
+		trace.WithAttributes(
+			attribute.String("mercure.transport", "postgres"),
+			attribute.String("mercure.subscriber.id", s.ID),
+			attribute.String("mercure.last_event_id.requested", s.RequestLastEventID),
+		))
+	defer span.End()
+
+	fromSeq := int64(0)
+	responseLastEventID := EarliestLastEventID
+
+	if s.RequestLastEventID != EarliestLastEventID {
+		err := t.pool.QueryRow(ctx, fmt.Sprintf("SELECT seq FROM %s WHERE id = $1 AND seq <= $2 ORDER BY seq DESC LIMIT 1", t.table), s.RequestLastEventID, toSeq).Scan(&fromSeq)
+
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			// The requested event doesn't exist or has been discarded: the
+			// protocol reserves "earliest" for this case, nothing is replayed.
+			s.HistoryDispatched(EarliestLastEventID)
+
+			if t.logger.Enabled(ctx, slog.LevelInfo) {
+				t.logger.LogAttrs(ctx, slog.LevelInfo, "Can't find requested LastEventID")
+			}
+
+			return nil
+
+		case err != nil:
+			s.HistoryDispatched(EarliestLastEventID)
+
+			err = fmt.Errorf("unable to retrieve history from PostgreSQL: %w", err)
+			recordSpanError(span, err)
+
+			return err
+		}
+
+		// The subscriber already knows this id; echoing it is not a disclosure.
+		responseLastEventID = s.RequestLastEventID
+	}
+
+	rows, err := t.pool.Query(ctx, fmt.Sprintf("SELECT update FROM %s WHERE seq > $1 AND seq <= $2 ORDER BY seq", t.table), fromSeq, toSeq)
+	if err != nil {
+		s.HistoryDispatched(responseLastEventID)
+
+		err = fmt.Errorf("unable to retrieve history from PostgreSQL: %w", err)
+		recordSpanError(span, err)
+
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			updateJSON []byte
+			update     *Update
+		)
+
+		if err := rows.Scan(&updateJSON); err != nil {
+			s.HistoryDispatched(responseLastEventID)
+
+			err = fmt.Errorf("unable to retrieve history from PostgreSQL: %w", err)
+			recordSpanError(span, err)
+
+			return err
+		}
+
+		if err := json.Unmarshal(updateJSON, &update); err != nil {
+			s.HistoryDispatched(responseLastEventID)
+
+			err = fmt.Errorf("unable to unmarshal update: %w", err)
+			recordSpanError(span, err)
+
+			if t.logger.Enabled(ctx, slog.LevelError) {
+				t.logger.LogAttrs(ctx, slog.LevelError, "Unable to unmarshal update coming from PostgreSQL", slog.Any("error", err))
+			}
+
+			return err
+		}
+
+		if s.Match(update) && !s.Dispatch(ctx, update, true) {
+			s.HistoryDispatched(responseLastEventID)
+
+			return nil
+		}
+	}
+
+	s.HistoryDispatched(responseLastEventID)
+
+	if err := rows.Err(); err != nil {
+		err = fmt.Errorf("unable to retrieve history from PostgreSQL: %w", err)
+		recordSpanError(span, err)
+
+		return err
+	}
+
+	return nil
+}
+
+// shouldCleanup reports whether this publish runs a cleanup pass. cleanupFrequency
+// is the probability of doing so, from 0 (never) to 1 (every publish).
+func (t *PostgresTransport) shouldCleanup(lastSeq int64) bool {
+	if t.size == 0 || lastSeq <= 0 || t.size >= uint64(lastSeq) {
+		return false
+	}
+
+	return rand.Float64() < t.cleanupFrequency //nolint:gosec
+}
+
+// cleanup removes entries in the history above the size limit, triggered probabilistically.
+func (t *PostgresTransport) cleanup(ctx context.Context, tx pgx.Tx, lastSeq int64) error {
+	if !t.shouldCleanup(lastSeq) {
+		return nil
+	}
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf("DELETE FROM %s WHERE seq <= $1", t.table), lastSeq-int64(t.size)); err != nil { //nolint:gosec
+		return fmt.Errorf("unable to delete old updates: %w", err)
+	}
+
+	return nil
+}
+
+// Interface guards.
+var (
+	_ Transport              = (*PostgresTransport)(nil)
+	_ TransportLastEventID   = (*PostgresTransport)(nil)
+	_ TransportSubscribers   = (*PostgresTransport)(nil)
+	_ TransportHealthChecker = (*PostgresTransport)(nil)
+)
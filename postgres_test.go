@@ -0,0 +1,190 @@
+package mercure
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createPostgresTransport creates a transport using the database set in the
+// MERCURE_TEST_POSTGRES_DSN environment variable, and skips the test if it
+// isn't set, except on CI where a PostgreSQL service is always available.
+func createPostgresTransport(t *testing.T, size uint64, cleanupFrequency float64) *PostgresTransport {
+	t.Helper()
+
+	dsn := os.Getenv("MERCURE_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		if os.Getenv("CI") != "" {
+			t.Fatal("MERCURE_TEST_POSTGRES_DSN must be set on CI")
+		}
+
+		t.Skip("MERCURE_TEST_POSTGRES_DSN not set")
+	}
+
+	if cleanupFrequency == 0 {
+		cleanupFrequency = PostgresDefaultCleanupFrequency
+	}
+
+	table := "test_" + strings.ToLower(strings.ReplaceAll(t.Name(), "/", "_"))
+
+	transport, err := NewPostgresTransport(t.Context(), NewSubscriberList(0), slog.Default(), dsn, table, size, cleanupFrequency)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Close(context.Background()))
+
+		conn, err := pgx.Connect(context.Background(), dsn)
+		require.NoError(t, err)
+
+		_, err = conn.Exec(context.Background(), "DROP TABLE IF EXISTS "+transport.table)
+		require.NoError(t, err)
+		require.NoError(t, conn.Close(context.Background()))
+	})
+
+	return transport
+}
+
+// waitForPostgresLastEventID waits until the notification of the given update has been received.
+func waitForPostgresLastEventID(t *testing.T, transport *PostgresTransport, id string) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		lastEventID, _, _ := transport.GetSubscribers(t.Context())
+
+		return lastEventID == id
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestPostgresTransportPurgeHistory(t *testing.T) {
+	t.Parallel()
+
+	transport := createPostgresTransport(t, 5, 1)
+
+	for i := range 12 {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{
+			Event:  Event{ID: strconv.Itoa(i)},
+			Topics: []string{"https://example.com/foo"},
+		}))
+	}
+
+	var count int
+	require.NoError(t, transport.pool.QueryRow(t.Context(), "SELECT count(*) FROM "+transport.table).Scan(&count))
+	assert.Equal(t, 5, count)
+}
+
+func TestPostgresTransportMultipleNodes(t *testing.T) {
+	t.Parallel()
+
+	node1 := createPostgresTransport(t, 0, 0)
+
+	node2, err := NewPostgresTransport(t.Context(), NewSubscriberList(0), slog.Default(), os.Getenv("MERCURE_TEST_POSTGRES_DSN"), node1.tableName, 0, 0)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, node2.Close(context.Background()))
+	})
+
+	s := NewLocalSubscriber("", node2.logger, &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers([]string{"https://example.com/foo"}), stringsToExactMatchers(nil))
+
+	require.NoError(t, node2.AddSubscriber(t.Context(), s))
+
+	require.Eventually(t, func() bool {
+		return node2.Ready(t.Context()) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	u := &Update{Topics: []string{"https://example.com/foo"}}
+	require.NoError(t, node1.Dispatch(t.Context(), u))
+
+	assert.Equal(t, u.ID, (<-s.Receive()).ID)
+	waitForPostgresLastEventID(t, node2, u.ID)
+}
+
+func TestPostgresTransportConcurrentDispatch(t *testing.T) {
+	t.Parallel()
+
+	transport := createPostgresTransport(t, 0, 0)
+	topics := []string{"https://example.com/foo"}
+
+	require.Eventually(t, func() bool {
+		return transport.Ready(t.Context()) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	live := NewLocalSubscriber("", transport.logger, &TopicMatcherStore{})
+	live.setMatchers(stringsToExactMatchers(topics), stringsToExactMatchers(nil))
+	require.NoError(t, transport.AddSubscriber(t.Context(), live))
+
+	const n = 50
+
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Go(func() {
+			assert.NoError(t, transport.Dispatch(t.Context(), &Update{Topics: topics, Event: Event{ID: strconv.Itoa(i)}}))
+		})
+	}
+
+	wg.Wait()
+
+	// Every update is received once by live subscribers, and replayed in
+	// the same order to subscribers resuming from the history.
+	var ids []string
+	for range n {
+		ids = append(ids, (<-live.Receive()).ID)
+	}
+
+	s := NewLocalSubscriber(EarliestLastEventID, transport.logger, &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers(topics), stringsToExactMatchers(nil))
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	for _, id := range ids {
+		assert.Equal(t, id, (<-s.Receive()).ID)
+	}
+}
+
+func TestPostgresTransportHealth(t *testing.T) {
+	t.Parallel()
+
+	transport := createPostgresTransport(t, 0, 0)
+
+	require.Eventually(t, func() bool {
+		return transport.Ready(t.Context()) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, transport.Live(t.Context()))
+
+	// Kill the listening connection: the listener must reconnect.
+	var pid int
+	require.NoError(t, transport.pool.QueryRow(t.Context(), "SELECT pid FROM pg_stat_activity WHERE query = $1 AND pid <> pg_backend_pid()", "LISTEN "+transport.table).Scan(&pid))
+	_, err := transport.pool.Exec(t.Context(), "SELECT pg_terminate_backend($1)", pid)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return transport.Ready(t.Context()) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	s := NewLocalSubscriber("", transport.logger, &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers([]string{"https://example.com/foo"}), stringsToExactMatchers(nil))
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	u := &Update{Topics: []string{"https://example.com/foo"}}
+	require.NoError(t, transport.Dispatch(t.Context(), u))
+	assert.Equal(t, u.ID, (<-s.Receive()).ID)
+}
+
+func TestNewPostgresTransportInvalidDSN(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewPostgresTransport(t.Context(), NewSubscriberList(0), slog.Default(), "invalid://", "", 0, 0)
+
+	var transportErr *TransportError
+	require.ErrorAs(t, err, &transportErr)
+	assert.Equal(t, "invalid DSN", transportErr.msg)
+}
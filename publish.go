@@ -2,6 +2,8 @@ package mercure
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -9,6 +11,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"go.opentelemetry.io/otel/trace"
@@ -30,6 +33,10 @@ const (
 	// (subscribematchers.go).
 )
 
+// maxIdempotencyKeyLength caps the length of the Idempotency-Key header, as
+// the keys are kept by the transport during the deduplication window.
+const maxIdempotencyKeyLength = 255
+
 // Sentinel errors returned by Publish. Callers can branch on them via
 // errors.Is.
 var (
@@ -42,6 +49,7 @@ var (
 	ErrTooManyTopics     = errors.New("too many topics in update")
 	ErrMissingTopic      = errors.New("update carries no topic")
 	ErrInvalidData       = errors.New(`"data" field is not valid UTF-8`)
+	ErrInvalidExpires    = errors.New(`"expires" field is in the past`)
 )
 
 // Validate enforces the publish-side input rules that protect subscribers
@@ -112,12 +120,51 @@ func (u *Update) Validate() error {
 		return ErrInvalidData
 	}
 
+	// An update that has already expired would never be delivered.
+	if u.expired(time.Now()) {
+		return ErrInvalidExpires
+	}
+
 	return nil
 }
 
 // Publish broadcasts the given update to all subscribers.
 // The id field of the Update instance can be updated by the underlying Transport.
 func (h *Hub) Publish(ctx context.Context, update *Update) error {
+	_, err := h.publish(ctx, "", update)
+
+	return err
+}
+
+// PublishIdempotent broadcasts the given update to all subscribers, unless an
+// update has already been published with the same idempotency key during the
+// deduplication window of the transport. In this case, nothing is broadcast,
+// the id field of the Update instance is set to the one of the original update,
+// and false is returned. The key is ignored if the transport doesn't implement
+// TransportDeduplicator.
+func (h *Hub) PublishIdempotent(ctx context.Context, key string, update *Update) (bool, error) {
+	return h.publish(ctx, key, update)
+}
+
+// publisherIdempotencyKey namespaces the idempotency key of a publication
+// with the identity of its publisher, so that a publisher can't replay the
+// publications of another one, nor learn their IDs. The identity is the
+// subject of the token, or the token itself if it has none.
+func publisherIdempotencyKey(c *claims, key string) string {
+	if c == nil {
+		return key
+	}
+
+	if c.Subject == "" {
+		return c.tokenHash + ":" + key
+	}
+
+	sum := sha256.Sum256([]byte(c.Issuer + "\x00" + c.Subject))
+
+	return hex.EncodeToString(sum[:]) + ":" + key
+}
+
+func (h *Hub) publish(ctx context.Context, key string, update *Update) (bool, error) {
 	ctx, span := startSpan(ctx, "mercure.publish", trace.WithSpanKind(trace.SpanKindProducer))
 	// Deferred so the ID assigned by the transport via AssignUUID lands on the span.
 	defer func() {
@@ -135,19 +182,28 @@ func (h *Hub) Publish(ctx context.Context, update *Update) error {
 
 		recordSpanError(span, err)
 
-		return err
+		return false, err
 	}
 
 	ctx = context.WithValue(ctx, UpdateContextKey, update)
 
-	if err := h.transport.Dispatch(ctx, update); err != nil {
+	dispatched, err := dispatchIdempotent(ctx, h.transport, key, update)
+	if err != nil {
 		if h.logger.Enabled(ctx, slog.LevelError) {
 			h.logger.LogAttrs(ctx, slog.LevelError, "Failed to dispatch update", slog.Any("error", err))
 		}
 
 		recordSpanError(span, err)
 
-		return err //nolint:wrapcheck
+		return false, err //nolint:wrapcheck
+	}
+
+	if !dispatched {
+		if h.logger.Enabled(ctx, slog.LevelDebug) {
+			h.logger.LogAttrs(ctx, slog.LevelDebug, "Update replay ignored")
+		}
+
+		return false, nil
 	}
 
 	h.metrics.UpdatePublished(update)
@@ -156,7 +212,153 @@ func (h *Hub) Publish(ctx context.Context, update *Update) error {
 		h.logger.LogAttrs(ctx, slog.LevelDebug, "Update published")
 	}
 
-	return nil
+	return true, nil
+}
+
+// publishErrorStatus returns the HTTP status code of a publication error:
+// validation errors are the publisher's fault, the other ones are the hub's.
+func publishErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrReservedTopic), errors.Is(err, ErrReservedWildcard),
+		errors.Is(err, ErrInvalidEventID), errors.Is(err, ErrInvalidEventType),
+		errors.Is(err, ErrReservedEventType),
+		errors.Is(err, ErrInvalidTopic), errors.Is(err, ErrTooManyTopics),
+		errors.Is(err, ErrMissingTopic), errors.Is(err, ErrInvalidData),
+		errors.Is(err, ErrInvalidExpires):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// publishResult is the outcome of a publication, as reported to publishers
+// sending several updates at once.
+type publishResult struct {
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Status int    `json:"status,omitempty"`
+	// Replayed reports that the update had already been published with the
+	// same idempotency key, and hasn't been dispatched again.
+	Replayed bool `json:"replayed,omitempty"`
+}
+
+// newPublishErrorResult returns the result of a publication that failed with
+// err. Only the details of validation errors are disclosed.
+func newPublishErrorResult(err error) publishResult {
+	status := publishErrorStatus(err)
+	if status == http.StatusBadRequest {
+		return publishResult{Error: err.Error(), Status: status}
+	}
+
+	return publishResult{Error: http.StatusText(status), Status: status}
+}
+
+// checkPublication checks the topics of u, and that the publisher holding
+// claims is allowed to publish it. It returns the error result otherwise, or
+// a zero result.
+func (h *Hub) checkPublication(ctx context.Context, claims *claims, u *Update) publishResult {
+	// As for forms, topics are checked before being matched against the
+	// claims, as they are used as keys of the match cache.
+	if len(u.Topics) == 0 {
+		return publishResult{Error: ErrMissingTopic.Error(), Status: http.StatusBadRequest}
+	}
+
+	if len(u.Topics) > maxPublishTopics {
+		return publishResult{Error: ErrTooManyTopics.Error(), Status: http.StatusBadRequest}
+	}
+
+	for _, t := range u.Topics {
+		if !validProtocolString(t) {
+			return publishResult{Error: fmt.Errorf("%q: %w", t, ErrInvalidTopic).Error(), Status: http.StatusBadRequest}
+		}
+	}
+
+	if !h.canPublish(ctx, claims, u.Topics, u.Private) {
+		return publishResult{Error: http.StatusText(http.StatusForbidden), Status: http.StatusForbidden}
+	}
+
+	return publishResult{}
+}
+
+// canPublish reports whether the publisher holding claims can publish an
+// update to topics. Topics must have been checked with validProtocolString.
+func (h *Hub) canPublish(ctx context.Context, claims *claims, topics []string, private bool) bool {
+	if claims == nil || claims.authz.grantsAll(h.topicMatcherStore, actionPublish, topics) {
+		return true
+	}
+
+	if private {
+		return false
+	}
+
+	infoEnabled := h.logger.Enabled(ctx, slog.LevelInfo)
+	if h.isBackwardCompatiblyEnabledWith(7) {
+		if infoEnabled {
+			h.logger.LogAttrs(ctx, slog.LevelInfo, `Deprecated: posting public updates to topics not granted to the token is deprecated since the version 7 of the protocol, grant the "*" topic to allow publishing on all topics.`)
+		}
+
+		return true
+	}
+
+	if infoEnabled {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, `Unsupported: posting public updates to topics not granted to the token is not supported anymore, grant the "*" topic to allow publishing on all topics or enable backward compatibility with the version 7 of the protocol.`)
+	}
+
+	return false
+}
+
+// parseFormPublication reads the update sent as an
+// application/x-www-form-urlencoded body. It writes the error response and
+// returns false if the body is invalid.
+func parseFormPublication(w http.ResponseWriter, r *http.Request) (*Update, bool) {
+	if err := r.ParseForm(); err != nil {
+		status := http.StatusBadRequest
+
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+
+		http.Error(w, http.StatusText(status), status)
+
+		return nil, false
+	}
+
+	topics := r.PostForm["topic"]
+	if len(topics) == 0 {
+		http.Error(w, `Missing "topic" parameter`, http.StatusBadRequest)
+
+		return nil, false
+	}
+
+	var retry uint64
+
+	if retryString := r.PostForm.Get("retry"); retryString != "" {
+		var err error
+		if retry, err = strconv.ParseUint(retryString, 10, 64); err != nil {
+			http.Error(w, `Invalid "retry" parameter`, http.StatusBadRequest)
+
+			return nil, false
+		}
+	}
+
+	var expires time.Time
+
+	if expiresString := r.PostForm.Get("expires"); expiresString != "" {
+		var err error
+		if expires, err = time.Parse(time.RFC3339, expiresString); err != nil {
+			http.Error(w, `Invalid "expires" parameter`, http.StatusBadRequest)
+
+			return nil, false
+		}
+	}
+
+	return &Update{
+		Topics:  topics,
+		Private: len(r.PostForm["private"]) != 0,
+		Event:   Event{r.PostForm.Get("data"), r.PostForm.Get("id"), r.PostForm.Get("type"), retry},
+		Expires: expires,
+	}, true
 }
 
 // PublishHandler allows publisher to broadcast updates to all subscribers.
@@ -196,26 +398,29 @@ func (h *Hub) PublishHandler(w http.ResponseWriter, r *http.Request) {
 
 	h.limitRequestBody(w, r)
 
-	if err := r.ParseForm(); err != nil {
-		status := http.StatusBadRequest
-
-		var maxBytesErr *http.MaxBytesError
-		if errors.As(err, &maxBytesErr) {
-			status = http.StatusRequestEntityTooLarge
-		}
-
-		http.Error(w, http.StatusText(status), status)
+	if isBatchPublication(r) {
+		h.publishBatch(ctx, w, r, claims)
 
 		return
 	}
 
-	topics := r.PostForm["topic"]
-	if len(topics) == 0 {
-		http.Error(w, `Missing "topic" parameter`, http.StatusBadRequest)
+	var (
+		parsed *Update
+		ok     bool
+	)
+
+	if isJSONPublication(r) {
+		parsed, ok = h.parseJSONPublication(w, r)
+	} else {
+		parsed, ok = parseFormPublication(w, r)
+	}
 
+	if !ok {
 		return
 	}
 
+	topics := parsed.Topics
+
 	// Reject oversized topic lists before running canDispatch — otherwise
 	// an authenticated publisher could force O(topics × matchers)
 	// matching work on every request before being rejected by validate.
@@ -239,61 +444,40 @@ func (h *Hub) PublishHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	var retry uint64
-
-	if retryString := r.PostForm.Get("retry"); retryString != "" {
-		var err error
-		if retry, err = strconv.ParseUint(retryString, 10, 64); err != nil {
-			http.Error(w, `Invalid "retry" parameter`, http.StatusBadRequest)
-
-			return
-		}
-	}
-
-	private := len(r.PostForm["private"]) != 0
-	if claims != nil && !claims.authz.grantsAll(h.topicMatcherStore, actionPublish, topics) { //nolint:nestif
-		if private {
-			h.writeBearerError(w, r, bearerErrInsufficientScope, http.StatusForbidden)
+	// A publisher retrying a request identifies it with the Idempotency-Key
+	// header or, failing that, with the ID it set. They are namespaced not to
+	// collide.
+	var idempotencyKey string
+	if k := r.Header.Get("Idempotency-Key"); k != "" {
+		if len(k) > maxIdempotencyKeyLength || !validProtocolString(k) {
+			http.Error(w, `Invalid "Idempotency-Key" header`, http.StatusBadRequest)
 
 			return
 		}
 
-		infoEnabled := h.logger.Enabled(ctx, slog.LevelInfo)
-		if h.isBackwardCompatiblyEnabledWith(7) {
-			if infoEnabled {
-				h.logger.LogAttrs(ctx, slog.LevelInfo, `Deprecated: posting public updates to topics not granted to the token is deprecated since the version 7 of the protocol, grant the "*" topic to allow publishing on all topics.`)
-			}
-		} else {
-			if infoEnabled {
-				h.logger.LogAttrs(ctx, slog.LevelInfo, `Unsupported: posting public updates to topics not granted to the token is not supported anymore, grant the "*" topic to allow publishing on all topics or enable backward compatibility with the version 7 of the protocol.`)
-			}
+		idempotencyKey = publisherIdempotencyKey(claims, "key:"+k)
+	} else if parsed.ID != "" {
+		idempotencyKey = publisherIdempotencyKey(claims, "id:"+parsed.ID)
+	}
 
-			h.writeBearerError(w, r, bearerErrInsufficientScope, http.StatusForbidden)
+	if !h.canPublish(ctx, claims, topics, parsed.Private) {
+		h.writeBearerError(w, r, bearerErrInsufficientScope, http.StatusForbidden)
 
-			return
-		}
+		return
 	}
 
-	u = &Update{
-		Topics:  topics,
-		Private: private,
-		Debug:   h.debug,
-		Event:   Event{r.PostForm.Get("data"), r.PostForm.Get("id"), r.PostForm.Get("type"), retry},
-	}
+	u = parsed
+	u.Debug = h.debug
 
 	dispatchCtx := context.WithoutCancel(ctx)
 
-	// Validation, dispatch, logging and metrics live in Hub.Publish.
-	if err := h.Publish(dispatchCtx, u); err != nil {
-		switch {
-		case errors.Is(err, ErrReservedTopic), errors.Is(err, ErrReservedWildcard),
-			errors.Is(err, ErrInvalidEventID), errors.Is(err, ErrInvalidEventType),
-			errors.Is(err, ErrReservedEventType),
-			errors.Is(err, ErrInvalidTopic), errors.Is(err, ErrTooManyTopics),
-			errors.Is(err, ErrMissingTopic), errors.Is(err, ErrInvalidData):
-			http.Error(w, err.Error(), http.StatusBadRequest)
-		default:
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	// Validation, dispatch, logging and metrics live in Hub.PublishIdempotent.
+	dispatched, err := h.PublishIdempotent(dispatchCtx, idempotencyKey, u)
+	if err != nil {
+		if status := publishErrorStatus(err); status == http.StatusBadRequest {
+			http.Error(w, err.Error(), status)
+		} else {
+			http.Error(w, http.StatusText(status), status)
 		}
 
 		// Mirror the error onto the handler span too; Hub.Publish's child
@@ -307,6 +491,10 @@ func (h *Hub) PublishHandler(w http.ResponseWriter, r *http.Request) {
 	// The body is the update id; the protocol requires this exact media type.
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 
+	if !dispatched {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+
 	if _, err := io.WriteString(w, u.ID); err != nil {
 		if h.logger.Enabled(ctx, slog.LevelInfo) {
 			h.logger.LogAttrs(ctx, slog.LevelInfo, "Failed to write publish response", slog.Any("error", err))
@@ -10,8 +10,10 @@ import (
 	"strings"
 	"testing"
 	"testing/synctest"
+	"time"
 
 	"github.com/gofrs/uuid/v5"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -184,6 +186,175 @@ func TestPublishHandlerInvalidRetry(t *testing.T) {
 `, w.Body.String())
 }
 
+func TestPublishHandlerInvalidExpires(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+
+	for expires, body := range map[string]string{
+		"invalid":              `Invalid "expires" parameter`,
+		"2000-01-01T00:00:00Z": ErrInvalidExpires.Error(),
+	} {
+		form := url.Values{}
+		form.Add("topic", "https://example.com/books/1")
+		form.Add("data", "foo")
+		form.Add("expires", expires)
+
+		req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", bearerPrefix+createDummyAuthorizedJWT(rolePublisher, []string{"*"}))
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+
+		resp := w.Result()
+		require.NoError(t, resp.Body.Close())
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, body+"\n", w.Body.String())
+	}
+}
+
+func publishIdempotent(t *testing.T, hub *Hub, token, key, id string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	form := url.Values{}
+	form.Add("topic", "https://example.com/books/1")
+	form.Add("data", "foo")
+
+	if id != "" {
+		form.Add("id", id)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Authorization", bearerPrefix+token)
+
+	if key != "" {
+		req.Header.Add("Idempotency-Key", key)
+	}
+
+	w := httptest.NewRecorder()
+	hub.PublishHandler(w, req)
+
+	return w
+}
+
+func TestPublishHandlerIdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithTransport(NewLocalTransport(NewSubscriberList(0), WithLocalDeduplicationWindow(time.Minute))))
+	token := createDummyAuthorizedJWT(rolePublisher, []string{"*"})
+
+	w := publishIdempotent(t, hub, token, "foo", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+
+	id := w.Body.String()
+
+	w = publishIdempotent(t, hub, token, "foo", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, id, w.Body.String())
+
+	// A reused ID is a replay too, keys and IDs don't collide.
+	w = publishIdempotent(t, hub, token, "", "foo")
+	assert.Equal(t, "foo", w.Body.String())
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+
+	w = publishIdempotent(t, hub, token, "", "foo")
+	assert.Equal(t, "foo", w.Body.String())
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+
+	// The header takes precedence over the ID.
+	w = publishIdempotent(t, hub, token, "bar", "foo")
+	assert.Equal(t, "foo", w.Body.String())
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+
+	w = publishIdempotent(t, hub, token, "foo\x7f", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "Invalid \"Idempotency-Key\" header\n", w.Body.String())
+
+	w = publishIdempotent(t, hub, token, strings.Repeat("a", maxIdempotencyKeyLength+1), "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPublishHandlerIdempotencyKeyPerPublisher(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithTransport(NewLocalTransport(NewSubscriberList(0), WithLocalDeduplicationWindow(time.Minute))))
+
+	mint := func(subject string) string {
+		token := jwt.New(jwt.SigningMethodHS256)
+		token.Header["typ"] = atJWTType
+		token.Claims = &claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    testIssuer,
+				Subject:   subject,
+				Audience:  jwt.ClaimStrings{testResourceIdentifier},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+			AuthorizationDetails: []authorizationDetail{{
+				Type:    authorizationDetailTypeMercure,
+				Actions: []mercureAction{actionPublish},
+				Topics:  stringsToDetailTopics([]string{"*"}),
+			}},
+		}
+
+		tokenString, err := token.SignedString([]byte("publisher"))
+		require.NoError(t, err)
+
+		return tokenString
+	}
+
+	alice, bob := mint("alice"), mint("bob")
+
+	w := publishIdempotent(t, hub, alice, "foo", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	id := w.Body.String()
+
+	// Another publisher reusing the key isn't replaying the publication.
+	w = publishIdempotent(t, hub, bob, "foo", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+	assert.NotEqual(t, id, w.Body.String())
+
+	// The subject identifies the publisher, whatever the token.
+	w = publishIdempotent(t, hub, mint("alice"), "foo", "")
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, id, w.Body.String())
+}
+
+func TestPublishHandlerIdempotencyKeyWithTransportMiddleware(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t,
+		WithTransport(NewLocalTransport(NewSubscriberList(0), WithLocalDeduplicationWindow(time.Minute))),
+		WithTransportMiddleware(NewTracingTransportMiddleware(), NewRetryTransportMiddleware(2, time.Millisecond)),
+	)
+	token := createDummyAuthorizedJWT(rolePublisher, []string{"*"})
+
+	id := publishIdempotent(t, hub, token, "foo", "").Body.String()
+
+	w := publishIdempotent(t, hub, token, "foo", "")
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, id, w.Body.String())
+}
+
+func TestPublishHandlerIdempotencyKeyNotSupported(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+	token := createDummyAuthorizedJWT(rolePublisher, []string{"*"})
+
+	for range 2 {
+		w := publishIdempotent(t, hub, token, "foo", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+	}
+}
+
 func TestPublishHandlerNotAuthorizedTopicMatcher(t *testing.T) {
 	t.Parallel()
 
@@ -502,6 +673,8 @@ func TestUpdateValidate(t *testing.T) {
 		{"type CR", Update{Topics: []string{"https://example.com/books/1"}, Event: Event{Type: "foo\rinjected"}}, ErrInvalidEventType},
 		{"type NUL", Update{Topics: []string{"https://example.com/books/1"}, Event: Event{Type: "foo\x00bar"}}, ErrInvalidEventType},
 		{"type reserved mercure", Update{Topics: []string{"https://example.com/books/1"}, Event: Event{Type: reservedEventType}}, ErrReservedEventType},
+		{"expires in the future", Update{Topics: []string{"https://example.com/books/1"}, Expires: time.Now().Add(time.Hour)}, nil},
+		{"expires in the past", Update{Topics: []string{"https://example.com/books/1"}, Expires: time.Now().Add(-time.Second)}, ErrInvalidExpires},
 	}
 
 	for _, tc := range cases {
@@ -0,0 +1,263 @@
+package mercure
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ndjsonContentType is the media type of batch publications and NDJSON
+// subscriptions: one JSON update per line.
+const ndjsonContentType = "application/x-ndjson"
+
+// maxPublishBatchSize caps the number of updates of a batch publication.
+const maxPublishBatchSize = 1000
+
+// ErrTooManyBatchUpdates is returned when a batch publication contains too many updates.
+var ErrTooManyBatchUpdates = errors.New("too many updates in batch")
+
+// PublishBatch validates the given updates, and broadcasts the valid ones to
+// all subscribers, in order. If the transport implements
+// TransportBatchDispatcher, they are dispatched in a single call, atomically
+// on Bolt. The id field of the Update instances can be updated by the
+// underlying Transport.
+//
+// It returns the error of each update, nil if it has been published.
+func (h *Hub) PublishBatch(ctx context.Context, updates []*Update) []error {
+	_, errs := h.PublishBatchIdempotent(ctx, nil, updates)
+
+	return errs
+}
+
+// PublishBatchIdempotent is like PublishBatch, but skips the updates already
+// published with the idempotency key of the same index, as PublishIdempotent
+// does. keys may be nil, and empty keys are ignored.
+//
+// It reports whether each update has been dispatched, and returns its error.
+func (h *Hub) PublishBatchIdempotent(ctx context.Context, keys []string, updates []*Update) ([]bool, []error) {
+	ctx, span := startSpan(ctx, "mercure.publish_batch",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.Int("mercure.batch.size", len(updates))),
+	)
+	defer span.End()
+
+	errs := make([]error, len(updates))
+	valid := make([]*Update, 0, len(updates))
+	indexes := make([]int, 0, len(updates))
+
+	var validKeys []string
+	if keys != nil {
+		validKeys = make([]string, 0, len(updates))
+	}
+
+	for i, u := range updates {
+		if err := u.Validate(); err != nil {
+			if h.logger.Enabled(ctx, slog.LevelInfo) {
+				h.logger.LogAttrs(ctx, slog.LevelInfo, "Rejected invalid update", slog.Int("index", i), slog.Any("error", err))
+			}
+
+			errs[i] = err
+
+			continue
+		}
+
+		valid = append(valid, u)
+		indexes = append(indexes, i)
+
+		if keys != nil {
+			validKeys = append(validKeys, keys[i])
+		}
+	}
+
+	dispatched := make([]bool, len(updates))
+	if len(valid) == 0 {
+		return dispatched, errs
+	}
+
+	d, dispatchErrs := h.dispatchBatch(ctx, validKeys, valid)
+
+	for j, u := range valid {
+		i := indexes[j]
+		dispatched[i], errs[i] = d[j], dispatchErrs[j]
+
+		if errs[i] != nil {
+			recordSpanError(span, errs[i])
+
+			continue
+		}
+
+		if dispatched[i] {
+			h.metrics.UpdatePublished(u)
+		}
+	}
+
+	if h.logger.Enabled(ctx, slog.LevelDebug) {
+		h.logger.LogAttrs(ctx, slog.LevelDebug, "Batch published", slog.Int("updates", len(updates)))
+	}
+
+	return dispatched, errs
+}
+
+// dispatchBatch dispatches the updates with the batch dispatcher of the
+// transport if any, or one by one otherwise. It reports whether each update
+// has been dispatched, and returns its error.
+func (h *Hub) dispatchBatch(ctx context.Context, keys []string, updates []*Update) ([]bool, []error) {
+	dispatched := make([]bool, len(updates))
+	errs := make([]error, len(updates))
+
+	d, err := dispatchBatch(ctx, h.transport, keys, updates)
+
+	switch {
+	case err == nil:
+		return d, errs
+	case !errors.Is(err, errBatchUnsupported):
+		if h.logger.Enabled(ctx, slog.LevelError) {
+			h.logger.LogAttrs(ctx, slog.LevelError, "Failed to dispatch batch", slog.Any("error", err))
+		}
+
+		for i := range errs {
+			errs[i] = err
+		}
+
+		return dispatched, errs
+	}
+
+	for i, u := range updates {
+		var key string
+		if keys != nil {
+			key = keys[i]
+		}
+
+		dispatched[i], errs[i] = dispatchIdempotent(ctx, h.transport, key, u)
+
+		if errs[i] != nil && h.logger.Enabled(ctx, slog.LevelError) {
+			h.logger.LogAttrs(ctx, slog.LevelError, "Failed to dispatch update", slog.Any("error", errs[i]))
+		}
+	}
+
+	return dispatched, errs
+}
+
+// isBatchPublication reports whether r is a batch publication.
+func isBatchPublication(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	return err == nil && mediaType == ndjsonContentType
+}
+
+// publishBatch handles a batch publication: an update per line, in the JSON
+// Lines format. It replies with the result of each update, in the same order
+// and format. Empty lines are ignored.
+func (h *Hub) publishBatch(ctx context.Context, w http.ResponseWriter, r *http.Request, claims *claims) {
+	var (
+		results []publishResult
+		updates []*Update
+		keys    []string
+		// The index in results of each update.
+		indexes []int
+	)
+
+	br := bufio.NewReader(r.Body)
+
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			status := http.StatusBadRequest
+
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				status = http.StatusRequestEntityTooLarge
+			}
+
+			http.Error(w, http.StatusText(status), status)
+
+			return
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if len(results) == maxPublishBatchSize {
+				http.Error(w, ErrTooManyBatchUpdates.Error(), http.StatusBadRequest)
+
+				return
+			}
+
+			u, result := h.parseBatchUpdate(ctx, line, claims)
+			if u != nil {
+				// As for forms, the ID set by the publisher identifies
+				// retried publications.
+				var key string
+				if u.ID != "" {
+					key = publisherIdempotencyKey(claims, "id:"+u.ID)
+				}
+
+				updates = append(updates, u)
+				keys = append(keys, key)
+				indexes = append(indexes, len(results))
+			}
+
+			results = append(results, result)
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	dispatched, errs := h.PublishBatchIdempotent(context.WithoutCancel(ctx), keys, updates)
+	for i, err := range errs {
+		result := &results[indexes[i]]
+
+		if err == nil {
+			result.ID = updates[i].ID
+			result.Replayed = !dispatched[i]
+
+			continue
+		}
+
+		*result = newPublishErrorResult(err)
+	}
+
+	w.Header().Set("Content-Type", ndjsonContentType)
+
+	enc := json.NewEncoder(w)
+	for _, result := range results {
+		if err := enc.Encode(result); err != nil {
+			if h.logger.Enabled(ctx, slog.LevelInfo) {
+				h.logger.LogAttrs(ctx, slog.LevelInfo, "Failed to write publish response", slog.Any("error", err))
+			}
+
+			return
+		}
+	}
+}
+
+// parseBatchUpdate decodes an update of a batch and checks that the
+// publisher is allowed to publish it. It returns the error result otherwise.
+func (h *Hub) parseBatchUpdate(ctx context.Context, line []byte, claims *claims) (*Update, publishResult) {
+	var p jsonPublication
+	if err := json.Unmarshal(line, &p); err != nil {
+		return nil, publishResult{Error: "Invalid JSON: " + err.Error(), Status: http.StatusBadRequest}
+	}
+
+	u, err := p.update()
+	if err != nil {
+		return nil, publishResult{Error: "Invalid JSON: " + err.Error(), Status: http.StatusBadRequest}
+	}
+
+	u.Debug = h.debug
+
+	if result := h.checkPublication(ctx, claims, u); result.Status != 0 {
+		return nil, result
+	}
+
+	return u, publishResult{}
+}
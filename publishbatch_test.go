@@ -0,0 +1,214 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func publishBatch(t *testing.T, hub *Hub, topics []string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(body))
+	req.Header.Add("Content-Type", "application/x-ndjson; charset=utf-8")
+	req.Header.Add("Authorization", bearerPrefix+createDummyAuthorizedJWT(rolePublisher, topics))
+
+	w := httptest.NewRecorder()
+	hub.PublishHandler(w, req)
+
+	return w
+}
+
+func TestPublishHandlerBatch(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	matchers := []TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/books/1"}, {Type: MatcherTypeExact, Pattern: "https://example.com/books/3"}}
+	s.SetMatchers(matchers, matchers)
+	require.NoError(t, hub.transport.AddSubscriber(t.Context(), s))
+	s.Ready(t.Context())
+
+	w := publishBatch(t, hub, []string{"https://example.com/books/1", "https://example.com/books/2", "https://example.com/books/3"}, `{"topics": "https://example.com/books/1", "data": "a", "id": "a"}
+{"topics": ["https://example.com/books/2", "https://example.com/alternate"], "id": "b"}
+
+{"topics": "https://example.com/books/1", "type": "mercure"}
+{"topics": "https://example.com/authors/1", "private": true}
+{"topics": 1}
+{"id": "c"}
+{"topics": "https://example.com/books/3", "data": {"c": true}, "private": true, "retry": 10, "expires": "2100-01-01T00:00:00Z", "id": "c"}
+`)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, `{"id":"a"}
+{"error":"Forbidden","status":403}
+{"error":"\"type\" field uses the reserved value \"mercure\"","status":400}
+{"error":"Forbidden","status":403}
+{"error":"Invalid JSON: topics must be a string or an array of strings: json: cannot unmarshal number into Go value of type []string","status":400}
+{"error":"update carries no topic","status":400}
+{"id":"c"}
+`, w.Body.String())
+
+	u := <-s.Receive()
+	assert.Equal(t, "a", u.ID)
+	assert.Equal(t, "a", u.Data)
+
+	u = <-s.Receive()
+	assert.Equal(t, "c", u.ID)
+	assert.JSONEq(t, `{"c": true}`, u.Data)
+	assert.True(t, u.Private)
+	assert.Equal(t, uint64(10), u.Retry)
+	assert.Equal(t, 2100, u.Expires.Year())
+}
+
+func TestPublishHandlerBatchTooManyUpdates(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+
+	w := publishBatch(t, hub, []string{"*"}, strings.Repeat(`{"topics": "https://example.com/books/1"}`+"\n", maxPublishBatchSize+1))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ErrTooManyBatchUpdates.Error()+"\n", w.Body.String())
+}
+
+func TestPublishHandlerBatchTooLarge(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithMaxRequestBodySize(10))
+
+	w := publishBatch(t, hub, []string{"*"}, `{"topics": "https://example.com/books/1"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestPublishBatchBolt(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0)
+	hub := createDummy(t, WithTransport(transport))
+
+	errs := hub.PublishBatch(t.Context(), []*Update{
+		{Event: Event{ID: "a"}, Topics: []string{"https://example.com/books/1"}},
+		{Event: Event{ID: "#b"}, Topics: []string{"https://example.com/books/1"}},
+		{Event: Event{ID: "c"}, Topics: []string{"https://example.com/books/1"}},
+	})
+
+	require.Len(t, errs, 3)
+	require.NoError(t, errs[0])
+	require.ErrorIs(t, errs[1], ErrInvalidEventID)
+	require.NoError(t, errs[2])
+
+	assert.Equal(t, []string{"a", "c"}, historyIDs(t, transport))
+	assert.Equal(t, "c", transport.lastEventID)
+}
+
+type batchErrorTransport struct {
+	*LocalTransport
+}
+
+func (*batchErrorTransport) DispatchBatch(context.Context, []string, []*Update) ([]bool, error) {
+	return nil, errors.New("failed")
+}
+
+func TestPublishBatchAtomic(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithTransport(&batchErrorTransport{NewLocalTransport(NewSubscriberList(0))}))
+
+	errs := hub.PublishBatch(t.Context(), []*Update{
+		{Topics: []string{"https://example.com/books/1"}},
+		{Topics: []string{"*"}},
+		{Topics: []string{"https://example.com/books/2"}},
+	})
+
+	require.EqualError(t, errs[0], "failed")
+	require.ErrorIs(t, errs[1], ErrReservedWildcard)
+	require.EqualError(t, errs[2], "failed")
+}
+
+func TestPublishHandlerBatchIdempotent(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0, WithBoltDeduplicationWindow(time.Minute))
+	hub := createDummy(t, WithTransport(transport))
+	topics := []string{"https://example.com/books/1"}
+
+	w := publishBatch(t, hub, topics, `{"topics": "https://example.com/books/1", "id": "a"}
+{"topics": "https://example.com/books/1", "id": "b"}
+{"topics": "https://example.com/books/1", "id": "a"}
+`)
+	assert.Equal(t, `{"id":"a"}
+{"id":"b"}
+{"id":"a","replayed":true}
+`, w.Body.String())
+
+	w = publishBatch(t, hub, topics, `{"topics": "https://example.com/books/1", "id": "b"}
+{"topics": "https://example.com/books/1", "id": "c"}
+`)
+	assert.Equal(t, `{"id":"b","replayed":true}
+{"id":"c"}
+`, w.Body.String())
+
+	assert.Equal(t, []string{"a", "b", "c"}, historyIDs(t, transport))
+	assert.Equal(t, "c", transport.lastEventID)
+}
+
+func TestPublishBatchTransportMiddleware(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0, WithBoltDeduplicationWindow(time.Minute))
+	hub := createDummy(t, WithTransport(transport), WithTransportMiddleware(
+		NewTracingTransportMiddleware(),
+		NewFaultInjectionTransportMiddleware(func(_ context.Context, u *Update) error {
+			if u.Data == "fail" {
+				return errors.New("failed")
+			}
+
+			return nil
+		}),
+	))
+
+	// The batch reaches the wrapped transport atomically.
+	errs := hub.PublishBatch(t.Context(), []*Update{
+		{Event: Event{ID: "a"}, Topics: []string{"https://example.com/books/1"}},
+		{Event: Event{ID: "b", Data: "fail"}, Topics: []string{"https://example.com/books/1"}},
+	})
+	require.EqualError(t, errs[0], "failed")
+	require.EqualError(t, errs[1], "failed")
+	assert.Equal(t, EarliestLastEventID, transport.lastEventID)
+
+	dispatched, errs := hub.PublishBatchIdempotent(t.Context(), []string{"k", "k"}, []*Update{
+		{Event: Event{ID: "a"}, Topics: []string{"https://example.com/books/1"}},
+		{Event: Event{ID: "b"}, Topics: []string{"https://example.com/books/1"}},
+	})
+	assert.Equal(t, []error{nil, nil}, errs)
+	assert.Equal(t, []bool{true, false}, dispatched)
+	assert.Equal(t, []string{"a"}, historyIDs(t, transport))
+}
+
+func TestPublishBatchTransportMiddlewareWithoutBatchDispatcher(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t,
+		WithTransport(NewLocalTransport(NewSubscriberList(0), WithLocalDeduplicationWindow(time.Minute))),
+		WithTransportMiddleware(NewTracingTransportMiddleware()),
+	)
+
+	// The updates are dispatched one by one.
+	dispatched, errs := hub.PublishBatchIdempotent(t.Context(), []string{"k", "", "k"}, []*Update{
+		{Topics: []string{"https://example.com/books/1"}},
+		{Topics: []string{"https://example.com/books/1"}},
+		{Topics: []string{"https://example.com/books/1"}},
+	})
+	assert.Equal(t, []error{nil, nil, nil}, errs)
+	assert.Equal(t, []bool{true, true, false}, dispatched)
+}
@@ -0,0 +1,124 @@
+package mercure
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// jsonPublication is an update sent as an application/json body, or as a
+// line of a batch publication.
+type jsonPublication struct {
+	Topics  publicationTopics `json:"topics"`
+	Data    json.RawMessage   `json:"data"`
+	ID      string            `json:"id"`
+	Type    string            `json:"type"`
+	Retry   uint64            `json:"retry"`
+	Private bool              `json:"private"`
+	Expires time.Time         `json:"expires"`
+}
+
+// publicationTopics is a single topic or an array of topics, the first one
+// being the canonical topic.
+type publicationTopics []string
+
+func (pt *publicationTopics) UnmarshalJSON(data []byte) error {
+	var topic string
+	if err := json.Unmarshal(data, &topic); err == nil {
+		*pt = publicationTopics{topic}
+
+		return nil
+	}
+
+	var topics []string
+	if err := json.Unmarshal(data, &topics); err != nil {
+		return fmt.Errorf("topics must be a string or an array of strings: %w", err)
+	}
+
+	*pt = topics
+
+	return nil
+}
+
+// isJSONPublication reports whether r is a publication with a JSON body.
+func isJSONPublication(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	return err == nil && mediaType == "application/json"
+}
+
+// parseJSONPublication reads the update sent as an application/json body. It
+// writes the error response and returns false if the body is invalid.
+func (h *Hub) parseJSONPublication(w http.ResponseWriter, r *http.Request) (*Update, bool) {
+	var p jsonPublication
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+
+			return nil, false
+		}
+
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+
+		return nil, false
+	}
+
+	if len(p.Topics) == 0 {
+		http.Error(w, `Missing "topics" field`, http.StatusBadRequest)
+
+		return nil, false
+	}
+
+	u, err := p.update()
+	if err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+
+		return nil, false
+	}
+
+	return u, true
+}
+
+// update returns the update described by p.
+func (p *jsonPublication) update() (*Update, error) {
+	data, err := jsonPublicationData(p.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Update{
+		Topics:  p.Topics,
+		Private: p.Private,
+		Event:   Event{data, p.ID, p.Type, p.Retry},
+		Expires: p.Expires,
+	}, nil
+}
+
+// jsonPublicationData returns the data sent to subscribers: strings are sent
+// as is, the other JSON values are serialized on a single line.
+func jsonPublicationData(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return "", nil
+	}
+
+	if raw[0] == '"' {
+		var data string
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return "", fmt.Errorf("unable to unmarshal data: %w", err)
+		}
+
+		return data, nil
+	}
+
+	var b bytes.Buffer
+	if err := json.Compact(&b, raw); err != nil {
+		return "", fmt.Errorf("unable to compact data: %w", err)
+	}
+
+	return b.String(), nil
+}
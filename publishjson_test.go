@@ -0,0 +1,127 @@
+package mercure
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func publishJSON(t *testing.T, hub *Hub, topics []string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(body))
+	req.Header.Add("Content-Type", "application/json; charset=utf-8")
+	req.Header.Add("Authorization", bearerPrefix+createDummyAuthorizedJWT(rolePublisher, topics))
+
+	w := httptest.NewRecorder()
+	hub.PublishHandler(w, req)
+
+	return w
+}
+
+func TestPublishHandlerJSON(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+
+	topics := []string{"https://example.com/books/1"}
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.SetMatchers(stringsToExactMatchers(topics), stringsToExactMatchers(topics))
+	require.NoError(t, hub.transport.AddSubscriber(t.Context(), s))
+	s.Ready(t.Context())
+
+	w := publishJSON(t, hub, append(topics, "https://example.com/alternate"), `{
+	"topics": ["https://example.com/books/1", "https://example.com/alternate"],
+	"data": {"title": "Hello!",
+		"pages": [1, 2]},
+	"id": "id",
+	"type": "book",
+	"retry": 10,
+	"private": true
+}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "id", w.Body.String())
+
+	u := <-s.Receive()
+	assert.Equal(t, "id", u.ID)
+	assert.Equal(t, []string{"https://example.com/books/1", "https://example.com/alternate"}, u.Topics)
+	assert.JSONEq(t, `{"title":"Hello!","pages":[1,2]}`, u.Data)
+	assert.NotContains(t, u.Data, "\n")
+	assert.Equal(t, "book", u.Type)
+	assert.Equal(t, uint64(10), u.Retry)
+	assert.True(t, u.Private)
+
+	w = publishJSON(t, hub, topics, `{"topics": "https://example.com/books/1", "data": "Hello!"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	u = <-s.Receive()
+	assert.Equal(t, "Hello!", u.Data)
+}
+
+func TestPublishHandlerJSONInvalid(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+
+	for name, tc := range map[string]struct {
+		body   string
+		status int
+	}{
+		"malformed":           {`{"topics": `, http.StatusBadRequest},
+		"no topic":            {`{"data": "Hello!"}`, http.StatusBadRequest},
+		"invalid topics":      {`{"topics": 1}`, http.StatusBadRequest},
+		"invalid topic":       {`{"topics": "https://example.com/books/1\n"}`, http.StatusBadRequest},
+		"too many topics":     {`{"topics": [` + strings.TrimSuffix(strings.Repeat(`"https://example.com/books/1",`, maxPublishTopics+1), ",") + `]}`, http.StatusBadRequest},
+		"not allowed":         {`{"topics": "https://example.com/books/2"}`, http.StatusForbidden},
+		"private not allowed": {`{"topics": "https://example.com/authors/1", "private": true}`, http.StatusForbidden},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			w := publishJSON(t, hub, []string{"https://example.com/books/1"}, tc.body)
+			assert.Equal(t, tc.status, w.Code)
+		})
+	}
+}
+
+func TestPublishHandlerJSONTooLarge(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithMaxRequestBodySize(10))
+
+	w := publishJSON(t, hub, []string{"*"}, `{"topics": "https://example.com/books/1"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestPublishHandlerJSONUnlimited(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithMaxRequestBodySize(0))
+
+	// The limit is disabled, for instance because a reverse proxy enforces one.
+	w := publishJSON(t, hub, []string{"*"}, `{"topics": "https://example.com/books/1", "data": "`+strings.Repeat("a", 11<<20)+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestJSONPublicationData(t *testing.T) {
+	t.Parallel()
+
+	for raw, expected := range map[string]string{
+		``:                   "",
+		`null`:               "",
+		`"a\nb"`:             "a\nb",
+		`1.5`:                "1.5",
+		`[1, true, "a"]`:     `[1,true,"a"]`,
+		"{\n\"a\": \"b\"\n}": `{"a":"b"}`,
+	} {
+		data, err := jsonPublicationData(json.RawMessage(raw))
+		require.NoError(t, err)
+		assert.Equal(t, expected, data)
+	}
+}
@@ -0,0 +1,491 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultRedisStreamName = "mercure"
+
+// redisReadBlock is how long a XREAD call waits for new entries before returning.
+const redisReadBlock = time.Second
+
+// redisReadCount is the maximum number of entries read in a single call.
+const redisReadCount = 100
+
+// redisRetryDelay is the delay between two attempts to read the stream after an error.
+const redisRetryDelay = time.Second
+
+// redisMaxReaderDowntime is how long the stream may stay unreadable before
+// Live starts reporting the transport as unhealthy.
+const redisMaxReaderDowntime = time.Minute
+
+// ErrRedisReaderDown is returned by the health checks when the stream
+// containing updates published by all hub nodes can't be read.
+var ErrRedisReaderDown = errors.New("redis stream reader is not connected")
+
+// redisDispatchScript appends an update to the stream and indexes its ID. When
+// the stream has a maximum length, the index entries of the trimmed updates are
+// removed, unless the same ID has been reused by a more recent update.
+//
+// KEYS[1]: stream, KEYS[2]: index, ARGV[1]: update ID, ARGV[2]: update, ARGV[3]: size.
+var redisDispatchScript = redis.NewScript(`
+local size = tonumber(ARGV[3])
+local streamID
+
+if size > 0 then
+	local excess = redis.call('XLEN', KEYS[1]) - size + 1
+	if excess > 0 then
+		for _, entry in ipairs(redis.call('XRANGE', KEYS[1], '-', '+', 'COUNT', excess)) do
+			local id = entry[2][2]
+			if redis.call('HGET', KEYS[2], id) == entry[1] then
+				redis.call('HDEL', KEYS[2], id)
+			end
+		end
+	end
+
+	streamID = redis.call('XADD', KEYS[1], 'MAXLEN', size, '*', 'id', ARGV[1], 'update', ARGV[2])
+else
+	streamID = redis.call('XADD', KEYS[1], '*', 'id', ARGV[1], 'update', ARGV[2])
+end
+
+redis.call('HSET', KEYS[2], ARGV[1], streamID)
+
+return streamID
+`)
+
+// RedisTransport implements the TransportInterface using Redis Streams.
+//
+// Updates are appended to a stream read by all hub nodes sharing the same
+// Redis server, a hash maps update IDs to stream entry IDs to replay history.
+type RedisTransport struct {
+	sync.RWMutex
+
+	subscribers  *SubscriberList
+	logger       *slog.Logger
+	client       *redis.Client
+	stream       string
+	index        string
+	size         uint64
+	closed       chan struct{}
+	closedOnce   sync.Once
+	readerDone   chan struct{}
+	cancelReader context.CancelFunc
+	lastStreamID string
+	lastEventID  string
+
+	readerMu        sync.RWMutex
+	reading         bool
+	readerDownSince time.Time
+	readerErr       error
+}
+
+// NewRedisTransport creates a new RedisTransport.
+//
+// The ID index is stored in a hash named after the stream, suffixed with ":ids".
+func NewRedisTransport(
+	ctx context.Context,
+	subscriberList *SubscriberList,
+	logger *slog.Logger,
+	url string,
+	stream string,
+	size uint64,
+) (*RedisTransport, error) {
+	if stream == "" {
+		stream = defaultRedisStreamName
+	}
+
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, &TransportError{dsn: url, msg: "invalid Redis URL", err: err}
+	}
+
+	t := &RedisTransport{
+		logger:          logger,
+		client:          redis.NewClient(options),
+		stream:          stream,
+		index:           stream + ":ids",
+		size:            size,
+		subscribers:     subscriberList,
+		closed:          make(chan struct{}),
+		readerDone:      make(chan struct{}),
+		lastStreamID:    "0-0",
+		lastEventID:     EarliestLastEventID,
+		readerDownSince: time.Now(),
+	}
+
+	entries, err := t.client.XRevRangeN(ctx, stream, "+", "-", 1).Result()
+	if err != nil {
+		_ = t.client.Close()
+
+		return nil, &TransportError{dsn: url, err: fmt.Errorf("unable to get last_event_id from Redis: %w", err)}
+	}
+
+	if len(entries) == 1 {
+		t.lastStreamID = entries[0].ID
+		t.lastEventID, _ = entries[0].Values["id"].(string)
+	}
+
+	readerCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	t.cancelReader = cancel
+
+	go t.read(readerCtx)
+
+	return t, nil
+}
+
+// Dispatch dispatches an update to all subscribers and persists it in Redis.
+//
+// Local subscribers, as well as subscribers connected to other hub nodes,
+// receive the update when it is read from the stream.
+func (t *RedisTransport) Dispatch(ctx context.Context, update *Update) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	update.AssignUUID()
+
+	// Marshal through the pointer so Update's custom MarshalJSON applies.
+	updateJSON, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("error when marshaling update: %w", err)
+	}
+
+	if err := redisDispatchScript.Run(ctx, t.client, []string{t.stream, t.index}, update.ID, updateJSON, t.size).Err(); err != nil {
+		return fmt.Errorf("redis error: %w", err)
+	}
+
+	return nil
+}
+
+// AddSubscriber adds a new subscriber to the transport.
+func (t *RedisTransport) AddSubscriber(ctx context.Context, s *LocalSubscriber) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	t.Lock()
+	t.subscribers.Add(s)
+	toStreamID := t.lastStreamID
+	t.Unlock()
+
+	if s.RequestLastEventIDSet {
+		if err := t.dispatchHistory(ctx, s, toStreamID); err != nil {
+			return err
+		}
+	}
+
+	s.Ready(ctx)
+
+	return nil
+}
+
+// RemoveSubscriber removes a new subscriber from the transport.
+func (t *RedisTransport) RemoveSubscriber(_ context.Context, s *LocalSubscriber) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.subscribers.Remove(s)
+
+	return nil
+}
+
+// LastEventID returns the ID of the last dispatched update.
+func (t *RedisTransport) LastEventID(_ context.Context) string {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.lastEventID
+}
+
+// GetSubscribers get the list of active subscribers.
+func (t *RedisTransport) GetSubscribers(_ context.Context) (string, []*Subscriber, error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.lastEventID, getSubscribers(t.subscribers), nil
+}
+
+// Ready reports whether Redis is reachable and the stream is being read.
+func (t *RedisTransport) Ready(ctx context.Context) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	if err := t.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("unable to ping Redis: %w", err)
+	}
+
+	t.readerMu.RLock()
+	defer t.readerMu.RUnlock()
+
+	if !t.reading {
+		return t.readerError()
+	}
+
+	return nil
+}
+
+// Live reports whether the transport is closed or hasn't been able to read
+// the stream for an extended period.
+func (t *RedisTransport) Live(_ context.Context) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	t.readerMu.RLock()
+	defer t.readerMu.RUnlock()
+
+	if !t.reading && time.Since(t.readerDownSince) > redisMaxReaderDowntime {
+		return t.readerError()
+	}
+
+	return nil
+}
+
+// readerError must be called with readerMu held.
+func (t *RedisTransport) readerError() error {
+	if t.readerErr == nil {
+		return ErrRedisReaderDown
+	}
+
+	return fmt.Errorf("%w: %w", ErrRedisReaderDown, t.readerErr)
+}
+
+// Close closes the Transport.
+func (t *RedisTransport) Close(_ context.Context) error {
+	var err error
+
+	t.closedOnce.Do(func() {
+		close(t.closed)
+
+		// Closing the client interrupts the blocking read.
+		t.cancelReader()
+		err = t.client.Close()
+		<-t.readerDone
+
+		t.Lock()
+		defer t.Unlock()
+
+		t.subscribers.Walk(0, func(s *LocalSubscriber) bool {
+			s.Disconnect()
+
+			return true
+		})
+	})
+
+	if err == nil {
+		return nil
+	}
+
+	return fmt.Errorf("unable to close Redis client: %w", err)
+}
+
+// read reads the stream and dispatches the updates published by all the hub
+// nodes to local subscribers, until the transport is closed.
+func (t *RedisTransport) read(ctx context.Context) {
+	defer close(t.readerDone)
+
+	for {
+		t.RLock()
+		lastStreamID := t.lastStreamID
+		t.RUnlock()
+
+		streams, err := t.client.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{t.stream, lastStreamID},
+			Count:   redisReadCount,
+			Block:   redisReadBlock,
+		}).Result()
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil && !errors.Is(err, redis.Nil) {
+			t.setReaderError(err)
+
+			if t.logger.Enabled(ctx, slog.LevelError) {
+				t.logger.LogAttrs(ctx, slog.LevelError, "Unable to read the Redis stream, retrying", slog.Any("error", err))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(redisRetryDelay):
+			}
+
+			continue
+		}
+
+		t.setReaderError(nil)
+
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				t.dispatchMessage(ctx, message)
+			}
+		}
+	}
+}
+
+func (t *RedisTransport) setReaderError(err error) {
+	t.readerMu.Lock()
+	defer t.readerMu.Unlock()
+
+	switch {
+	case err == nil:
+		t.reading = true
+	case t.reading:
+		t.reading = false
+		t.readerDownSince = time.Now()
+	}
+
+	t.readerErr = err
+}
+
+func (t *RedisTransport) dispatchMessage(ctx context.Context, message redis.XMessage) {
+	update, err := unmarshalRedisMessage(message)
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.lastStreamID = message.ID
+
+	if err != nil {
+		if t.logger.Enabled(ctx, slog.LevelError) {
+			t.logger.LogAttrs(ctx, slog.LevelError, "Unable to unmarshal update coming from Redis", slog.String("stream_id", message.ID), slog.Any("error", err))
+		}
+
+		return
+	}
+
+	t.lastEventID = update.ID
+
+	for _, s := range t.subscribers.MatchAny(update) {
+		s.Dispatch(ctx, update, false)
+	}
+}
+
+func unmarshalRedisMessage(message redis.XMessage) (*Update, error) {
+	updateJSON, _ := message.Values["update"].(string)
+
+	var update *Update
+	if err := json.Unmarshal([]byte(updateJSON), &update); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal update: %w", err)
+	}
+
+	return update, nil
+}
+
+func (t *RedisTransport) dispatchHistory(ctx context.Context, s *LocalSubscriber, toStreamID string) error {
+	ctx, span := startSpan(ctx, "mercure.transport.history",
+		trace.WithAttributes(
+			attribute.String("mercure.transport", "redis"),
+			attribute.String("mercure.subscriber.id", s.ID),
+			attribute.String("mercure.last_event_id.requested", s.RequestLastEventID),
+		))
+	defer span.End()
+
+	start := "-"
+	responseLastEventID := EarliestLastEventID
+
+	if s.RequestLastEventID != EarliestLastEventID {
+		streamID, err := t.client.HGet(ctx, t.index, s.RequestLastEventID).Result()
+
+		switch {
+		case errors.Is(err, redis.Nil):
+			// The requested event doesn't exist or has been trimmed: the
+			// protocol reserves "earliest" for this case, nothing is replayed.
+			s.HistoryDispatched(EarliestLastEventID)
+
+			if t.logger.Enabled(ctx, slog.LevelInfo) {
+				t.logger.LogAttrs(ctx, slog.LevelInfo, "Can't find requested LastEventID")
+			}
+
+			return nil
+
+		case err != nil:
+			s.HistoryDispatched(EarliestLastEventID)
+
+			err = fmt.Errorf("unable to retrieve history from Redis: %w", err)
+			recordSpanError(span, err)
+
+			return err
+		}
+
+		// The subscriber already knows this id; echoing it is not a disclosure.
+		start = "(" + streamID
+		responseLastEventID = s.RequestLastEventID
+	}
+
+	for {
+		entries, err := t.client.XRangeN(ctx, t.stream, start, toStreamID, redisReadCount).Result()
+		if err != nil {
+			s.HistoryDispatched(responseLastEventID)
+
+			err = fmt.Errorf("unable to retrieve history from Redis: %w", err)
+			recordSpanError(span, err)
+
+			return err
+		}
+
+		for _, entry := range entries {
+			update, err := unmarshalRedisMessage(entry)
+			if err != nil {
+				s.HistoryDispatched(responseLastEventID)
+				recordSpanError(span, err)
+
+				if t.logger.Enabled(ctx, slog.LevelError) {
+					t.logger.LogAttrs(ctx, slog.LevelError, "Unable to unmarshal update coming from Redis", slog.String("stream_id", entry.ID), slog.Any("error", err))
+				}
+
+				return err
+			}
+
+			if s.Match(update) && !s.Dispatch(ctx, update, true) {
+				s.HistoryDispatched(responseLastEventID)
+
+				return nil
+			}
+		}
+
+		if len(entries) < redisReadCount {
+			break
+		}
+
+		start = "(" + entries[len(entries)-1].ID
+	}
+
+	s.HistoryDispatched(responseLastEventID)
+
+	return nil
+}
+
+// Interface guards.
+var (
+	_ Transport              = (*RedisTransport)(nil)
+	_ TransportLastEventID   = (*RedisTransport)(nil)
+	_ TransportSubscribers   = (*RedisTransport)(nil)
+	_ TransportHealthChecker = (*RedisTransport)(nil)
+)
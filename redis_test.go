@@ -0,0 +1,160 @@
+package mercure
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createRedisTransport(t *testing.T, m *miniredis.Miniredis, size uint64) *RedisTransport {
+	t.Helper()
+
+	transport, err := NewRedisTransport(t.Context(), NewSubscriberList(0), slog.Default(), "redis://"+m.Addr(), "", size)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Close(context.Background()))
+	})
+
+	return transport
+}
+
+// waitForRedisLastEventID waits until the given update has been read from the stream.
+func waitForRedisLastEventID(t *testing.T, transport *RedisTransport, id string) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		lastEventID, _, _ := transport.GetSubscribers(t.Context())
+
+		return lastEventID == id
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRedisTransportRetrieveAllHistory(t *testing.T) {
+	t.Parallel()
+
+	transport := createRedisTransport(t, miniredis.RunT(t), 0)
+	ctx := t.Context()
+
+	for i := 1; i <= 2*redisReadCount+3; i++ {
+		require.NoError(t, transport.Dispatch(ctx, &Update{
+			Event:  Event{ID: strconv.Itoa(i)},
+			Topics: []string{"https://example.com/foo"},
+		}))
+	}
+
+	require.NoError(t, transport.Dispatch(ctx, &Update{Topics: []string{"https://example.com/not-subscribed"}, Event: Event{ID: "not-subscribed"}}))
+	require.NoError(t, transport.Dispatch(ctx, &Update{Topics: []string{"https://example.com/foo"}, Private: true, Event: Event{ID: "private"}}))
+
+	waitForRedisLastEventID(t, transport, "private")
+
+	s := NewLocalSubscriber(EarliestLastEventID, transport.logger, &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers([]string{"https://example.com/foo"}), stringsToExactMatchers(nil))
+
+	require.NoError(t, transport.AddSubscriber(ctx, s))
+	assert.Equal(t, EarliestLastEventID, <-s.responseLastEventID)
+
+	for i := 1; i <= 2*redisReadCount+3; i++ {
+		assert.Equal(t, strconv.Itoa(i), (<-s.Receive()).ID)
+	}
+
+	u := &Update{Topics: []string{"https://example.com/foo"}, Event: Event{ID: "live"}}
+	require.NoError(t, transport.Dispatch(ctx, u))
+	assert.Equal(t, "live", (<-s.Receive()).ID)
+}
+
+func TestRedisTransportTrimHistory(t *testing.T) {
+	t.Parallel()
+
+	m := miniredis.RunT(t)
+	transport := createRedisTransport(t, m, 5)
+
+	for i := range 12 {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{
+			Event:  Event{ID: strconv.Itoa(i)},
+			Topics: []string{"https://example.com/foo"},
+		}))
+	}
+
+	entries, err := transport.client.XRange(t.Context(), transport.stream, "-", "+").Result()
+	require.NoError(t, err)
+	require.Len(t, entries, 5)
+	assert.Equal(t, "7", entries[0].Values["id"])
+
+	ids, err := transport.client.HKeys(t.Context(), transport.index).Result()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"7", "8", "9", "10", "11"}, ids)
+}
+
+func TestRedisTransportMultipleNodes(t *testing.T) {
+	t.Parallel()
+
+	m := miniredis.RunT(t)
+	node1 := createRedisTransport(t, m, 0)
+	node2 := createRedisTransport(t, m, 0)
+
+	s := NewLocalSubscriber("", node2.logger, &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers([]string{"https://example.com/foo"}), stringsToExactMatchers(nil))
+	require.NoError(t, node2.AddSubscriber(t.Context(), s))
+
+	u := &Update{Topics: []string{"https://example.com/foo"}}
+	require.NoError(t, node1.Dispatch(t.Context(), u))
+
+	assert.Equal(t, u.ID, (<-s.Receive()).ID)
+	waitForRedisLastEventID(t, node1, u.ID)
+	waitForRedisLastEventID(t, node2, u.ID)
+}
+
+func TestRedisTransportHealth(t *testing.T) {
+	t.Parallel()
+
+	m := miniredis.RunT(t)
+	transport := createRedisTransport(t, m, 0)
+
+	require.Eventually(t, func() bool {
+		return transport.Ready(t.Context()) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, transport.Live(t.Context()))
+
+	m.SetError("server down")
+
+	require.Eventually(t, func() bool {
+		transport.readerMu.RLock()
+		defer transport.readerMu.RUnlock()
+
+		return !transport.reading
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Error(t, transport.Ready(t.Context()))
+
+	// The stream has been unreadable for less than the threshold.
+	require.NoError(t, transport.Live(t.Context()))
+
+	transport.readerMu.Lock()
+	transport.readerDownSince = time.Now().Add(-2 * redisMaxReaderDowntime)
+	transport.readerMu.Unlock()
+
+	require.ErrorIs(t, transport.Live(t.Context()), ErrRedisReaderDown)
+
+	m.SetError("")
+
+	require.Eventually(t, func() bool {
+		return transport.Ready(t.Context()) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, transport.Live(t.Context()))
+}
+
+func TestNewRedisTransportInvalidURL(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewRedisTransport(t.Context(), NewSubscriberList(0), slog.Default(), "http://example.com", "", 0)
+
+	var transportErr *TransportError
+	require.ErrorAs(t, err, &transportErr)
+	assert.Equal(t, "invalid Redis URL", transportErr.msg)
+}
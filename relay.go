@@ -0,0 +1,477 @@
+package mercure
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RelayDefaultReconnectDelay is the default delay before reconnecting to the upstream hub after an error.
+const RelayDefaultReconnectDelay = 3 * time.Second
+
+var (
+	// ErrInvalidRelayUpstream is returned when the URL of the upstream hub isn't an absolute HTTP(S) URL.
+	ErrInvalidRelayUpstream = errors.New("invalid upstream hub URL")
+	// ErrRelayNotConnected is returned by Ready while the relay isn't connected to the upstream hub.
+	ErrRelayNotConnected = errors.New("not connected to the upstream hub")
+	// ErrRelayForward is returned when the upstream hub rejects a forwarded update.
+	ErrRelayForward = errors.New("unable to forward the update to the upstream hub")
+)
+
+// RelayOption sets an optional setting of RelayTransport.
+type RelayOption func(t *RelayTransport) error
+
+// WithRelaySubscriberJWT sets the JWT used to subscribe to the upstream hub.
+// It must grant access to the private updates to relay, if any.
+func WithRelaySubscriberJWT(jwt string) RelayOption {
+	return func(t *RelayTransport) error {
+		t.subscriberJWT = jwt
+
+		return nil
+	}
+}
+
+// WithRelayPublisherJWT forwards the updates published on this hub to the
+// upstream hub, using the given JWT. Forwarded updates are dispatched to
+// local subscribers when they are received back from the upstream hub, so
+// every hub dispatches them in the same order.
+func WithRelayPublisherJWT(jwt string) RelayOption {
+	return func(t *RelayTransport) error {
+		t.publisherJWT = jwt
+
+		return nil
+	}
+}
+
+// WithRelayTopicMatchers sets the topics to relay from the upstream hub. All topics are relayed by default.
+func WithRelayTopicMatchers(matchers ...TopicMatcher) RelayOption {
+	return func(t *RelayTransport) error {
+		for _, m := range matchers {
+			if !knownMatcherType(m.Type) {
+				return fmt.Errorf("%w: %q", ErrUnsupportedMatcherType, m.Type)
+			}
+		}
+
+		t.matchers = matchers
+
+		return nil
+	}
+}
+
+// WithRelayHTTPClient sets the HTTP client used to connect to the upstream hub.
+// It must not have a timeout, as the subscription is long-lived.
+func WithRelayHTTPClient(client *http.Client) RelayOption {
+	return func(t *RelayTransport) error {
+		t.client = client
+
+		return nil
+	}
+}
+
+// WithRelayReconnectDelay sets the delay before reconnecting to the upstream hub after an error.
+func WithRelayReconnectDelay(delay time.Duration) RelayOption {
+	return func(t *RelayTransport) error {
+		t.reconnectDelay = delay
+
+		return nil
+	}
+}
+
+// WithRelayLocalOptions sets the options of the underlying LocalTransport,
+// for instance to keep a history of the relayed updates.
+func WithRelayLocalOptions(options ...LocalOption) RelayOption {
+	return func(t *RelayTransport) error {
+		t.localOptions = options
+
+		return nil
+	}
+}
+
+// RelayTransport relays the updates of an upstream hub to the local
+// subscribers. It subscribes to the upstream hub over SSE, resuming with
+// Last-Event-ID after a disconnection, and preserves the update IDs, so
+// clients can fail over between hubs without losing their cursor.
+//
+// The local fan-out, and the optional in-memory history, are handled by a LocalTransport.
+type RelayTransport struct {
+	sync.RWMutex
+
+	local          *LocalTransport
+	logger         *slog.Logger
+	upstream       *url.URL
+	client         *http.Client
+	subscriberJWT  string
+	publisherJWT   string
+	matchers       []TopicMatcher
+	reconnectDelay time.Duration
+	localOptions   []LocalOption
+	// lastEventID is the ID of the last update received from the upstream hub.
+	lastEventID string
+	connected   atomic.Bool
+	cancel      context.CancelFunc
+	closed      chan struct{}
+	closedOnce  sync.Once
+	done        chan struct{}
+	// warnedMissingTopics is set once the updates without topic have been reported.
+	warnedMissingTopics atomic.Bool
+}
+
+// NewRelayTransport creates a new RelayTransport relaying the updates of the
+// hub at upstream (e.g. https://example.com/.well-known/mercure).
+func NewRelayTransport(subscriberList *SubscriberList, logger *slog.Logger, upstream *url.URL, options ...RelayOption) (*RelayTransport, error) {
+	if upstream == nil || !upstream.IsAbs() || (upstream.Scheme != "http" && upstream.Scheme != "https") {
+		return nil, &TransportError{err: fmt.Errorf("%w: %v", ErrInvalidRelayUpstream, upstream)}
+	}
+
+	t := &RelayTransport{
+		logger:         logger,
+		upstream:       upstream,
+		client:         &http.Client{},
+		matchers:       []TopicMatcher{{Type: MatcherTypeExact, Pattern: "*"}},
+		reconnectDelay: RelayDefaultReconnectDelay,
+		closed:         make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+
+	for _, o := range options {
+		if err := o(t); err != nil {
+			return nil, &TransportError{err: err}
+		}
+	}
+
+	t.local = NewLocalTransport(subscriberList, t.localOptions...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+
+	go t.run(ctx)
+
+	return t, nil
+}
+
+// Dispatch dispatches an update to the local subscribers, or forwards it to
+// the upstream hub if a publisher JWT is set.
+func (t *RelayTransport) Dispatch(ctx context.Context, update *Update) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	// Subscription events are specific to this hub.
+	if t.publisherJWT == "" || slices.ContainsFunc(update.Topics, addressesReservedNamespace) {
+		return t.local.Dispatch(ctx, update)
+	}
+
+	update.AssignUUID()
+
+	return t.forward(ctx, update)
+}
+
+// forward publishes the update on the upstream hub.
+func (t *RelayTransport) forward(ctx context.Context, update *Update) error {
+	form := url.Values{
+		"topic": update.Topics,
+		"data":  {update.Data},
+		"id":    {update.ID},
+	}
+
+	if update.Type != "" {
+		form.Set("type", update.Type)
+	}
+
+	if update.Retry != 0 {
+		form.Set("retry", strconv.FormatUint(update.Retry, 10))
+	}
+
+	if update.Private {
+		form.Set("private", "on")
+	}
+
+	if !update.Expires.IsZero() {
+		form.Set("expires", update.Expires.Format(time.RFC3339Nano))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.upstream.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRelayForward, err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+t.publisherJWT)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRelayForward, err)
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s", ErrRelayForward, resp.Status)
+	}
+
+	return nil
+}
+
+// run keeps the subscription to the upstream hub open until the transport is closed.
+func (t *RelayTransport) run(ctx context.Context) {
+	defer close(t.done)
+
+	for {
+		err := t.subscribe(ctx)
+
+		t.connected.Store(false)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		// The upstream hub closes the connections regularly (write_timeout):
+		// reconnect right away in this case.
+		if err == nil {
+			continue
+		}
+
+		if t.logger.Enabled(ctx, slog.LevelWarn) {
+			t.logger.LogAttrs(ctx, slog.LevelWarn, "Connection to the upstream hub lost", slog.Any("error", err), slog.Duration("retry", t.reconnectDelay))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(t.reconnectDelay):
+		}
+	}
+}
+
+// subscribe connects to the upstream hub and relays its updates until the
+// connection is closed. It returns nil if the upstream hub closed it cleanly.
+func (t *RelayTransport) subscribe(ctx context.Context) error {
+	u := *t.upstream
+
+	query := u.Query()
+	for _, m := range t.matchers {
+		param := paramMatch
+		if m.Type != MatcherTypeExact {
+			param += "_" + string(m.Type)
+		}
+
+		query.Add(param, m.Pattern)
+	}
+
+	query.Set(paramWithTopics, "")
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("unable to create the upstream request: %w", err)
+	}
+
+	req.Header.Set("Accept", "text/event-stream")
+
+	if t.subscriberJWT != "" {
+		req.Header.Set("Authorization", "Bearer "+t.subscriberJWT)
+	}
+
+	t.RLock()
+	lastEventID := t.lastEventID
+	t.RUnlock()
+
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to connect to the upstream hub: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s", ErrRelayNotConnected, resp.Status)
+	}
+
+	if lastEventID != "" && resp.Header.Get("Mercure-Last-Event-Id") == EarliestLastEventID && t.logger.Enabled(ctx, slog.LevelWarn) {
+		t.logger.LogAttrs(ctx, slog.LevelWarn, "The upstream hub can't resume from the last received event, updates may have been missed", slog.String("last_event_id", lastEventID))
+	}
+
+	t.connected.Store(true)
+
+	if t.logger.Enabled(ctx, slog.LevelInfo) {
+		t.logger.LogAttrs(ctx, slog.LevelInfo, "Connected to the upstream hub", slog.String("last_event_id", lastEventID))
+	}
+
+	err = t.readEvents(ctx, resp.Body)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	return err
+}
+
+// readEvents parses the Server-Sent Events sent by the upstream hub, including
+// the non-standard "topic", "private" and "expires" fields, and relays the
+// updates.
+func (t *RelayTransport) readEvents(ctx context.Context, body io.Reader) error {
+	r := bufio.NewReader(body)
+
+	var (
+		update  = &Update{}
+		data    strings.Builder
+		hasData bool
+	)
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		if line == "" {
+			if hasData {
+				update.Data = data.String()
+				t.relay(ctx, update)
+			}
+
+			update = &Update{}
+			data.Reset()
+			hasData = false
+
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "id":
+			update.ID = value
+		case "event":
+			update.Type = value
+		case "retry":
+			if retry, err := strconv.ParseUint(value, 10, 64); err == nil {
+				update.Retry = retry
+			}
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+
+			data.WriteString(value)
+
+			hasData = true
+		case "topic":
+			update.Topics = append(update.Topics, value)
+		case "private":
+			update.Private = value == "true"
+		case "expires":
+			if expires, err := time.Parse(time.RFC3339Nano, value); err == nil {
+				update.Expires = expires
+			}
+		}
+	}
+}
+
+// relay dispatches an update received from the upstream hub to the local subscribers.
+func (t *RelayTransport) relay(ctx context.Context, update *Update) {
+	if update.ID != "" {
+		t.Lock()
+		t.lastEventID = update.ID
+		t.Unlock()
+	}
+
+	// The subscription events of the upstream hub are skipped by Validate.
+	if err := update.Validate(); err != nil {
+		// The upstream hub doesn't send the topics, for instance because it
+		// doesn't support the with_topics parameter: nothing can be relayed.
+		if errors.Is(err, ErrMissingTopic) && !t.warnedMissingTopics.Swap(true) && t.logger.Enabled(ctx, slog.LevelWarn) {
+			t.logger.LogAttrs(ctx, slog.LevelWarn, "The upstream hub doesn't send the topics of the updates, they can't be relayed", slog.Any("update", update))
+
+			return
+		}
+
+		if t.logger.Enabled(ctx, slog.LevelDebug) {
+			t.logger.LogAttrs(ctx, slog.LevelDebug, "Skipping update from the upstream hub", slog.Any("update", update), slog.Any("error", err))
+		}
+
+		return
+	}
+
+	if err := t.local.Dispatch(ctx, update); err != nil && t.logger.Enabled(ctx, slog.LevelError) {
+		t.logger.LogAttrs(ctx, slog.LevelError, "Unable to relay update", slog.Any("update", update), slog.Any("error", err))
+	}
+}
+
+// AddSubscriber adds a new subscriber to the transport.
+func (t *RelayTransport) AddSubscriber(ctx context.Context, s *LocalSubscriber) error {
+	return t.local.AddSubscriber(ctx, s)
+}
+
+// RemoveSubscriber removes a subscriber from the transport.
+func (t *RelayTransport) RemoveSubscriber(ctx context.Context, s *LocalSubscriber) error {
+	return t.local.RemoveSubscriber(ctx, s)
+}
+
+// LastEventID returns the ID of the last update dispatched to the local subscribers.
+func (t *RelayTransport) LastEventID(ctx context.Context) string {
+	return t.local.LastEventID(ctx)
+}
+
+// GetSubscribers gets the list of active subscribers.
+func (t *RelayTransport) GetSubscribers(ctx context.Context) (string, []*Subscriber, error) {
+	return t.local.GetSubscribers(ctx)
+}
+
+// Ready reports whether the transport is connected to the upstream hub.
+func (t *RelayTransport) Ready(_ context.Context) error {
+	if !t.connected.Load() {
+		return ErrRelayNotConnected
+	}
+
+	return nil
+}
+
+// Live reports whether the transport is running. Connection errors are
+// retried forever, they don't require a restart.
+func (t *RelayTransport) Live(_ context.Context) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+		return nil
+	}
+}
+
+// Close closes the Transport.
+func (t *RelayTransport) Close(ctx context.Context) error {
+	t.closedOnce.Do(func() {
+		close(t.closed)
+		t.cancel()
+		<-t.done
+	})
+
+	return t.local.Close(ctx)
+}
+
+// Interface guards.
+var (
+	_ Transport              = (*RelayTransport)(nil)
+	_ TransportSubscribers   = (*RelayTransport)(nil)
+	_ TransportLastEventID   = (*RelayTransport)(nil)
+	_ TransportHealthChecker = (*RelayTransport)(nil)
+)
@@ -0,0 +1,257 @@
+package mercure
+
+import (
+	"bufio"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createUpstreamHub starts a hub keeping a history, so relays can resume.
+func createUpstreamHub(t *testing.T) (*Hub, *LocalTransport, *httptest.Server, *url.URL) {
+	t.Helper()
+
+	transport := NewLocalTransport(NewSubscriberList(0), WithLocalHistorySize(100))
+	hub := createAnonymousDummy(t, WithTransport(transport))
+
+	srv := httptest.NewServer(hub)
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL + defaultHubURL)
+	require.NoError(t, err)
+
+	return hub, transport, srv, u
+}
+
+func createRelayTransport(t *testing.T, upstream *url.URL, options ...RelayOption) *RelayTransport {
+	t.Helper()
+
+	options = append([]RelayOption{
+		WithRelaySubscriberJWT(createDummyAuthorizedJWT(roleSubscriber, []string{"*"})),
+		WithRelayReconnectDelay(10 * time.Millisecond),
+	}, options...)
+
+	transport, err := NewRelayTransport(NewSubscriberList(0), slog.Default(), upstream, options...)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Close(t.Context()))
+	})
+
+	require.Eventually(t, func() bool { return transport.Ready(t.Context()) == nil }, 5*time.Second, time.Millisecond)
+
+	return transport
+}
+
+func TestRelayTransport(t *testing.T) {
+	t.Parallel()
+
+	upstream, _, _, upstreamURL := createUpstreamHub(t)
+	transport := createRelayTransport(t, upstreamURL)
+
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.SetMatchers(
+		[]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/alt"}},
+		[]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/alt"}},
+	)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	expires := time.Now().Add(time.Hour)
+	require.NoError(t, upstream.Publish(t.Context(), &Update{
+		Event:   Event{ID: "a", Type: "message", Retry: 5, Data: "multi\nline"},
+		Topics:  []string{"https://example.com/foo", "https://example.com/alt"},
+		Private: true,
+		Expires: expires,
+	}))
+
+	u := <-s.Receive()
+	assert.Equal(t, "a", u.ID)
+	assert.Equal(t, "message", u.Type)
+	assert.Equal(t, uint64(5), u.Retry)
+	assert.Equal(t, "multi\nline", u.Data)
+	assert.Equal(t, []string{"https://example.com/foo", "https://example.com/alt"}, u.Topics)
+	assert.True(t, u.Private)
+	assert.True(t, expires.Equal(u.Expires))
+
+	lastEventID, _, err := transport.GetSubscribers(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "a", lastEventID)
+}
+
+func TestRelayTransportResumesAfterDisconnection(t *testing.T) {
+	t.Parallel()
+
+	upstream, _, srv, upstreamURL := createUpstreamHub(t)
+	transport := createRelayTransport(t, upstreamURL, WithRelayReconnectDelay(100*time.Millisecond))
+
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	require.NoError(t, upstream.Publish(t.Context(), &Update{Event: Event{ID: "a"}, Topics: []string{"https://example.com/foo"}}))
+	assert.Equal(t, "a", (<-s.Receive()).ID)
+
+	srv.CloseClientConnections()
+	require.Eventually(t, func() bool { return transport.Ready(t.Context()) != nil }, 5*time.Second, time.Millisecond)
+
+	// Published while the relay is disconnected.
+	require.NoError(t, upstream.Publish(t.Context(), &Update{Event: Event{ID: "b"}, Topics: []string{"https://example.com/foo"}}))
+	require.NoError(t, upstream.Publish(t.Context(), &Update{Event: Event{ID: "c"}, Topics: []string{"https://example.com/foo"}}))
+
+	assert.Equal(t, "b", (<-s.Receive()).ID)
+	assert.Equal(t, "c", (<-s.Receive()).ID)
+}
+
+func TestRelayTransportForward(t *testing.T) {
+	t.Parallel()
+
+	_, upstreamTransport, _, upstreamURL := createUpstreamHub(t)
+	transport := createRelayTransport(t, upstreamURL, WithRelayPublisherJWT(createDummyAuthorizedJWT(rolePublisher, []string{"*"})))
+
+	upstreamSubscriber := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	upstreamSubscriber.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}}, nil)
+	require.NoError(t, upstreamTransport.AddSubscriber(t.Context(), upstreamSubscriber))
+
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	expires := time.Now().Add(time.Hour)
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: "a", Data: "foo"}, Topics: []string{"https://example.com/foo"}, Expires: expires}))
+
+	// Received by the subscribers of both hubs, with the same ID.
+	upstreamUpdate := <-upstreamSubscriber.Receive()
+	assert.Equal(t, "a", upstreamUpdate.ID)
+	assert.True(t, expires.Equal(upstreamUpdate.Expires))
+
+	// The expiration survives the round trip.
+	u := <-s.Receive()
+	assert.Equal(t, "a", u.ID)
+	assert.Equal(t, "foo", u.Data)
+	assert.True(t, expires.Equal(u.Expires))
+}
+
+func TestRelayTransportMissingTopics(t *testing.T) {
+	t.Parallel()
+
+	var buf lockedBuffer
+
+	// An upstream hub ignoring the with_topics parameter.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("id: a\ndata: foo\n\nid: b\ndata: bar\n\n"))
+		w.(http.Flusher).Flush()
+
+		<-t.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+
+	upstream, err := url.Parse(srv.URL + defaultHubURL)
+	require.NoError(t, err)
+
+	transport, err := NewRelayTransport(NewSubscriberList(0), slog.New(slog.NewJSONHandler(&buf, nil)), upstream)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Close(t.Context()))
+	})
+
+	require.Eventually(t, func() bool {
+		transport.RLock()
+		defer transport.RUnlock()
+
+		return transport.lastEventID == "b"
+	}, 5*time.Second, time.Millisecond)
+
+	// Reported once, not for every update.
+	assert.Equal(t, 1, strings.Count(buf.String(), "The upstream hub doesn't send the topics"))
+}
+
+func TestRelayTransportForwardError(t *testing.T) {
+	t.Parallel()
+
+	_, _, _, upstreamURL := createUpstreamHub(t)
+	transport := createRelayTransport(t, upstreamURL, WithRelayPublisherJWT(createDummyUnauthorizedJWT()))
+
+	err := transport.Dispatch(t.Context(), &Update{Topics: []string{"https://example.com/foo"}})
+	require.ErrorIs(t, err, ErrRelayForward)
+}
+
+// A client can fail over from the upstream hub to a relaying hub, and resume
+// from the last event it received.
+func TestRelayTransportFailover(t *testing.T) {
+	t.Parallel()
+
+	upstream, _, _, upstreamURL := createUpstreamHub(t)
+	transport := createRelayTransport(t, upstreamURL, WithRelayLocalOptions(WithLocalHistorySize(100)))
+
+	downstream := createAnonymousDummy(t, WithTransport(transport))
+	srv := httptest.NewServer(downstream)
+	t.Cleanup(srv.Close)
+
+	for _, id := range []string{"a", "b", "c"} {
+		require.NoError(t, upstream.Publish(t.Context(), &Update{Event: Event{ID: id}, Topics: []string{"https://example.com/foo"}}))
+	}
+
+	require.Eventually(t, func() bool {
+		lastEventID, _, _ := transport.GetSubscribers(t.Context())
+
+		return lastEventID == "c"
+	}, 5*time.Second, time.Millisecond)
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, srv.URL+defaultHubURL+"?match="+url.QueryEscape("https://example.com/foo"), nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "a")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, resp.Body.Close())
+	})
+
+	assert.Equal(t, "a", resp.Header.Get("Mercure-Last-Event-Id"))
+
+	var ids []string
+
+	scanner := bufio.NewScanner(resp.Body)
+	for len(ids) < 2 && scanner.Scan() {
+		if id, ok := strings.CutPrefix(scanner.Text(), "id: "); ok {
+			ids = append(ids, id)
+		}
+	}
+
+	assert.Equal(t, []string{"b", "c"}, ids)
+}
+
+func TestNewRelayTransportInvalidUpstream(t *testing.T) {
+	t.Parallel()
+
+	for _, u := range []string{"/.well-known/mercure", "ftp://example.com/.well-known/mercure"} {
+		upstream, err := url.Parse(u)
+		require.NoError(t, err)
+
+		_, err = NewRelayTransport(NewSubscriberList(0), slog.Default(), upstream)
+		require.ErrorIs(t, err, ErrInvalidRelayUpstream)
+	}
+}
+
+func TestUpdateTopicFields(t *testing.T) {
+	t.Parallel()
+
+	u := &Update{Event: Event{ID: "a", Data: "foo"}, Topics: []string{"https://example.com/foo", "https://example.com/alt"}, Private: true}
+	assert.Equal(t, "topic: https://example.com/foo\ntopic: https://example.com/alt\nprivate: true\n", u.topicFields(u.Topics))
+
+	u.Private = false
+	assert.Equal(t, "topic: https://example.com/foo\n", u.topicFields(u.Topics[:1]))
+
+	u.Expires = time.Date(2026, 1, 2, 3, 4, 5, 6, time.FixedZone("", 3600))
+	assert.Equal(t, "topic: https://example.com/foo\nexpires: 2026-01-02T02:04:05.000000006Z\n", u.topicFields(u.Topics[:1]))
+}
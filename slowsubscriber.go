@@ -0,0 +1,220 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+)
+
+// DefaultSubscriberBufferSize is the default number of updates buffered for each subscriber.
+const DefaultSubscriberBufferSize = 1000
+
+// ErrInvalidSlowSubscriberPolicy is returned when an unknown slow subscriber policy is configured.
+var ErrInvalidSlowSubscriberPolicy = errors.New(`the slow subscriber policy must be "disconnect", "drop_oldest" or "conflate"`)
+
+// ErrInvalidSubscriberBufferSize is returned when the configured subscriber buffer size is not positive.
+var ErrInvalidSubscriberBufferSize = errors.New("the subscriber buffer size must be greater than 0")
+
+// SlowSubscriberPolicy is what happens when a subscriber doesn't receive updates
+// as fast as they are published, and its buffer is full.
+type SlowSubscriberPolicy string
+
+const (
+	// SlowSubscriberDisconnect closes the connection. The client reconnects
+	// and, if the transport has a history, fetches the missed updates using
+	// the Last-Event-ID. It's the default.
+	SlowSubscriberDisconnect SlowSubscriberPolicy = "disconnect"
+	// SlowSubscriberDropOldest drops the oldest buffered update to make room
+	// for the new one. The subscriber is notified of the loss by an SSE
+	// comment sent before the next update.
+	SlowSubscriberDropOldest SlowSubscriberPolicy = "drop_oldest"
+	// SlowSubscriberConflate keeps only the latest pending update for each
+	// topic (the first topic of the update) until the subscriber catches up.
+	// The subscriber is disconnected if more topics than the buffer size
+	// are pending.
+	SlowSubscriberConflate SlowSubscriberPolicy = "conflate"
+)
+
+// SlowSubscriberOutcome is the action taken because of a slow subscriber.
+type SlowSubscriberOutcome string
+
+const (
+	// SlowSubscriberDisconnected means that the subscriber has been disconnected.
+	SlowSubscriberDisconnected SlowSubscriberOutcome = "disconnected"
+	// SlowSubscriberDropped means that an update has been dropped.
+	SlowSubscriberDropped SlowSubscriberOutcome = "dropped"
+	// SlowSubscriberConflated means that an update has been replaced by a newer one for the same topic.
+	SlowSubscriberConflated SlowSubscriberOutcome = "conflated"
+)
+
+// SlowSubscriberMetrics can be implemented by Metrics to collect the actions taken because of slow subscribers.
+type SlowSubscriberMetrics interface {
+	// SlowSubscriber collects metrics about slow subscribers.
+	SlowSubscriber(s *LocalSubscriber, outcome SlowSubscriberOutcome)
+}
+
+// WithSlowSubscriberPolicy sets what to do when a subscriber doesn't receive
+// updates fast enough, defaults to SlowSubscriberDisconnect.
+func WithSlowSubscriberPolicy(policy SlowSubscriberPolicy) Option {
+	return func(o *opt) error {
+		switch policy {
+		case SlowSubscriberDisconnect, SlowSubscriberDropOldest, SlowSubscriberConflate:
+			o.slowSubscriberPolicy = policy
+
+			return nil
+		default:
+			return fmt.Errorf("%w: %q", ErrInvalidSlowSubscriberPolicy, policy)
+		}
+	}
+}
+
+// WithSubscriberBufferSize sets the number of updates buffered for each
+// subscriber before applying the slow subscriber policy, defaults to
+// DefaultSubscriberBufferSize.
+func WithSubscriberBufferSize(size int) Option {
+	return func(o *opt) error {
+		if size <= 0 {
+			return ErrInvalidSubscriberBufferSize
+		}
+
+		o.subscriberBufferSize = size
+
+		return nil
+	}
+}
+
+// handleFullChan applies the slow subscriber policy when the out channel is
+// full. It reports whether u has been queued. The mutex must be held.
+func (s *LocalSubscriber) handleFullChan(ctx context.Context, u *Update) bool {
+	switch s.slowPolicy {
+	case SlowSubscriberDropOldest:
+		select {
+		case <-s.out:
+		default:
+			// The channel has been drained in the meantime.
+		}
+
+		// Dispatch holds the mutex, there is room for u.
+		select {
+		case s.out <- u:
+			s.dropped.Add(1)
+			s.slowSubscriber(SlowSubscriberDropped)
+
+			return true
+		default:
+		}
+
+	case SlowSubscriberConflate:
+		if s.conflate(u) {
+			return true
+		}
+
+	case SlowSubscriberDisconnect:
+	}
+
+	s.doDisconnect()
+	s.slowSubscriber(SlowSubscriberDisconnected)
+
+	if s.logger.Enabled(ctx, slog.LevelInfo) {
+		s.logger.LogAttrs(ctx, slog.LevelInfo, "Subscriber unable to receive updates fast enough")
+	}
+
+	return false
+}
+
+// conflate adds u to the pending updates, replacing the pending update for the
+// same topic if any. It returns false if there are too many pending topics.
+func (s *LocalSubscriber) conflate(u *Update) bool {
+	key := conflationKey(u)
+
+	i := slices.IndexFunc(s.pending, func(p *Update) bool {
+		return conflationKey(p) == key
+	})
+
+	switch {
+	case i != -1:
+		s.pending = slices.Delete(s.pending, i, i+1)
+		s.slowSubscriber(SlowSubscriberConflated)
+	case len(s.pending) >= cap(s.out):
+		return false
+	}
+
+	s.pending = append(s.pending, u)
+	s.pendingCount.Store(int64(len(s.pending)))
+
+	return true
+}
+
+func conflationKey(u *Update) string {
+	if len(u.Topics) == 0 {
+		return ""
+	}
+
+	return u.Topics[0]
+}
+
+// flushPending moves as many pending updates as possible to the out channel.
+// It reports whether no updates are pending anymore. The mutex must be held.
+func (s *LocalSubscriber) flushPending() bool {
+	for len(s.pending) > 0 {
+		select {
+		case s.out <- s.pending[0]:
+			s.pending[0] = nil
+			s.pending = s.pending[1:]
+		default:
+			s.pendingCount.Store(int64(len(s.pending)))
+
+			return false
+		}
+	}
+
+	s.pending = nil
+	s.pendingCount.Store(0)
+
+	return true
+}
+
+// refill moves the pending conflated updates to the out channel. The hub calls
+// it after receiving each update, so the pending ones are delivered even if
+// no new updates are dispatched.
+func (s *LocalSubscriber) refill() {
+	if s.pendingCount.Load() == 0 {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.disconnected.Load() == 0 {
+		s.flushPending()
+	}
+}
+
+// takeDropped returns an SSE comment signaling the updates dropped since the
+// last call, or an empty string if none has been dropped.
+func (s *LocalSubscriber) takeDropped() string {
+	dropped := s.takeDroppedCount()
+	if dropped == 0 {
+		return ""
+	}
+
+	return ": " + strconv.FormatUint(dropped, 10) + " updates dropped\n"
+}
+
+// takeDroppedCount returns the number of updates dropped since the last call.
+func (s *LocalSubscriber) takeDroppedCount() uint64 {
+	if s.dropped.Load() == 0 {
+		return 0
+	}
+
+	return s.dropped.Swap(0)
+}
+
+func (s *LocalSubscriber) slowSubscriber(outcome SlowSubscriberOutcome) {
+	if s.slowSubscriberMetrics != nil {
+		s.slowSubscriberMetrics.SlowSubscriber(s, outcome)
+	}
+}
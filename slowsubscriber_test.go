@@ -0,0 +1,136 @@
+package mercure
+
+import (
+	"log/slog"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSlowSubscriber(t *testing.T, policy SlowSubscriberPolicy, bufferSize int) (*LocalSubscriber, *PrometheusMetrics) {
+	t.Helper()
+
+	m := NewPrometheusMetrics(nil)
+
+	s := newLocalSubscriber("", slog.Default(), &TopicMatcherStore{}, bufferSize)
+	s.slowPolicy = policy
+	s.slowSubscriberMetrics = m
+	s.Ready(t.Context())
+
+	return s, m
+}
+
+func dispatchSlow(t *testing.T, s *LocalSubscriber, topic string, ids ...int) {
+	t.Helper()
+
+	for _, id := range ids {
+		require.True(t, s.Dispatch(t.Context(), &Update{Event: Event{ID: strconv.Itoa(id)}, Topics: []string{topic}}, false))
+	}
+}
+
+func receiveIDs(s *LocalSubscriber, n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = (<-s.Receive()).ID
+		s.refill()
+	}
+
+	return ids
+}
+
+func TestSlowSubscriberDisconnect(t *testing.T) {
+	t.Parallel()
+
+	s, m := newSlowSubscriber(t, SlowSubscriberDisconnect, 2)
+
+	dispatchSlow(t, s, "https://example.com/a", 1, 2)
+	assert.False(t, s.Dispatch(t.Context(), &Update{Topics: []string{"https://example.com/a"}}, false))
+
+	assert.Equal(t, []string{"1", "2"}, receiveIDs(s, 2))
+
+	_, ok := <-s.Receive()
+	assert.False(t, ok)
+	assertCounterValue(t, 1, m.slowSubscribers.WithLabelValues(string(SlowSubscriberDisconnected)))
+}
+
+func TestSlowSubscriberDropOldest(t *testing.T) {
+	t.Parallel()
+
+	s, m := newSlowSubscriber(t, SlowSubscriberDropOldest, 2)
+
+	dispatchSlow(t, s, "https://example.com/a", 1, 2, 3, 4)
+
+	assert.Equal(t, ": 2 updates dropped\n", s.takeDropped())
+	assert.Empty(t, s.takeDropped())
+	assert.Equal(t, []string{"3", "4"}, receiveIDs(s, 2))
+	assertCounterValue(t, 2, m.slowSubscribers.WithLabelValues(string(SlowSubscriberDropped)))
+	assertCounterValue(t, 0, m.slowSubscribers.WithLabelValues(string(SlowSubscriberDisconnected)))
+}
+
+func TestSlowSubscriberConflate(t *testing.T) {
+	t.Parallel()
+
+	s, m := newSlowSubscriber(t, SlowSubscriberConflate, 2)
+
+	dispatchSlow(t, s, "https://example.com/a", 1)
+	dispatchSlow(t, s, "https://example.com/b", 2)
+	// Pending from now on.
+	dispatchSlow(t, s, "https://example.com/a", 3)
+	dispatchSlow(t, s, "https://example.com/c", 4)
+	dispatchSlow(t, s, "https://example.com/a", 5)
+
+	assert.Equal(t, []string{"1", "2", "4", "5"}, receiveIDs(s, 4))
+	assertCounterValue(t, 1, m.slowSubscribers.WithLabelValues(string(SlowSubscriberConflated)))
+
+	// Not full anymore.
+	dispatchSlow(t, s, "https://example.com/a", 6)
+	assert.Equal(t, []string{"6"}, receiveIDs(s, 1))
+	assert.Zero(t, s.pendingCount.Load())
+}
+
+func TestSlowSubscriberConflateTooManyTopics(t *testing.T) {
+	t.Parallel()
+
+	s, m := newSlowSubscriber(t, SlowSubscriberConflate, 1)
+
+	dispatchSlow(t, s, "https://example.com/a", 1)
+	dispatchSlow(t, s, "https://example.com/b", 2)
+	assert.False(t, s.Dispatch(t.Context(), &Update{Topics: []string{"https://example.com/c"}}, false))
+
+	assert.Equal(t, []string{"1"}, receiveIDs(s, 1))
+
+	_, ok := <-s.Receive()
+	assert.False(t, ok)
+	assertCounterValue(t, 1, m.slowSubscribers.WithLabelValues(string(SlowSubscriberDisconnected)))
+}
+
+func TestSlowSubscriberLiveQueue(t *testing.T) {
+	t.Parallel()
+
+	s := newLocalSubscriber("", slog.Default(), &TopicMatcherStore{}, 2)
+	s.slowPolicy = SlowSubscriberDropOldest
+
+	for i := range 5 {
+		s.Dispatch(t.Context(), &Update{Event: Event{ID: strconv.Itoa(i)}}, false)
+	}
+
+	assert.Equal(t, 5, s.Ready(t.Context()))
+	assert.Equal(t, []string{"3", "4"}, receiveIDs(s, 2))
+}
+
+func TestSlowSubscriberOptions(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewHub(t.Context(), WithSlowSubscriberPolicy("foo"))
+	require.ErrorIs(t, err, ErrInvalidSlowSubscriberPolicy)
+
+	_, err = NewHub(t.Context(), WithSubscriberBufferSize(0))
+	require.ErrorIs(t, err, ErrInvalidSubscriberBufferSize)
+
+	h, err := NewHub(t.Context(), WithSlowSubscriberPolicy(SlowSubscriberConflate), WithSubscriberBufferSize(10))
+	require.NoError(t, err)
+	assert.Equal(t, SlowSubscriberConflate, h.slowSubscriberPolicy)
+	assert.Equal(t, 10, h.subscriberBufferSize)
+}
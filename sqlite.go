@@ -0,0 +1,685 @@
+package mercure
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	_ "modernc.org/sqlite" // SQLite driver
+)
+
+const defaultSQLitePath = "mercure.sqlite"
+
+// sqliteMaxSweepInterval is the maximum delay between two removals of the
+// updates older than the maximum age and of the expired updates.
+const sqliteMaxSweepInterval = time.Minute
+
+// sqliteSchemaVersion is stored in the user_version pragma, it must be
+// incremented when the schema changes.
+const sqliteSchemaVersion = 2
+
+// sqliteMigrations upgrade the schema of existing databases, the migration
+// at index i going from version i+1 to version i+2.
+var sqliteMigrations = []string{
+	"ALTER TABLE updates ADD COLUMN expires INTEGER;",
+}
+
+// sqliteSchema is the schema of the database. The history can be inspected with plain SQL:
+//
+//	SELECT u.seq, u.id, datetime(u.created_at / 1000, 'unixepoch'), t.topic
+//	FROM updates u JOIN update_topics t USING (seq)
+//	ORDER BY u.seq, t.position;
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS updates (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	id TEXT NOT NULL,
+	type TEXT NOT NULL,
+	data TEXT NOT NULL,
+	retry INTEGER NOT NULL,
+	private INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	expires INTEGER
+);
+CREATE INDEX IF NOT EXISTS updates_id ON updates (id);
+CREATE INDEX IF NOT EXISTS updates_created_at ON updates (created_at);
+CREATE INDEX IF NOT EXISTS updates_expires ON updates (expires) WHERE expires IS NOT NULL;
+CREATE TABLE IF NOT EXISTS update_topics (
+	seq INTEGER NOT NULL REFERENCES updates (seq) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	topic TEXT NOT NULL,
+	PRIMARY KEY (seq, position)
+);
+CREATE INDEX IF NOT EXISTS update_topics_topic ON update_topics (topic);
+`
+
+// sqliteSelectUpdates selects updates and their topics, ordered by position.
+const sqliteSelectUpdates = `SELECT u.seq, u.id, u.type, u.data, u.retry, u.private, u.expires,
+	(SELECT json_group_array(topic) FROM (SELECT topic FROM update_topics WHERE seq = u.seq ORDER BY position))
+FROM updates u`
+
+// SQLiteTransport implements the TransportInterface using SQLite in WAL mode.
+//
+// Updates are stored in the updates table, indexed by event ID, and their
+// topics in the update_topics table.
+type SQLiteTransport struct {
+	sync.RWMutex
+
+	subscribers *SubscriberList
+	logger      *slog.Logger
+	db          *sql.DB
+	size        uint64
+	maxAge      time.Duration
+	closed      chan struct{}
+	closedOnce  sync.Once
+	sweeperDone chan struct{}
+	lastSeq     int64
+	lastEventID string
+
+	// writeMu serializes writes so updates are dispatched in sequence order,
+	// without blocking subscribers while the database is written.
+	writeMu sync.Mutex
+}
+
+// NewSQLiteTransport creates a new SQLiteTransport.
+//
+// When size is not 0, only the last size updates are kept. When maxAge is not
+// 0, updates older than maxAge are removed periodically.
+func NewSQLiteTransport(
+	subscriberList *SubscriberList,
+	logger *slog.Logger,
+	path string,
+	size uint64,
+	maxAge time.Duration,
+) (*SQLiteTransport, error) {
+	if path == "" {
+		path = defaultSQLitePath
+	}
+
+	if dir := filepath.Dir(path); dir != "" && dir != "." {
+		// Path comes from operator config (Caddyfile or env), not HTTP input.
+		if err := os.MkdirAll(dir, 0o700); err != nil { //nolint:gosec
+			return nil, &TransportError{err: fmt.Errorf("creating SQLite data directory %q: %w", dir, err)}
+		}
+	}
+
+	dsn := (&url.URL{
+		Scheme: "file",
+		Opaque: path,
+		RawQuery: url.Values{"_pragma": {
+			"journal_mode(WAL)",
+			"synchronous(NORMAL)",
+			"busy_timeout(5000)",
+			"foreign_keys(ON)",
+		}}.Encode(),
+	}).String()
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, &TransportError{dsn: path, err: err}
+	}
+
+	t := &SQLiteTransport{
+		logger:      logger,
+		db:          db,
+		size:        size,
+		maxAge:      maxAge,
+		subscribers: subscriberList,
+		closed:      make(chan struct{}),
+		sweeperDone: make(chan struct{}),
+		lastEventID: EarliestLastEventID,
+	}
+
+	if err := t.init(); err != nil {
+		_ = db.Close()
+
+		return nil, &TransportError{dsn: path, err: err}
+	}
+
+	go t.sweep()
+
+	return t, nil
+}
+
+// init creates the schema and retrieves the last stored event.
+func (t *SQLiteTransport) init() error {
+	ctx := context.Background()
+
+	var version int
+	if err := t.db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("unable to get the SQLite schema version: %w", err)
+	}
+
+	if version > sqliteSchemaVersion {
+		return fmt.Errorf("unsupported SQLite schema version %d", version) //nolint:err113
+	}
+
+	// Databases created before the schema was versioned have version 0 and
+	// no table yet, the schema being created along with the version.
+	var migrations string
+	if version > 0 {
+		migrations = strings.Join(sqliteMigrations[version-1:], "")
+	}
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("sqlite error: %w", err)
+	}
+
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, migrations+sqliteSchema+fmt.Sprintf("PRAGMA user_version = %d;", sqliteSchemaVersion)); err != nil {
+		return fmt.Errorf("unable to create the SQLite schema: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to create the SQLite schema: %w", err)
+	}
+
+	err = t.db.QueryRowContext(ctx, "SELECT seq, id FROM updates ORDER BY seq DESC LIMIT 1").Scan(&t.lastSeq, &t.lastEventID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("unable to get last_event_id from SQLite: %w", err)
+	}
+
+	return nil
+}
+
+// Dispatch dispatches an update to all subscribers and persists it in SQLite.
+func (t *SQLiteTransport) Dispatch(ctx context.Context, update *Update) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	update.AssignUUID()
+
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+
+	seq, err := t.persist(ctx, []*Update{update})
+	if err != nil {
+		return err
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.lastSeq = seq
+	t.lastEventID = update.ID
+
+	for _, s := range t.subscribers.MatchAny(update) {
+		s.Dispatch(ctx, update, false)
+	}
+
+	return nil
+}
+
+// persist stores updates in a single transaction and returns the sequence of the last one.
+// It must be called with writeMu held.
+func (t *SQLiteTransport) persist(ctx context.Context, updates []*Update) (int64, error) {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("sqlite error: %w", err)
+	}
+
+	defer func() { _ = tx.Rollback() }()
+
+	seq, err := insertUpdates(ctx, tx, updates, time.Now().UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+
+	if err := t.commit(ctx, tx, seq); err != nil {
+		return 0, err
+	}
+
+	return seq, nil
+}
+
+// insertUpdates inserts the updates using the given transaction, and returns
+// the sequence of the last one.
+func insertUpdates(ctx context.Context, tx *sql.Tx, updates []*Update, createdAt int64) (seq int64, err error) {
+	for _, update := range updates {
+		res, err := tx.ExecContext(ctx,
+			"INSERT INTO updates (id, type, data, retry, private, created_at, expires) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			update.ID, update.Type, update.Data, int64(update.Retry), update.Private, createdAt, sqliteExpires(update.Expires), //nolint:gosec
+		)
+		if err != nil {
+			return 0, fmt.Errorf("unable to insert update: %w", err)
+		}
+
+		if seq, err = res.LastInsertId(); err != nil {
+			return 0, fmt.Errorf("unable to insert update: %w", err)
+		}
+
+		for position, topic := range update.Topics {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO update_topics (seq, position, topic) VALUES (?, ?, ?)", seq, position, topic); err != nil {
+				return 0, fmt.Errorf("unable to insert topic: %w", err)
+			}
+		}
+	}
+
+	return seq, nil
+}
+
+// sqliteExpires returns the expiration time of an update, in milliseconds
+// rounded up so that it is never considered as expired too early.
+func sqliteExpires(expires time.Time) sql.NullInt64 {
+	if expires.IsZero() {
+		return sql.NullInt64{}
+	}
+
+	return sql.NullInt64{Int64: expires.Add(time.Millisecond - 1).UnixMilli(), Valid: true}
+}
+
+// commit removes the updates above the size limit, seq being the sequence of
+// the last inserted update, and commits the transaction.
+func (t *SQLiteTransport) commit(ctx context.Context, tx *sql.Tx, seq int64) error {
+	if t.size > 0 && seq > int64(t.size) { //nolint:gosec
+		if _, err := tx.ExecContext(ctx, "DELETE FROM updates WHERE seq <= ?", seq-int64(t.size)); err != nil { //nolint:gosec
+			return fmt.Errorf("unable to delete old updates: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sqlite error: %w", err)
+	}
+
+	return nil
+}
+
+// AddSubscriber adds a new subscriber to the transport.
+func (t *SQLiteTransport) AddSubscriber(ctx context.Context, s *LocalSubscriber) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	t.Lock()
+	t.subscribers.Add(s)
+	toSeq := t.lastSeq
+	t.Unlock()
+
+	if s.RequestLastEventIDSet {
+		if err := t.dispatchHistory(ctx, s, toSeq); err != nil {
+			return err
+		}
+	}
+
+	s.Ready(ctx)
+
+	return nil
+}
+
+// RemoveSubscriber removes a new subscriber from the transport.
+func (t *SQLiteTransport) RemoveSubscriber(_ context.Context, s *LocalSubscriber) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.subscribers.Remove(s)
+
+	return nil
+}
+
+// LastEventID returns the ID of the last dispatched update.
+func (t *SQLiteTransport) LastEventID(_ context.Context) string {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.lastEventID
+}
+
+// GetSubscribers get the list of active subscribers.
+func (t *SQLiteTransport) GetSubscribers(_ context.Context) (string, []*Subscriber, error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.lastEventID, getSubscribers(t.subscribers), nil
+}
+
+// Ready reports whether the database can be queried.
+func (t *SQLiteTransport) Ready(ctx context.Context) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	var exists bool
+	if err := t.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM updates)").Scan(&exists); err != nil {
+		return fmt.Errorf("unable to query SQLite: %w", err)
+	}
+
+	return nil
+}
+
+// Live reports whether the transport is closed or the database can't be reached.
+func (t *SQLiteTransport) Live(ctx context.Context) error {
+	select {
+	case <-t.closed:
+		return ErrClosedTransport
+	default:
+	}
+
+	if err := t.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("unable to ping SQLite: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the Transport.
+func (t *SQLiteTransport) Close(_ context.Context) (err error) {
+	t.closedOnce.Do(func() {
+		close(t.closed)
+		<-t.sweeperDone
+
+		t.writeMu.Lock()
+		defer t.writeMu.Unlock()
+
+		t.Lock()
+		defer t.Unlock()
+
+		t.subscribers.Walk(0, func(s *LocalSubscriber) bool {
+			s.Disconnect()
+
+			return true
+		})
+		err = t.db.Close()
+	})
+
+	if err == nil {
+		return nil
+	}
+
+	return fmt.Errorf("unable to close SQLite DB: %w", err)
+}
+
+// sweep periodically removes the updates older than the maximum age and the
+// expired updates, until the transport is closed.
+func (t *SQLiteTransport) sweep() {
+	defer close(t.sweeperDone)
+
+	interval := sqliteMaxSweepInterval
+	if t.maxAge > 0 {
+		interval = min(t.maxAge, interval)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.closed:
+			return
+		case <-ticker.C:
+		}
+
+		ctx := context.Background()
+		now := time.Now()
+
+		if t.maxAge > 0 {
+			if _, err := t.db.ExecContext(ctx, "DELETE FROM updates WHERE created_at < ?", now.Add(-t.maxAge).UnixMilli()); err != nil && t.logger.Enabled(ctx, slog.LevelError) {
+				t.logger.LogAttrs(ctx, slog.LevelError, "Unable to remove expired updates from SQLite", slog.Any("error", err))
+			}
+		}
+
+		if err := t.purgeExpired(ctx, now); err != nil && t.logger.Enabled(ctx, slog.LevelError) {
+			t.logger.LogAttrs(ctx, slog.LevelError, "Unable to purge expired updates from SQLite", slog.Any("error", err))
+		}
+	}
+}
+
+// purgeExpired removes from the history the updates expired at now.
+func (t *SQLiteTransport) purgeExpired(ctx context.Context, now time.Time) error {
+	if _, err := t.db.ExecContext(ctx, "DELETE FROM updates WHERE expires <= ?", now.UnixMilli()); err != nil {
+		return fmt.Errorf("sqlite error: %w", err)
+	}
+
+	return nil
+}
+
+//nolint:funlen
+func (t *SQLiteTransport) dispatchHistory(ctx context.Context, s *LocalSubscriber, toSeq int64) error {
+	ctx, span := startSpan(ctx, "mercure.transport.history",
+		trace.WithAttributes(
+			attribute.String("mercure.transport", "sqlite"),
+			attribute.String("mercure.subscriber.id", s.ID),
+			attribute.String("mercure.last_event_id.requested", s.RequestLastEventID),
+		))
+	defer span.End()
+
+	fromSeq := int64(0)
+	responseLastEventID := EarliestLastEventID
+
+	if s.RequestLastEventID != EarliestLastEventID {
+		err := t.db.QueryRowContext(ctx, "SELECT seq FROM updates WHERE id = ? AND seq <= ? ORDER BY seq DESC LIMIT 1", s.RequestLastEventID, toSeq).Scan(&fromSeq)
+
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			// The requested event doesn't exist or has been discarded: the
+			// protocol reserves "earliest" for this case, nothing is replayed.
+			s.HistoryDispatched(EarliestLastEventID)
+
+			if t.logger.Enabled(ctx, slog.LevelInfo) {
+				t.logger.LogAttrs(ctx, slog.LevelInfo, "Can't find requested LastEventID")
+			}
+
+			return nil
+
+		case err != nil:
+			s.HistoryDispatched(EarliestLastEventID)
+
+			err = fmt.Errorf("unable to retrieve history from SQLite: %w", err)
+			recordSpanError(span, err)
+
+			return err
+		}
+
+		// The subscriber already knows this id; echoing it is not a disclosure.
+		responseLastEventID = s.RequestLastEventID
+	}
+
+	// Expired updates not purged yet are skipped.
+	rows, err := t.db.QueryContext(ctx, sqliteSelectUpdates+" WHERE u.seq > ? AND u.seq <= ? AND (u.expires IS NULL OR u.expires > ?) ORDER BY u.seq", fromSeq, toSeq, time.Now().UnixMilli())
+	if err != nil {
+		s.HistoryDispatched(responseLastEventID)
+
+		err = fmt.Errorf("unable to retrieve history from SQLite: %w", err)
+		recordSpanError(span, err)
+
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		update, err := scanSQLiteUpdate(rows)
+		if err != nil {
+			s.HistoryDispatched(responseLastEventID)
+
+			err = fmt.Errorf("unable to retrieve history from SQLite: %w", err)
+			recordSpanError(span, err)
+
+			return err
+		}
+
+		if s.Match(update) && !s.Dispatch(ctx, update, true) {
+			s.HistoryDispatched(responseLastEventID)
+
+			return nil
+		}
+	}
+
+	s.HistoryDispatched(responseLastEventID)
+
+	if err := rows.Err(); err != nil {
+		err = fmt.Errorf("unable to retrieve history from SQLite: %w", err)
+		recordSpanError(span, err)
+
+		return err
+	}
+
+	return nil
+}
+
+// scanSQLiteUpdate builds an update from a row selected with sqliteSelectUpdates.
+func scanSQLiteUpdate(rows *sql.Rows) (*Update, error) {
+	var (
+		seq     int64
+		retry   int64
+		expires sql.NullInt64
+		topics  string
+		update  Update
+	)
+
+	if err := rows.Scan(&seq, &update.ID, &update.Type, &update.Data, &retry, &update.Private, &expires, &topics); err != nil {
+		return nil, fmt.Errorf("unable to scan update: %w", err)
+	}
+
+	update.Retry = uint64(retry) //nolint:gosec
+	if expires.Valid {
+		update.Expires = time.UnixMilli(expires.Int64)
+	}
+
+	if err := json.Unmarshal([]byte(topics), &update.Topics); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal topics of update %q: %w", update.ID, err)
+	}
+
+	return &update, nil
+}
+
+// ImportBolt copies the history stored by a BoltTransport in the Bolt
+// database at path. The import is done only once: nothing is imported if
+// updates have already been stored in the SQLite database.
+//
+// The imported updates are considered as created at import time for the
+// computation of their age. It returns the number of imported updates.
+func (t *SQLiteTransport) ImportBolt(ctx context.Context, path, bucketName string) (int, error) {
+	if bucketName == "" {
+		bucketName = defaultBoltBucketName
+	}
+
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+
+	// AUTOINCREMENT tracks the largest sequence ever used, even if the
+	// corresponding updates have been removed since.
+	var used bool
+	if err := t.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM sqlite_sequence WHERE name = 'updates' AND seq > 0)").Scan(&used); err != nil {
+		return 0, fmt.Errorf("sqlite error: %w", err)
+	}
+
+	if used {
+		return 0, nil
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{ReadOnly: true, Timeout: 1 * time.Second})
+	if err != nil {
+		return 0, fmt.Errorf("unable to open Bolt DB %q: %w", path, err)
+	}
+	defer db.Close()
+
+	// The updates are inserted in batches, to bound the memory used, but in
+	// a single transaction: the import is done entirely or not at all.
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("sqlite error: %w", err)
+	}
+
+	defer func() { _ = tx.Rollback() }()
+
+	var (
+		n           int
+		seq         int64
+		lastEventID string
+	)
+
+	createdAt := time.Now().UnixMilli()
+	batch := make([]*Update, 0, boltImportBatchSize)
+
+	flush := func() (err error) {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if seq, err = insertUpdates(ctx, tx, batch, createdAt); err != nil {
+			return err
+		}
+
+		n += len(batch)
+		lastEventID = batch[len(batch)-1].ID
+		batch = batch[:0]
+
+		return nil
+	}
+
+	if err := db.View(func(btx *bolt.Tx) error {
+		b := btx.Bucket([]byte(bucketName))
+		if b == nil {
+			return nil // No data
+		}
+
+		return b.ForEach(func(_, v []byte) error {
+			var update *Update
+			if err := json.Unmarshal(v, &update); err != nil {
+				return fmt.Errorf("unable to unmarshal update: %w", err)
+			}
+
+			batch = append(batch, update)
+			if len(batch) < boltImportBatchSize {
+				return nil
+			}
+
+			return flush()
+		})
+	}); err != nil {
+		return 0, fmt.Errorf("unable to import Bolt DB %q: %w", path, err)
+	}
+
+	if err := flush(); err != nil {
+		return 0, err
+	}
+
+	if n == 0 {
+		return 0, nil
+	}
+
+	if err := t.commit(ctx, tx, seq); err != nil {
+		return 0, err
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.lastSeq = seq
+	t.lastEventID = lastEventID
+
+	return n, nil
+}
+
+// Interface guards.
+var (
+	_ Transport              = (*SQLiteTransport)(nil)
+	_ TransportLastEventID   = (*SQLiteTransport)(nil)
+	_ TransportSubscribers   = (*SQLiteTransport)(nil)
+	_ TransportHealthChecker = (*SQLiteTransport)(nil)
+)
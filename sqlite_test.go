@@ -0,0 +1,292 @@
+package mercure
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createSQLiteTransport(t *testing.T, size uint64, maxAge time.Duration) *SQLiteTransport {
+	t.Helper()
+
+	transport, err := NewSQLiteTransport(NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "test.sqlite"), size, maxAge)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Close(context.Background()))
+	})
+
+	return transport
+}
+
+func TestSQLiteTransportPurgeHistory(t *testing.T) {
+	t.Parallel()
+
+	transport := createSQLiteTransport(t, 5, 0)
+
+	for i := range 12 {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{
+			Event:  Event{ID: strconv.Itoa(i)},
+			Topics: []string{"https://example.com/foo"},
+		}))
+	}
+
+	var count int
+	require.NoError(t, transport.db.QueryRowContext(t.Context(), "SELECT count(*) FROM updates").Scan(&count))
+	assert.Equal(t, 5, count)
+
+	require.NoError(t, transport.db.QueryRowContext(t.Context(), "SELECT count(*) FROM update_topics").Scan(&count))
+	assert.Equal(t, 5, count)
+}
+
+func TestSQLiteTransportMaxAge(t *testing.T) {
+	t.Parallel()
+
+	transport := createSQLiteTransport(t, 0, 50*time.Millisecond)
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Topics: []string{"https://example.com/foo"}}))
+
+	require.Eventually(t, func() bool {
+		var count int
+		require.NoError(t, transport.db.QueryRowContext(t.Context(), "SELECT count(*) FROM update_topics").Scan(&count))
+
+		return count == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSQLiteTransportExpiry(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		transport := createSQLiteTransport(t, 0, 0)
+		expires := time.Now().Add(time.Hour)
+
+		for _, u := range []*Update{
+			{Event: Event{ID: "a"}, Expires: time.Now().Add(time.Second)},
+			{Event: Event{ID: "b"}},
+			{Event: Event{ID: "c"}, Expires: expires},
+		} {
+			u.Topics = []string{"https://example.com/foo"}
+			require.NoError(t, transport.Dispatch(t.Context(), u))
+		}
+
+		time.Sleep(2 * time.Second)
+
+		// Expired updates aren't replayed, even before being purged.
+		s := NewLocalSubscriber(EarliestLastEventID, transport.logger, &TopicMatcherStore{})
+		s.setMatchers(stringsToExactMatchers([]string{"https://example.com/foo"}), stringsToExactMatchers(nil))
+		require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+		assert.Equal(t, "b", (<-s.Receive()).ID)
+
+		u := <-s.Receive()
+		assert.Equal(t, "c", u.ID)
+		assert.WithinDuration(t, expires, u.Expires, time.Millisecond)
+		assert.False(t, u.Expires.Before(expires))
+
+		// The sweeper removes them.
+		time.Sleep(sqliteMaxSweepInterval)
+		synctest.Wait()
+
+		var count int
+		require.NoError(t, transport.db.QueryRowContext(t.Context(), "SELECT count(*) FROM updates").Scan(&count))
+		assert.Equal(t, 2, count)
+	})
+}
+
+func TestSQLiteTransportMigrateSchema(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "test.sqlite")
+
+	// Version 1 of the schema, without expiration dates.
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+
+	_, err = db.ExecContext(t.Context(), `
+CREATE TABLE updates (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	id TEXT NOT NULL,
+	type TEXT NOT NULL,
+	data TEXT NOT NULL,
+	retry INTEGER NOT NULL,
+	private INTEGER NOT NULL,
+	created_at INTEGER NOT NULL
+);
+CREATE TABLE update_topics (
+	seq INTEGER NOT NULL REFERENCES updates (seq) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	topic TEXT NOT NULL,
+	PRIMARY KEY (seq, position)
+);
+INSERT INTO updates (id, type, data, retry, private, created_at) VALUES ('1', '', 'data', 0, 0, 0);
+INSERT INTO update_topics (seq, position, topic) VALUES (1, 0, 'https://example.com/foo');
+PRAGMA user_version = 1;`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	transport, err := NewSQLiteTransport(NewSubscriberList(0), slog.Default(), path, 0, 0)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Close(context.Background()))
+	})
+
+	var version int
+	require.NoError(t, transport.db.QueryRowContext(t.Context(), "PRAGMA user_version").Scan(&version))
+	assert.Equal(t, sqliteSchemaVersion, version)
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: "2"}, Topics: []string{"https://example.com/foo"}, Expires: time.Now().Add(time.Hour)}))
+
+	s := NewLocalSubscriber(EarliestLastEventID, transport.logger, &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers([]string{"https://example.com/foo"}), stringsToExactMatchers(nil))
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	assert.Equal(t, "1", (<-s.Receive()).ID)
+	assert.Equal(t, "2", (<-s.Receive()).ID)
+}
+
+func TestSQLiteTransportConcurrentDispatch(t *testing.T) {
+	t.Parallel()
+
+	transport := createSQLiteTransport(t, 0, 0)
+
+	s := NewLocalSubscriber("", transport.logger, &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers([]string{"https://example.com/foo"}), stringsToExactMatchers(nil))
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			assert.NoError(t, transport.Dispatch(t.Context(), &Update{Topics: []string{"https://example.com/foo"}}))
+		})
+	}
+
+	wg.Wait()
+
+	// Live updates are received in the order they have been stored.
+	rows, err := transport.db.QueryContext(t.Context(), "SELECT id FROM updates ORDER BY seq")
+	require.NoError(t, err)
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		require.NoError(t, rows.Scan(&id))
+		assert.Equal(t, id, (<-s.Receive()).ID)
+	}
+
+	require.NoError(t, rows.Err())
+}
+
+func TestSQLiteTransportReopen(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "test.sqlite")
+
+	transport, err := NewSQLiteTransport(NewSubscriberList(0), slog.Default(), path, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Topics: []string{"https://example.com/foo"}, Event: Event{ID: "1"}}))
+	require.NoError(t, transport.Close(t.Context()))
+
+	transport, err = NewSQLiteTransport(NewSubscriberList(0), slog.Default(), path, 0, 0)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Close(context.Background()))
+	})
+
+	lastEventID, _, _ := transport.GetSubscribers(t.Context())
+	assert.Equal(t, "1", lastEventID)
+}
+
+func TestSQLiteTransportImportBolt(t *testing.T) {
+	t.Parallel()
+
+	boltPath := filepath.Join(t.TempDir(), "bolt.db")
+
+	boltTransport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), boltPath, "", 0, 0)
+	require.NoError(t, err)
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, boltTransport.Dispatch(t.Context(), &Update{
+			Event:  Event{ID: strconv.Itoa(i), Data: "data " + strconv.Itoa(i)},
+			Topics: []string{"https://example.com/foo", "https://example.com/bar"},
+		}))
+	}
+
+	require.NoError(t, boltTransport.Close(t.Context()))
+
+	transport := createSQLiteTransport(t, 0, 0)
+
+	n, err := transport.ImportBolt(t.Context(), boltPath, "")
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	lastEventID, _, _ := transport.GetSubscribers(t.Context())
+	assert.Equal(t, "3", lastEventID)
+
+	// The import is done only once.
+	n, err = transport.ImportBolt(t.Context(), boltPath, "")
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	s := NewLocalSubscriber("1", transport.logger, &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers([]string{"https://example.com/bar"}), stringsToExactMatchers(nil))
+
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+	assert.Equal(t, "1", <-s.responseLastEventID)
+
+	assert.Equal(t, &Update{
+		Topics: []string{"https://example.com/foo", "https://example.com/bar"},
+		Event:  Event{ID: "2", Data: "data 2"},
+	}, <-s.Receive())
+	assert.Equal(t, "3", (<-s.Receive()).ID)
+}
+
+func TestSQLiteTransportImportBoltBatches(t *testing.T) {
+	t.Parallel()
+
+	boltPath := filepath.Join(t.TempDir(), "bolt.db")
+
+	boltTransport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), boltPath, "", 0, 0)
+	require.NoError(t, err)
+
+	dispatchNumberedBoltUpdates(t, boltTransport, boltImportBatchSize+500)
+	require.NoError(t, boltTransport.Close(t.Context()))
+
+	// The size limit is applied once all the batches are imported.
+	transport := createSQLiteTransport(t, 10, 0)
+
+	n, err := transport.ImportBolt(t.Context(), boltPath, "")
+	require.NoError(t, err)
+	assert.Equal(t, boltImportBatchSize+500, n)
+
+	lastEventID, _, _ := transport.GetSubscribers(t.Context())
+	assert.Equal(t, strconv.Itoa(boltImportBatchSize+500), lastEventID)
+
+	var count int
+	require.NoError(t, transport.db.QueryRowContext(t.Context(), "SELECT COUNT(*) FROM updates").Scan(&count))
+	assert.Equal(t, 10, count)
+}
+
+func TestSQLiteTransportImportBoltSkippedWhenNotEmpty(t *testing.T) {
+	t.Parallel()
+
+	transport := createSQLiteTransport(t, 0, 0)
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Topics: []string{"https://example.com/foo"}}))
+
+	// The Bolt DB doesn't even need to exist.
+	n, err := transport.ImportBolt(t.Context(), filepath.Join(t.TempDir(), "missing.db"), "")
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
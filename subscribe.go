@@ -80,6 +80,19 @@ func (rc *responseController) flush(ctx context.Context) bool {
 func (h *Hub) newResponseController(w http.ResponseWriter, s *LocalSubscriber) *responseController {
 	wd := h.getWriteDeadline(s)
 
+	return &responseController{
+		*http.NewResponseController(w), // nolint:bodyclose
+		w,
+		h.getDisconnectionTime(wd),
+		wd,
+		h,
+		s,
+	}
+}
+
+// getDisconnectionTime returns the time at which a connection with the given
+// write deadline must be closed.
+func (h *Hub) getDisconnectionTime(writeDeadline time.Time) time.Time {
 	// Disconnect one dispatch before the write deadline so the client sees a
 	// clean end of stream instead of a failed write. That subtraction lands in
 	// the past when the deadline is nearer than dispatchTimeout — a token
@@ -87,22 +100,14 @@ func (h *Hub) newResponseController(w http.ResponseWriter, s *LocalSubscriber) *
 	// would close the connection as soon as it opened and put the subscriber in
 	// a reconnect loop. Fall back to the deadline itself: less margin, but the
 	// subscriber gets the time its token grants. A zero deadline means no
-	// deadline at all, and SubscribeHandler then arms no timer.
-	dt := wd
-	if !wd.IsZero() {
-		if d := wd.Add(-h.dispatchTimeout); d.After(time.Now()) {
-			dt = d
+	// deadline at all, and the subscribe handlers then arm no timer.
+	if !writeDeadline.IsZero() {
+		if d := writeDeadline.Add(-h.dispatchTimeout); d.After(time.Now()) {
+			return d
 		}
 	}
 
-	return &responseController{
-		*http.NewResponseController(w), // nolint:bodyclose
-		w,
-		dt,
-		wd,
-		h,
-		s,
-	}
+	return writeDeadline
 }
 
 func (h *Hub) getWriteDeadline(s *LocalSubscriber) (deadline time.Time) {
@@ -124,7 +129,7 @@ func (h *Hub) getWriteDeadline(s *LocalSubscriber) (deadline time.Time) {
 func (h *Hub) SubscribeHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	s, rc := h.registerSubscriber(ctx, w, r)
+	s := h.registerSubscriber(ctx, w, r)
 	if s == nil {
 		return
 	}
@@ -133,6 +138,18 @@ func (h *Hub) SubscribeHandler(w http.ResponseWriter, r *http.Request) {
 
 	defer h.shutdown(ctx, s)
 
+	if s.poll {
+		h.poll(ctx, w, s)
+
+		return
+	}
+
+	// Server-side consumers can ask for an NDJSON stream, easier to parse.
+	ndjson := acceptsNDJSON(r)
+
+	h.sendHeaders(ctx, w, s, ndjson)
+	rc := h.newResponseController(w, s)
+	rc.flush(ctx)
 	rc.setDefaultWriteDeadline(ctx)
 
 	var (
@@ -164,6 +181,13 @@ func (h *Hub) SubscribeHandler(w http.ResponseWriter, r *http.Request) {
 
 	debugLevel := rc.hub.logger.Enabled(ctx, slog.LevelDebug)
 
+	// Send an SSE comment as a heartbeat, to prevent issues with some proxies
+	// and old browsers, or a blank line in NDJSON streams.
+	heartbeat := ":\n"
+	if ndjson {
+		heartbeat = "\n"
+	}
+
 	// On hub shutdown (Caddy "stopping" event, pod SIGTERM, …) we prefer to
 	// let each subscriber drain on its own per-connection write deadline
 	// (derived from writeTimeout, and optionally shortened by JWT expiry)
@@ -196,8 +220,7 @@ func (h *Hub) SubscribeHandler(w http.ResponseWriter, r *http.Request) {
 
 			return
 		case <-heartbeatTimerC:
-			// Send an SSE comment as a heartbeat, to prevent issues with some proxies and old browsers
-			if !h.write(ctx, rc, ":\n") {
+			if !h.write(ctx, rc, heartbeat) {
 				return
 			}
 
@@ -206,7 +229,42 @@ func (h *Hub) SubscribeHandler(w http.ResponseWriter, r *http.Request) {
 			// Cleanly close the HTTP connection before the write deadline to prevent client-side errors
 			return
 		case update, ok := <-s.Receive():
-			if !ok || !h.write(ctx, rc, newSerializedUpdate(update).event) {
+			if !ok {
+				return
+			}
+
+			s.refill()
+
+			// Ephemeral updates that expired while queued aren't sent anymore.
+			if update.expired(time.Now()) {
+				if debugLevel {
+					rc.hub.logger.LogAttrs(ctx, slog.LevelDebug, "Expired update dropped", slog.Any("update", update))
+				}
+
+				continue
+			}
+
+			var event string
+			if ndjson {
+				var err error
+				if event, err = ndjsonEvent(s, update); err != nil {
+					if rc.hub.logger.Enabled(ctx, slog.LevelError) {
+						rc.hub.logger.LogAttrs(ctx, slog.LevelError, "Unable to serialize update", slog.Any("update", update), slog.Any("error", err))
+					}
+
+					return
+				}
+			} else {
+				event = newSerializedUpdate(update).event
+				if s.withTopics {
+					event = update.topicFields(s.authorizedTopics(update)) + event
+				}
+
+				// Signal the updates dropped because the subscriber was too slow.
+				event = s.takeDropped() + event
+			}
+
+			if !h.write(ctx, rc, event) {
 				return
 			}
 
@@ -224,11 +282,55 @@ func (h *Hub) SubscribeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// registerSubscriber initializes the connection.
-func (h *Hub) registerSubscriber(ctx context.Context, w http.ResponseWriter, r *http.Request) (*LocalSubscriber, *responseController) { //nolint:funlen
+// registerSubscriber authorizes the subscriber and adds it to the transport.
+// It writes the error response and returns nil if it can't. The caller starts
+// the response, and must call shutdown once the connection is closed.
+func (h *Hub) registerSubscriber(ctx context.Context, w http.ResponseWriter, r *http.Request) *LocalSubscriber {
 	ctx, span := startSpan(ctx, "mercure.subscribe", trace.WithSpanKind(trace.SpanKindConsumer))
 	defer span.End()
 
+	s := h.newRequestSubscriber(ctx, span, w, r)
+	if s == nil {
+		return nil
+	}
+
+	addCtx := context.WithoutCancel(ctx)
+
+	if err := h.transport.AddSubscriber(addCtx, s); err != nil {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+
+		if h.logger.Enabled(ctx, slog.LevelError) {
+			h.logger.LogAttrs(ctx, slog.LevelError, "Unable to add subscriber", slog.Any("error", err))
+		}
+
+		recordSpanError(span, err)
+
+		return nil
+	}
+
+	// Announce the subscription only once it exists, so a failed registration
+	// cannot publish an active:true for a subscriber that never connected and
+	// then have to take it back. shutdown() already announces termination in
+	// this order: remove first, then dispatch active:false.
+	h.dispatchSubscriptionUpdate(addCtx, s, true)
+
+	if h.logger.Enabled(ctx, slog.LevelInfo) {
+		if s.Claims != nil && h.logger.Enabled(ctx, slog.LevelDebug) {
+			h.logger.LogAttrs(ctx, slog.LevelInfo, "New subscriber", slog.Any("payload", s.SubscriptionPayloads))
+		} else {
+			h.logger.LogAttrs(ctx, slog.LevelInfo, "New subscriber")
+		}
+	}
+
+	h.metrics.SubscriberConnected(s)
+
+	return s
+}
+
+// newRequestSubscriber authorizes the subscriber of r and parses its topic
+// matchers, without adding it to the transport. It writes the error response,
+// records the error in span, and returns nil if it can't.
+func (h *Hub) newRequestSubscriber(ctx context.Context, span trace.Span, w http.ResponseWriter, r *http.Request) *LocalSubscriber { //nolint:funlen
 	h.limitRequestBody(w, r)
 
 	values, err := h.subscribeValues(r)
@@ -243,13 +345,17 @@ func (h *Hub) registerSubscriber(ctx context.Context, w http.ResponseWriter, r *
 		http.Error(w, http.StatusText(status), status)
 		recordSpanError(span, err)
 
-		return nil, nil
+		return nil
 	}
 
 	lastEventID, lastEventIDSet := h.retrieveLastEventID(ctx, r, values)
 
-	s := NewLocalSubscriber(lastEventID, h.logger, h.topicMatcherStore)
+	s := newLocalSubscriber(lastEventID, h.logger, h.topicMatcherStore, h.subscriberBufferSize)
 	s.RequestLastEventIDSet = lastEventIDSet
+	s.slowPolicy = h.slowSubscriberPolicy
+	s.slowSubscriberMetrics, _ = h.metrics.(SlowSubscriberMetrics)
+	_, s.withTopics = values[paramWithTopics]
+	s.poll = values.Get(paramMode) == modePoll
 
 	var claims *claims
 
@@ -268,7 +374,7 @@ func (h *Hub) registerSubscriber(ctx context.Context, w http.ResponseWriter, r *
 				recordSpanError(span, err)
 			}
 
-			return nil, nil
+			return nil
 		}
 	}
 
@@ -279,7 +385,7 @@ func (h *Hub) registerSubscriber(ctx context.Context, w http.ResponseWriter, r *
 		h.writeMatcherParamError(ctx, w, err)
 		recordSpanError(span, err)
 
-		return nil, nil
+		return nil
 	}
 
 	var privateTopicMatchers []TopicMatcher
@@ -296,47 +402,14 @@ func (h *Hub) registerSubscriber(ctx context.Context, w http.ResponseWriter, r *
 		)
 	}
 
-	addCtx := context.WithoutCancel(ctx)
-
-	if err := h.transport.AddSubscriber(addCtx, s); err != nil {
-		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
-
-		if h.logger.Enabled(ctx, slog.LevelError) {
-			h.logger.LogAttrs(ctx, slog.LevelError, "Unable to add subscriber", slog.Any("error", err))
-		}
-
-		recordSpanError(span, err)
-
-		return nil, nil
-	}
-
-	// Announce the subscription only once it exists, so a failed registration
-	// cannot publish an active:true for a subscriber that never connected and
-	// then have to take it back. shutdown() already announces termination in
-	// this order: remove first, then dispatch active:false.
-	h.dispatchSubscriptionUpdate(addCtx, s, true)
-
-	h.sendHeaders(ctx, w, s)
-	rc := h.newResponseController(w, s)
-	rc.flush(ctx)
-
-	if h.logger.Enabled(ctx, slog.LevelInfo) {
-		if claims != nil && h.logger.Enabled(ctx, slog.LevelDebug) {
-			h.logger.LogAttrs(ctx, slog.LevelInfo, "New subscriber", slog.Any("payload", s.SubscriptionPayloads))
-		} else {
-			h.logger.LogAttrs(ctx, slog.LevelInfo, "New subscriber")
-		}
-	}
-
-	h.metrics.SubscriberConnected(s)
-
-	return s, rc
+	return s
 }
 
 //nolint:gochecknoglobals
 var (
 	headerConnection   = []string{"keep-alive"}
 	headerContentType  = []string{"text/event-stream"}
+	headerNDJSON       = []string{ndjsonContentType}
 	headerCacheControl = []string{"private, no-cache, no-store, must-revalidate, max-age=0"}
 	headerPragma       = []string{"no-cache"}
 	headerExpire       = []string{"0"}
@@ -345,13 +418,21 @@ var (
 )
 
 // sendHeaders sends correct HTTP headers to create a keep-alive connection.
-func (h *Hub) sendHeaders(ctx context.Context, w http.ResponseWriter, s *LocalSubscriber) {
+func (h *Hub) sendHeaders(ctx context.Context, w http.ResponseWriter, s *LocalSubscriber, ndjson bool) {
 	header := w.Header()
 
 	// Keep alive, useful only for HTTP 1 clients https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Keep-Alive
 	header["Connection"] = headerConnection
 
-	header["Content-Type"] = headerContentType
+	// An SSE comment, or a blank line in NDJSON streams.
+	body := []byte{':', '\n'}
+
+	if ndjson {
+		header["Content-Type"] = headerNDJSON
+		body = body[1:]
+	} else {
+		header["Content-Type"] = headerContentType
+	}
 
 	// Disable cache, even for old browsers and proxies
 	header["Cache-Control"] = headerCacheControl
@@ -362,12 +443,12 @@ func (h *Hub) sendHeaders(ctx context.Context, w http.ResponseWriter, s *LocalSu
 	header["X-Accel-Buffering"] = headerXAccelBuffering
 
 	if s.RequestLastEventIDSet {
-		header["Mercure-Last-Event-Id"] = []string{<-s.responseLastEventID}
+		header["Mercure-Last-Event-Id"] = []string{<-s.ResponseLastEventID()}
 	}
 
 	// Write a comment in the body
 	// Go currently doesn't provide a better way to flush the headers
-	if _, err := w.Write([]byte{':', '\n'}); err != nil && h.logger.Enabled(ctx, slog.LevelInfo) {
+	if _, err := w.Write(body); err != nil && h.logger.Enabled(ctx, slog.LevelInfo) {
 		h.logger.LogAttrs(ctx, slog.LevelInfo, "Failed to write comment", slog.Any("error", err))
 	}
 }
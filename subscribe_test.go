@@ -1478,3 +1478,42 @@ func TestSubscriptionEventReachesTheSubscriberItDescribes(t *testing.T) {
 	assert.Contains(t, body, `"active": true`)
 	assert.Contains(t, body, `"match": "/.well-known/mercure/subscriptions/:mt/:m/:s"`)
 }
+
+func TestSubscribeDropsExpiredUpdates(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		transport := NewLocalTransport(NewSubscriberList(0), WithLocalHistorySize(10))
+		hub := createAnonymousDummy(t, WithTransport(transport))
+		ctx := t.Context()
+
+		require.NoError(t, transport.Dispatch(ctx, &Update{
+			Topics:  []string{"https://example.com/foos/a"},
+			Event:   Event{ID: "a", Data: "d1"},
+			Expires: time.Now().Add(time.Second),
+		}))
+		require.NoError(t, transport.Dispatch(ctx, &Update{
+			Topics:  []string{"https://example.com/foos/b"},
+			Event:   Event{ID: "b", Data: "d2"},
+			Expires: time.Now().Add(time.Hour),
+		}))
+
+		time.Sleep(2 * time.Second)
+
+		go func() {
+			ctx, cancel := context.WithCancel(t.Context())
+			req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?match_urlpattern=https://example.com/foos/:id&last_event_id=earliest", nil).WithContext(ctx)
+
+			w := &responseTester{
+				expectedStatusCode: http.StatusOK,
+				expectedBody:       ":\nid: b\ndata: d2\n\n",
+				tb:                 t,
+				cancel:             cancel,
+			}
+
+			hub.SubscribeHandler(w, req)
+		}()
+
+		synctest.Wait()
+	})
+}
@@ -28,6 +28,13 @@ const (
 	// deprecated_topic build tag. It is also the path-variable name of the
 	// deprecated /subscriptions/{topic} routes.
 	paramTopic = "topic"
+
+	// paramWithTopics is the subscribe query parameter asking the hub to add
+	// the topics and the privacy of every update to the events it sends, as
+	// non-standard "topic" and "private" fields that EventSource ignores.
+	// Only the topics the subscriber is authorized for are sent. It is used
+	// by hubs relaying the updates of another hub.
+	paramWithTopics = "with_topics"
 )
 
 var (
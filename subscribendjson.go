@@ -0,0 +1,63 @@
+package mercure
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ndjsonUpdate is a line of an NDJSON subscription.
+type ndjsonUpdate struct {
+	*jsonUpdate
+
+	// Dropped is the number of updates dropped before this one because the
+	// subscriber was too slow.
+	Dropped uint64 `json:"dropped,omitempty"`
+}
+
+// acceptsNDJSON reports whether the subscriber prefers an NDJSON stream to an
+// event stream, according to the Accept header. Event streams are preferred
+// on equal quality.
+func acceptsNDJSON(r *http.Request) bool {
+	var ndjsonQ, sseQ float64
+
+	for _, accept := range r.Header.Values("Accept") {
+		for part := range strings.SplitSeq(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(part)
+			if err != nil {
+				continue
+			}
+
+			q := 1.0
+			if v, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(v, 64); err != nil {
+					continue
+				}
+			}
+
+			switch mediaType {
+			case ndjsonContentType:
+				ndjsonQ = max(ndjsonQ, q)
+			case "text/event-stream":
+				sseQ = max(sseQ, q)
+			}
+		}
+	}
+
+	return ndjsonQ > sseQ
+}
+
+// ndjsonEvent serializes update as a line of the NDJSON stream of s. Topics
+// are always included, server-side consumers usually route updates by topic,
+// but only those s is authorized for.
+func ndjsonEvent(s *LocalSubscriber, update *Update) (string, error) {
+	j, err := json.Marshal(ndjsonUpdate{newJSONUpdate(update, s.authorizedTopics(update)), s.takeDroppedCount()})
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal update: %w", err)
+	}
+
+	return string(j) + "\n", nil
+}
@@ -0,0 +1,133 @@
+package mercure
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptsNDJSON(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		accept   string
+		expected bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"text/event-stream", false},
+		{"application/x-ndjson", true},
+		{"application/json, application/x-ndjson", true},
+		{"text/event-stream, application/x-ndjson", false},
+		{"text/event-stream;q=0.5, application/x-ndjson", true},
+		{"application/x-ndjson;q=0.9, text/event-stream", false},
+		{"application/x-ndjson;q=invalid", false},
+	} {
+		t.Run(tc.accept, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, defaultHubURL, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+
+			assert.Equal(t, tc.expected, acceptsNDJSON(req))
+		})
+	}
+}
+
+func TestSubscribeNDJSON(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		transport := createBoltTransport(t, 0, 0)
+		hub := createAnonymousDummy(t, WithTransport(transport))
+		ctx := t.Context()
+
+		require.NoError(t, transport.Dispatch(ctx, &Update{
+			Topics: []string{"https://example.com/foos/a"},
+			Event:  Event{ID: "a", Data: "d1"},
+		}))
+		require.NoError(t, transport.Dispatch(ctx, &Update{
+			Topics: []string{"https://example.com/foos/b"},
+			Event:  Event{ID: "b", Type: "foo", Data: "multi\nline"},
+		}))
+
+		ctx, cancel := context.WithCancel(ctx)
+		req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?match_urlpattern=https://example.com/foos/:id&last_event_id=a", nil).WithContext(ctx)
+		req.Header.Set("Accept", ndjsonContentType)
+
+		w := &responseTester{
+			header:             http.Header{},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       "\n" + `{"id":"b","type":"foo","data":"multi\nline","topics":["https://example.com/foos/b"]}` + "\n",
+			tb:                 t,
+			cancel:             cancel,
+		}
+
+		hub.SubscribeHandler(w, req)
+
+		assert.Equal(t, ndjsonContentType, w.Header().Get("Content-Type"))
+		assert.Equal(t, "a", w.Header().Get("Mercure-Last-Event-ID"))
+	})
+}
+
+func TestSubscribeNDJSONHeartbeat(t *testing.T) {
+	hub := createAnonymousDummy(t, WithHeartbeat(5*time.Millisecond))
+	s, _ := hub.transport.(*LocalTransport)
+	ctx := t.Context()
+
+	go func() {
+		for {
+			s.RLock()
+			empty := s.subscribers.Len() == 0
+			s.RUnlock()
+
+			if empty {
+				continue
+			}
+
+			_ = hub.transport.Dispatch(ctx, &Update{
+				Topics: []string{"https://example.com/books/1"},
+				Event:  Event{Data: "Hello World", ID: "b"},
+			})
+
+			return
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?match=https://example.com/books/1", nil).WithContext(ctx)
+	req.Header.Set("Accept", ndjsonContentType)
+
+	w := &responseTester{
+		expectedStatusCode: http.StatusOK,
+		expectedBody:       "\n" + `{"id":"b","data":"Hello World","topics":["https://example.com/books/1"]}` + "\n\n",
+		tb:                 t,
+		cancel:             cancel,
+	}
+
+	hub.SubscribeHandler(w, req)
+}
+
+func TestNDJSONEventAuthorizedTopics(t *testing.T) {
+	t.Parallel()
+
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers([]string{"https://example.com/books/1"}), stringsToExactMatchers([]string{"https://example.com/books/1"}))
+
+	event, err := ndjsonEvent(s, &Update{
+		Topics:  []string{"https://example.com/books/1", "https://example.com/users/foo/books/1"},
+		Event:   Event{ID: "a", Data: "d1"},
+		Private: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":"a","data":"d1","topics":["https://example.com/books/1"],"private":true}`+"\n", event)
+}
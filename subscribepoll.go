@@ -0,0 +1,126 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	// paramMode is the subscribe query parameter selecting the subscription
+	// mode: an event stream by default, or long polling with modePoll.
+	paramMode = "mode"
+	modePoll  = "poll"
+)
+
+// maxPollBatchSize caps the number of updates of a long-polling response.
+const maxPollBatchSize = 1000
+
+// pollResponse is the body of a long-polling response.
+type pollResponse struct {
+	Updates []*jsonUpdate `json:"updates"`
+	// LastEventID is the cursor to pass as last_event_id to the next poll. It
+	// is only omitted if the transport doesn't implement TransportSubscribers.
+	LastEventID string `json:"last_event_id,omitempty"`
+	// Dropped is the number of updates dropped because the subscriber was too
+	// slow.
+	Dropped uint64 `json:"dropped,omitempty"`
+}
+
+// poll waits until at least one update matches the long-polling subscriber s,
+// or until the poll timeout expires, and sends the updates as a JSON batch.
+func (h *Hub) poll(ctx context.Context, w http.ResponseWriter, s *LocalSubscriber) {
+	timeout := h.pollTimeout
+
+	// Never wait past the write deadline, as for event streams.
+	if wd := h.getWriteDeadline(s); !wd.IsZero() {
+		timeout = min(timeout, time.Until(h.getDisconnectionTime(wd)))
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	resp := pollResponse{Updates: []*jsonUpdate{}}
+
+	// The transports send the cursor once the history has been dispatched.
+	if s.RequestLastEventIDSet {
+		resp.LastEventID = <-s.ResponseLastEventID()
+		w.Header()["Mercure-Last-Event-Id"] = []string{resp.LastEventID}
+	} else {
+		resp.LastEventID = h.transportLastEventID(ctx)
+	}
+
+	debugLevel := h.logger.Enabled(ctx, slog.LevelDebug)
+
+	for len(resp.Updates) < maxPollBatchSize {
+		var (
+			update *Update
+			ok     bool
+		)
+
+		if len(resp.Updates) == 0 {
+			select {
+			case <-ctx.Done():
+				if debugLevel {
+					h.logger.LogAttrs(ctx, slog.LevelDebug, "Connection closed by the client")
+				}
+
+				return
+			case <-h.ctx.Done():
+			case <-timer.C:
+			case update, ok = <-s.Receive():
+			}
+		} else {
+			// Return the updates already queued along with the first one,
+			// without waiting for more.
+			select {
+			case update, ok = <-s.Receive():
+			default:
+			}
+		}
+
+		if !ok {
+			break
+		}
+
+		s.refill()
+
+		// Ephemeral updates that expired while queued aren't sent anymore.
+		if update.expired(time.Now()) {
+			continue
+		}
+
+		resp.Updates = append(resp.Updates, newJSONUpdate(update, s.updateTopics(update)))
+		resp.LastEventID = update.ID
+		resp.Dropped += s.takeDroppedCount()
+	}
+
+	header := w.Header()
+	header["Content-Type"] = []string{"application/json"}
+	header["Cache-Control"] = headerCacheControl
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.handleWriterError(ctx, err, "Error while writing poll response")
+
+		return
+	}
+
+	if debugLevel {
+		h.logger.LogAttrs(ctx, slog.LevelDebug, "Poll response sent", slog.Int("updates", len(resp.Updates)))
+	}
+}
+
+// transportLastEventID returns the ID of the last update dispatched by the
+// transport, or an empty string if it is unknown. Called once the subscriber
+// is registered, it is a valid cursor: the matching updates dispatched after
+// it are received by the subscriber.
+func (h *Hub) transportLastEventID(ctx context.Context) string {
+	tl, ok := TransportAs[TransportLastEventID](h.transport)
+	if !ok {
+		return ""
+	}
+
+	return tl.LastEventID(ctx)
+}
@@ -0,0 +1,151 @@
+package mercure
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodePollResponse(t *testing.T, w *httptest.ResponseRecorder) pollResponse {
+	t.Helper()
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var resp pollResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	return resp
+}
+
+func TestSubscribePollHistory(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0)
+	hub := createAnonymousDummy(t, WithTransport(transport))
+	ctx := t.Context()
+
+	for _, id := range []string{"a", "b", "c"} {
+		require.NoError(t, transport.Dispatch(ctx, &Update{
+			Topics: []string{"https://example.com/foos/" + id},
+			Event:  Event{ID: id, Data: "d" + id},
+		}))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?mode=poll&match_urlpattern=https://example.com/foos/:id&last_event_id=a", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	hub.SubscribeHandler(w, req)
+
+	resp := decodePollResponse(t, w)
+	assert.Equal(t, []*jsonUpdate{{ID: "b", Data: "db"}, {ID: "c", Data: "dc"}}, resp.Updates)
+	assert.Equal(t, "c", resp.LastEventID)
+	assert.Equal(t, "a", w.Header().Get("Mercure-Last-Event-ID"))
+
+	s, _ := hub.transport.(*BoltTransport)
+	assert.Zero(t, s.subscribers.Len())
+}
+
+func TestSubscribePollLive(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t)
+	s, _ := hub.transport.(*LocalTransport)
+	ctx := t.Context()
+
+	go func() {
+		for {
+			s.RLock()
+			empty := s.subscribers.Len() == 0
+			s.RUnlock()
+
+			if empty {
+				continue
+			}
+
+			_ = hub.transport.Dispatch(ctx, &Update{
+				Topics: []string{"https://example.com/books/1"},
+				Event:  Event{Data: "Hello World", ID: "b"},
+			})
+
+			return
+		}
+	}()
+
+	req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?mode=poll&match=https://example.com/books/1&with_topics", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	hub.SubscribeHandler(w, req)
+
+	resp := decodePollResponse(t, w)
+	assert.Equal(t, []*jsonUpdate{{ID: "b", Data: "Hello World", Topics: []string{"https://example.com/books/1"}}}, resp.Updates)
+	assert.Equal(t, "b", resp.LastEventID)
+	assert.Empty(t, w.Header().Get("Mercure-Last-Event-ID"))
+}
+
+func TestSubscribePollTimeout(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		transport := createBoltTransport(t, 0, 0)
+		hub := createAnonymousDummy(t, WithTransport(transport), WithPollTimeout(time.Second))
+		ctx := t.Context()
+
+		require.NoError(t, transport.Dispatch(ctx, &Update{
+			Topics: []string{"https://example.com/foos/a"},
+			Event:  Event{ID: "a", Data: "d1"},
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?mode=poll&match_urlpattern=https://example.com/foos/:id&last_event_id=a", nil).WithContext(ctx)
+		w := httptest.NewRecorder()
+
+		start := time.Now()
+		hub.SubscribeHandler(w, req)
+		assert.Equal(t, time.Second, time.Since(start))
+
+		resp := decodePollResponse(t, w)
+		assert.Empty(t, resp.Updates)
+		assert.Equal(t, "a", resp.LastEventID)
+	})
+}
+
+func TestSubscribePollTimeoutWithoutLastEventID(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		transport := createBoltTransport(t, 0, 0)
+		hub := createAnonymousDummy(t, WithTransport(transport), WithPollTimeout(time.Second))
+		ctx := t.Context()
+
+		require.NoError(t, transport.Dispatch(ctx, &Update{
+			Topics: []string{"https://example.com/foos/a"},
+			Event:  Event{ID: "a", Data: "d1"},
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?mode=poll&match=https://example.com/books/1", nil).WithContext(ctx)
+		w := httptest.NewRecorder()
+		hub.SubscribeHandler(w, req)
+
+		// The cursor is the last event ID of the transport at registration.
+		resp := decodePollResponse(t, w)
+		assert.Empty(t, resp.Updates)
+		assert.Equal(t, "a", resp.LastEventID)
+		assert.Empty(t, w.Header().Get("Mercure-Last-Event-ID"))
+	})
+}
+
+func TestSubscribePollUnauthorized(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+
+	req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?mode=poll&match=https://example.com/books/1", nil)
+	w := httptest.NewRecorder()
+	hub.SubscribeHandler(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
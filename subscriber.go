@@ -60,6 +60,20 @@ func (s *Subscriber) Match(u *Update) bool {
 	return s.MatchTopics(u.Topics, u.Private)
 }
 
+// authorizedTopics returns the topics of u the subscriber would be allowed
+// to receive u for on their own. The other topics of an update the
+// subscriber receives must not be disclosed to it.
+func (s *Subscriber) authorizedTopics(u *Update) []string {
+	topics := make([]string, 0, len(u.Topics))
+	for _, t := range u.Topics {
+		if s.MatchTopics([]string{t}, u.Private) {
+			topics = append(topics, t)
+		}
+	}
+
+	return topics
+}
+
 func (s *Subscriber) LogValue() slog.Value {
 	attrs := []slog.Attr{
 		slog.String("id", s.ID),
@@ -89,6 +89,30 @@ func TestMatchTopic(t *testing.T) {
 	assert.True(t, s.Match(&Update{Topics: []string{"https://example.com/no-match"}}))
 }
 
+func TestAuthorizedTopics(t *testing.T) {
+	t.Parallel()
+
+	tms, err := NewTopicMatcherStore(0)
+	require.NoError(t, err)
+
+	s := NewLocalSubscriber("", slog.Default(), tms)
+	s.setMatchers([]TopicMatcher{
+		{Type: MatcherTypeURLPattern, Pattern: "https://example.com/books/:id"},
+		{Type: MatcherTypeExact, Pattern: "https://example.com/users/foo/books"},
+	}, []TopicMatcher{
+		{Type: MatcherTypeURLPattern, Pattern: "https://example.com/users/foo/*"},
+	})
+
+	topics := []string{"https://example.com/books/1", "https://example.com/users/foo/books", "https://example.com/users/bar/books"}
+
+	assert.Equal(t, []string{"https://example.com/books/1", "https://example.com/users/foo/books"}, s.authorizedTopics(&Update{Topics: topics}))
+	assert.Equal(t, []string{"https://example.com/users/foo/books"}, s.authorizedTopics(&Update{Topics: topics, Private: true}))
+	assert.Nil(t, s.updateTopics(&Update{Topics: topics}))
+
+	s.withTopics = true
+	assert.Equal(t, []string{"https://example.com/users/foo/books"}, s.updateTopics(&Update{Topics: topics, Private: true}))
+}
+
 func TestSubscriberDoesNotBlockWhenChanIsFull(t *testing.T) {
 	t.Parallel()
 
@@ -97,7 +121,7 @@ func TestSubscriberDoesNotBlockWhenChanIsFull(t *testing.T) {
 	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
 	s.Ready(ctx)
 
-	for i := 0; i <= outBufferLength; i++ {
+	for i := 0; i <= DefaultSubscriberBufferSize; i++ {
 		s.Dispatch(ctx, &Update{}, false)
 	}
 
@@ -265,7 +265,7 @@ func (h *Hub) initSubscription(w http.ResponseWriter, r *http.Request) (span tra
 		return span, "", nil, false
 	}
 
-	transport, isSubTransport := h.transport.(TransportSubscribers)
+	transport, isSubTransport := TransportAs[TransportSubscribers](h.transport)
 	if !isSubTransport {
 		panic("The transport isn't an instance of hub.TransportSubscribers")
 	}
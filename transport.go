@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 )
 
 // EarliestLastEventID is the reserved value representing the earliest available event id.
@@ -38,6 +39,14 @@ type TransportSubscribers interface {
 	GetSubscribers(ctx context.Context) (string, []*Subscriber, error)
 }
 
+// TransportLastEventID may be implemented by transports able to return the
+// ID of the last dispatched update without listing the subscribers.
+type TransportLastEventID interface {
+	// LastEventID returns the ID of the last update dispatched by the
+	// transport, EarliestLastEventID if none has been yet.
+	LastEventID(ctx context.Context) string
+}
+
 // TransportTopicMatcherStore provides a method to pass the TopicMatcherStore to the transport.
 type TransportTopicMatcherStore interface {
 	SetTopicMatcherStore(store *TopicMatcherStore)
@@ -58,9 +67,73 @@ type TransportHealthChecker interface {
 	Live(ctx context.Context) error
 }
 
+// TransportDeduplicator may be implemented by transports able to detect the
+// replays of a publication, for instance a publisher retrying a request that
+// timed out. The hub only uses it if the outermost transport, possibly a
+// middleware, implements it.
+type TransportDeduplicator interface {
+	// Deduplicates reports whether replays are detected, typically whether
+	// a deduplication window is configured. DispatchIdempotent isn't called
+	// otherwise.
+	Deduplicates() bool
+
+	// DispatchIdempotent dispatches update like Dispatch, unless an update
+	// has already been dispatched with the same idempotency key during the
+	// deduplication window of the transport. In this case, nothing is
+	// dispatched, the ID of update is set to the one of the original update,
+	// and false is returned.
+	DispatchIdempotent(ctx context.Context, key string, update *Update) (bool, error)
+}
+
+// TransportBatchDispatcher may be implemented by transports able to dispatch
+// several updates at once, for instance in a single database transaction.
+// The hub only uses it if the outermost transport, possibly a middleware,
+// implements it, and dispatches the updates one by one otherwise.
+type TransportBatchDispatcher interface {
+	// DispatchBatch dispatches the updates in order, like DispatchIdempotent
+	// with the idempotency key of the same index, and reports which ones have
+	// been dispatched. keys may be nil, and empty keys are ignored. If an
+	// error is returned, none of the updates has been dispatched.
+	DispatchBatch(ctx context.Context, keys []string, updates []*Update) ([]bool, error)
+}
+
+// TransportHistory may be implemented by transports able to read their
+// history on demand, for instance to serve the history endpoint.
+type TransportHistory interface {
+	// GetHistory returns, in order, at most limit updates matching s that
+	// have been dispatched after the update identified by sinceID, or since
+	// the earliest available one if sinceID is EarliestLastEventID.
+	// Transports may stop before limit to bound the number of updates read.
+	// ErrUnknownLastEventID is returned if sinceID isn't in the history.
+	GetHistory(ctx context.Context, s *Subscriber, sinceID string, limit int) (*HistoryPage, error)
+}
+
+// HistoryPage is a page of the history returned by TransportHistory.
+type HistoryPage struct {
+	Updates []*Update
+	// LastEventID is the ID of the last update read, matching or not, from
+	// which the next page starts. It is empty if no update has been read.
+	LastEventID string
+	// More reports whether the history may hold more matching updates.
+	More bool
+}
+
+// TransportHandler may be implemented by transports serving HTTP endpoints,
+// for instance to exchange updates between hubs. The hub routes the requests
+// whose path starts with HandlerPathPrefix to the transport.
+type TransportHandler interface {
+	http.Handler
+
+	// HandlerPathPrefix returns the path prefix of the endpoints served by the transport.
+	HandlerPathPrefix() string
+}
+
 // ErrClosedTransport is returned by the Transport's Dispatch and AddSubscriber methods after a call to Close.
 var ErrClosedTransport = errors.New("hub: read/write on closed Transport")
 
+// ErrUnknownLastEventID is returned by TransportHistory's GetHistory method when the requested event ID isn't in the history.
+var ErrUnknownLastEventID = errors.New("hub: unknown last event ID")
+
 // TransportError is returned when the Transport's DSN is invalid.
 type TransportError struct {
 	dsn string
@@ -0,0 +1,444 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TransportMiddleware wraps a Transport to add cross-cutting behavior, such as
+// tracing, retries or payload transformation, to any transport.
+//
+// The returned Transport should embed TransportWrapper, or implement
+// TransportUnwrapper: the optional interfaces (TransportSubscribers,
+// TransportHealthChecker, TransportTopicMatcherStore...) it doesn't implement
+// are then looked up on the wrapped Transport by TransportAs.
+type TransportMiddleware func(next Transport) Transport
+
+// TransportUnwrapper is implemented by the transports wrapping another transport.
+type TransportUnwrapper interface {
+	// Unwrap returns the wrapped transport.
+	Unwrap() Transport
+}
+
+// TransportWrapper forwards all the calls to the wrapped Transport. Embed it
+// in the transports returned by a TransportMiddleware, and override the
+// methods to intercept.
+//
+// TransportWrapper doesn't implement TransportDeduplicator nor
+// TransportBatchDispatcher: the hub only uses them when the outermost
+// transport implements them itself, so that a middleware overriding only
+// Dispatch sees every update. Implement them to keep the deduplication and
+// the batches of the wrapped transport, as the built-in middlewares do.
+type TransportWrapper struct {
+	Transport
+}
+
+// errBatchUnsupported is returned by the DispatchBatch method of the built-in
+// middlewares when the wrapped transport doesn't implement
+// TransportBatchDispatcher. The hub then dispatches the updates one by one.
+var errBatchUnsupported = errors.New("batches not supported by the transport")
+
+// Unwrap returns the wrapped transport.
+func (w TransportWrapper) Unwrap() Transport { //nolint:ireturn
+	return w.Transport
+}
+
+// deduplicates reports whether t implements TransportDeduplicator itself, and
+// detects replays.
+func deduplicates(t Transport) bool {
+	d, ok := t.(TransportDeduplicator)
+
+	return ok && d.Deduplicates()
+}
+
+// dispatchIdempotent dispatches update with DispatchIdempotent if t
+// implements TransportDeduplicator itself and detects replays, and key isn't
+// empty. It uses Dispatch otherwise.
+func dispatchIdempotent(ctx context.Context, t Transport, key string, update *Update) (bool, error) {
+	if d, ok := t.(TransportDeduplicator); ok && key != "" && d.Deduplicates() {
+		return d.DispatchIdempotent(ctx, key, update) //nolint:wrapcheck
+	}
+
+	if err := t.Dispatch(ctx, update); err != nil {
+		return false, err //nolint:wrapcheck
+	}
+
+	return true, nil
+}
+
+// dispatchBatch dispatches the updates with DispatchBatch if t implements
+// TransportBatchDispatcher itself, and returns errBatchUnsupported otherwise.
+func dispatchBatch(ctx context.Context, t Transport, keys []string, updates []*Update) ([]bool, error) {
+	if bd, ok := t.(TransportBatchDispatcher); ok {
+		return bd.DispatchBatch(ctx, keys, updates) //nolint:wrapcheck
+	}
+
+	return nil, errBatchUnsupported
+}
+
+// TransportAs returns the first transport of the chain of wrappers starting
+// at t that implements T, typically one of the optional transport interfaces.
+func TransportAs[T any](t Transport) (T, bool) {
+	for t != nil {
+		if v, ok := t.(T); ok {
+			return v, true
+		}
+
+		u, ok := t.(TransportUnwrapper)
+		if !ok {
+			break
+		}
+
+		t = u.Unwrap()
+	}
+
+	var zero T
+
+	return zero, false
+}
+
+// WithTransportMiddleware wraps the transport with the given middlewares.
+// The first middleware is the outermost one: it handles the calls first.
+// This option can be used several times, the middlewares are then appended.
+func WithTransportMiddleware(middlewares ...TransportMiddleware) Option {
+	return func(o *opt) error {
+		o.transportMiddlewares = append(o.transportMiddlewares, middlewares...)
+
+		return nil
+	}
+}
+
+// applyTransportMiddlewares wraps t with middlewares, the first one being the outermost.
+func applyTransportMiddlewares(t Transport, middlewares []TransportMiddleware) Transport { //nolint:ireturn
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		t = middlewares[i](t)
+	}
+
+	return t
+}
+
+type tracingTransport struct {
+	TransportWrapper
+}
+
+// NewTracingTransportMiddleware creates a middleware recording an
+// OpenTelemetry span for each dispatched update and each added or removed
+// subscriber, using the tracer provider of the span active in the context.
+func NewTracingTransportMiddleware() TransportMiddleware {
+	return func(next Transport) Transport {
+		return &tracingTransport{TransportWrapper{next}}
+	}
+}
+
+func (t *tracingTransport) Dispatch(ctx context.Context, update *Update) error {
+	ctx, span := startSpan(ctx, "mercure.transport.dispatch", trace.WithSpanKind(trace.SpanKindInternal), trace.WithAttributes(update.SpanAttributes()...))
+	defer span.End()
+
+	err := t.Transport.Dispatch(ctx, update)
+	if err != nil {
+		recordSpanError(span, err)
+	}
+
+	return err //nolint:wrapcheck
+}
+
+func (t *tracingTransport) Deduplicates() bool {
+	return deduplicates(t.Transport)
+}
+
+func (t *tracingTransport) DispatchIdempotent(ctx context.Context, key string, update *Update) (bool, error) {
+	ctx, span := startSpan(ctx, "mercure.transport.dispatch", trace.WithSpanKind(trace.SpanKindInternal), trace.WithAttributes(update.SpanAttributes()...))
+	defer span.End()
+
+	dispatched, err := dispatchIdempotent(ctx, t.Transport, key, update)
+	if err != nil {
+		recordSpanError(span, err)
+	}
+
+	return dispatched, err
+}
+
+func (t *tracingTransport) DispatchBatch(ctx context.Context, keys []string, updates []*Update) ([]bool, error) {
+	// Dispatched one by one, each update gets its own span.
+	if _, ok := t.Transport.(TransportBatchDispatcher); !ok {
+		return nil, errBatchUnsupported
+	}
+
+	ctx, span := startSpan(ctx, "mercure.transport.dispatch_batch", trace.WithSpanKind(trace.SpanKindInternal), trace.WithAttributes(attribute.Int("mercure.batch.size", len(updates))))
+	defer span.End()
+
+	dispatched, err := dispatchBatch(ctx, t.Transport, keys, updates)
+	if err != nil {
+		recordSpanError(span, err)
+	}
+
+	return dispatched, err
+}
+
+func (t *tracingTransport) AddSubscriber(ctx context.Context, s *LocalSubscriber) error {
+	ctx, span := startSpan(ctx, "mercure.transport.add_subscriber", trace.WithSpanKind(trace.SpanKindInternal))
+	defer span.End()
+
+	err := t.Transport.AddSubscriber(ctx, s)
+	if err != nil {
+		recordSpanError(span, err)
+	}
+
+	return err //nolint:wrapcheck
+}
+
+func (t *tracingTransport) RemoveSubscriber(ctx context.Context, s *LocalSubscriber) error {
+	ctx, span := startSpan(ctx, "mercure.transport.remove_subscriber", trace.WithSpanKind(trace.SpanKindInternal))
+	defer span.End()
+
+	err := t.Transport.RemoveSubscriber(ctx, s)
+	if err != nil {
+		recordSpanError(span, err)
+	}
+
+	return err //nolint:wrapcheck
+}
+
+type retryTransport struct {
+	TransportWrapper
+
+	attempts int
+	delay    time.Duration
+}
+
+// NewRetryTransportMiddleware creates a middleware retrying to dispatch an
+// update up to attempts times, waiting delay between attempts, as long as the
+// transport isn't closed and the context isn't done.
+//
+// Only use it with transports whose Dispatch doesn't partially succeed,
+// otherwise some subscribers could receive the update twice.
+func NewRetryTransportMiddleware(attempts int, delay time.Duration) TransportMiddleware {
+	return func(next Transport) Transport {
+		return &retryTransport{TransportWrapper{next}, attempts, delay}
+	}
+}
+
+func (t *retryTransport) Dispatch(ctx context.Context, update *Update) (err error) {
+	for attempt := 1; ; attempt++ {
+		err = t.Transport.Dispatch(ctx, update)
+		if err == nil || attempt >= t.attempts || errors.Is(err, ErrClosedTransport) {
+			return err //nolint:wrapcheck
+		}
+
+		select {
+		case <-ctx.Done():
+			return err //nolint:wrapcheck
+		case <-time.After(t.delay):
+		}
+	}
+}
+
+func (t *retryTransport) Deduplicates() bool {
+	return deduplicates(t.Transport)
+}
+
+// DispatchIdempotent retries as Dispatch does: replays of an update already
+// dispatched by a previous attempt are detected.
+func (t *retryTransport) DispatchIdempotent(ctx context.Context, key string, update *Update) (dispatched bool, err error) {
+	for attempt := 1; ; attempt++ {
+		dispatched, err = dispatchIdempotent(ctx, t.Transport, key, update)
+		if err == nil || attempt >= t.attempts || errors.Is(err, ErrClosedTransport) {
+			return dispatched, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return dispatched, err
+		case <-time.After(t.delay):
+		}
+	}
+}
+
+// DispatchBatch retries as Dispatch does: batches are dispatched atomically.
+func (t *retryTransport) DispatchBatch(ctx context.Context, keys []string, updates []*Update) (dispatched []bool, err error) {
+	for attempt := 1; ; attempt++ {
+		dispatched, err = dispatchBatch(ctx, t.Transport, keys, updates)
+		if err == nil || attempt >= t.attempts || errors.Is(err, ErrClosedTransport) || errors.Is(err, errBatchUnsupported) {
+			return dispatched, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return dispatched, err
+		case <-time.After(t.delay):
+		}
+	}
+}
+
+type transformTransport struct {
+	TransportWrapper
+
+	transform func(ctx context.Context, update *Update) (*Update, error)
+}
+
+// NewTransformTransportMiddleware creates a middleware dispatching the update
+// returned by transform instead of the original one, for instance to enrich or
+// encrypt its data. The update isn't dispatched if transform returns an error
+// or a nil update. The returned update must keep the ID of the original one,
+// which is sent to the publisher.
+func NewTransformTransportMiddleware(transform func(ctx context.Context, update *Update) (*Update, error)) TransportMiddleware {
+	return func(next Transport) Transport {
+		return &transformTransport{TransportWrapper{next}, transform}
+	}
+}
+
+func (t *transformTransport) Dispatch(ctx context.Context, update *Update) error {
+	update, err := t.transform(ctx, update)
+	if err != nil || update == nil {
+		return err
+	}
+
+	return t.Transport.Dispatch(ctx, update) //nolint:wrapcheck
+}
+
+func (t *transformTransport) Deduplicates() bool {
+	return deduplicates(t.Transport)
+}
+
+func (t *transformTransport) DispatchIdempotent(ctx context.Context, key string, update *Update) (bool, error) {
+	transformed, err := t.transform(ctx, update)
+	if err != nil {
+		return false, err
+	}
+
+	// Not dispatched on purpose, as by Dispatch.
+	if transformed == nil {
+		return true, nil
+	}
+
+	dispatched, err := dispatchIdempotent(ctx, t.Transport, key, transformed)
+
+	// The ID of the original update is sent to the publisher of a replay.
+	update.ID = transformed.ID
+
+	return dispatched, err
+}
+
+func (t *transformTransport) DispatchBatch(ctx context.Context, keys []string, updates []*Update) ([]bool, error) {
+	if _, ok := t.Transport.(TransportBatchDispatcher); !ok {
+		return nil, errBatchUnsupported
+	}
+
+	var (
+		transformedKeys    []string
+		transformedUpdates []*Update
+		// The index in updates of each transformed update.
+		indexes []int
+	)
+
+	for i, update := range updates {
+		transformed, err := t.transform(ctx, update)
+		if err != nil {
+			return nil, err
+		}
+
+		// Not dispatched on purpose, as by Dispatch.
+		if transformed == nil {
+			continue
+		}
+
+		if keys != nil {
+			transformedKeys = append(transformedKeys, keys[i])
+		}
+
+		transformedUpdates = append(transformedUpdates, transformed)
+		indexes = append(indexes, i)
+	}
+
+	dispatched := make([]bool, len(updates))
+	for i := range dispatched {
+		dispatched[i] = true
+	}
+
+	if len(transformedUpdates) == 0 {
+		return dispatched, nil
+	}
+
+	d, err := dispatchBatch(ctx, t.Transport, transformedKeys, transformedUpdates)
+	if err != nil {
+		return nil, err
+	}
+
+	for j, i := range indexes {
+		dispatched[i] = d[j]
+		// The ID of the original update is sent to the publisher of a replay.
+		updates[i].ID = transformedUpdates[j].ID
+	}
+
+	return dispatched, nil
+}
+
+type faultTransport struct {
+	TransportWrapper
+
+	fault func(ctx context.Context, update *Update) error
+}
+
+// NewFaultInjectionTransportMiddleware creates a middleware failing to
+// dispatch the updates for which fault returns an error, to test how
+// publishers and the other middlewares handle transport failures.
+func NewFaultInjectionTransportMiddleware(fault func(ctx context.Context, update *Update) error) TransportMiddleware {
+	return func(next Transport) Transport {
+		return &faultTransport{TransportWrapper{next}, fault}
+	}
+}
+
+func (t *faultTransport) Dispatch(ctx context.Context, update *Update) error {
+	if err := t.fault(ctx, update); err != nil {
+		return err
+	}
+
+	return t.Transport.Dispatch(ctx, update) //nolint:wrapcheck
+}
+
+func (t *faultTransport) Deduplicates() bool {
+	return deduplicates(t.Transport)
+}
+
+func (t *faultTransport) DispatchIdempotent(ctx context.Context, key string, update *Update) (bool, error) {
+	if err := t.fault(ctx, update); err != nil {
+		return false, err
+	}
+
+	return dispatchIdempotent(ctx, t.Transport, key, update)
+}
+
+func (t *faultTransport) DispatchBatch(ctx context.Context, keys []string, updates []*Update) ([]bool, error) {
+	if _, ok := t.Transport.(TransportBatchDispatcher); !ok {
+		return nil, errBatchUnsupported
+	}
+
+	for _, update := range updates {
+		if err := t.fault(ctx, update); err != nil {
+			return nil, err
+		}
+	}
+
+	return dispatchBatch(ctx, t.Transport, keys, updates)
+}
+
+// Interface guards.
+var (
+	_ TransportUnwrapper       = TransportWrapper{}
+	_ TransportUnwrapper       = (*tracingTransport)(nil)
+	_ TransportDeduplicator    = (*tracingTransport)(nil)
+	_ TransportBatchDispatcher = (*tracingTransport)(nil)
+	_ TransportUnwrapper       = (*retryTransport)(nil)
+	_ TransportDeduplicator    = (*retryTransport)(nil)
+	_ TransportBatchDispatcher = (*retryTransport)(nil)
+	_ TransportUnwrapper       = (*transformTransport)(nil)
+	_ TransportDeduplicator    = (*transformTransport)(nil)
+	_ TransportBatchDispatcher = (*transformTransport)(nil)
+	_ TransportUnwrapper       = (*faultTransport)(nil)
+	_ TransportDeduplicator    = (*faultTransport)(nil)
+	_ TransportBatchDispatcher = (*faultTransport)(nil)
+)
@@ -0,0 +1,187 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errInjectedFault = errors.New("injected fault")
+
+func TestWithTransportMiddleware(t *testing.T) {
+	t.Parallel()
+
+	var calls []string
+
+	recorder := func(name string) TransportMiddleware {
+		return NewFaultInjectionTransportMiddleware(func(context.Context, *Update) error {
+			calls = append(calls, name)
+
+			return nil
+		})
+	}
+
+	transport := NewLocalTransport(NewSubscriberList(0))
+	hub := createAnonymousDummy(t,
+		WithTransport(transport),
+		WithSubscriptions(),
+		WithTransportMiddleware(recorder("a"), recorder("b")),
+		WithTransportMiddleware(NewTracingTransportMiddleware()),
+	)
+
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topics: []string{"https://example.com/foo"}}))
+	assert.Equal(t, []string{"a", "b"}, calls)
+
+	// The optional interfaces of the wrapped transport are still available.
+	ts, ok := TransportAs[TransportSubscribers](hub.transport)
+	require.True(t, ok)
+	assert.Same(t, transport, ts)
+}
+
+// countingTransport is a custom middleware overriding only Dispatch.
+type countingTransport struct {
+	TransportWrapper
+
+	dispatched []string
+}
+
+func (t *countingTransport) Dispatch(ctx context.Context, update *Update) error {
+	t.dispatched = append(t.dispatched, update.ID)
+
+	return t.Transport.Dispatch(ctx, update) //nolint:wrapcheck
+}
+
+func TestWithTransportMiddlewareOverridingDispatchOnly(t *testing.T) {
+	t.Parallel()
+
+	counter := &countingTransport{}
+	transport := createBoltTransport(t, 0, 0, WithBoltDeduplicationWindow(time.Minute))
+	hub := createDummy(t, WithTransport(transport), WithTransportMiddleware(func(next Transport) Transport {
+		counter.Transport = next
+
+		return counter
+	}))
+
+	// Idempotent and batch publications aren't hidden from the middleware,
+	// at the cost of deduplication and atomicity.
+	dispatched, err := hub.PublishIdempotent(t.Context(), "k", &Update{Event: Event{ID: "a"}, Topics: []string{"https://example.com/foo"}})
+	require.NoError(t, err)
+	assert.True(t, dispatched)
+
+	d, errs := hub.PublishBatchIdempotent(t.Context(), []string{"k", "k"}, []*Update{
+		{Event: Event{ID: "b"}, Topics: []string{"https://example.com/foo"}},
+		{Event: Event{ID: "c"}, Topics: []string{"https://example.com/foo"}},
+	})
+	assert.Equal(t, []error{nil, nil}, errs)
+	assert.Equal(t, []bool{true, true}, d)
+
+	assert.Equal(t, []string{"a", "b", "c"}, counter.dispatched)
+	assert.Equal(t, []string{"a", "b", "c"}, historyIDs(t, transport))
+}
+
+func TestTransportAs(t *testing.T) {
+	t.Parallel()
+
+	local := NewLocalTransport(NewSubscriberList(0))
+	mesh, err := NewMeshTransport(local, slog.Default(), nil, testMeshSecret)
+	require.NoError(t, err)
+
+	transport := NewTracingTransportMiddleware()(mesh)
+
+	th, ok := TransportAs[TransportHandler](transport)
+	require.True(t, ok)
+	assert.Same(t, mesh, th)
+
+	l, ok := TransportAs[*LocalTransport](transport)
+	require.True(t, ok)
+	assert.Same(t, local, l)
+
+	_, ok = TransportAs[*BoltTransport](transport)
+	assert.False(t, ok)
+
+	_, ok = TransportAs[TransportSubscribers](nil)
+	assert.False(t, ok)
+}
+
+func TestTracingTransportMiddleware(t *testing.T) {
+	t.Parallel()
+
+	ctx, sr := spanRecorder(t)
+
+	transport := NewTracingTransportMiddleware()(NewLocalTransport(NewSubscriberList(0)))
+
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	require.NoError(t, transport.AddSubscriber(ctx, s))
+	require.NoError(t, transport.Dispatch(ctx, &Update{Topics: []string{"https://example.com/foo"}}))
+	require.NoError(t, transport.RemoveSubscriber(ctx, s))
+
+	assert.Equal(t, []string{"mercure.transport.add_subscriber", "mercure.transport.dispatch", "mercure.transport.remove_subscriber"}, endedSpanNames(sr))
+}
+
+func TestRetryTransportMiddleware(t *testing.T) {
+	t.Parallel()
+
+	failures := func(n int) TransportMiddleware {
+		return NewFaultInjectionTransportMiddleware(func(context.Context, *Update) error {
+			if n == 0 {
+				return nil
+			}
+
+			n--
+
+			return errInjectedFault
+		})
+	}
+
+	local := NewLocalTransport(NewSubscriberList(0))
+	u := &Update{Topics: []string{"https://example.com/foo"}}
+
+	transport := NewRetryTransportMiddleware(3, time.Millisecond)(failures(2)(local))
+	require.NoError(t, transport.Dispatch(t.Context(), u))
+
+	transport = NewRetryTransportMiddleware(2, time.Millisecond)(failures(2)(local))
+	require.ErrorIs(t, transport.Dispatch(t.Context(), u), errInjectedFault)
+
+	require.NoError(t, local.Close(t.Context()))
+
+	attempts := 0
+	transport = NewRetryTransportMiddleware(3, time.Millisecond)(NewFaultInjectionTransportMiddleware(func(context.Context, *Update) error {
+		attempts++
+
+		return nil
+	})(local))
+	require.ErrorIs(t, transport.Dispatch(t.Context(), u), ErrClosedTransport)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestTransformTransportMiddleware(t *testing.T) {
+	t.Parallel()
+
+	local := NewLocalTransport(NewSubscriberList(0))
+	transport := NewTransformTransportMiddleware(func(_ context.Context, u *Update) (*Update, error) {
+		if u.Data == "drop" {
+			return nil, nil
+		}
+
+		transformed := *u
+		transformed.Data = "transformed " + u.Data
+
+		return &transformed, nil
+	})(local)
+
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/foo"}}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: "a", Data: "drop"}, Topics: []string{"https://example.com/foo"}}))
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: "b", Data: "foo"}, Topics: []string{"https://example.com/foo"}}))
+
+	u := <-s.Receive()
+	assert.Equal(t, "b", u.ID)
+	assert.Equal(t, "transformed foo", u.Data)
+}
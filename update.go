@@ -2,6 +2,8 @@ package mercure
 
 import (
 	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/gofrs/uuid/v5"
 	"go.opentelemetry.io/otel/attribute"
@@ -24,6 +26,10 @@ type Update struct {
 
 	// To print debug information
 	Debug bool
+
+	// Expires is the time after which the update must not be delivered
+	// anymore, neither from the history nor live. Zero means it never expires.
+	Expires time.Time `json:",omitzero"`
 }
 
 func (u *Update) LogValue() slog.Value {
@@ -35,6 +41,10 @@ func (u *Update) LogValue() slog.Value {
 		slog.Bool("private", u.Private),
 	}
 
+	if !u.Expires.IsZero() {
+		attrs = append(attrs, slog.Time("expires", u.Expires))
+	}
+
 	if u.Debug {
 		attrs = append(attrs, slog.String("data", u.Data))
 	}
@@ -55,6 +65,11 @@ func (u *Update) AssignUUID() {
 	}
 }
 
+// expired reports whether the update must not be delivered anymore at now.
+func (u *Update) expired(now time.Time) bool {
+	return !u.Expires.IsZero() && !now.Before(u.Expires)
+}
+
 // SpanAttributes returns the OpenTelemetry attributes describing this update.
 func (u *Update) SpanAttributes() []attribute.KeyValue {
 	attrs := make([]attribute.KeyValue, 0, 3)
@@ -68,6 +83,61 @@ func (u *Update) SpanAttributes() []attribute.KeyValue {
 	)
 }
 
+// topicFields serializes topics, the privacy and the expiration of the update
+// as non-standard Server-Sent Events fields, for subscribers that asked for
+// them. Topics never contain control characters, they can't inject other
+// fields.
+func (u *Update) topicFields(topics []string) string {
+	var b strings.Builder
+
+	for _, t := range topics {
+		b.WriteString("topic: ")
+		b.WriteString(t)
+		b.WriteByte('\n')
+	}
+
+	if u.Private {
+		b.WriteString("private: true\n")
+	}
+
+	if !u.Expires.IsZero() {
+		b.WriteString("expires: ")
+		b.WriteString(u.Expires.UTC().Format(time.RFC3339Nano))
+		b.WriteByte('\n')
+	}
+
+	return b.String()
+}
+
+// jsonUpdate is an update sent to a subscriber as JSON. Topics, Private and
+// Expires are only set when the subscriber asked for them, as for topicFields.
+type jsonUpdate struct {
+	ID      string     `json:"id"`
+	Type    string     `json:"type,omitempty"`
+	Data    string     `json:"data"`
+	Retry   uint64     `json:"retry,omitempty"`
+	Topics  []string   `json:"topics,omitempty"`
+	Private bool       `json:"private,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// newJSONUpdate converts u, including topics and its privacy if topics isn't
+// nil.
+func newJSONUpdate(u *Update, topics []string) *jsonUpdate {
+	ju := &jsonUpdate{ID: u.ID, Type: u.Type, Data: u.Data, Retry: u.Retry}
+	if topics != nil {
+		ju.Topics = topics
+		ju.Private = u.Private
+
+		if !u.Expires.IsZero() {
+			expires := u.Expires.UTC()
+			ju.Expires = &expires
+		}
+	}
+
+	return ju
+}
+
 func newSerializedUpdate(u *Update) *serializedUpdate {
 	return &serializedUpdate{u, u.String()}
 }
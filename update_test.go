@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/stretchr/testify/assert"
@@ -54,6 +55,23 @@ func TestUpdateJSON(t *testing.T) {
 	assert.JSONEq(t, legacy, string(out))
 }
 
+func TestUpdateJSONExpires(t *testing.T) {
+	t.Parallel()
+
+	u := &Update{Topics: []string{"https://example.com/a"}, Expires: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)}
+
+	out, err := json.Marshal(u)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), `"Expires":"2030-01-02T03:04:05Z"`)
+
+	var decoded *Update
+
+	require.NoError(t, json.Unmarshal(out, &decoded))
+	assert.True(t, u.Expires.Equal(decoded.Expires))
+	assert.False(t, decoded.expired(time.Date(2030, 1, 2, 3, 4, 4, 0, time.UTC)))
+	assert.True(t, decoded.expired(u.Expires))
+}
+
 func TestLogUpdate(t *testing.T) {
 	t.Parallel()
 
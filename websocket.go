@@ -0,0 +1,345 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/gorilla/mux"
+)
+
+// webSocketMessage is a message sent by the hub over a WebSocket connection:
+// either an update, or the result of a publication made over the connection.
+type webSocketMessage struct {
+	Update *jsonUpdate `json:"update,omitempty"`
+	// Dropped is the number of updates dropped since the previous update
+	// because the subscriber was too slow.
+	Dropped uint64 `json:"dropped,omitempty"`
+
+	// Ref is the reference of the publication request, set by the client.
+	Ref string `json:"ref,omitempty"`
+	publishResult
+}
+
+// webSocketRequest is a message sent by a client over a WebSocket connection.
+type webSocketRequest struct {
+	Ref     string           `json:"ref"`
+	Publish *jsonPublication `json:"publish"`
+}
+
+// isWebSocketUpgrade reports whether r is a WebSocket handshake.
+func isWebSocketUpgrade(r *http.Request, _ *mux.RouteMatch) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// WebSocketHandler upgrades the connection to the WebSocket protocol and
+// sends the updates to the subscriber as JSON messages. Subscribers are
+// authorized as by SubscribeHandler, and disconnected under the same
+// conditions.
+//
+// Clients whose token carries the publish action can also publish updates
+// over the connection.
+//
+//nolint:funlen,gocognit
+func (h *Hub) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	// The connection is hijacked: the request context isn't canceled when it
+	// is closed.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	publisher := h.authorizeWebSocketPublisher(r)
+
+	s := h.registerSubscriber(ctx, w, r)
+	if s == nil {
+		return
+	}
+
+	ctx = context.WithValue(ctx, SubscriberContextKey, &s.Subscriber)
+
+	defer h.shutdown(ctx, s)
+
+	if s.RequestLastEventIDSet {
+		w.Header()["Mercure-Last-Event-Id"] = []string{<-s.ResponseLastEventID()}
+	}
+
+	// Waits for the reader to stop, once the connection is closed.
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	c, err := websocket.Accept(w, r, h.webSocketAcceptOptions())
+	if err != nil {
+		if h.logger.Enabled(ctx, slog.LevelInfo) {
+			h.logger.LogAttrs(ctx, slog.LevelInfo, "Unable to upgrade to WebSocket", slog.Any("error", err))
+		}
+
+		return
+	}
+
+	defer c.CloseNow()
+
+	// Messages are bounded as publish request bodies, and not at all if the
+	// limit is disabled.
+	if h.maxRequestBodySize > 0 {
+		c.SetReadLimit(h.maxRequestBodySize)
+	} else {
+		c.SetReadLimit(-1)
+	}
+
+	writeDeadline := h.getWriteDeadline(s)
+
+	// The reader handles the publications, the control frames (including the
+	// pongs answering heartbeats), and detects when the client leaves.
+	wg.Go(func() {
+		defer cancel()
+
+		for {
+			_, data, err := c.Read(ctx)
+			if err != nil {
+				return
+			}
+
+			if !h.writeWebSocket(ctx, c, writeDeadline, h.publishWebSocketRequest(ctx, publisher, data)) {
+				return
+			}
+		}
+	})
+
+	var (
+		heartbeatTimer      *time.Timer
+		heartbeatTimerC     <-chan time.Time
+		disconnectionTimerC <-chan time.Time
+	)
+
+	if h.heartbeat != 0 {
+		heartbeatTimer = time.NewTimer(h.heartbeat)
+		defer heartbeatTimer.Stop()
+
+		heartbeatTimerC = heartbeatTimer.C
+	}
+
+	// See SubscribeHandler.
+	if !writeDeadline.IsZero() {
+		disconnectionTimer := time.NewTimer(time.Until(h.getDisconnectionTime(writeDeadline)))
+		defer disconnectionTimer.Stop()
+
+		disconnectionTimerC = disconnectionTimer.C
+	}
+
+	var hubCtxDoneC <-chan struct{}
+	if h.writeTimeout == 0 {
+		hubCtxDoneC = h.ctx.Done()
+	}
+
+	debugLevel := h.logger.Enabled(ctx, slog.LevelDebug)
+
+	for {
+		select {
+		case <-hubCtxDoneC:
+			if debugLevel {
+				h.logger.LogAttrs(ctx, slog.LevelDebug, "Hub is shutting down, closing connection")
+			}
+
+			_ = c.Close(websocket.StatusGoingAway, "")
+
+			return
+		case <-ctx.Done():
+			if debugLevel {
+				h.logger.LogAttrs(ctx, slog.LevelDebug, "Connection closed by the client")
+			}
+
+			return
+		case <-heartbeatTimerC:
+			pingCtx, cancelPing := h.webSocketWriteContext(ctx, writeDeadline)
+			err := c.Ping(pingCtx)
+
+			cancelPing()
+
+			if err != nil {
+				if debugLevel {
+					h.logger.LogAttrs(ctx, slog.LevelDebug, "Failed to send heartbeat", slog.Any("error", err))
+				}
+
+				return
+			}
+
+			heartbeatTimer.Reset(h.heartbeat)
+		case <-disconnectionTimerC:
+			// Cleanly close the connection before the write deadline to prevent client-side errors
+			_ = c.Close(websocket.StatusNormalClosure, "")
+
+			return
+		case update, ok := <-s.Receive():
+			if !ok {
+				return
+			}
+
+			s.refill()
+
+			// Ephemeral updates that expired while queued aren't sent anymore.
+			if update.expired(time.Now()) {
+				if debugLevel {
+					h.logger.LogAttrs(ctx, slog.LevelDebug, "Expired update dropped", slog.Any("update", update))
+				}
+
+				continue
+			}
+
+			msg := &webSocketMessage{Update: newJSONUpdate(update, s.updateTopics(update)), Dropped: s.takeDroppedCount()}
+			if !h.writeWebSocket(ctx, c, writeDeadline, msg) {
+				return
+			}
+
+			if heartbeatTimer != nil {
+				heartbeatTimer.Reset(h.heartbeat)
+			}
+
+			if debugLevel {
+				h.logger.LogAttrs(ctx, slog.LevelDebug, "Update sent", slog.Any("update", update))
+			}
+		}
+	}
+}
+
+// authorizeWebSocketPublisher returns the claims of the publisher if the
+// client is allowed to publish over the WebSocket connection, or nil.
+func (h *Hub) authorizeWebSocketPublisher(r *http.Request) *claims {
+	if !h.publisherConfigured {
+		return nil
+	}
+
+	// The handshake is a GET request, but publishing isn't a safe operation:
+	// authorize it as a POST request, so that a token sent in a cookie is only
+	// accepted from the allowed publish origins.
+	pr := r.Clone(r.Context())
+	pr.Method = http.MethodPost
+
+	c, err := h.authorize(pr, true)
+	if err != nil {
+		ctx := r.Context()
+		if h.logger.Enabled(ctx, slog.LevelDebug) {
+			h.logger.LogAttrs(ctx, slog.LevelDebug, "Publishing over WebSocket not allowed", slog.Any("error", err))
+		}
+
+		return nil
+	}
+
+	return c
+}
+
+// publishWebSocketRequest publishes the update sent by a client over a
+// WebSocket connection, and returns the result to send back.
+func (h *Hub) publishWebSocketRequest(ctx context.Context, publisher *claims, data []byte) *webSocketMessage {
+	var req webSocketRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return &webSocketMessage{publishResult: publishResult{Error: "Invalid JSON: " + err.Error(), Status: http.StatusBadRequest}}
+	}
+
+	msg := &webSocketMessage{Ref: req.Ref}
+
+	switch {
+	case req.Publish == nil:
+		msg.publishResult = publishResult{Error: `Missing "publish" field`, Status: http.StatusBadRequest}
+
+		return msg
+	case publisher == nil:
+		msg.publishResult = publishResult{Error: http.StatusText(http.StatusForbidden), Status: http.StatusForbidden}
+
+		return msg
+	case publisher.ExpiresAt != nil && !time.Now().Before(publisher.ExpiresAt.Time):
+		msg.publishResult = publishResult{Error: http.StatusText(http.StatusUnauthorized), Status: http.StatusUnauthorized}
+
+		return msg
+	}
+
+	u, err := req.Publish.update()
+	if err != nil {
+		msg.publishResult = publishResult{Error: "Invalid JSON: " + err.Error(), Status: http.StatusBadRequest}
+
+		return msg
+	}
+
+	u.Debug = h.debug
+
+	if result := h.checkPublication(ctx, publisher, u); result.Status != 0 {
+		msg.publishResult = result
+
+		return msg
+	}
+
+	// As for forms, the ID set by the publisher identifies retried
+	// publications.
+	var key string
+	if u.ID != "" {
+		key = publisherIdempotencyKey(publisher, "id:"+u.ID)
+	}
+
+	dispatched, err := h.PublishIdempotent(context.WithoutCancel(ctx), key, u)
+	if err != nil {
+		msg.publishResult = newPublishErrorResult(err)
+
+		return msg
+	}
+
+	msg.ID = u.ID
+	msg.Replayed = !dispatched
+
+	return msg
+}
+
+// webSocketAcceptOptions allows cross-origin connections from the CORS
+// origins, as for EventSource.
+func (h *Hub) webSocketAcceptOptions() *websocket.AcceptOptions {
+	opts := &websocket.AcceptOptions{}
+
+	for _, origin := range h.corsOrigins {
+		if origin == "*" {
+			opts.InsecureSkipVerify = true
+
+			break
+		}
+
+		opts.OriginPatterns = append(opts.OriginPatterns, origin)
+	}
+
+	return opts
+}
+
+// webSocketWriteContext returns the context of a write: it is canceled at the
+// write deadline, or after the dispatch timeout if it comes first.
+func (h *Hub) webSocketWriteContext(ctx context.Context, writeDeadline time.Time) (context.Context, context.CancelFunc) {
+	deadline := writeDeadline
+	if h.dispatchTimeout != 0 {
+		if d := time.Now().Add(h.dispatchTimeout); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+
+	if deadline.IsZero() {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithDeadline(ctx, deadline)
+}
+
+// writeWebSocket sends msg to the client.
+// It returns false if the subscriber has been disconnected (e.g. timeout).
+func (h *Hub) writeWebSocket(ctx context.Context, c *websocket.Conn, writeDeadline time.Time, msg *webSocketMessage) bool {
+	ctx, cancel := h.webSocketWriteContext(ctx, writeDeadline)
+	defer cancel()
+
+	if err := wsjson.Write(ctx, c, msg); err != nil {
+		if h.logger.Enabled(ctx, slog.LevelDebug) {
+			h.logger.LogAttrs(ctx, slog.LevelDebug, "Failed to write WebSocket message", slog.Any("error", err))
+		}
+
+		return false
+	}
+
+	return true
+}
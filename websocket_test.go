@@ -0,0 +1,257 @@
+package mercure
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dialWebSocket(t *testing.T, hub *Hub, query, token string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+
+	server := httptest.NewServer(hub)
+	t.Cleanup(server.Close)
+
+	opts := &websocket.DialOptions{HTTPHeader: http.Header{}}
+	if token != "" {
+		opts.HTTPHeader.Set("Authorization", bearerPrefix+token)
+	}
+
+	c, resp, err := websocket.Dial(t.Context(), "ws"+strings.TrimPrefix(server.URL, "http")+defaultHubURL+"?"+query, opts)
+	if err == nil {
+		t.Cleanup(func() {
+			_ = c.CloseNow()
+		})
+	}
+
+	return c, resp, err
+}
+
+func readWebSocketMessage(t *testing.T, c *websocket.Conn) *webSocketMessage {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+
+	var msg webSocketMessage
+	require.NoError(t, wsjson.Read(ctx, c, &msg))
+
+	return &msg
+}
+
+func TestWebSocketHandler(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithWebSocket())
+
+	c, _, err := dialWebSocket(t, hub, "match=https://example.com/books/1", "")
+	require.NoError(t, err)
+
+	require.NoError(t, hub.Publish(t.Context(), &Update{
+		Event:  Event{ID: "a", Data: "Hello!", Type: "greeting", Retry: 10},
+		Topics: []string{"https://example.com/books/1"},
+	}))
+
+	msg := readWebSocketMessage(t, c)
+	assert.Equal(t, &jsonUpdate{ID: "a", Type: "greeting", Data: "Hello!", Retry: 10}, msg.Update)
+}
+
+func TestWebSocketHandlerWithTopics(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithWebSocket())
+
+	c, _, err := dialWebSocket(t, hub, "match=https://example.com/books/1&with_topics", "")
+	require.NoError(t, err)
+
+	require.NoError(t, hub.Publish(t.Context(), &Update{
+		Event:  Event{ID: "a"},
+		Topics: []string{"https://example.com/books/1", "https://example.com/alternate"},
+	}))
+
+	msg := readWebSocketMessage(t, c)
+	// The topics the subscriber isn't authorized for aren't disclosed.
+	assert.Equal(t, []string{"https://example.com/books/1"}, msg.Update.Topics)
+}
+
+func TestWebSocketHandlerLastEventID(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithWebSocket(), WithTransport(createBoltTransport(t, 0, 0)))
+
+	for _, id := range []string{"a", "b"} {
+		require.NoError(t, hub.Publish(t.Context(), &Update{
+			Event:  Event{ID: id},
+			Topics: []string{"https://example.com/books/1"},
+		}))
+	}
+
+	c, resp, err := dialWebSocket(t, hub, "match=https://example.com/books/1&last_event_id=a", "")
+	require.NoError(t, err)
+	assert.Equal(t, "a", resp.Header.Get("Mercure-Last-Event-Id"))
+
+	assert.Equal(t, "b", readWebSocketMessage(t, c).Update.ID)
+}
+
+func TestWebSocketHandlerUnauthorized(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithWebSocket())
+
+	_, resp, err := dialWebSocket(t, hub, "match=https://example.com/books/1", "")
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestWebSocketHandlerDisabled(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t)
+
+	server := httptest.NewServer(hub)
+	t.Cleanup(server.Close)
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, server.URL+defaultHubURL+"?match=https://example.com/books/1", nil)
+	require.NoError(t, err)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+
+	// The SSE stream is served instead.
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	require.NoError(t, resp.Body.Close())
+}
+
+func TestWebSocketHandlerDisconnection(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithWebSocket(), WithWriteTimeout(100*time.Millisecond), WithDispatchTimeout(0))
+
+	c, _, err := dialWebSocket(t, hub, "match=https://example.com/books/1", "")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+
+	_, _, err = c.Read(ctx)
+	assert.Equal(t, websocket.StatusNormalClosure, websocket.CloseStatus(err))
+}
+
+func TestWebSocketHandlerPublish(t *testing.T) {
+	t.Parallel()
+
+	tms, err := NewTopicMatcherStore(0)
+	require.NoError(t, err)
+
+	// The same key verifies both roles, so that a single token can subscribe and publish.
+	hub, err := NewHub(t.Context(),
+		WithIssuers([]Issuer{{
+			Identifier: testIssuer,
+			Publisher:  Static{Key: []byte("shared"), Algorithm: "HS256"},
+			Subscriber: Static{Key: []byte("shared"), Algorithm: "HS256"},
+		}}),
+		WithResourceIdentifier(testResourceIdentifier),
+		WithTopicMatcherStore(tms),
+		WithWebSocket(),
+	)
+	require.NoError(t, err)
+
+	token := mintAccessToken([]byte("shared"), testResourceIdentifier, []authorizationDetail{{
+		Type:    authorizationDetailTypeMercure,
+		Actions: []mercureAction{actionSubscribe, actionPublish},
+		Topics:  stringsToDetailTopics([]string{"https://example.com/books/1"}),
+	}})
+
+	c, _, err := dialWebSocket(t, hub, "match=https://example.com/books/1", token)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Write(t.Context(), websocket.MessageText, []byte(`{"ref": "1", "publish": {"topics": "https://example.com/books/1", "data": {"title": "Hello!"}, "id": "a", "private": true}}`)))
+
+	// The update and the result of the publication are sent concurrently.
+	var update, result *webSocketMessage
+	for range 2 {
+		if msg := readWebSocketMessage(t, c); msg.Update != nil {
+			update = msg
+		} else {
+			result = msg
+		}
+	}
+
+	require.NotNil(t, update)
+	assert.Equal(t, "a", update.Update.ID)
+	assert.JSONEq(t, `{"title": "Hello!"}`, update.Update.Data)
+
+	require.NotNil(t, result)
+	assert.Equal(t, &webSocketMessage{Ref: "1", publishResult: publishResult{ID: "a"}}, result)
+
+	for message, expected := range map[string]*webSocketMessage{
+		`{"ref": "2", "publish": {"topics": "https://example.com/books/2"}}`: {Ref: "2", publishResult: publishResult{Error: "Forbidden", Status: http.StatusForbidden}},
+		`{"ref": "3", "publish": {"topics": []}}`:                            {Ref: "3", publishResult: publishResult{Error: ErrMissingTopic.Error(), Status: http.StatusBadRequest}},
+		`{"ref": "4"}`: {Ref: "4", publishResult: publishResult{Error: `Missing "publish" field`, Status: http.StatusBadRequest}},
+		`{`:            {publishResult: publishResult{Error: "Invalid JSON: unexpected end of JSON input", Status: http.StatusBadRequest}},
+	} {
+		require.NoError(t, c.Write(t.Context(), websocket.MessageText, []byte(message)))
+		assert.Equal(t, expected, readWebSocketMessage(t, c), message)
+	}
+}
+
+func TestWebSocketHandlerPublishNotAllowed(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithWebSocket())
+
+	c, _, err := dialWebSocket(t, hub, "match=https://example.com/books/1", createDummyAuthorizedJWT(roleSubscriber, []string{"https://example.com/books/1"}))
+	require.NoError(t, err)
+
+	require.NoError(t, c.Write(t.Context(), websocket.MessageText, []byte(`{"ref": "1", "publish": {"topics": "https://example.com/books/1"}}`)))
+	assert.Equal(t, &webSocketMessage{Ref: "1", publishResult: publishResult{Error: "Forbidden", Status: http.StatusForbidden}}, readWebSocketMessage(t, c))
+}
+
+func TestWebSocketHandlerHeartbeat(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithWebSocket(), WithHeartbeat(10*time.Millisecond))
+
+	server := httptest.NewServer(hub)
+	t.Cleanup(server.Close)
+
+	pinged := make(chan struct{}, 1)
+
+	c, _, err := websocket.Dial(t.Context(), "ws"+strings.TrimPrefix(server.URL, "http")+defaultHubURL+"?match=https://example.com/books/1", &websocket.DialOptions{
+		OnPingReceived: func(context.Context, []byte) bool {
+			select {
+			case pinged <- struct{}{}:
+			default:
+			}
+
+			return true
+		},
+	})
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = c.CloseNow()
+	})
+
+	// Control frames are handled while reading.
+	ctx := c.CloseRead(t.Context())
+
+	select {
+	case <-pinged:
+	case <-ctx.Done():
+		t.Fatal("connection closed")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no heartbeat")
+	}
+}